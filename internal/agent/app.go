@@ -14,12 +14,16 @@ import (
 	"metrics/internal/logger"
 )
 
+// streamCloseTimeout - сколько ждать подтверждения отправленных в поток метрик при остановке агента
+const streamCloseTimeout = 5 * time.Second
+
 type AppHTTP struct {
 	isRun               bool
 	logFile             *os.File
 	logger              *zap.Logger
 	metricsUplader      *metricsuploader.MetricsUplader
 	metricsUploaderGRPC *metricsuploader.MetricsUploaderGRPC
+	metricsStreamerGRPC *metricsuploader.MetricsStreamerGRPC
 	config              config.Config
 }
 
@@ -44,11 +48,15 @@ func mustInitLogger(app *AppHTTP) {
 func NewAppHTTP(config config.Config) *AppHTTP {
 	app := &AppHTTP{}
 	app.config = config
-	app.metricsUplader = metricsuploader.NewMetricsUploader(app.config.HTTPClientConnection, app.config.SignKey, app.config.PublicKeyRSA)
+	app.metricsUplader = metricsuploader.NewMetricsUploader(app.config.HTTPClientConnection, app.config.SignKey, app.config.PublicKeyRSA, app.config.AgentID)
 
 	if config.ServerGRPCAddr != "" {
 		var err error
-		app.metricsUploaderGRPC, err = metricsuploader.NewMetricsUploaderGRPC(app.config.ServerGRPCAddr)
+		if config.GRPCStream.Enabled {
+			app.metricsStreamerGRPC, err = metricsuploader.NewMetricsStreamerGRPC(app.config.ServerGRPCAddr, app.config.AgentID, app.config.SignKey, app.config.GRPCStream, app.config.GRPCTLS)
+		} else {
+			app.metricsUploaderGRPC, err = metricsuploader.NewMetricsUploaderGRPC(app.config.ServerGRPCAddr, app.config.AgentID, app.config.SignKey, app.config.GRPCTLS)
+		}
 
 		if err != nil {
 			log.Fatal(err)
@@ -77,9 +85,22 @@ func refreshAllMetrics(app *AppHTTP, metricsDump *statsreader.MetricsDump, wgRef
 	}()
 }
 
+// streamMetrics - отправка считанных метрик в поток gRPC сразу после считывания.
+func streamMetrics(app *AppHTTP, metricsDump *statsreader.MetricsDump, wgRefresh *sync.WaitGroup) {
+	go func() {
+		wgRefresh.Wait()
+		app.metricsStreamerGRPC.Send(*metricsDump)
+	}()
+}
+
 func uploadMetrics(app *AppHTTP, metricsDump *statsreader.MetricsDump, wgRefresh *sync.WaitGroup) {
 	wgRefresh.Wait()
 
+	// В потоке метрики уже отправлены после считывания
+	if app.metricsStreamerGRPC != nil {
+		return
+	}
+
 	go func() {
 		if app.metricsUploaderGRPC != nil {
 			log.Println(app.metricsUploaderGRPC.Upload(*metricsDump))
@@ -112,6 +133,9 @@ func (app *AppHTTP) Run(ctx context.Context) {
 		case <-tickerStatisticsRefresh.C:
 			app.logger.Info("refresh metrics")
 			refreshAllMetrics(app, metricsDump, &wgRefresh)
+			if app.metricsStreamerGRPC != nil {
+				streamMetrics(app, metricsDump, &wgRefresh)
+			}
 		case <-tickerStatisticsUpload.C:
 			app.logger.Info("upload metrics")
 			uploadMetrics(app, metricsDump, &wgRefresh)
@@ -119,6 +143,9 @@ func (app *AppHTTP) Run(ctx context.Context) {
 			app.logger.Info("upload metrics")
 			uploadMetrics(app, metricsDump, &wgRefresh)
 			wgRefresh.Wait()
+			if app.metricsStreamerGRPC != nil {
+				app.metricsStreamerGRPC.Send(*metricsDump)
+			}
 
 			app.Stop()
 		}
@@ -129,6 +156,13 @@ func (app *AppHTTP) Stop() {
 	app.logger.Info("stop")
 	app.isRun = false
 
+	if app.metricsStreamerGRPC != nil {
+		err := app.metricsStreamerGRPC.Close(streamCloseTimeout)
+		if err != nil {
+			app.logger.Error("cant close metrics stream", zap.Error(err))
+		}
+	}
+
 	app.logFile.Close()
 }
 
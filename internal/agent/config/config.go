@@ -24,6 +24,37 @@ type HTTPClientConfig struct {
 	IsEnabledHTTPS bool `env:"IS_ENABLED_HTTPS"  json:"is_enabled_https,omitempty"`
 }
 
+// GRPCStreamConfig используется для хранения настроек отправки метрик по gRPC в одном долгоживущем потоке.
+type GRPCStreamConfig struct {
+	// Enabled - отправлять метрики в потоке после каждого считывания вместо запроса на каждый интервал отправки (flag: grpc-stream; default: true)
+	Enabled bool `env:"GRPC_STREAM" json:"enabled"`
+	// Window - макс. количество отправленных, но ещё не подтверждённых сервером пачек (default: 16)
+	Window int `env:"GRPC_STREAM_WINDOW" json:"window,omitempty"`
+	// QueueSize - макс. количество пачек в очереди на отправку, при переполнении отбрасываются самые старые (default: 1000)
+	QueueSize int `env:"GRPC_STREAM_QUEUE_SIZE" json:"queue_size,omitempty"`
+	// ReconnectMaxWait - макс. пауза между попытками переподключения, пауза удваивается с каждой неудачей (default: 30s)
+	ReconnectMaxWait time.Duration `env:"GRPC_RECONNECT_MAX_WAIT" json:"reconnect_max_wait,omitempty"`
+}
+
+// GRPCTLSConfig используется для хранения настроек TLS соединения с gRPC сервером.
+type GRPCTLSConfig struct {
+	// Enabled - соединение с gRPC сервером по TLS, включается также заданием любого из файлов (flag: grpc-tls; default: false)
+	Enabled bool `env:"GRPC_TLS" json:"enabled,omitempty"`
+	// CAFile - сертификаты CA PEM для проверки сервера, пустой - системные CA (flag: grpc-tls-ca)
+	CAFile string `env:"GRPC_TLS_CA" json:"ca_file,omitempty"`
+	// CertFile - сертификат агента PEM для mTLS, CN сертификата должен совпадать с AgentID (flag: grpc-tls-cert)
+	CertFile string `env:"GRPC_TLS_CERT" json:"cert_file,omitempty"`
+	// KeyFile - приватный ключ сертификата агента PEM (flag: grpc-tls-key)
+	KeyFile string `env:"GRPC_TLS_KEY" json:"key_file,omitempty"`
+	// ServerName - имя сервера для проверки сертификата, пустое - хост из адреса (flag: grpc-tls-server-name)
+	ServerName string `env:"GRPC_TLS_SERVER_NAME" json:"server_name,omitempty"`
+}
+
+// IsEnabled - соединение с gRPC сервером по TLS.
+func (tlsConfig GRPCTLSConfig) IsEnabled() bool {
+	return tlsConfig.Enabled || tlsConfig.CAFile != "" || tlsConfig.CertFile != ""
+}
+
 // Config используется для хранения конфигурации агента.
 type Config struct {
 	// PollInterval - интервал между считыванием метрик (flag: p; default: 2s)
@@ -39,8 +70,12 @@ type Config struct {
 	// DebugMode - debug мод (flag: d)
 	DebugMode bool `env:"DEBUG" json:"debug,omitempty"`
 	// ServerGRPCAddr - адрес gRPC сервера (если значение установлено, то вместо HTTP будет использоваться gRPC)
-	ServerGRPCAddr       string `env:"ADDRESS_GRPC" json:"address_grpc,omitempty"`
+	ServerGRPCAddr string `env:"ADDRESS_GRPC" json:"address_grpc,omitempty"`
+	// AgentID - идентификатор агента, по нему сервер разделяет метрики разных агентов (flag: id; default: имя хоста)
+	AgentID              string `env:"AGENT_ID" json:"agent_id,omitempty"`
 	HTTPClientConnection HTTPClientConfig
+	GRPCStream           GRPCStreamConfig `json:"grpc_stream,omitempty"`
+	GRPCTLS              GRPCTLSConfig    `json:"grpc_tls,omitempty"`
 }
 
 // initDefaultValues - значения конфига по умолчанию.
@@ -48,6 +83,7 @@ func (config *Config) initDefaultValues() {
 	config.PollInterval = time.Duration(2) * time.Second
 	config.ReportInterval = time.Duration(10) * time.Second
 	config.DebugMode = false
+	config.AgentID, _ = os.Hostname()
 
 	config.HTTPClientConnection = HTTPClientConfig{
 		RetryCount:       2,
@@ -55,6 +91,13 @@ func (config *Config) initDefaultValues() {
 		RetryMaxWaitTime: time.Duration(90) * time.Second,
 		ServerAddr:       "127.0.0.1:8080",
 	}
+
+	config.GRPCStream = GRPCStreamConfig{
+		Enabled:          true,
+		Window:           16,
+		QueueSize:        1000,
+		ReconnectMaxWait: time.Duration(30) * time.Second,
+	}
 }
 
 func newConfig() *Config {
@@ -110,6 +153,13 @@ func (config *Config) parseFlags() {
 	flag.StringVar(&config.SignKey, "k", config.SignKey, "sign key")
 	flag.StringVar(&config.LogFile, "l", config.LogFile, "path to log file, to disable use empty path \"\"")
 	flag.BoolVar(&config.DebugMode, "d", config.DebugMode, "debug mode")
+	flag.StringVar(&config.AgentID, "id", config.AgentID, "agent ID, server stores metrics of each agent separately")
+	flag.BoolVar(&config.GRPCStream.Enabled, "grpc-stream", config.GRPCStream.Enabled, "send metrics over gRPC in one long-lived stream after each poll")
+	flag.BoolVar(&config.GRPCTLS.Enabled, "grpc-tls", config.GRPCTLS.Enabled, "connect to gRPC server over TLS")
+	flag.StringVar(&config.GRPCTLS.CAFile, "grpc-tls-ca", config.GRPCTLS.CAFile, "CA certificates (PEM) to verify gRPC server, empty uses system CAs")
+	flag.StringVar(&config.GRPCTLS.CertFile, "grpc-tls-cert", config.GRPCTLS.CertFile, "agent TLS certificate (PEM) for mutual TLS")
+	flag.StringVar(&config.GRPCTLS.KeyFile, "grpc-tls-key", config.GRPCTLS.KeyFile, "agent TLS private key (PEM)")
+	flag.StringVar(&config.GRPCTLS.ServerName, "grpc-tls-server-name", config.GRPCTLS.ServerName, "gRPC server name to verify certificate, empty uses host from address")
 	flag.Parse()
 }
 
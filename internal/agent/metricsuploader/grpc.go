@@ -2,20 +2,30 @@ package metricsuploader
 
 import (
 	"context"
+	"encoding/hex"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"metrics/internal/agent/config"
 	"metrics/internal/agent/statsreader"
+	"metrics/internal/server/storage"
+	"metrics/internal/tlsconfig"
 	pb "metrics/proto"
 )
 
 type MetricsUploaderGRPC struct {
 	clientConn *grpc.ClientConn
 	client     pb.MetricsClient
+	agentID    string
+	signKey    string
 }
 
-func NewMetricsUploaderGRPC(addr string) (*MetricsUploaderGRPC, error) {
-	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// NewMetricsUploaderGRPC - gRPC клиент, agentID передаётся серверу в метаданных x-agent-id,
+// непустым signKey подписывается каждая метрика.
+func NewMetricsUploaderGRPC(addr string, agentID string, signKey string, tlsConfig config.GRPCTLSConfig) (*MetricsUploaderGRPC, error) {
+	conn, err := dialGRPC(addr, tlsConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -23,9 +33,41 @@ func NewMetricsUploaderGRPC(addr string) (*MetricsUploaderGRPC, error) {
 	return &MetricsUploaderGRPC{
 		clientConn: conn,
 		client:     pb.NewMetricsClient(conn),
+		agentID:    agentID,
+		signKey:    signKey,
 	}, nil
 }
 
+// dialGRPC - соединение с gRPC сервером addr, по TLS, если он включён в tlsConfig.
+func dialGRPC(addr string, tlsConfig config.GRPCTLSConfig) (*grpc.ClientConn, error) {
+	transportCredentials := insecure.NewCredentials()
+	if tlsConfig.IsEnabled() {
+		clientTLS, err := tlsconfig.Client(tlsConfig.CAFile, tlsConfig.CertFile, tlsConfig.KeyFile, tlsConfig.ServerName)
+		if err != nil {
+			return nil, err
+		}
+		transportCredentials = credentials.NewTLS(clientTLS)
+	}
+
+	return grpc.Dial(addr, grpc.WithTransportCredentials(transportCredentials))
+}
+
+// signMetric - подпись метрики ключом signKey, как поле hash в JSON API.
+func signMetric(metric *pb.Metric, signKey string) {
+	if signKey == "" {
+		return
+	}
+
+	switch metricOne := metric.Metric.(type) {
+	case *pb.Metric_Gauge:
+		value := storage.MetricValue{MType: storage.MeticTypeGauge, Value: &metricOne.Gauge.Value}
+		metricOne.Gauge.Hash = hex.EncodeToString(value.GetHash(storage.SeriesKey(metricOne.Gauge.Id, metricOne.Gauge.Labels), signKey))
+	case *pb.Metric_Counter:
+		value := storage.MetricValue{MType: storage.MeticTypeCounter, Delta: &metricOne.Counter.Delta}
+		metricOne.Counter.Hash = hex.EncodeToString(value.GetHash(storage.SeriesKey(metricOne.Counter.Id, metricOne.Counter.Labels), signKey))
+	}
+}
+
 func (m *MetricsUploaderGRPC) Upload(metricsDump statsreader.MetricsDump) (err error) {
 	updateMetricsRequest := pb.UpdateMetricsRequest{}
 
@@ -51,7 +93,16 @@ func (m *MetricsUploaderGRPC) Upload(metricsDump statsreader.MetricsDump) (err e
 		})
 	}
 
-	_, err = m.client.UpdateMetrics(context.Background(), &updateMetricsRequest)
+	for _, metric := range updateMetricsRequest.Metrics {
+		signMetric(metric, m.signKey)
+	}
+
+	ctx := context.Background()
+	if m.agentID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-agent-id", m.agentID)
+	}
+
+	_, err = m.client.UpdateMetrics(ctx, &updateMetricsRequest)
 	if err != nil {
 		return
 	}
@@ -59,7 +59,8 @@ func newMetricValue(mtype string, value string) (storage.MetricValue, error) {
 	return mValue, nil
 }
 
-func NewMetricsUploader(config config.HTTPClientConfig, signKey, publicKeyRSA string) *MetricsUplader {
+// NewMetricsUploader - HTTP клиент, agentID передаётся серверу в заголовке X-Agent-ID.
+func NewMetricsUploader(config config.HTTPClientConfig, signKey, publicKeyRSA, agentID string) *MetricsUplader {
 	var metricsUplader MetricsUplader
 	metricsUplader.config = config
 	metricsUplader.signKey = signKey
@@ -77,6 +78,9 @@ func NewMetricsUploader(config config.HTTPClientConfig, signKey, publicKeyRSA st
 		currentIP = ""
 	}
 	client.Header.Add("X-Real-IP", currentIP)
+	if agentID != "" {
+		client.Header.Add("X-Agent-ID", agentID)
+	}
 
 	if publicKeyRSA != "" {
 		var err error
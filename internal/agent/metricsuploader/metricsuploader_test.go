@@ -3,6 +3,7 @@ package metricsuploader
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/suite"
 	"metrics/internal/agent/config"
@@ -18,6 +19,7 @@ type UploaderTestingSuite struct {
 	serverCtxCancel     context.CancelFunc
 	metricsUploader     *MetricsUplader
 	metricsUploaderGRPC *MetricsUploaderGRPC
+	metricsStreamerGRPC *MetricsStreamerGRPC
 }
 
 func (suite *UploaderTestingSuite) SetupSuite() {
@@ -31,13 +33,16 @@ func (suite *UploaderTestingSuite) SetupSuite() {
 	go serverAPI.Run(suite.serverCtx)
 
 	agentConfig := config.LoadConfig()
-	suite.metricsUploader = NewMetricsUploader(agentConfig.HTTPClientConnection, "", "")
+	suite.metricsUploader = NewMetricsUploader(agentConfig.HTTPClientConnection, "", "", agentConfig.AgentID)
 
 	clientIP, err := suite.metricsUploader.IP()
 	suite.NoError(err)
 	suite.NotEmpty(clientIP)
 
-	suite.metricsUploaderGRPC, err = NewMetricsUploaderGRPC(ServerGRPCAddr)
+	suite.metricsUploaderGRPC, err = NewMetricsUploaderGRPC(ServerGRPCAddr, agentConfig.AgentID, agentConfig.SignKey, agentConfig.GRPCTLS)
+	suite.NoError(err)
+
+	suite.metricsStreamerGRPC, err = NewMetricsStreamerGRPC(ServerGRPCAddr, agentConfig.AgentID, agentConfig.SignKey, agentConfig.GRPCStream, agentConfig.GRPCTLS)
 	suite.NoError(err)
 }
 
@@ -55,6 +60,19 @@ func (suite *UploaderTestingSuite) TestUploadGRPC() {
 	suite.NoError(err)
 }
 
+func (suite *UploaderTestingSuite) TestStreamGRPC() {
+	metricsDump, err := statsreader.NewMetricsDump()
+	suite.NoError(err)
+
+	for i := 0; i < 3; i++ {
+		metricsDump.Refresh()
+		suite.metricsStreamerGRPC.Send(*metricsDump)
+	}
+
+	err = suite.metricsStreamerGRPC.Close(5 * time.Second)
+	suite.NoError(err)
+}
+
 func (suite *UploaderTestingSuite) TestUploadOne() {
 	err := suite.metricsUploader.oneStatUpload(storage.MeticTypeCounter, "Counter1", "27")
 	suite.NoError(err)
@@ -114,7 +132,7 @@ func BenchmarkUploader(b *testing.B) {
 
 	metricsUploader := NewMetricsUploader(config.HTTPClientConfig{
 		ServerAddr: "127.0.0.1:8080",
-	}, "", "")
+	}, "", "", "")
 
 	b.Run("sync", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
@@ -0,0 +1,367 @@
+package metricsuploader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"metrics/internal/agent/config"
+	"metrics/internal/agent/statsreader"
+	"metrics/internal/server/storage"
+	pb "metrics/proto"
+)
+
+// reconnectMinWait - пауза перед первой попыткой переподключения потока
+const reconnectMinWait = 100 * time.Millisecond
+
+// errAckRetry - сервер временно не смог записать пачку, поток переоткрывается и пачка отправляется снова
+var errAckRetry = errors.New("server asked to retry batch")
+
+// MetricsStreamerGRPC - отправка метрик в одном долгоживущем потоке gRPC UploadMetrics.
+// Пачки ставятся в очередь и отправляются, пока неподтверждённых пачек меньше окна Window.
+// При обрыве поток переоткрывается с растущей паузой, неподтверждённые пачки отправляются снова,
+// сервер пропускает уже записанные пачки по номеру в сессии.
+type MetricsStreamerGRPC struct {
+	clientConn *grpc.ClientConn
+	client     pb.MetricsClient
+	agentID    string
+	signKey    string
+	config     config.GRPCStreamConfig
+	session    string
+
+	mutex    *sync.Mutex
+	sequence uint64
+	queue    []*pb.UploadRequest
+	inflight []*pb.UploadRequest
+	// counters - значения counter на момент последней пачки, в пачку попадает прирост
+	counters map[string]int64
+
+	wakeup  chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// NewMetricsStreamerGRPC - поток отправки метрик на сервер addr, agentID передаётся серверу в метаданных x-agent-id,
+// непустым signKey подписывается каждая метрика.
+func NewMetricsStreamerGRPC(addr string, agentID string, signKey string, streamConfig config.GRPCStreamConfig, tlsConfig config.GRPCTLSConfig) (*MetricsStreamerGRPC, error) {
+	conn, err := dialGRPC(addr, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMetricsStreamerGRPC(conn, agentID, signKey, streamConfig)
+}
+
+func newMetricsStreamerGRPC(conn *grpc.ClientConn, agentID string, signKey string, streamConfig config.GRPCStreamConfig) (*MetricsStreamerGRPC, error) {
+	session := make([]byte, 8)
+	_, err := rand.Read(session)
+	if err != nil {
+		return nil, err
+	}
+
+	if streamConfig.Window <= 0 {
+		streamConfig.Window = 1
+	}
+	if streamConfig.QueueSize <= 0 {
+		streamConfig.QueueSize = 1
+	}
+	if streamConfig.ReconnectMaxWait < reconnectMinWait {
+		streamConfig.ReconnectMaxWait = reconnectMinWait
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	streamer := &MetricsStreamerGRPC{
+		clientConn: conn,
+		client:     pb.NewMetricsClient(conn),
+		agentID:    agentID,
+		signKey:    signKey,
+		config:     streamConfig,
+		session:    hex.EncodeToString(session),
+		mutex:      &sync.Mutex{},
+		counters:   make(map[string]int64),
+		wakeup:     make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+		stopped:    make(chan struct{}),
+	}
+
+	go streamer.run()
+
+	return streamer, nil
+}
+
+// Send - постановка текущих значений метрик в очередь отправки.
+// Для counter отправляется прирост с прошлой пачки, counter без прироста не отправляются.
+func (m *MetricsStreamerGRPC) Send(metricsDump statsreader.MetricsDump) {
+	metricsDump.RLock()
+	defer metricsDump.RUnlock()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	request := &pb.UploadRequest{
+		Session: m.session,
+	}
+	for metricID, metricValue := range metricsDump.MetricsGauge {
+		request.Metrics = append(request.Metrics, &pb.Metric{
+			Metric: &pb.Metric_Gauge{
+				Gauge: &pb.MetricGauge{
+					Id:    metricID,
+					Value: float64(metricValue),
+				},
+			},
+		})
+	}
+	for metricID, metricValue := range metricsDump.MetricsCounter {
+		delta := int64(metricValue) - m.counters[metricID]
+		if delta <= 0 {
+			continue
+		}
+		m.counters[metricID] = int64(metricValue)
+
+		request.Metrics = append(request.Metrics, &pb.Metric{
+			Metric: &pb.Metric_Counter{
+				Counter: &pb.MetricCounter{
+					Id:    metricID,
+					Delta: delta,
+				},
+			},
+		})
+	}
+	if len(request.Metrics) == 0 {
+		return
+	}
+	for _, metric := range request.Metrics {
+		signMetric(metric, m.signKey)
+	}
+
+	m.sequence++
+	request.Sequence = m.sequence
+	m.queue = append(m.queue, request)
+	if len(m.queue) > m.config.QueueSize {
+		dropped := len(m.queue) - m.config.QueueSize
+		foldCounters(m.queue[:dropped], request, m.signKey)
+		m.queue = m.queue[dropped:]
+		log.Printf("metrics stream queue is full, dropped %d oldest batches\n", dropped)
+	}
+
+	m.notify()
+}
+
+// foldCounters - прирост counter из отброшенных пачек dropped добавляется в пачку request,
+// чтобы при переполнении очереди терялись только промежуточные значения gauge.
+func foldCounters(dropped []*pb.UploadRequest, request *pb.UploadRequest, signKey string) {
+	counters := make(map[string]*pb.MetricCounter)
+	for _, metric := range request.Metrics {
+		if counter := metric.GetCounter(); counter != nil {
+			counters[storage.SeriesKey(counter.Id, counter.Labels)] = counter
+		}
+	}
+
+	changed := make(map[string]struct{})
+	for _, droppedRequest := range dropped {
+		for _, metric := range droppedRequest.Metrics {
+			droppedCounter := metric.GetCounter()
+			if droppedCounter == nil {
+				continue
+			}
+
+			key := storage.SeriesKey(droppedCounter.Id, droppedCounter.Labels)
+			counter, ok := counters[key]
+			if !ok {
+				counter = &pb.MetricCounter{Id: droppedCounter.Id, Labels: droppedCounter.Labels}
+				counters[key] = counter
+				request.Metrics = append(request.Metrics, &pb.Metric{Metric: &pb.Metric_Counter{Counter: counter}})
+			}
+			counter.Delta += droppedCounter.Delta
+			changed[key] = struct{}{}
+		}
+	}
+
+	for _, metric := range request.Metrics {
+		if counter := metric.GetCounter(); counter != nil {
+			if _, ok := changed[storage.SeriesKey(counter.Id, counter.Labels)]; ok {
+				signMetric(metric, signKey)
+			}
+		}
+	}
+}
+
+// Pending - количество пачек в очереди и неподтверждённых сервером.
+func (m *MetricsStreamerGRPC) Pending() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return len(m.queue) + len(m.inflight)
+}
+
+// Close - ожидание подтверждения отправленных пачек не дольше timeout и закрытие потока.
+func (m *MetricsStreamerGRPC) Close(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for m.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	pending := m.Pending()
+
+	m.cancel()
+	<-m.stopped
+
+	err := m.clientConn.Close()
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return fmt.Errorf("metrics stream closed with %d unacknowledged batches", pending)
+	}
+
+	return nil
+}
+
+func (m *MetricsStreamerGRPC) notify() {
+	select {
+	case m.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// run - поддержание потока: переоткрытие после обрыва с паузой от reconnectMinWait до ReconnectMaxWait.
+func (m *MetricsStreamerGRPC) run() {
+	defer close(m.stopped)
+
+	wait := reconnectMinWait
+	for {
+		acked, err := m.stream()
+		if m.ctx.Err() != nil {
+			return
+		}
+		log.Println("metrics stream:", err)
+
+		m.requeue()
+		if acked {
+			wait = reconnectMinWait
+		}
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+		if wait > m.config.ReconnectMaxWait {
+			wait = m.config.ReconnectMaxWait
+		}
+	}
+}
+
+// requeue - неподтверждённые пачки возвращаются в начало очереди для отправки в новом потоке.
+func (m *MetricsStreamerGRPC) requeue() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.queue = append(m.inflight, m.queue...)
+	m.inflight = nil
+}
+
+// next - следующая пачка для отправки, nil - очередь пуста или окно неподтверждённых пачек заполнено.
+func (m *MetricsStreamerGRPC) next() *pb.UploadRequest {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.queue) == 0 || len(m.inflight) >= m.config.Window {
+		return nil
+	}
+
+	request := m.queue[0]
+	m.queue = m.queue[1:]
+	m.inflight = append(m.inflight, request)
+
+	return request
+}
+
+// ack - обработка подтверждения пачки. Пачки, которые сервер не может записать, отбрасываются,
+// при временной ошибке сервера возвращается errAckRetry.
+func (m *MetricsStreamerGRPC) ack(ack *pb.UploadAck) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i, request := range m.inflight {
+		if request.Sequence != ack.Sequence {
+			continue
+		}
+
+		switch code := codes.Code(ack.Code); code {
+		case codes.OK:
+		case codes.Unavailable, codes.ResourceExhausted, codes.Aborted, codes.DeadlineExceeded, codes.Internal:
+			return fmt.Errorf("%w %d: %s", errAckRetry, ack.Sequence, status.Error(code, ack.Error))
+		default:
+			log.Printf("metrics batch %d rejected: %s\n", ack.Sequence, status.Error(code, ack.Error))
+		}
+
+		m.inflight = append(m.inflight[:i], m.inflight[i+1:]...)
+		break
+	}
+	m.notify()
+
+	return nil
+}
+
+// stream - один поток UploadMetrics до обрыва или остановки, возвращает, подтвердил ли сервер хотя бы одну пачку.
+func (m *MetricsStreamerGRPC) stream() (bool, error) {
+	ctx, cancel := context.WithCancel(m.ctx)
+	defer cancel()
+
+	if m.agentID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-agent-id", m.agentID)
+	}
+
+	stream, err := m.client.UploadMetrics(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// acked - подтверждений в потоке, пишется горутиной чтения
+	var acked int32
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			ack, err := stream.Recv()
+			if err == nil {
+				err = m.ack(ack)
+			}
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			atomic.StoreInt32(&acked, 1)
+		}
+	}()
+
+	for {
+		for request := m.next(); request != nil; request = m.next() {
+			err = stream.Send(request)
+			if err != nil {
+				return atomic.LoadInt32(&acked) == 1, err
+			}
+		}
+
+		select {
+		case <-m.wakeup:
+		case err = <-recvErr:
+			return atomic.LoadInt32(&acked) == 1, err
+		case <-m.ctx.Done():
+			return atomic.LoadInt32(&acked) == 1, m.ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package metricsuploader
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"metrics/internal/agent/config"
+	"metrics/internal/agent/statsreader"
+	pb "metrics/proto"
+)
+
+// uploadServer - сервер UploadMetrics, который обрывает первый поток после первой пачки без подтверждения
+// и отклоняет пачки из reject.
+type uploadServer struct {
+	pb.UnimplementedMetricsServer
+	mutex    sync.Mutex
+	streams  int
+	received []*pb.UploadRequest
+	reject   map[uint64]codes.Code
+}
+
+func (server *uploadServer) UploadMetrics(stream pb.Metrics_UploadMetricsServer) error {
+	server.mutex.Lock()
+	server.streams++
+	first := server.streams == 1
+	server.mutex.Unlock()
+
+	for {
+		request, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		server.mutex.Lock()
+		server.received = append(server.received, request)
+		code := server.reject[request.Sequence]
+		server.mutex.Unlock()
+
+		if first {
+			return errors.New("connection lost")
+		}
+
+		err = stream.Send(&pb.UploadAck{Sequence: request.Sequence, Code: int32(code)})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (server *uploadServer) sequences() []uint64 {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	sequences := make([]uint64, 0, len(server.received))
+	for _, request := range server.received {
+		sequences = append(sequences, request.Sequence)
+	}
+	return sequences
+}
+
+// newTestStreamer - поток к серверу server, для nil - к недоступному серверу.
+func newTestStreamer(t *testing.T, server *uploadServer) *MetricsStreamerGRPC {
+	listener := bufconn.Listen(1024 * 1024)
+	if server != nil {
+		serverGRPC := grpc.NewServer()
+		pb.RegisterMetricsServer(serverGRPC, server)
+		go serverGRPC.Serve(listener)
+		t.Cleanup(serverGRPC.Stop)
+	} else {
+		listener.Close()
+	}
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+
+	streamer, err := newMetricsStreamerGRPC(conn, "agent-1", "", config.GRPCStreamConfig{
+		Window:           2,
+		QueueSize:        10,
+		ReconnectMaxWait: 200 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	return streamer
+}
+
+func TestMetricsStreamerReconnect(t *testing.T) {
+	server := &uploadServer{reject: map[uint64]codes.Code{3: codes.InvalidArgument}}
+	streamer := newTestStreamer(t, server)
+
+	metricsDump, err := statsreader.NewMetricsDump()
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		metricsDump.Refresh()
+		streamer.Send(*metricsDump)
+	}
+
+	// Пачка, отправленная в оборванный поток, повторяется, отклонённая пачка не повторяется
+	require.NoError(t, streamer.Close(5*time.Second))
+	require.Equal(t, []uint64{1, 1, 2, 3}, server.sequences())
+
+	// В каждой пачке прирост PollCount с прошлой пачки
+	for _, request := range server.received {
+		for _, metric := range request.Metrics {
+			if counter := metric.GetCounter(); counter != nil {
+				require.Equal(t, "PollCount", counter.Id)
+				require.EqualValues(t, 1, counter.Delta)
+			}
+		}
+	}
+}
+
+func TestMetricsStreamerQueueOverflow(t *testing.T) {
+	streamer := newTestStreamer(t, nil)
+
+	metricsDump, err := statsreader.NewMetricsDump()
+	require.NoError(t, err)
+	for i := 0; i < 15; i++ {
+		metricsDump.Refresh()
+		streamer.Send(*metricsDump)
+	}
+
+	// Сервер недоступен, в очереди остаются 10 последних пачек
+	streamer.mutex.Lock()
+	require.Len(t, streamer.queue, 10)
+	require.EqualValues(t, 6, streamer.queue[0].Sequence)
+
+	// Прирост counter из отброшенных пачек перенесён в оставшиеся
+	var pollCount int64
+	for _, request := range streamer.queue {
+		for _, metric := range request.Metrics {
+			if counter := metric.GetCounter(); counter != nil && counter.Id == "PollCount" {
+				pollCount += counter.Delta
+			}
+		}
+	}
+	require.EqualValues(t, 15, pollCount)
+	streamer.mutex.Unlock()
+
+	require.Error(t, streamer.Close(50*time.Millisecond))
+}
@@ -0,0 +1,159 @@
+// Package agents - учёт агентов, от которых приходят метрики.
+package agents
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"metrics/internal/server/storage"
+)
+
+const (
+	// HeaderAgentID - заголовок HTTP с идентификатором агента
+	HeaderAgentID = "X-Agent-ID"
+	// HeaderRealIP - заголовок HTTP с IP адресом агента
+	HeaderRealIP = "X-Real-IP"
+	// MetadataAgentID - ключ метаданных gRPC с идентификатором агента
+	MetadataAgentID = "x-agent-id"
+	// MetadataRealIP - ключ метаданных gRPC с IP адресом агента
+	MetadataRealIP = "x-real-ip"
+)
+
+// Source - источник метрик: идентификатор агента и адрес, с которого он пришёл.
+// Если агент не передал идентификатор, идентификатором считается адрес.
+type Source struct {
+	ID      string
+	Address string
+}
+
+func newSource(id, realIP, remoteAddr string) Source {
+	address := realIP
+	if address == "" {
+		address = remoteAddr
+		if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+			address = host
+		}
+	}
+
+	if id == "" {
+		id = address
+	}
+
+	return Source{
+		ID:      id,
+		Address: address,
+	}
+}
+
+// SourceFromRequest - источник HTTP запроса: заголовок X-Agent-ID, затем X-Real-IP, затем адрес соединения.
+func SourceFromRequest(request *http.Request) Source {
+	return newSource(request.Header.Get(HeaderAgentID), request.Header.Get(HeaderRealIP), request.RemoteAddr)
+}
+
+// SourceFromContext - источник gRPC запроса: метаданные x-agent-id, затем x-real-ip, затем адрес соединения.
+func SourceFromContext(ctx context.Context) Source {
+	var id, realIP, remoteAddr string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(MetadataAgentID); len(values) > 0 {
+			id = values[0]
+		}
+		if values := md.Get(MetadataRealIP); len(values) > 0 {
+			realIP = values[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remoteAddr = p.Addr.String()
+	}
+
+	return newSource(id, realIP, remoteAddr)
+}
+
+// Agent - агент, его последний адрес, время последней отправки и количество серий в хранилище.
+// LastSeen - последняя отправка с запуска сервера или последняя запись в серии агента, пустой, если время неизвестно.
+// Stale - агент перестал отправлять метрики.
+type Agent struct {
+	ID       string     `json:"id"`
+	Address  string     `json:"address,omitempty"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+	Metrics  int        `json:"metrics"`
+	Stale    bool       `json:"stale"`
+}
+
+// Registry - потокобезопасный реестр агентов, отправлявших метрики с запуска сервера.
+type Registry struct {
+	mutex      sync.RWMutex
+	agents     map[string]Agent
+	staleAfter time.Duration
+}
+
+// NewRegistry - реестр, в котором агент устаревает, если не отправлял метрики дольше staleAfter, 0 - не устаревает.
+func NewRegistry(staleAfter time.Duration) *Registry {
+	return &Registry{
+		agents:     make(map[string]Agent),
+		staleAfter: staleAfter,
+	}
+}
+
+// Seen - отметка об отправке метрик источником.
+func (registry *Registry) Seen(source Source, now time.Time) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.agents[source.ID] = Agent{
+		ID:       source.ID,
+		Address:  source.Address,
+		LastSeen: &now,
+	}
+}
+
+// List - агенты на момент now, отсортированные по идентификатору.
+// Серии считаются по метке источника, поэтому в список попадают и агенты, не отправлявшие метрики с запуска сервера.
+func (registry *Registry) List(allValues map[string]storage.MetricMap, now time.Time) []Agent {
+	registry.mutex.RLock()
+	agents := make(map[string]Agent, len(registry.agents))
+	for id, agent := range registry.agents {
+		agents[id] = agent
+	}
+	registry.mutex.RUnlock()
+
+	for _, metricMap := range allValues {
+		for key, value := range metricMap {
+			_, labels, err := storage.ParseSeriesKey(key)
+			if err != nil {
+				continue
+			}
+
+			id, ok := labels[storage.SourceLabel]
+			if !ok {
+				continue
+			}
+
+			agent, ok := agents[id]
+			if !ok {
+				agent.ID = id
+			}
+			agent.Metrics++
+			if value.UpdatedAt != nil && (agent.LastSeen == nil || value.UpdatedAt.After(*agent.LastSeen)) {
+				agent.LastSeen = value.UpdatedAt
+			}
+			agents[id] = agent
+		}
+	}
+
+	list := make([]Agent, 0, len(agents))
+	for _, agent := range agents {
+		agent.Stale = registry.staleAfter > 0 && agent.LastSeen != nil && now.Sub(*agent.LastSeen) > registry.staleAfter
+		list = append(list, agent)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	return list
+}
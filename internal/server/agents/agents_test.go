@@ -0,0 +1,85 @@
+package agents
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/storage"
+)
+
+func TestSourceFromRequest(t *testing.T) {
+	request := httptest.NewRequest("POST", "/updates/", nil)
+	request.RemoteAddr = "10.0.0.5:51000"
+	require.Equal(t, Source{ID: "10.0.0.5", Address: "10.0.0.5"}, SourceFromRequest(request))
+
+	request.Header.Set(HeaderRealIP, "192.168.1.10")
+	require.Equal(t, Source{ID: "192.168.1.10", Address: "192.168.1.10"}, SourceFromRequest(request))
+
+	request.Header.Set(HeaderAgentID, "web-1")
+	require.Equal(t, Source{ID: "web-1", Address: "192.168.1.10"}, SourceFromRequest(request))
+}
+
+func TestRegistryList(t *testing.T) {
+	registry := NewRegistry(30 * time.Second)
+	now := time.Now()
+	registry.Seen(Source{ID: "web-1", Address: "10.0.0.1"}, now)
+	registry.Seen(Source{ID: "web-3", Address: "10.0.0.3"}, now.Add(-time.Minute))
+	updatedAt := now.Add(-10 * time.Second)
+
+	value := 1.5
+	allValues := map[string]storage.MetricMap{
+		storage.MeticTypeGauge: {
+			`Alloc{source="web-1"}`: {MType: storage.MeticTypeGauge, Value: &value, UpdatedAt: &updatedAt},
+			`Alloc{source="web-2"}`: {MType: storage.MeticTypeGauge, Value: &value},
+			"Alloc":                 {MType: storage.MeticTypeGauge, Value: &value},
+		},
+		storage.MeticTypeCounter: {
+			`PollCount{source="web-1"}`: {MType: storage.MeticTypeCounter},
+		},
+	}
+
+	agents := registry.List(allValues, now)
+	require.Len(t, agents, 3)
+
+	require.Equal(t, "web-1", agents[0].ID)
+	require.Equal(t, 2, agents[0].Metrics)
+	require.Equal(t, "10.0.0.1", agents[0].Address)
+	require.Equal(t, now, *agents[0].LastSeen)
+	require.False(t, agents[0].Stale)
+
+	// Агент есть в хранилище, но не отправлял метрики с запуска сервера
+	require.Equal(t, "web-2", agents[1].ID)
+	require.Equal(t, 1, agents[1].Metrics)
+	require.Nil(t, agents[1].LastSeen)
+	require.False(t, agents[1].Stale)
+
+	require.Equal(t, "web-3", agents[2].ID)
+	require.Equal(t, 0, agents[2].Metrics)
+	require.True(t, agents[2].Stale)
+}
+
+func TestRegistryListLastWrite(t *testing.T) {
+	registry := NewRegistry(30 * time.Second)
+	now := time.Now()
+	updatedAt := now.Add(-time.Minute)
+	lastUpdatedAt := now.Add(-10 * time.Second)
+
+	value := 1.5
+	allValues := map[string]storage.MetricMap{
+		storage.MeticTypeGauge: {
+			`Alloc{source="web-1"}`:     {MType: storage.MeticTypeGauge, Value: &value, UpdatedAt: &updatedAt},
+			`HeapAlloc{source="web-1"}`: {MType: storage.MeticTypeGauge, Value: &value, UpdatedAt: &lastUpdatedAt},
+			`Alloc{source="web-2"}`:     {MType: storage.MeticTypeGauge, Value: &value, UpdatedAt: &updatedAt},
+		},
+	}
+
+	// Время последней отправки берётся из серий, если агент не отправлял метрики с запуска сервера
+	agents := registry.List(allValues, now)
+	require.Len(t, agents, 2)
+	require.Equal(t, lastUpdatedAt, *agents[0].LastSeen)
+	require.False(t, agents[0].Stale)
+	require.Equal(t, updatedAt, *agents[1].LastSeen)
+	require.True(t, agents[1].Stale)
+}
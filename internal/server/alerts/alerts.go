@@ -0,0 +1,178 @@
+package alerts
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"metrics/internal/server/storage"
+)
+
+// State - состояние оповещения.
+type State string
+
+const (
+	// StatePending - условие выполняется, но меньше For
+	StatePending State = "pending"
+	// StateFiring - условие выполняется не меньше For
+	StateFiring State = "firing"
+	// StateResolved - условие сработавшего оповещения перестало выполняться
+	StateResolved State = "resolved"
+)
+
+// resolvedRetention - сколько завершённое оповещение остаётся в списке.
+const resolvedRetention = 15 * time.Minute
+
+// Alert - оповещение правила по одной серии, Labels - метки серии.
+type Alert struct {
+	Rule       string         `json:"rule"`
+	Series     string         `json:"series"`
+	Labels     storage.Labels `json:"labels,omitempty"`
+	Severity   string         `json:"severity,omitempty"`
+	State      State          `json:"state"`
+	Value      float64        `json:"value"`
+	Op         string         `json:"op"`
+	Threshold  float64        `json:"threshold"`
+	ActiveAt   time.Time      `json:"active_at"`
+	FiredAt    *time.Time     `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time     `json:"resolved_at,omitempty"`
+}
+
+type alertKey struct {
+	rule   string
+	series string
+}
+
+// Engine - потокобезопасная проверка правил и состояния оповещений.
+type Engine struct {
+	rules  []Rule
+	mutex  sync.RWMutex
+	alerts map[alertKey]Alert
+}
+
+// NewEngine - проверка правил rules, правила должны быть проверены ValidateRules.
+func NewEngine(rules []Rule) *Engine {
+	return &Engine{
+		rules:  rules,
+		alerts: make(map[alertKey]Alert),
+	}
+}
+
+// Rules - правила оповещений.
+func (engine *Engine) Rules() []Rule {
+	return engine.rules
+}
+
+// Evaluate - проверка правил по значениям хранилища на момент now.
+// Возвращает оповещения, которые сработали или завершились при этой проверке.
+// Серия, которой больше нет в хранилище, считается не выполняющей условие.
+func (engine *Engine) Evaluate(allValues map[string]storage.MetricMap, now time.Time) []Alert {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	var changed []Alert
+	active := make(map[alertKey]struct{})
+	values := make(map[alertKey]float64)
+	for _, rule := range engine.rules {
+		metricMap := allValues[rule.Type]
+		for _, series := range storage.MatchSeries(metricMap, rule.Metric, rule.Labels) {
+			value, ok := floatValue(metricMap[series])
+			if !ok {
+				continue
+			}
+
+			key := alertKey{rule: rule.Name, series: series}
+			values[key] = value
+			if !rule.Match(value) {
+				continue
+			}
+			active[key] = struct{}{}
+
+			alert, ok := engine.alerts[key]
+			if !ok || alert.State == StateResolved {
+				_, labels, _ := storage.ParseSeriesKey(series)
+				alert = Alert{
+					Rule:      rule.Name,
+					Series:    series,
+					Labels:    labels,
+					Severity:  rule.Severity,
+					State:     StatePending,
+					Op:        rule.Op,
+					Threshold: rule.Threshold,
+					ActiveAt:  now,
+				}
+			}
+			alert.Value = value
+
+			if alert.State == StatePending && now.Sub(alert.ActiveAt) >= time.Duration(rule.For) {
+				firedAt := now
+				alert.State = StateFiring
+				alert.FiredAt = &firedAt
+				changed = append(changed, alert)
+			}
+			engine.alerts[key] = alert
+		}
+	}
+
+	for key, alert := range engine.alerts {
+		if _, ok := active[key]; ok {
+			continue
+		}
+
+		switch alert.State {
+		case StatePending:
+			// Условие перестало выполняться до срабатывания
+			delete(engine.alerts, key)
+		case StateFiring:
+			resolvedAt := now
+			alert.State = StateResolved
+			alert.ResolvedAt = &resolvedAt
+			if value, ok := values[key]; ok {
+				alert.Value = value
+			}
+			engine.alerts[key] = alert
+			changed = append(changed, alert)
+		case StateResolved:
+			if now.Sub(*alert.ResolvedAt) > resolvedRetention {
+				delete(engine.alerts, key)
+			}
+		}
+	}
+
+	sortAlerts(changed)
+	return changed
+}
+
+// Alerts - текущие оповещения, отсортированные по правилу и серии.
+func (engine *Engine) Alerts() []Alert {
+	engine.mutex.RLock()
+	list := make([]Alert, 0, len(engine.alerts))
+	for _, alert := range engine.alerts {
+		list = append(list, alert)
+	}
+	engine.mutex.RUnlock()
+
+	sortAlerts(list)
+	return list
+}
+
+func sortAlerts(list []Alert) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Rule != list[j].Rule {
+			return list[i].Rule < list[j].Rule
+		}
+		return list[i].Series < list[j].Series
+	})
+}
+
+// floatValue - значение gauge или counter для сравнения с порогом.
+func floatValue(metricValue storage.MetricValue) (float64, bool) {
+	switch {
+	case metricValue.MType == storage.MeticTypeGauge && metricValue.Value != nil:
+		return *metricValue.Value, true
+	case metricValue.MType == storage.MeticTypeCounter && metricValue.Delta != nil:
+		return float64(*metricValue.Delta), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,114 @@
+package alerts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/config"
+	"metrics/internal/server/storage"
+)
+
+func gaugeValues(values map[string]float64) map[string]storage.MetricMap {
+	metricMap := storage.MetricMap{}
+	for key, value := range values {
+		value := value
+		metricMap[key] = storage.MetricValue{MType: storage.MeticTypeGauge, Value: &value}
+	}
+
+	return map[string]storage.MetricMap{storage.MeticTypeGauge: metricMap}
+}
+
+func TestEngineEvaluate(t *testing.T) {
+	engine := NewEngine([]Rule{{
+		Name:      "HighAlloc",
+		Metric:    "Alloc",
+		Type:      storage.MeticTypeGauge,
+		Labels:    storage.Labels{"source": "web-1"},
+		Op:        OpGreater,
+		Threshold: 100,
+		For:       config.Duration(time.Minute),
+	}})
+	now := time.Now()
+
+	// Серия другого источника не проверяется
+	changed := engine.Evaluate(gaugeValues(map[string]float64{`Alloc{source="web-1"}`: 150, `Alloc{source="web-2"}`: 150}), now)
+	require.Empty(t, changed)
+	alerts := engine.Alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, StatePending, alerts[0].State)
+	require.Equal(t, `Alloc{source="web-1"}`, alerts[0].Series)
+
+	changed = engine.Evaluate(gaugeValues(map[string]float64{`Alloc{source="web-1"}`: 200}), now.Add(time.Minute))
+	require.Len(t, changed, 1)
+	require.Equal(t, StateFiring, changed[0].State)
+	require.EqualValues(t, 200, changed[0].Value)
+	require.Equal(t, now, changed[0].ActiveAt)
+
+	// Повторная проверка не меняет состояние сработавшего оповещения
+	changed = engine.Evaluate(gaugeValues(map[string]float64{`Alloc{source="web-1"}`: 200}), now.Add(2*time.Minute))
+	require.Empty(t, changed)
+
+	changed = engine.Evaluate(gaugeValues(map[string]float64{`Alloc{source="web-1"}`: 50}), now.Add(3*time.Minute))
+	require.Len(t, changed, 1)
+	require.Equal(t, StateResolved, changed[0].State)
+	require.NotNil(t, changed[0].ResolvedAt)
+	require.EqualValues(t, 50, changed[0].Value)
+
+	// Завершённое оповещение удаляется из списка через resolvedRetention
+	engine.Evaluate(gaugeValues(nil), now.Add(3*time.Minute+resolvedRetention+time.Second))
+	require.Empty(t, engine.Alerts())
+}
+
+func TestEnginePendingReset(t *testing.T) {
+	engine := NewEngine([]Rule{{
+		Name:      "LowAlloc",
+		Metric:    "Alloc",
+		Type:      storage.MeticTypeGauge,
+		Op:        OpLess,
+		Threshold: 10,
+		For:       config.Duration(time.Minute),
+	}})
+	now := time.Now()
+
+	engine.Evaluate(gaugeValues(map[string]float64{"Alloc": 5}), now)
+	require.Len(t, engine.Alerts(), 1)
+
+	// Условие перестало выполняться до срабатывания - оповещения нет
+	changed := engine.Evaluate(gaugeValues(map[string]float64{"Alloc": 50}), now.Add(30*time.Second))
+	require.Empty(t, changed)
+	require.Empty(t, engine.Alerts())
+
+	engine.Evaluate(gaugeValues(map[string]float64{"Alloc": 5}), now.Add(45*time.Second))
+	changed = engine.Evaluate(gaugeValues(map[string]float64{"Alloc": 5}), now.Add(90*time.Second))
+	require.Empty(t, changed)
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	err := os.WriteFile(path, []byte(`{"rules": [{"name": "HighAlloc", "metric": "Alloc", "op": ">", "threshold": 100, "for": "1m"}]}`), 0644)
+	require.NoError(t, err)
+
+	rulesFile, err := LoadRules(path)
+	require.NoError(t, err)
+	require.Len(t, rulesFile.Rules, 1)
+	require.Equal(t, storage.MeticTypeGauge, rulesFile.Rules[0].Type)
+	require.Equal(t, config.Duration(time.Minute), rulesFile.Rules[0].For)
+
+	tests := []struct {
+		name  string
+		rules []Rule
+	}{
+		{name: "empty metric", rules: []Rule{{Name: "a", Op: OpGreater}}},
+		{name: "unknown op", rules: []Rule{{Name: "a", Metric: "Alloc", Op: "=>"}}},
+		{name: "histogram", rules: []Rule{{Name: "a", Metric: "Latency", Type: storage.MeticTypeHistogram, Op: OpGreater}}},
+		{name: "duplicate name", rules: []Rule{{Name: "a", Metric: "Alloc", Op: OpGreater}, {Name: "a", Metric: "HeapAlloc", Op: OpGreater}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorIs(t, ValidateRules(tt.rules), ErrInvalidRule)
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"metrics/internal/server/config"
+	"metrics/internal/server/storage"
+)
+
+// ErrInvalidRoute - получатель или маршрут уведомлений заполнен неверно
+var ErrInvalidRoute = errors.New("invalid alert route")
+
+// Receiver - получатель уведомлений, задаётся ровно один канал.
+type Receiver struct {
+	Name    string         `json:"name"`
+	Webhook *WebhookConfig `json:"webhook,omitempty"`
+	Email   *EmailConfig   `json:"email,omitempty"`
+	File    *FileConfig    `json:"file,omitempty"`
+}
+
+// Validate - проверка получателя и обязательных полей его канала.
+func (receiver Receiver) Validate() error {
+	if receiver.Name == "" {
+		return fmt.Errorf("%w: empty receiver name", ErrInvalidRoute)
+	}
+
+	var channels int
+	if receiver.Webhook != nil {
+		channels++
+		if receiver.Webhook.URL == "" {
+			return fmt.Errorf("%w: receiver %q: empty webhook url", ErrInvalidRoute, receiver.Name)
+		}
+	}
+	if receiver.Email != nil {
+		channels++
+		if receiver.Email.Addr == "" || receiver.Email.From == "" || len(receiver.Email.To) == 0 {
+			return fmt.Errorf("%w: receiver %q: email addr, from and to required", ErrInvalidRoute, receiver.Name)
+		}
+	}
+	if receiver.File != nil {
+		channels++
+		if receiver.File.Path == "" {
+			return fmt.Errorf("%w: receiver %q: empty file path", ErrInvalidRoute, receiver.Name)
+		}
+	}
+	if channels != 1 {
+		return fmt.Errorf("%w: receiver %q: exactly one of webhook, email, file required", ErrInvalidRoute, receiver.Name)
+	}
+
+	return nil
+}
+
+// Route - маршрут уведомлений. Оповещение уходит по первому подходящему маршруту,
+// следующие маршруты проверяются, только если у подходящего задан Continue.
+type Route struct {
+	// Receiver - имя получателя
+	Receiver string `json:"receiver"`
+	// Severity - важность оповещений маршрута, пустая - любая
+	Severity string `json:"severity,omitempty"`
+	// Labels - метки, которые должны быть у серии оповещения
+	Labels storage.Labels `json:"labels,omitempty"`
+	// GroupBy - метки, по значениям которых оповещения правила делятся на группы, пустой - одна группа на правило
+	GroupBy []string `json:"group_by,omitempty"`
+	// RepeatInterval - интервал повторного уведомления о группе со сработавшими оповещениями, 0 - без повторов
+	RepeatInterval config.Duration `json:"repeat_interval,omitempty"`
+	// Continue - после этого маршрута проверять следующие
+	Continue bool `json:"continue,omitempty"`
+}
+
+// Match - оповещение идёт по маршруту.
+func (route Route) Match(alert Alert) bool {
+	return (route.Severity == "" || route.Severity == alert.Severity) && alert.Labels.Match(route.Labels)
+}
+
+// groupKey - ключ группы оповещения: правило и значения меток GroupBy.
+func (route Route) groupKey(alert Alert) string {
+	labels := storage.Labels{}
+	for _, name := range route.GroupBy {
+		if value, ok := alert.Labels[name]; ok {
+			labels[name] = value
+		}
+	}
+
+	return storage.SeriesKey(alert.Rule, labels)
+}
+
+// ValidateRoutes - проверка получателей и маршрутов, маршрут должен ссылаться на существующего получателя.
+func ValidateRoutes(routes []Route, receivers []Receiver) error {
+	names := make(map[string]struct{}, len(receivers))
+	for _, receiver := range receivers {
+		if err := receiver.Validate(); err != nil {
+			return err
+		}
+
+		if _, ok := names[receiver.Name]; ok {
+			return fmt.Errorf("%w: duplicate receiver %q", ErrInvalidRoute, receiver.Name)
+		}
+		names[receiver.Name] = struct{}{}
+	}
+
+	for _, route := range routes {
+		if _, ok := names[route.Receiver]; !ok {
+			return fmt.Errorf("%w: unknown receiver %q", ErrInvalidRoute, route.Receiver)
+		}
+		if route.RepeatInterval < 0 {
+			return fmt.Errorf("%w: negative repeat interval", ErrInvalidRoute)
+		}
+		if err := route.Labels.Validate(); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidRoute, err)
+		}
+	}
+
+	return nil
+}
+
+// NewNotifiers - каналы получателей по имени, получатели должны быть проверены ValidateRoutes.
+func NewNotifiers(receivers []Receiver) map[string]Notifier {
+	notifiers := make(map[string]Notifier, len(receivers))
+	for _, receiver := range receivers {
+		switch {
+		case receiver.Webhook != nil:
+			notifiers[receiver.Name] = NewWebhookNotifier(*receiver.Webhook)
+		case receiver.Email != nil:
+			notifiers[receiver.Name] = NewEmailNotifier(*receiver.Email)
+		case receiver.File != nil:
+			notifiers[receiver.Name] = NewFileNotifier(*receiver.File)
+		}
+	}
+
+	return notifiers
+}
+
+// notificationGroup - состояние группы: о каких оповещениях и в каком состоянии уже сообщено.
+type notificationGroup struct {
+	route    int
+	key      string
+	notified map[string]State
+	lastSent time.Time
+}
+
+// Dispatcher - маршрутизация, группировка, повторы и заглушение уведомлений об оповещениях.
+type Dispatcher struct {
+	routes    []Route
+	notifiers map[string]Notifier
+	silences  *Silences
+	mutex     *sync.Mutex
+	groups    map[string]*notificationGroup
+}
+
+func NewDispatcher(routes []Route, notifiers map[string]Notifier, silences *Silences) *Dispatcher {
+	return &Dispatcher{
+		routes:    routes,
+		notifiers: notifiers,
+		silences:  silences,
+		mutex:     &sync.Mutex{},
+		groups:    make(map[string]*notificationGroup),
+	}
+}
+
+func alertID(alert Alert) string {
+	return alert.Rule + "\x00" + alert.Series
+}
+
+// Dispatch - отправка уведомлений по текущим оповещениям на момент now.
+// О группе сообщается, когда в ней появилось сработавшее оповещение или завершилось то, о котором уже сообщали,
+// и повторно через RepeatInterval, пока в ней есть сработавшие оповещения.
+// Заглушённые оповещения в уведомления не попадают. Группа, уведомление о которой не отправлено, отправляется при следующем вызове.
+func (dispatcher *Dispatcher) Dispatch(ctx context.Context, alerts []Alert, now time.Time) error {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+
+	current := make(map[string][]Alert)
+	for _, alert := range alerts {
+		if alert.State == StatePending || dispatcher.silences.Silenced(alert, now) {
+			continue
+		}
+
+		for i, route := range dispatcher.routes {
+			if !route.Match(alert) {
+				continue
+			}
+
+			key := route.groupKey(alert)
+			id := fmt.Sprintf("%d:%s", i, key)
+			if _, ok := dispatcher.groups[id]; !ok {
+				dispatcher.groups[id] = &notificationGroup{route: i, key: key, notified: make(map[string]State)}
+			}
+			current[id] = append(current[id], alert)
+
+			if !route.Continue {
+				break
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(dispatcher.groups))
+	for id := range dispatcher.groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var errs []error
+	for _, id := range ids {
+		group := dispatcher.groups[id]
+		err := dispatcher.dispatchGroup(ctx, group, current[id], now)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		if len(group.notified) == 0 && len(current[id]) == 0 {
+			delete(dispatcher.groups, id)
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return fmt.Errorf("%d notifications failed, first: %w", len(errs), errs[0])
+	}
+}
+
+func (dispatcher *Dispatcher) dispatchGroup(ctx context.Context, group *notificationGroup, alerts []Alert, now time.Time) error {
+	route := dispatcher.routes[group.route]
+
+	var notify []Alert
+	var changed, firing bool
+	present := make(map[string]struct{}, len(alerts))
+	for _, alert := range alerts {
+		id := alertID(alert)
+		present[id] = struct{}{}
+
+		switch alert.State {
+		case StateFiring:
+			firing = true
+			changed = changed || group.notified[id] != StateFiring
+			notify = append(notify, alert)
+		case StateResolved:
+			// О завершении сообщается, только если сообщали о срабатывании
+			if group.notified[id] == StateFiring {
+				changed = true
+				notify = append(notify, alert)
+			}
+		}
+	}
+
+	// Оповещения, которых больше нет или которые заглушены, забываются без уведомления
+	for id := range group.notified {
+		if _, ok := present[id]; !ok {
+			delete(group.notified, id)
+		}
+	}
+
+	repeat := firing && route.RepeatInterval > 0 && now.Sub(group.lastSent) >= time.Duration(route.RepeatInterval)
+	if len(notify) == 0 || !changed && !repeat {
+		return nil
+	}
+
+	notification := Notification{
+		Receiver: route.Receiver,
+		GroupKey: group.key,
+		Status:   StateResolved,
+		Alerts:   notify,
+		Time:     now,
+	}
+	if firing {
+		notification.Status = StateFiring
+	}
+	sortAlerts(notification.Alerts)
+
+	notifier, ok := dispatcher.notifiers[route.Receiver]
+	if !ok {
+		return fmt.Errorf("%w: unknown receiver %q", ErrInvalidRoute, route.Receiver)
+	}
+
+	err := notifier.Notify(ctx, notification)
+	if err != nil {
+		return fmt.Errorf("receiver %s: %w", route.Receiver, err)
+	}
+
+	group.lastSent = now
+	for _, alert := range notify {
+		id := alertID(alert)
+		if alert.State == StateFiring {
+			group.notified[id] = StateFiring
+		} else {
+			delete(group.notified, id)
+		}
+	}
+
+	return nil
+}
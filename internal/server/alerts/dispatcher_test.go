@@ -0,0 +1,137 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/config"
+	"metrics/internal/server/storage"
+)
+
+// recordingNotifier - получатель, запоминающий уведомления, отправка завершается ошибкой, пока задан fail.
+type recordingNotifier struct {
+	notifications []Notification
+	fail          bool
+}
+
+func (notifier *recordingNotifier) Notify(_ context.Context, notification Notification) error {
+	if notifier.fail {
+		return errors.New("receiver is unavailable")
+	}
+
+	notifier.notifications = append(notifier.notifications, notification)
+	return nil
+}
+
+func firingAlert(rule, source, severity string) Alert {
+	labels := storage.Labels{storage.SourceLabel: source}
+	return Alert{
+		Rule:     rule,
+		Series:   storage.SeriesKey("Alloc", labels),
+		Labels:   labels,
+		Severity: severity,
+		State:    StateFiring,
+	}
+}
+
+func TestDispatcherRouting(t *testing.T) {
+	critical := &recordingNotifier{}
+	other := &recordingNotifier{}
+	dispatcher := NewDispatcher([]Route{
+		{Receiver: "critical", Severity: "critical", GroupBy: []string{storage.SourceLabel}},
+		{Receiver: "other"},
+	}, map[string]Notifier{"critical": critical, "other": other}, NewSilences())
+
+	now := time.Now()
+	alerts := []Alert{
+		firingAlert("HighAlloc", "web-1", "critical"),
+		firingAlert("HighAlloc", "web-2", "critical"),
+		firingAlert("LowDisk", "web-1", "warning"),
+		firingAlert("LowDisk", "web-2", "warning"),
+	}
+	require.NoError(t, dispatcher.Dispatch(context.Background(), alerts, now))
+
+	// critical группируется по источнику, остальные - по правилу
+	require.Len(t, critical.notifications, 2)
+	require.Equal(t, `HighAlloc{source="web-1"}`, critical.notifications[0].GroupKey)
+	require.Len(t, other.notifications, 1)
+	require.Len(t, other.notifications[0].Alerts, 2)
+
+	// Без изменений и без RepeatInterval повторно не отправляется
+	require.NoError(t, dispatcher.Dispatch(context.Background(), alerts, now.Add(time.Hour)))
+	require.Len(t, critical.notifications, 2)
+	require.Len(t, other.notifications, 1)
+}
+
+func TestDispatcherRepeatAndResolve(t *testing.T) {
+	notifier := &recordingNotifier{}
+	dispatcher := NewDispatcher([]Route{
+		{Receiver: "ops", RepeatInterval: config.Duration(time.Hour)},
+	}, map[string]Notifier{"ops": notifier}, NewSilences())
+
+	now := time.Now()
+	alert := firingAlert("HighAlloc", "web-1", "")
+	require.NoError(t, dispatcher.Dispatch(context.Background(), []Alert{alert}, now))
+	require.NoError(t, dispatcher.Dispatch(context.Background(), []Alert{alert}, now.Add(time.Minute)))
+	require.Len(t, notifier.notifications, 1)
+
+	require.NoError(t, dispatcher.Dispatch(context.Background(), []Alert{alert}, now.Add(time.Hour)))
+	require.Len(t, notifier.notifications, 2)
+
+	// Ошибка отправки - уведомление о завершении отправляется при следующем вызове
+	alert.State = StateResolved
+	notifier.fail = true
+	require.Error(t, dispatcher.Dispatch(context.Background(), []Alert{alert}, now.Add(2*time.Hour)))
+	notifier.fail = false
+	require.NoError(t, dispatcher.Dispatch(context.Background(), []Alert{alert}, now.Add(2*time.Hour+time.Minute)))
+	require.Len(t, notifier.notifications, 3)
+	require.Equal(t, StateResolved, notifier.notifications[2].Status)
+
+	// О завершении сообщается один раз
+	require.NoError(t, dispatcher.Dispatch(context.Background(), []Alert{alert}, now.Add(3*time.Hour)))
+	require.Len(t, notifier.notifications, 3)
+}
+
+func TestDispatcherSilences(t *testing.T) {
+	notifier := &recordingNotifier{}
+	silences := NewSilences()
+	dispatcher := NewDispatcher([]Route{{Receiver: "ops"}}, map[string]Notifier{"ops": notifier}, silences)
+
+	now := time.Now()
+	silence, err := silences.Add(Silence{
+		Labels:   storage.Labels{storage.SourceLabel: "web-1"},
+		StartsAt: now,
+		EndsAt:   now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, silence.ID)
+
+	alerts := []Alert{firingAlert("HighAlloc", "web-1", ""), firingAlert("HighAlloc", "web-2", "")}
+	require.NoError(t, dispatcher.Dispatch(context.Background(), alerts, now))
+	require.Len(t, notifier.notifications, 1)
+	require.Len(t, notifier.notifications[0].Alerts, 1)
+	require.Equal(t, "web-2", notifier.notifications[0].Alerts[0].Labels[storage.SourceLabel])
+
+	// После окончания заглушения оповещение отправляется
+	require.NoError(t, dispatcher.Dispatch(context.Background(), alerts, now.Add(time.Hour)))
+	require.Len(t, notifier.notifications, 2)
+	require.Len(t, notifier.notifications[1].Alerts, 2)
+
+	require.Empty(t, silences.List(now.Add(time.Hour)))
+	require.ErrorIs(t, silences.Delete(silence.ID), ErrSilenceNotFound)
+
+	_, err = silences.Add(Silence{StartsAt: now, EndsAt: now.Add(time.Hour)})
+	require.ErrorIs(t, err, ErrInvalidSilence)
+}
+
+func TestValidateRoutes(t *testing.T) {
+	receivers := []Receiver{{Name: "ops", File: &FileConfig{Path: "/tmp/alerts.jsonl"}}}
+	require.NoError(t, ValidateRoutes([]Route{{Receiver: "ops"}}, receivers))
+	require.ErrorIs(t, ValidateRoutes([]Route{{Receiver: "unknown"}}, receivers), ErrInvalidRoute)
+
+	receivers = append(receivers, Receiver{Name: "both", File: &FileConfig{Path: "/tmp/a"}, Webhook: &WebhookConfig{URL: "http://localhost"}})
+	require.ErrorIs(t, ValidateRoutes(nil, receivers), ErrInvalidRoute)
+}
@@ -0,0 +1,322 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"metrics/internal/server/config"
+)
+
+// Notification - уведомление получателю о группе оповещений.
+// Status - firing, если в группе есть сработавшие оповещения, иначе resolved.
+type Notification struct {
+	Receiver string    `json:"receiver"`
+	GroupKey string    `json:"group_key"`
+	Status   State     `json:"status"`
+	Alerts   []Alert   `json:"alerts"`
+	Time     time.Time `json:"time"`
+}
+
+// Subject - краткое описание уведомления для заголовка письма.
+func (notification Notification) Subject() string {
+	return fmt.Sprintf("[%s] %s (%d alerts)", strings.ToUpper(string(notification.Status)), notification.GroupKey, len(notification.Alerts))
+}
+
+// Text - текст уведомления, по строке на оповещение.
+func (notification Notification) Text() string {
+	var text strings.Builder
+	for _, alert := range notification.Alerts {
+		fmt.Fprintf(&text, "%s [%s] %s = %v %s %v since %s\n",
+			alert.Rule, alert.State, alert.Series, alert.Value, alert.Op, alert.Threshold, alert.ActiveAt.Format(time.RFC3339))
+	}
+
+	return text.String()
+}
+
+// Notifier - канал отправки уведомлений.
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// WebhookConfig - отправка уведомлений JSON POST запросом.
+type WebhookConfig struct {
+	// URL - адрес, на который отправляется уведомление
+	URL string `json:"url"`
+	// Retries - количество повторов при ошибке сети или ответе 5xx (default: 3)
+	Retries *int `json:"retries,omitempty"`
+	// RetryInterval - пауза перед первым повтором, каждая следующая вдвое больше (default: 1s)
+	RetryInterval config.Duration `json:"retry_interval,omitempty"`
+	// Timeout - таймаут одного запроса (default: 5s)
+	Timeout config.Duration `json:"timeout,omitempty"`
+}
+
+// WebhookNotifier - уведомления JSON POST запросом с повторами.
+type WebhookNotifier struct {
+	url           string
+	retries       int
+	retryInterval time.Duration
+	client        *http.Client
+}
+
+func NewWebhookNotifier(webhookConfig WebhookConfig) *WebhookNotifier {
+	notifier := &WebhookNotifier{
+		url:           webhookConfig.URL,
+		retries:       3,
+		retryInterval: time.Duration(webhookConfig.RetryInterval),
+		client: &http.Client{
+			Timeout: time.Duration(webhookConfig.Timeout),
+		},
+	}
+	if webhookConfig.Retries != nil {
+		notifier.retries = *webhookConfig.Retries
+	}
+	if notifier.retryInterval <= 0 {
+		notifier.retryInterval = time.Second
+	}
+	if notifier.client.Timeout <= 0 {
+		notifier.client.Timeout = 5 * time.Second
+	}
+
+	return notifier
+}
+
+// errRetryable - ошибка отправки, после которой имеет смысл повторить запрос.
+var errRetryable = errors.New("retryable webhook error")
+
+func (notifier *WebhookNotifier) Notify(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	retryInterval := notifier.retryInterval
+	for attempt := 0; ; attempt++ {
+		err = notifier.send(ctx, body)
+		if err == nil || !errors.Is(err, errRetryable) || attempt >= notifier.retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryInterval):
+		}
+		retryInterval *= 2
+	}
+}
+
+func (notifier *WebhookNotifier) send(ctx context.Context, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, notifier.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := notifier.client.Do(request)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w: %s", errRetryable, err)
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode < 300:
+		return nil
+	case response.StatusCode >= 500, response.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: webhook %s responded %s", errRetryable, notifier.url, response.Status)
+	default:
+		return fmt.Errorf("webhook %s responded %s", notifier.url, response.Status)
+	}
+}
+
+// EmailConfig - отправка уведомлений письмом через SMTP сервер.
+type EmailConfig struct {
+	// Addr - адрес SMTP сервера host:port
+	Addr string `json:"addr"`
+	// From - адрес отправителя
+	From string `json:"from"`
+	// To - адреса получателей
+	To []string `json:"to"`
+	// Username - пользователь для PLAIN авторизации, пустой - без авторизации
+	Username string `json:"username,omitempty"`
+	// Password - пароль для PLAIN авторизации
+	Password string `json:"password,omitempty"`
+	// Timeout - таймаут отправки письма: соединения и всего диалога с сервером (default: 10s)
+	Timeout config.Duration `json:"timeout,omitempty"`
+}
+
+// EmailNotifier - уведомления письмом через SMTP сервер.
+type EmailNotifier struct {
+	config  EmailConfig
+	timeout time.Duration
+}
+
+func NewEmailNotifier(emailConfig EmailConfig) *EmailNotifier {
+	notifier := &EmailNotifier{
+		config:  emailConfig,
+		timeout: time.Duration(emailConfig.Timeout),
+	}
+	if notifier.timeout <= 0 {
+		notifier.timeout = 10 * time.Second
+	}
+
+	return notifier
+}
+
+func (notifier *EmailNotifier) Notify(ctx context.Context, notification Notification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(notifier.config.Addr)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if notifier.config.Username != "" {
+		auth = smtp.PlainAuth("", notifier.config.Username, notifier.config.Password, host)
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", notifier.config.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(notifier.config.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", notification.Subject())
+	fmt.Fprintf(&message, "Date: %s\r\n", notification.Time.Format(time.RFC1123Z))
+	message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(notification.Text(), "\n", "\r\n"))
+
+	return notifier.send(ctx, host, auth, message.Bytes())
+}
+
+// send - отправка письма как smtp.SendMail, но с таймаутом и отменой по ctx:
+// зависший SMTP сервер не должен задерживать уведомления бесконечно.
+func (notifier *EmailNotifier) send(ctx context.Context, host string, auth smtp.Auth, message []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, notifier.timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", notifier.config.Addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err = conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// Отмена ctx прерывает диалог с сервером, не дожидаясь дедлайна
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support AUTH")
+		}
+		if err = client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(notifier.config.From); err != nil {
+		return err
+	}
+	for _, to := range notifier.config.To {
+		if err = client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(message); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// FileConfig - запись уведомлений в локальный файл.
+type FileConfig struct {
+	// Path - файл, в который дописывается по JSON строке на уведомление
+	Path string `json:"path"`
+}
+
+// FileNotifier - запись уведомлений в файл JSONL, файл только дописывается.
+type FileNotifier struct {
+	path  string
+	mutex *sync.Mutex
+}
+
+func NewFileNotifier(fileConfig FileConfig) *FileNotifier {
+	return &FileNotifier{
+		path:  fileConfig.Path,
+		mutex: &sync.Mutex{},
+	}
+}
+
+func (notifier *FileNotifier) Notify(ctx context.Context, notification Notification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+
+	// Файл открывается на каждую запись, чтобы его можно было ротировать снаружи
+	file, err := os.OpenFile(notifier.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
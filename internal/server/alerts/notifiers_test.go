@@ -0,0 +1,200 @@
+package alerts
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/config"
+)
+
+func testNotification() Notification {
+	return Notification{
+		Receiver: "ops",
+		GroupKey: "HighAlloc",
+		Status:   StateFiring,
+		Alerts: []Alert{{
+			Rule:      "HighAlloc",
+			Series:    `Alloc{source="web-1"}`,
+			State:     StateFiring,
+			Value:     150,
+			Op:        OpGreater,
+			Threshold: 100,
+		}},
+		Time: time.Now(),
+	}
+}
+
+func TestWebhookNotifierRetry(t *testing.T) {
+	var requests int32
+	var received Notification
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		require.Equal(t, "application/json", request.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(request.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(WebhookConfig{URL: server.URL, RetryInterval: config.Duration(time.Millisecond)})
+	require.NoError(t, notifier.Notify(context.Background(), testNotification()))
+	require.EqualValues(t, 3, atomic.LoadInt32(&requests))
+	require.Equal(t, "HighAlloc", received.GroupKey)
+	require.Len(t, received.Alerts, 1)
+
+	// Ошибка клиента не повторяется
+	atomic.StoreInt32(&requests, 0)
+	badRequest := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		rw.WriteHeader(http.StatusBadRequest)
+	}))
+	defer badRequest.Close()
+
+	notifier = NewWebhookNotifier(WebhookConfig{URL: badRequest.URL, RetryInterval: config.Duration(time.Millisecond)})
+	require.Error(t, notifier.Notify(context.Background(), testNotification()))
+	require.EqualValues(t, 1, atomic.LoadInt32(&requests))
+}
+
+// serveSMTP - минимальный SMTP сервер для одного письма, текст письма отправляется в messages.
+func serveSMTP(t *testing.T, listener net.Listener, messages chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, err := conn.Write([]byte(line + "\r\n"))
+		require.NoError(t, err)
+	}
+
+	reply("220 localhost ESMTP")
+	var data strings.Builder
+	inData := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		if inData {
+			if line == ".\r\n" {
+				inData = false
+				messages <- data.String()
+				reply("250 OK")
+				continue
+			}
+			data.WriteString(line)
+			continue
+		}
+
+		switch command := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case command == "DATA":
+			inData = true
+			reply("354 End data with <CR><LF>.<CR><LF>")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	messages := make(chan string, 1)
+	go serveSMTP(t, listener, messages)
+
+	notifier := NewEmailNotifier(EmailConfig{
+		Addr: listener.Addr().String(),
+		From: "metrics@example.com",
+		To:   []string{"ops@example.com"},
+	})
+	require.NoError(t, notifier.Notify(context.Background(), testNotification()))
+
+	message := <-messages
+	require.Contains(t, message, "Subject: [FIRING] HighAlloc (1 alerts)")
+	require.Contains(t, message, "To: ops@example.com")
+	require.Contains(t, message, `HighAlloc [firing] Alloc{source="web-1"} = 150 > 100`)
+}
+
+func TestEmailNotifierTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	// Сервер принимает соединение и молчит
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(time.Second)
+	}()
+
+	notifier := NewEmailNotifier(EmailConfig{
+		Addr:    listener.Addr().String(),
+		From:    "metrics@example.com",
+		To:      []string{"ops@example.com"},
+		Timeout: config.Duration(50 * time.Millisecond),
+	})
+
+	start := time.Now()
+	require.Error(t, notifier.Notify(context.Background(), testNotification()))
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+
+	// Отмена контекста прерывает отправку до таймаута
+	notifier = NewEmailNotifier(EmailConfig{Addr: listener.Addr().String(), From: "metrics@example.com", To: []string{"ops@example.com"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+
+	start = time.Now()
+	require.Error(t, notifier.Notify(ctx, testNotification()))
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.jsonl")
+	notifier := NewFileNotifier(FileConfig{Path: path})
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, notifier.Notify(context.Background(), testNotification()))
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+
+	var notification Notification
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &notification))
+	require.Equal(t, StateFiring, notification.Status)
+}
@@ -0,0 +1,153 @@
+// Package alerts - оповещения по пороговым правилам для значений метрик.
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"metrics/internal/server/config"
+	"metrics/internal/server/storage"
+)
+
+// ErrInvalidRule - правило оповещения заполнено неверно
+var ErrInvalidRule = errors.New("invalid alert rule")
+
+// Операции сравнения значения с порогом
+const (
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+)
+
+// Rule - правило оповещения: серии метрики, метки которых содержат Labels, сравниваются с порогом.
+// Оповещение срабатывает, если условие выполняется не меньше For.
+type Rule struct {
+	// Name - уникальное имя правила
+	Name string `json:"name"`
+	// Metric - имя метрики без меток
+	Metric string `json:"metric"`
+	// Type - тип метрики: gauge или counter (default: gauge)
+	Type string `json:"type,omitempty"`
+	// Labels - метки, которые должны быть у серии, например source
+	Labels storage.Labels `json:"labels,omitempty"`
+	// Op - операция сравнения: >, >=, <, <=, ==, !=
+	Op string `json:"op"`
+	// Threshold - порог
+	Threshold float64 `json:"threshold"`
+	// For - сколько условие должно выполняться до срабатывания, 0 - срабатывает сразу
+	For config.Duration `json:"for,omitempty"`
+	// Severity - важность оповещения для маршрутизации уведомлений, например warning или critical
+	Severity string `json:"severity,omitempty"`
+}
+
+// Validate - проверка правила, пустой тип заменяется на gauge.
+func (rule *Rule) Validate() error {
+	if rule.Name == "" {
+		return fmt.Errorf("%w: empty name", ErrInvalidRule)
+	}
+	if rule.Metric == "" {
+		return fmt.Errorf("%w %q: empty metric", ErrInvalidRule, rule.Name)
+	}
+
+	switch rule.Type {
+	case "":
+		rule.Type = storage.MeticTypeGauge
+	case storage.MeticTypeGauge, storage.MeticTypeCounter:
+	default:
+		return fmt.Errorf("%w %q: metric type %q is not supported", ErrInvalidRule, rule.Name, rule.Type)
+	}
+
+	switch rule.Op {
+	case OpGreater, OpGreaterEqual, OpLess, OpLessEqual, OpEqual, OpNotEqual:
+	default:
+		return fmt.Errorf("%w %q: unknown op %q", ErrInvalidRule, rule.Name, rule.Op)
+	}
+
+	if rule.For < 0 {
+		return fmt.Errorf("%w %q: negative for", ErrInvalidRule, rule.Name)
+	}
+
+	if err := rule.Labels.Validate(); err != nil {
+		return fmt.Errorf("%w %q: %s", ErrInvalidRule, rule.Name, err)
+	}
+
+	return nil
+}
+
+// Match - условие правила выполняется для значения.
+func (rule Rule) Match(value float64) bool {
+	switch rule.Op {
+	case OpGreater:
+		return value > rule.Threshold
+	case OpGreaterEqual:
+		return value >= rule.Threshold
+	case OpLess:
+		return value < rule.Threshold
+	case OpLessEqual:
+		return value <= rule.Threshold
+	case OpEqual:
+		return value == rule.Threshold
+	case OpNotEqual:
+		return value != rule.Threshold
+	default:
+		return false
+	}
+}
+
+// ValidateRules - проверка правил и уникальности их имён.
+func ValidateRules(rules []Rule) error {
+	names := make(map[string]struct{}, len(rules))
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return err
+		}
+
+		if _, ok := names[rules[i].Name]; ok {
+			return fmt.Errorf("%w %q: duplicate name", ErrInvalidRule, rules[i].Name)
+		}
+		names[rules[i].Name] = struct{}{}
+	}
+
+	return nil
+}
+
+// RulesFile - правила оповещений и настройки уведомлений о них.
+type RulesFile struct {
+	Rules []Rule `json:"rules"`
+	// Receivers - получатели уведомлений
+	Receivers []Receiver `json:"receivers,omitempty"`
+	// Routes - маршруты уведомлений к получателям
+	Routes []Route `json:"routes,omitempty"`
+}
+
+// LoadRules - правила и настройки уведомлений из JSON файла вида {"rules": [...], "receivers": [...], "routes": [...]}.
+func LoadRules(path string) (RulesFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return RulesFile{}, err
+	}
+	defer file.Close()
+
+	var rulesFile RulesFile
+	err = json.NewDecoder(file).Decode(&rulesFile)
+	if err != nil {
+		return RulesFile{}, fmt.Errorf("alert rules %s: %w", path, err)
+	}
+
+	err = ValidateRules(rulesFile.Rules)
+	if err != nil {
+		return RulesFile{}, err
+	}
+
+	err = ValidateRoutes(rulesFile.Routes, rulesFile.Receivers)
+	if err != nil {
+		return RulesFile{}, err
+	}
+
+	return rulesFile, nil
+}
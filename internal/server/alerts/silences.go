@@ -0,0 +1,137 @@
+package alerts
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"metrics/internal/server/storage"
+)
+
+var (
+	// ErrSilenceNotFound - заглушения с таким идентификатором нет
+	ErrSilenceNotFound = errors.New("silence not found")
+	// ErrInvalidSilence - заглушение заполнено неверно
+	ErrInvalidSilence = errors.New("invalid silence")
+)
+
+// Silence - заглушение уведомлений об оповещениях правила Rule (пустое - любого),
+// метки серии которых содержат Labels, на интервал [StartsAt, EndsAt).
+type Silence struct {
+	ID       string         `json:"id"`
+	Rule     string         `json:"rule,omitempty"`
+	Labels   storage.Labels `json:"labels,omitempty"`
+	StartsAt time.Time      `json:"starts_at"`
+	EndsAt   time.Time      `json:"ends_at"`
+	Comment  string         `json:"comment,omitempty"`
+}
+
+// Validate - проверка заглушения: оно ограничено правилом или метками и заканчивается после начала.
+func (silence Silence) Validate() error {
+	if silence.Rule == "" && len(silence.Labels) == 0 {
+		return fmt.Errorf("%w: rule or labels required", ErrInvalidSilence)
+	}
+	if !silence.EndsAt.After(silence.StartsAt) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidSilence)
+	}
+
+	return silence.Labels.Validate()
+}
+
+// Active - заглушение действует в момент now.
+func (silence Silence) Active(now time.Time) bool {
+	return !now.Before(silence.StartsAt) && now.Before(silence.EndsAt)
+}
+
+// Match - заглушение относится к оповещению.
+func (silence Silence) Match(alert Alert) bool {
+	return (silence.Rule == "" || silence.Rule == alert.Rule) && alert.Labels.Match(silence.Labels)
+}
+
+// Silences - потокобезопасный список заглушений в ОП.
+type Silences struct {
+	mutex    sync.RWMutex
+	silences map[string]Silence
+}
+
+func NewSilences() *Silences {
+	return &Silences{
+		silences: make(map[string]Silence),
+	}
+}
+
+// Add - добавление заглушения, идентификатор назначается при добавлении.
+func (silences *Silences) Add(silence Silence) (Silence, error) {
+	err := silence.Validate()
+	if err != nil {
+		return Silence{}, err
+	}
+
+	id := make([]byte, 8)
+	_, err = rand.Read(id)
+	if err != nil {
+		return Silence{}, err
+	}
+	silence.ID = hex.EncodeToString(id)
+
+	silences.mutex.Lock()
+	defer silences.mutex.Unlock()
+	silences.silences[silence.ID] = silence
+
+	return silence, nil
+}
+
+// Delete - удаление заглушения.
+func (silences *Silences) Delete(id string) error {
+	silences.mutex.Lock()
+	defer silences.mutex.Unlock()
+
+	if _, ok := silences.silences[id]; !ok {
+		return ErrSilenceNotFound
+	}
+	delete(silences.silences, id)
+
+	return nil
+}
+
+// List - заглушения, которые действуют или начнутся после now, по времени окончания.
+// Закончившиеся заглушения удаляются.
+func (silences *Silences) List(now time.Time) []Silence {
+	silences.mutex.Lock()
+	defer silences.mutex.Unlock()
+
+	list := make([]Silence, 0, len(silences.silences))
+	for id, silence := range silences.silences {
+		if !now.Before(silence.EndsAt) {
+			delete(silences.silences, id)
+			continue
+		}
+		list = append(list, silence)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].EndsAt.Equal(list[j].EndsAt) {
+			return list[i].EndsAt.Before(list[j].EndsAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+
+	return list
+}
+
+// Silenced - оповещение заглушено в момент now.
+func (silences *Silences) Silenced(alert Alert, now time.Time) bool {
+	silences.mutex.RLock()
+	defer silences.mutex.RUnlock()
+
+	for _, silence := range silences.silences {
+		if silence.Active(now) && silence.Match(alert) {
+			return true
+		}
+	}
+
+	return false
+}
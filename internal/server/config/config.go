@@ -12,14 +12,66 @@ import (
 
 // StoreConfig используется для хранения конфигурации агента, связанной с хранилищами.
 type StoreConfig struct {
-	// Interval - интервал выгрузки на диск (flag: i; default: 300s)
+	// Interval - интервал записи снимка на диск, 0 - fsync журнала на каждое обновление (flag: i; default: 300s)
 	Interval time.Duration `env:"STORE_INTERVAL" json:"store_interval,omitempty"`
-	// DatabaseDSN - DSN БД (flag: d)
+	// DatabaseDSN - DSN БД Postgres или файла SQLite вида sqlite:///var/lib/metrics.db (flag: d)
 	DatabaseDSN string `env:"DATABASE_DSN" json:"database_dsn,omitempty"`
-	// File - файл для выгрузки (flag: f; default: /tmp/devops-metrics-db.json)
+	// File - файл снимка, рядом ведётся журнал File + ".wal" (flag: f; default: /tmp/devops-metrics-db.json)
 	File string `env:"STORE_FILE" json:"store_file,omitempty"`
 	// Restore - чтение значений с диска при запуске (flag: r; default: false)
 	Restore bool `env:"RESTORE" json:"restore,omitempty"`
+	// MigrateDryRun - только вывести неприменённые миграции БД и завершить работу (flag: migrate-dry-run; default: false)
+	MigrateDryRun bool `env:"MIGRATE_DRY_RUN" json:"migrate_dry_run,omitempty"`
+	// Retention - правила хранения и прореживания истории
+	Retention RetentionConfig `json:"retention,omitempty"`
+	// Cache - кеш с отложенной записью перед хранилищем
+	Cache CacheConfig `json:"cache,omitempty"`
+}
+
+// CacheConfig - настройки кеша с отложенной записью перед хранилищем.
+type CacheConfig struct {
+	// FlushInterval - интервал записи накопленных изменений в хранилище, 0 - кеш отключён (flag: cache-flush-interval; default: 0)
+	FlushInterval Duration `env:"CACHE_FLUSH_INTERVAL" json:"flush_interval,omitempty"`
+	// FlushSize - количество изменённых серий, при котором изменения записываются, не дожидаясь интервала, 0 - только по интервалу (flag: cache-flush-size; default: 1000)
+	FlushSize int `env:"CACHE_FLUSH_SIZE" json:"flush_size,omitempty"`
+}
+
+// StaleConfig - признаки устаревания агентов и метрик.
+type StaleConfig struct {
+	// ReportInterval - интервал отправки метрик агентами (flag: report-interval; default: 10s)
+	ReportInterval Duration `env:"REPORT_INTERVAL" json:"report_interval,omitempty"`
+	// Factor - агент и его gauge устаревают, если от агента не было метрик Factor интервалов отправки, 0 - не устаревают (flag: stale-factor; default: 3)
+	Factor int `env:"STALE_FACTOR" json:"factor,omitempty"`
+	// MetricTTL - срок, после которого серия без записи удаляется вместе с историей, 0 - не удаляется (flag: metric-ttl; default: 0)
+	MetricTTL Duration `env:"METRIC_TTL" json:"metric_ttl,omitempty"`
+}
+
+// StaleAfter - время без записи, после которого агент и его gauge считаются устаревшими, 0 - не устаревают.
+func (stale StaleConfig) StaleAfter() time.Duration {
+	if stale.Factor <= 0 {
+		return 0
+	}
+
+	return time.Duration(stale.ReportInterval) * time.Duration(stale.Factor)
+}
+
+// AlertsConfig - настройки оповещений по пороговым правилам.
+type AlertsConfig struct {
+	// RulesFile - JSON файл с правилами, получателями и маршрутами уведомлений, пустой - оповещения отключены (flag: alert-rules)
+	RulesFile string `env:"ALERT_RULES_FILE" json:"rules_file,omitempty"`
+	// EvalInterval - интервал проверки правил (flag: alert-interval; default: 10s)
+	EvalInterval Duration `env:"ALERT_EVAL_INTERVAL" json:"eval_interval,omitempty"`
+}
+
+// GRPCTLSConfig - TLS gRPC сервера.
+type GRPCTLSConfig struct {
+	// CertFile - сертификат сервера PEM, пустой - gRPC без TLS (flag: grpc-tls-cert)
+	CertFile string `env:"GRPC_TLS_CERT" json:"cert_file,omitempty"`
+	// KeyFile - приватный ключ сертификата сервера PEM (flag: grpc-tls-key)
+	KeyFile string `env:"GRPC_TLS_KEY" json:"key_file,omitempty"`
+	// ClientCAFile - сертификаты CA клиентов PEM, если задан - клиенты обязаны предъявить сертификат (mTLS),
+	// CN сертификата становится идентификатором агента (flag: grpc-tls-client-ca)
+	ClientCAFile string `env:"GRPC_TLS_CLIENT_CA" json:"client_ca_file,omitempty"`
 }
 
 // Config используется для хранения конфигурации сервера.
@@ -28,11 +80,25 @@ type Config struct {
 	ServerAddr string `env:"ADDRESS" json:"address,omitempty"`
 	// ServerGRPCAddr - адрес gRPC сервера (default: 127.0.0.1:50051)
 	ServerGRPCAddr string `env:"ADDRESS_GRPC" json:"address_grpc,omitempty"`
+	// ServerStatsDAddr - адрес приёма метрик StatsD по UDP, пустой - не принимаются (flag: statsd-addr)
+	ServerStatsDAddr string `env:"ADDRESS_STATSD" json:"address_statsd,omitempty"`
+	// ServerStatsDTCPAddr - адрес приёма метрик StatsD по TCP, строки разделяются переводом строки, пустой - не принимаются (flag: statsd-tcp-addr)
+	ServerStatsDTCPAddr string `env:"ADDRESS_STATSD_TCP" json:"address_statsd_tcp,omitempty"`
+	// StatsDFlushInterval - интервал записи агрегированных значений StatsD в хранилище (flag: statsd-flush-interval; default: 10s)
+	StatsDFlushInterval Duration `env:"STATSD_FLUSH_INTERVAL" json:"statsd_flush_interval,omitempty"`
+	// RemoteWriteMaxSize - макс. размер распакованного тела запроса remote write, байт (flag: remote-write-max-size; default: 33554432)
+	RemoteWriteMaxSize int `env:"REMOTE_WRITE_MAX_SIZE" json:"remote_write_max_size,omitempty"`
+	// GRPCTLS - TLS и mTLS gRPC сервера
+	GRPCTLS GRPCTLSConfig `json:"grpc_tls,omitempty"`
+	// GRPCReflection - сервис reflection gRPC для grpcurl и подобных клиентов (flag: grpc-reflection; default: false)
+	GRPCReflection bool `env:"GRPC_REFLECTION" json:"grpc_reflection,omitempty"`
+	// GRPCStatsInterval - интервал записи счётчиков и длительности запросов gRPC в хранилище как метрик сервера, 0 - не учитываются (flag: grpc-stats-interval; default: 10s)
+	GRPCStatsInterval Duration `env:"GRPC_STATS_INTERVAL" json:"grpc_stats_interval,omitempty"`
 	// TrustedSubNet - строковое представление доверенной сети
 	TrustedSubNet string `env:"TRUSTED_SUBNET" json:"trusted_subnet,omitempty"`
 	// ProfilingAddr -  адрес WEB сервера профилировщика, не работает если пустое значение (flag: pa; default: 127.0.0.1:8090)
 	ProfilingAddr string `env:"PROF_ADDRESS" json:"profiling_addr,omitempty"`
-	// TemplatesAbsPath - абсолютный путь до шаблонов HTML (default: ./templates)
+	// TemplatesAbsPath - каталог шаблонов HTML и статических файлов вместо встроенных в бинарный файл, для разработки веб-интерфейса
 	TemplatesAbsPath string `env:"TEMPLATES_ABS_PATH" json:"templates_abs_path,omitempty"`
 	// PrivateKeyRSA - приватный RSA ключ (flag: crypto-key)
 	PrivateKeyRSA string `env:"CRYPTO_KEY" json:"crypto_key,omitempty"`
@@ -40,7 +106,11 @@ type Config struct {
 	SignKey string `env:"KEY" json:"sign_key,omitempty"`
 	// DebugMode - debug мод (flag: debug; default: false)
 	DebugMode bool `env:"DEBUG" json:"debug,omitempty"`
-	Store     StoreConfig
+	// Stale - признаки устаревания агентов и метрик
+	Stale StaleConfig `json:"stale,omitempty"`
+	// Alerts - оповещения по пороговым правилам
+	Alerts AlertsConfig `json:"alerts,omitempty"`
+	Store  StoreConfig
 }
 
 func newConfig() *Config {
@@ -54,11 +124,36 @@ func newConfig() *Config {
 func (config *Config) initDefaultValues() {
 	config.ServerAddr = "127.0.0.1:8080"
 	config.ServerGRPCAddr = "127.0.0.1:50051"
-	config.TemplatesAbsPath = "./templates"
+	config.GRPCStatsInterval = Duration(10 * time.Second)
+	config.StatsDFlushInterval = Duration(10 * time.Second)
+	config.RemoteWriteMaxSize = 32 << 20
+	config.Stale = StaleConfig{
+		ReportInterval: Duration(10 * time.Second),
+		Factor:         3,
+	}
+	config.Alerts = AlertsConfig{
+		EvalInterval: Duration(10 * time.Second),
+	}
 	config.Store = StoreConfig{
 		Interval: time.Duration(300) * time.Second,
 		File:     "/tmp/devops-metrics-db.json",
 		Restore:  true,
+		Retention: RetentionConfig{
+			CompactInterval: Duration(time.Minute),
+			Rules: []RetentionRule{
+				{
+					Pattern: "*",
+					Raw:     Duration(24 * time.Hour),
+					Rollups: []RollupRule{
+						{Step: Duration(time.Minute), Retention: Duration(30 * 24 * time.Hour)},
+						{Step: Duration(time.Hour), Retention: Duration(365 * 24 * time.Hour)},
+					},
+				},
+			},
+		},
+		Cache: CacheConfig{
+			FlushSize: 1000,
+		},
 	}
 }
 
@@ -107,12 +202,30 @@ func (config *Config) parseFlags() {
 	flag.StringVar(&config.PrivateKeyRSA, "crypto-key", config.PrivateKeyRSA, "RSA private key")
 	flag.StringVar(&config.SignKey, "k", config.SignKey, "sign key")
 	flag.BoolVar(&config.DebugMode, "debug", config.DebugMode, "debug mode")
+	flag.DurationVar((*time.Duration)(&config.Stale.ReportInterval), "report-interval", time.Duration(config.Stale.ReportInterval), "agents report interval (example: 10s)")
+	flag.IntVar(&config.Stale.Factor, "stale-factor", config.Stale.Factor, "number of missed report intervals after which agent and its gauges are stale, 0 disables")
+	flag.StringVar(&config.Alerts.RulesFile, "alert-rules", config.Alerts.RulesFile, "path to JSON file with alert rules, receivers and routes")
+	flag.DurationVar((*time.Duration)(&config.Alerts.EvalInterval), "alert-interval", time.Duration(config.Alerts.EvalInterval), "alert rules evaluation interval (example: 10s)")
+	flag.StringVar(&config.GRPCTLS.CertFile, "grpc-tls-cert", config.GRPCTLS.CertFile, "gRPC server TLS certificate (PEM), empty disables TLS")
+	flag.StringVar(&config.GRPCTLS.KeyFile, "grpc-tls-key", config.GRPCTLS.KeyFile, "gRPC server TLS private key (PEM)")
+	flag.StringVar(&config.GRPCTLS.ClientCAFile, "grpc-tls-client-ca", config.GRPCTLS.ClientCAFile, "CA certificates (PEM) for gRPC client certificates, enables mutual TLS")
+	flag.BoolVar(&config.GRPCReflection, "grpc-reflection", config.GRPCReflection, "register gRPC server reflection service")
+	flag.DurationVar((*time.Duration)(&config.GRPCStatsInterval), "grpc-stats-interval", time.Duration(config.GRPCStatsInterval), "interval of storing gRPC request counters and latencies as server metrics, 0 disables (example: 10s)")
+	flag.StringVar(&config.ServerStatsDAddr, "statsd-addr", config.ServerStatsDAddr, "StatsD UDP listener address (host:port), empty disables")
+	flag.StringVar(&config.ServerStatsDTCPAddr, "statsd-tcp-addr", config.ServerStatsDTCPAddr, "StatsD TCP listener address (host:port), empty disables")
+	flag.DurationVar((*time.Duration)(&config.StatsDFlushInterval), "statsd-flush-interval", time.Duration(config.StatsDFlushInterval), "interval of storing aggregated StatsD values (example: 10s)")
+	flag.IntVar(&config.RemoteWriteMaxSize, "remote-write-max-size", config.RemoteWriteMaxSize, "max decompressed size of remote write request body in bytes")
+	flag.DurationVar((*time.Duration)(&config.Stale.MetricTTL), "metric-ttl", time.Duration(config.Stale.MetricTTL), "delete series not written for this time, 0 disables (example: 24h)")
 
 	//StoreConfig
 	flag.BoolVar(&config.Store.Restore, "r", config.Store.Restore, "restoring metrics from file")
 	flag.DurationVar(&config.Store.Interval, "i", config.Store.Interval, "store interval (example: 10s)")
 	flag.StringVar(&config.Store.DatabaseDSN, "d", config.Store.DatabaseDSN, "Database DSN")
 	flag.StringVar(&config.Store.File, "f", config.Store.File, "path to file for storage metrics")
+	flag.BoolVar(&config.Store.MigrateDryRun, "migrate-dry-run", config.Store.MigrateDryRun, "print pending database migrations and exit")
+	flag.DurationVar((*time.Duration)(&config.Store.Retention.CompactInterval), "retention-interval", time.Duration(config.Store.Retention.CompactInterval), "history compaction interval (example: 1m)")
+	flag.DurationVar((*time.Duration)(&config.Store.Cache.FlushInterval), "cache-flush-interval", time.Duration(config.Store.Cache.FlushInterval), "write-behind cache flush interval, 0 disables cache (example: 1s)")
+	flag.IntVar(&config.Store.Cache.FlushSize, "cache-flush-size", config.Store.Cache.FlushSize, "number of changed series that triggers write-behind cache flush")
 	flag.Parse()
 }
 
@@ -129,5 +242,10 @@ func LoadConfig() Config {
 		log.Fatal(err)
 	}
 
+	err = config.Store.Retention.Validate()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	return *config
 }
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"time"
+)
+
+// Duration - time.Duration, который в JSON и переменных окружения задаётся строкой (например "24h").
+type Duration time.Duration
+
+func (duration Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(duration).String()), nil
+}
+
+func (duration *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*duration = Duration(parsed)
+
+	return nil
+}
+
+// RollupRule - уровень прореживания истории.
+type RollupRule struct {
+	// Step - интервал агрегации
+	Step Duration `json:"step"`
+	// Retention - срок хранения агрегатов, 0 - без ограничения
+	Retention Duration `json:"retention,omitempty"`
+}
+
+// RetentionRule - правило хранения истории для метрик, имя которых соответствует шаблону.
+type RetentionRule struct {
+	// Pattern - шаблон имени метрики в формате path.Match (например "*" или "Alloc*")
+	Pattern string `json:"pattern"`
+	// Raw - срок хранения исходных значений, 0 - без ограничения
+	Raw Duration `json:"raw,omitempty"`
+	// Rollups - уровни прореживания по возрастанию шага
+	Rollups []RollupRule `json:"rollups,omitempty"`
+}
+
+// RetentionConfig - правила хранения и прореживания истории.
+type RetentionConfig struct {
+	// CompactInterval - интервал запуска компактора, 0 - компактор отключён (flag: retention-interval; default: 1m)
+	CompactInterval Duration `env:"RETENTION_COMPACT_INTERVAL" json:"compact_interval,omitempty"`
+	// Rules - правила, применяется первое подходящее (default: raw 24h, 1m - 30 дней, 1h - 365 дней)
+	Rules []RetentionRule `json:"rules,omitempty"`
+}
+
+// Match - первое правило, шаблон которого соответствует имени метрики.
+func (retention RetentionConfig) Match(name string) (RetentionRule, bool) {
+	i := retention.MatchIndex(name)
+	if i < 0 {
+		return RetentionRule{}, false
+	}
+
+	return retention.Rules[i], true
+}
+
+// MatchIndex - индекс первого правила, шаблон которого соответствует имени метрики, -1 если такого нет.
+func (retention RetentionConfig) MatchIndex(name string) int {
+	for i, rule := range retention.Rules {
+		if ok, _ := path.Match(rule.Pattern, name); ok {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Validate - проверка правил хранения.
+// Агрегаты считаются по исходным значениям, поэтому шаг не может превышать срок хранения исходных значений.
+func (retention RetentionConfig) Validate() error {
+	if retention.CompactInterval < 0 {
+		return errors.New("retention compact interval must not be negative")
+	}
+
+	for _, rule := range retention.Rules {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return fmt.Errorf("retention rule %q: %w", rule.Pattern, err)
+		}
+		if rule.Raw < 0 {
+			return fmt.Errorf("retention rule %q: raw retention must not be negative", rule.Pattern)
+		}
+
+		for i, rollup := range rule.Rollups {
+			if rollup.Step < Duration(time.Millisecond) {
+				return fmt.Errorf("retention rule %q: rollup step must be at least 1ms", rule.Pattern)
+			}
+			if rollup.Retention != 0 && rollup.Retention < rollup.Step {
+				return fmt.Errorf("retention rule %q: rollup retention %s is less than step %s", rule.Pattern, time.Duration(rollup.Retention), time.Duration(rollup.Step))
+			}
+			if rule.Raw != 0 && rule.Raw < rollup.Step {
+				return fmt.Errorf("retention rule %q: raw retention %s is less than rollup step %s", rule.Pattern, time.Duration(rule.Raw), time.Duration(rollup.Step))
+			}
+			if i > 0 && !(rule.Rollups[i-1].Step < rollup.Step) {
+				return fmt.Errorf("retention rule %q: rollup steps must be strictly increasing", rule.Pattern)
+			}
+		}
+	}
+
+	return nil
+}
@@ -9,17 +9,42 @@ import (
 type ContentType int
 
 const (
-	ContentTypeUnknown = iota
+	ContentTypeUnknown ContentType = iota
 	ContentTypePlainText
 	ContentTypeHTML
 	ContentTypeJSON
 	ContentTypeXML
 	ContentTypeForm
 	ContentTypeEventStream
+	ContentTypeOpenMetrics
 )
 
+// mimeTypes - MIME тип для заголовков ответа.
+var mimeTypes = map[ContentType]string{
+	ContentTypePlainText:   "text/plain",
+	ContentTypeHTML:        "text/html",
+	ContentTypeJSON:        "application/json",
+	ContentTypeXML:         "application/xml",
+	ContentTypeForm:        "application/x-www-form-urlencoded",
+	ContentTypeEventStream: "text/event-stream",
+	ContentTypeOpenMetrics: "application/openmetrics-text",
+}
+
+// String - MIME тип, для неизвестного типа - пустая строка.
+func (contentType ContentType) String() string {
+	return mimeTypes[contentType]
+}
+
 func GetContentType(header http.Header) ContentType {
-	contentTypeFull := header.Get("Content-Type")
+	return parseContentType(header.Get("Content-Type"))
+}
+
+// GetAcceptContentType - первый тип из заголовка Accept, которым клиент указывает ожидаемый ответ.
+func GetAcceptContentType(header http.Header) ContentType {
+	return parseContentType(strings.Split(header.Get("Accept"), ",")[0])
+}
+
+func parseContentType(contentTypeFull string) ContentType {
 	contentType := strings.TrimSpace(strings.Split(contentTypeFull, ";")[0])
 
 	switch contentType {
@@ -35,6 +60,8 @@ func GetContentType(header http.Header) ContentType {
 		return ContentTypeForm
 	case "text/event-stream":
 		return ContentTypeEventStream
+	case "application/openmetrics-text":
+		return ContentTypeOpenMetrics
 	default:
 		return ContentTypeUnknown
 	}
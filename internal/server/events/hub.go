@@ -0,0 +1,153 @@
+// Package events - рассылка изменений метрик подписчикам, например в поток Server-Sent Events.
+package events
+
+import (
+	"path"
+	"sync"
+
+	"metrics/internal/server/storage"
+)
+
+const (
+	// KindUpdate - значение серии записано, в событии новое значение
+	KindUpdate = "update"
+	// KindDelete - серия удалена
+	KindDelete = "delete"
+	// KindReload - изменилось неизвестное множество серий, значения нужно перечитать
+	KindReload = "reload"
+)
+
+// subscriberBuffer - количество событий, которые подписчик может не забрать, прежде чем будет отключён
+const subscriberBuffer = 256
+
+// Event - изменение метрики.
+type Event struct {
+	Kind   string               `json:"kind"`
+	Key    string               `json:"key,omitempty"`
+	ID     string               `json:"id,omitempty"`
+	Labels storage.Labels       `json:"labels,omitempty"`
+	MType  string               `json:"type,omitempty"`
+	Value  *storage.MetricValue `json:"value,omitempty"`
+	// Text - значение в виде строки, как на странице списка метрик
+	Text string `json:"text,omitempty"`
+}
+
+// Filter - отбор событий подписчика, пустые поля не ограничивают.
+type Filter struct {
+	// Name - шаблон имени метрики path.Match
+	Name string
+	// MType - тип метрики
+	MType string
+}
+
+// Validate - проверка шаблона имени.
+func (filter Filter) Validate() error {
+	_, err := path.Match(filter.Name, "")
+	return err
+}
+
+// Match - событие проходит отбор. События reload получают все подписчики.
+func (filter Filter) Match(event Event) bool {
+	if event.Kind == KindReload {
+		return true
+	}
+	if filter.MType != "" && filter.MType != event.MType {
+		return false
+	}
+	if filter.Name != "" {
+		ok, _ := path.Match(filter.Name, event.ID)
+		return ok
+	}
+
+	return true
+}
+
+type subscriber struct {
+	filter Filter
+	events chan Event
+}
+
+// Hub - потокобезопасная рассылка событий подписчикам.
+// Публикация не ждёт подписчиков: подписчик, не успевающий забирать события, отключается закрытием канала.
+type Hub struct {
+	mutex       *sync.RWMutex
+	subscribers map[*subscriber]struct{}
+	closed      bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		mutex:       &sync.RWMutex{},
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// Subscribe - подписка на события, подходящие под filter.
+// Канал закрывается при отписке, отключении медленного подписчика и закрытии Hub.
+func (hub *Hub) Subscribe(filter Filter) (<-chan Event, func()) {
+	sub := &subscriber{
+		filter: filter,
+		events: make(chan Event, subscriberBuffer),
+	}
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if hub.closed {
+		close(sub.events)
+		return sub.events, func() {}
+	}
+	hub.subscribers[sub] = struct{}{}
+
+	return sub.events, func() {
+		hub.mutex.Lock()
+		defer hub.mutex.Unlock()
+		hub.remove(sub)
+	}
+}
+
+// remove - отключение подписчика, вызывается под блокировкой.
+func (hub *Hub) remove(sub *subscriber) {
+	if _, ok := hub.subscribers[sub]; !ok {
+		return
+	}
+	delete(hub.subscribers, sub)
+	close(sub.events)
+}
+
+// HasSubscribers - есть ли подписчики, чтобы не готовить события впустую.
+func (hub *Hub) HasSubscribers() bool {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+
+	return len(hub.subscribers) > 0
+}
+
+// Publish - отправка события подходящим подписчикам.
+func (hub *Hub) Publish(event Event) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	for sub := range hub.subscribers {
+		if !sub.filter.Match(event) {
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			hub.remove(sub)
+		}
+	}
+}
+
+// Close - отключение всех подписчиков, новые подписки сразу получают закрытый канал.
+func (hub *Hub) Close() {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.closed = true
+	for sub := range hub.subscribers {
+		hub.remove(sub)
+	}
+}
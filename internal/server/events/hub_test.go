@@ -0,0 +1,57 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHubFilter(t *testing.T) {
+	hub := NewHub()
+	all, unsubscribeAll := hub.Subscribe(Filter{})
+	defer unsubscribeAll()
+	allocs, unsubscribeAllocs := hub.Subscribe(Filter{Name: "*Alloc", MType: "gauge"})
+	defer unsubscribeAllocs()
+
+	hub.Publish(Event{Kind: KindUpdate, ID: "HeapAlloc", MType: "gauge"})
+	hub.Publish(Event{Kind: KindUpdate, ID: "PollCount", MType: "counter"})
+	hub.Publish(Event{Kind: KindReload})
+
+	require.Len(t, all, 3)
+	require.Len(t, allocs, 2)
+	require.Equal(t, "HeapAlloc", (<-allocs).ID)
+	require.Equal(t, KindReload, (<-allocs).Kind)
+
+	require.Error(t, Filter{Name: "["}.Validate())
+}
+
+func TestHubSlowSubscriber(t *testing.T) {
+	hub := NewHub()
+	stream, unsubscribe := hub.Subscribe(Filter{})
+	defer unsubscribe()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		hub.Publish(Event{Kind: KindReload})
+	}
+	require.False(t, hub.HasSubscribers())
+
+	// Канал отключённого подписчика закрыт после непрочитанных событий
+	for range stream {
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub()
+	stream, unsubscribe := hub.Subscribe(Filter{})
+	require.True(t, hub.HasSubscribers())
+
+	hub.Close()
+	_, ok := <-stream
+	require.False(t, ok)
+	unsubscribe()
+
+	stream, _ = hub.Subscribe(Filter{})
+	_, ok = <-stream
+	require.False(t, ok)
+	require.False(t, hub.HasSubscribers())
+}
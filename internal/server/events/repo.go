@@ -0,0 +1,144 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"metrics/internal/server/storage"
+)
+
+// Repo - хранилище, публикующее изменения метрик в Hub.
+// После записи значение серии перечитывается, чтобы событие содержало накопленное значение counter, histogram и summary.
+// Пока подписчиков нет, хранилище работает без дополнительных чтений.
+type Repo struct {
+	storage.MetricStorager
+	hub *Hub
+}
+
+// NewRepo - публикация изменений repo в hub.
+func NewRepo(repo storage.MetricStorager, hub *Hub) *Repo {
+	return &Repo{
+		MetricStorager: repo,
+		hub:            hub,
+	}
+}
+
+// publishUpdate - публикация текущего значения серии.
+func (repo *Repo) publishUpdate(ctx context.Context, key string, metricType string) {
+	if !repo.hub.HasSubscribers() {
+		return
+	}
+
+	value, err := repo.MetricStorager.Read(ctx, key, metricType)
+	if err != nil {
+		return
+	}
+
+	event := seriesEvent(KindUpdate, key, metricType)
+	event.Value = &value
+	event.Text = value.GetStringValue()
+	repo.hub.Publish(event)
+}
+
+// seriesEvent - событие серии key, имя и метки разбираются из ключа.
+func seriesEvent(kind string, key string, metricType string) Event {
+	id, labels, err := storage.ParseSeriesKey(key)
+	if err != nil {
+		id, labels = key, nil
+	}
+
+	return Event{
+		Kind:   kind,
+		Key:    key,
+		ID:     id,
+		Labels: labels,
+		MType:  metricType,
+	}
+}
+
+func (repo *Repo) Update(ctx context.Context, key string, value storage.MetricValue) error {
+	err := repo.MetricStorager.Update(ctx, key, value)
+	if err != nil {
+		return err
+	}
+
+	repo.publishUpdate(ctx, key, value.MType)
+	return nil
+}
+
+func (repo *Repo) UpdateManySliceMetric(ctx context.Context, MetricBatch []storage.Metric) error {
+	err := repo.MetricStorager.UpdateManySliceMetric(ctx, MetricBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, metric := range MetricBatch {
+		repo.publishUpdate(ctx, metric.SeriesKey(), metric.MType)
+	}
+	return nil
+}
+
+func (repo *Repo) UpdateMany(ctx context.Context, DBSchema map[string]storage.MetricValue) error {
+	err := repo.MetricStorager.UpdateMany(ctx, DBSchema)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range DBSchema {
+		repo.publishUpdate(ctx, key, value.MType)
+	}
+	return nil
+}
+
+func (repo *Repo) SetValues(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	err := repo.MetricStorager.SetValues(ctx, gauges, counters)
+	if err != nil {
+		return err
+	}
+
+	for key := range gauges {
+		repo.publishUpdate(ctx, key, storage.MeticTypeGauge)
+	}
+	for key := range counters {
+		repo.publishUpdate(ctx, key, storage.MeticTypeCounter)
+	}
+	return nil
+}
+
+func (repo *Repo) ResetCounter(ctx context.Context, key string) error {
+	err := repo.MetricStorager.ResetCounter(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	repo.publishUpdate(ctx, key, storage.MeticTypeCounter)
+	return nil
+}
+
+func (repo *Repo) Delete(ctx context.Context, key string, metricType string) error {
+	err := repo.MetricStorager.Delete(ctx, key, metricType)
+	if err != nil {
+		return err
+	}
+
+	repo.hub.Publish(seriesEvent(KindDelete, key, metricType))
+	return nil
+}
+
+func (repo *Repo) DeleteMatching(ctx context.Context, metricType string, pattern string) (int, error) {
+	deleted, err := repo.MetricStorager.DeleteMatching(ctx, metricType, pattern)
+	if deleted > 0 {
+		repo.hub.Publish(Event{Kind: KindReload})
+	}
+
+	return deleted, err
+}
+
+func (repo *Repo) Expire(ctx context.Context, before time.Time) (int, error) {
+	expired, err := repo.MetricStorager.Expire(ctx, before)
+	if expired > 0 {
+		repo.hub.Publish(Event{Kind: KindReload})
+	}
+
+	return expired, err
+}
@@ -0,0 +1,63 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/config"
+	"metrics/internal/server/storage"
+)
+
+func TestRepoPublish(t *testing.T) {
+	ctx := context.Background()
+	hub := NewHub()
+	repo := NewRepo(storage.NewMetricsMemoryRepo(config.StoreConfig{}), hub)
+	delta := int64(5)
+
+	// Без подписчиков запись проходит без событий
+	require.NoError(t, repo.Update(ctx, "PollCount", storage.MetricValue{MType: storage.MeticTypeCounter, Delta: &delta}))
+
+	stream, unsubscribe := hub.Subscribe(Filter{})
+	defer unsubscribe()
+
+	key := storage.SeriesKey("PollCount", storage.Labels{storage.SourceLabel: "web-1"})
+	require.NoError(t, repo.UpdateManySliceMetric(ctx, []storage.Metric{{
+		ID:          "PollCount",
+		Labels:      storage.Labels{storage.SourceLabel: "web-1"},
+		MetricValue: storage.MetricValue{MType: storage.MeticTypeCounter, Delta: &delta},
+	}}))
+	require.NoError(t, repo.Update(ctx, key, storage.MetricValue{MType: storage.MeticTypeCounter, Delta: &delta}))
+
+	// Событие содержит накопленное значение counter
+	event := <-stream
+	require.Equal(t, KindUpdate, event.Kind)
+	require.Equal(t, key, event.Key)
+	require.Equal(t, "PollCount", event.ID)
+	require.Equal(t, storage.Labels{storage.SourceLabel: "web-1"}, event.Labels)
+	require.Equal(t, "5", event.Text)
+	event = <-stream
+	require.Equal(t, "10", event.Text)
+
+	require.NoError(t, repo.ResetCounter(ctx, key))
+	require.Equal(t, "0", (<-stream).Text)
+
+	require.NoError(t, repo.Delete(ctx, key, storage.MeticTypeCounter))
+	event = <-stream
+	require.Equal(t, KindDelete, event.Kind)
+	require.Nil(t, event.Value)
+
+	// Неудачная запись не публикуется
+	require.Error(t, repo.Delete(ctx, key, storage.MeticTypeCounter))
+
+	deleted, err := repo.DeleteMatching(ctx, storage.MeticTypeCounter, "Poll*")
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+	require.Equal(t, KindReload, (<-stream).Kind)
+
+	expired, err := repo.Expire(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 0, expired)
+	require.Len(t, stream, 0)
+}
@@ -0,0 +1,268 @@
+// Package exposition - вывод метрик хранилища в текстовых форматах Prometheus и OpenMetrics.
+package exposition
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"metrics/internal/server/storage"
+)
+
+// Format - формат вывода метрик.
+type Format int
+
+const (
+	// FormatPrometheus - текстовый формат Prometheus 0.0.4
+	FormatPrometheus Format = iota
+	// FormatOpenMetrics - формат OpenMetrics 1.0.0
+	FormatOpenMetrics
+)
+
+// ContentType - значение заголовка Content-Type ответа в формате format.
+func (format Format) ContentType() string {
+	if format == FormatOpenMetrics {
+		return "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	}
+
+	return "text/plain; version=0.0.4; charset=utf-8"
+}
+
+// metricTypes - порядок типов: при совпадении имён после приведения выводится метрика первого типа
+var metricTypes = []string{storage.MeticTypeGauge, storage.MeticTypeCounter, storage.MeticTypeHistogram, storage.MeticTypeSummary}
+
+type series struct {
+	labels storage.Labels
+	value  storage.MetricValue
+}
+
+// family - метрики одного имени и типа, для них выводится одна строка # TYPE.
+// seen - метки уже добавленных серий после приведения имён меток.
+type family struct {
+	name   string
+	mType  string
+	series []series
+	seen   map[string]struct{}
+}
+
+// Write - вывод всех метрик allValues в формате format.
+// Имена метрик и меток приводятся к допустимым в Prometheus заменой недопустимых символов на "_".
+// В OpenMetrics имя семейства counter выводится без суффикса _total, а имена значений - с ним.
+// Если имена метрик разных типов после приведения совпадают, выводится только метрика первого из типов gauge, counter, histogram, summary.
+// Если после приведения совпадают имя и метки серий одного типа (например, a.b и a_b), выводится серия с меньшим ключом.
+func Write(w io.Writer, allValues map[string]storage.MetricMap, format Format) error {
+	families := make(map[string]*family)
+	for _, metricType := range metricTypes {
+		keys := make([]string, 0, len(allValues[metricType]))
+		for key := range allValues[metricType] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			value := allValues[metricType][key]
+			id, labels, err := storage.ParseSeriesKey(key)
+			if err != nil {
+				continue
+			}
+
+			name := SanitizeName(id)
+			if format == FormatOpenMetrics && metricType == storage.MeticTypeCounter {
+				name = strings.TrimSuffix(name, "_total")
+			}
+
+			metricFamily, ok := families[name]
+			if !ok {
+				metricFamily = &family{name: name, mType: metricType, seen: make(map[string]struct{})}
+				families[name] = metricFamily
+			}
+			if metricFamily.mType != metricType {
+				continue
+			}
+
+			labels = sanitizeLabels(labels)
+			labelsKey := labels.String()
+			if _, ok := metricFamily.seen[labelsKey]; ok {
+				continue
+			}
+			metricFamily.seen[labelsKey] = struct{}{}
+			metricFamily.series = append(metricFamily.series, series{labels: labels, value: value})
+		}
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buffer := bufio.NewWriter(w)
+	for _, name := range names {
+		writeFamily(buffer, families[name], format)
+	}
+	if format == FormatOpenMetrics {
+		buffer.WriteString("# EOF\n")
+	}
+
+	return buffer.Flush()
+}
+
+// writeFamily - строка # TYPE и значения всех серий семейства.
+func writeFamily(w *bufio.Writer, metricFamily *family, format Format) {
+	sort.Slice(metricFamily.series, func(i, j int) bool {
+		return metricFamily.series[i].labels.String() < metricFamily.series[j].labels.String()
+	})
+
+	w.WriteString("# TYPE " + metricFamily.name + " " + metricFamily.mType + "\n")
+
+	for _, one := range metricFamily.series {
+		value := one.value
+		switch metricFamily.mType {
+		case storage.MeticTypeGauge:
+			if value.Value != nil {
+				writeSample(w, metricFamily.name, one.labels, "", "", formatFloat(*value.Value))
+			}
+		case storage.MeticTypeCounter:
+			name := metricFamily.name
+			if format == FormatOpenMetrics {
+				name += "_total"
+			}
+			if value.Delta != nil {
+				writeSample(w, name, one.labels, "", "", strconv.FormatInt(*value.Delta, 10))
+			}
+		case storage.MeticTypeHistogram:
+			if value.Histogram != nil {
+				writeHistogram(w, metricFamily.name, one.labels, *value.Histogram)
+			}
+		case storage.MeticTypeSummary:
+			if value.Summary != nil {
+				for _, quantile := range value.Summary.Quantiles {
+					writeSample(w, metricFamily.name, one.labels, "quantile", formatFloat(quantile.Quantile), formatFloat(quantile.Value))
+				}
+				writeSample(w, metricFamily.name+"_sum", one.labels, "", "", formatFloat(value.Summary.Sum))
+				writeSample(w, metricFamily.name+"_count", one.labels, "", "", strconv.FormatUint(value.Summary.Count, 10))
+			}
+		}
+	}
+}
+
+// writeHistogram - интервалы гистограммы с накопленным количеством наблюдений, сумма и количество.
+func writeHistogram(w *bufio.Writer, name string, labels storage.Labels, histogram storage.HistogramValue) {
+	var cumulative uint64
+	for i, bucket := range histogram.Buckets {
+		if i < len(histogram.Counts) {
+			cumulative += histogram.Counts[i]
+		}
+		writeSample(w, name+"_bucket", labels, "le", formatFloat(bucket), strconv.FormatUint(cumulative, 10))
+	}
+	writeSample(w, name+"_bucket", labels, "le", "+Inf", strconv.FormatUint(histogram.Count, 10))
+	writeSample(w, name+"_sum", labels, "", "", formatFloat(histogram.Sum))
+	writeSample(w, name+"_count", labels, "", "", strconv.FormatUint(histogram.Count, 10))
+}
+
+// sanitizeLabels - метки с именами, допустимыми в Prometheus. Если имена совпали после приведения, остаётся метка с меньшим исходным именем.
+func sanitizeLabels(labels storage.Labels) storage.Labels {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make(storage.Labels, len(labels))
+	for _, name := range names {
+		sanitized := SanitizeLabelName(name)
+		if _, ok := result[sanitized]; !ok {
+			result[sanitized] = labels[name]
+		}
+	}
+
+	return result
+}
+
+// writeSample - строка значения: имя, метки серии и дополнительная метка extraName (le, quantile), если она задана.
+func writeSample(w *bufio.Writer, name string, labels storage.Labels, extraName, extraValue, value string) {
+	w.WriteString(name)
+
+	labelNames := make([]string, 0, len(labels))
+	for labelName := range labels {
+		if labelName != extraName {
+			labelNames = append(labelNames, labelName)
+		}
+	}
+	sort.Strings(labelNames)
+
+	if len(labelNames) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, labelName := range labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, labelName, labels[labelName])
+		}
+		if extraName != "" {
+			if len(labelNames) > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteString(" " + value + "\n")
+}
+
+// labelValueReplacer - экранирование значений меток
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeLabel(w *bufio.Writer, name, value string) {
+	w.WriteString(name + `="` + labelValueReplacer.Replace(value) + `"`)
+}
+
+// formatFloat - число в записи Prometheus: +Inf, -Inf, NaN или кратчайшая десятичная запись.
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+// SanitizeName - имя метрики, допустимое в Prometheus ([a-zA-Z_:][a-zA-Z0-9_:]*).
+func SanitizeName(name string) string {
+	return sanitize(name, true)
+}
+
+// SanitizeLabelName - имя метки, допустимое в Prometheus ([a-zA-Z_][a-zA-Z0-9_]*).
+func SanitizeLabelName(name string) string {
+	return sanitize(name, false)
+}
+
+// sanitize - замена недопустимых символов на "_", имя, начинающееся с цифры, дополняется "_" в начале.
+func sanitize(name string, allowColon bool) string {
+	if name == "" {
+		return "_"
+	}
+
+	var builder strings.Builder
+	if name[0] >= '0' && name[0] <= '9' {
+		builder.WriteByte('_')
+	}
+	for _, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', allowColon && r == ':':
+			builder.WriteRune(r)
+		default:
+			builder.WriteByte('_')
+		}
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,147 @@
+package exposition
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/storage"
+)
+
+func gauge(value float64) storage.MetricValue {
+	return storage.MetricValue{MType: storage.MeticTypeGauge, Value: &value}
+}
+
+func counter(delta int64) storage.MetricValue {
+	return storage.MetricValue{MType: storage.MeticTypeCounter, Delta: &delta}
+}
+
+func testValues() map[string]storage.MetricMap {
+	histogram := storage.NewHistogramValue([]float64{0.1, 1})
+	for _, value := range []float64{0.05, 0.5, 0.5, 5} {
+		histogram.Observe(value)
+	}
+
+	return map[string]storage.MetricMap{
+		storage.MeticTypeGauge: {
+			"Alloc": gauge(1.5),
+			storage.SeriesKey("cpu.usage", storage.Labels{"core": "1"}): gauge(math.Inf(1)),
+			storage.SeriesKey("cpu.usage", storage.Labels{"core": "0"}): gauge(0.25),
+		},
+		storage.MeticTypeCounter: {
+			"requests_total": counter(7),
+			storage.SeriesKey("PollCount", storage.Labels{"path": `C:\tmp "x"`}): counter(3),
+		},
+		storage.MeticTypeHistogram: {
+			"latency": {MType: storage.MeticTypeHistogram, Histogram: histogram},
+		},
+		storage.MeticTypeSummary: {
+			"size": {MType: storage.MeticTypeSummary, Summary: &storage.SummaryValue{
+				Quantiles: []storage.Quantile{{Quantile: 0.5, Value: 2}, {Quantile: 0.99, Value: 10}},
+				Sum:       30,
+				Count:     6,
+			}},
+		},
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	var buffer bytes.Buffer
+	require.NoError(t, Write(&buffer, testValues(), FormatPrometheus))
+
+	require.Equal(t, `# TYPE Alloc gauge
+Alloc 1.5
+# TYPE PollCount counter
+PollCount{path="C:\\tmp \"x\""} 3
+# TYPE cpu_usage gauge
+cpu_usage{core="0"} 0.25
+cpu_usage{core="1"} +Inf
+# TYPE latency histogram
+latency_bucket{le="0.1"} 1
+latency_bucket{le="1"} 3
+latency_bucket{le="+Inf"} 4
+latency_sum 6.05
+latency_count 4
+# TYPE requests_total counter
+requests_total 7
+# TYPE size summary
+size{quantile="0.5"} 2
+size{quantile="0.99"} 10
+size_sum 30
+size_count 6
+`, buffer.String())
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	values := map[string]storage.MetricMap{
+		storage.MeticTypeCounter: {
+			"requests_total": counter(7),
+			storage.SeriesKey("PollCount", storage.Labels{"agent.id": "a-1"}): counter(3),
+		},
+	}
+
+	var buffer bytes.Buffer
+	require.NoError(t, Write(&buffer, values, FormatOpenMetrics))
+
+	require.Equal(t, `# TYPE PollCount counter
+PollCount_total{agent_id="a-1"} 3
+# TYPE requests counter
+requests_total 7
+# EOF
+`, buffer.String())
+}
+
+func TestWriteNameCollision(t *testing.T) {
+	values := map[string]storage.MetricMap{
+		storage.MeticTypeGauge:   {"cpu.usage": gauge(1)},
+		storage.MeticTypeCounter: {"cpu_usage": counter(2)},
+	}
+
+	var buffer bytes.Buffer
+	require.NoError(t, Write(&buffer, values, FormatPrometheus))
+	require.Equal(t, "# TYPE cpu_usage gauge\ncpu_usage 1\n", buffer.String())
+
+	buffer.Reset()
+	require.NoError(t, Write(&buffer, map[string]storage.MetricMap{}, FormatOpenMetrics))
+	require.Equal(t, "# EOF\n", buffer.String())
+}
+
+func TestWriteSeriesCollision(t *testing.T) {
+	values := map[string]storage.MetricMap{
+		storage.MeticTypeGauge: {
+			"a_b": gauge(2),
+			"a.b": gauge(1),
+			storage.SeriesKey("a.b", storage.Labels{"host": "x"}): gauge(3),
+			storage.SeriesKey("a_b", storage.Labels{"host": "x"}): gauge(4),
+		},
+	}
+
+	// Из совпавших после приведения серий выводится серия с меньшим ключом, на любом запуске
+	for i := 0; i < 10; i++ {
+		var buffer bytes.Buffer
+		require.NoError(t, Write(&buffer, values, FormatPrometheus))
+		require.Equal(t, "# TYPE a_b gauge\na_b 1\na_b{host=\"x\"} 3\n", buffer.String())
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric string
+		label  string
+	}{
+		{name: "Alloc", metric: "Alloc", label: "Alloc"},
+		{name: "http:requests", metric: "http:requests", label: "http_requests"},
+		{name: "cpu.usage-total", metric: "cpu_usage_total", label: "cpu_usage_total"},
+		{name: "1st", metric: "_1st", label: "_1st"},
+		{name: "память", metric: "______", label: "______"},
+		{name: "", metric: "_", label: "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.metric, SanitizeName(tt.name))
+			require.Equal(t, tt.label, SanitizeLabelName(tt.name))
+		})
+	}
+}
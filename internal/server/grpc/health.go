@@ -0,0 +1,64 @@
+package grpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"metrics/internal/server/storage"
+	pb "metrics/proto"
+)
+
+// Health - стандартный сервис проверки состояния gRPC (grpc.health.v1), состояние определяется Ping хранилища.
+// Состояние сервера ("") и сервиса метрик совпадают. Check проверяет хранилище при каждом запросе,
+// для подписчиков Watch состояние обновляет Run.
+type Health struct {
+	*health.Server
+	storage storage.MetricStorager
+}
+
+func NewHealth(storage storage.MetricStorager) *Health {
+	return &Health{
+		Server:  health.NewServer(),
+		storage: storage,
+	}
+}
+
+// update - проверка хранилища и обновление состояния.
+func (h *Health) update(ctx context.Context) {
+	servingStatus := healthpb.HealthCheckResponse_SERVING
+	if err := h.storage.Ping(ctx); err != nil {
+		servingStatus = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	h.SetServingStatus("", servingStatus)
+	h.SetServingStatus(pb.Metrics_ServiceDesc.ServiceName, servingStatus)
+}
+
+func (h *Health) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if in.Service == "" || in.Service == pb.Metrics_ServiceDesc.ServiceName {
+		h.update(ctx)
+	}
+
+	return h.Server.Check(ctx, in)
+}
+
+// Run - проверка хранилища каждые interval до отмены ctx.
+// При отмене сервер переходит в состояние NOT_SERVING до остановки, чтобы балансировщики перестали направлять запросы.
+func (h *Health) Run(ctx context.Context, interval time.Duration) {
+	h.update(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			h.Shutdown()
+			return
+		case <-ticker.C:
+			h.update(ctx)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"metrics/internal/server/config"
+	"metrics/internal/server/storage"
+	pb "metrics/proto"
+)
+
+// pingRepo - хранилище, Ping которого возвращает ошибку, пока down не равен 0.
+type pingRepo struct {
+	storage.MetricStorager
+	down int32
+}
+
+func (repo *pingRepo) Ping(context.Context) error {
+	if atomic.LoadInt32(&repo.down) != 0 {
+		return errors.New("database is down")
+	}
+	return nil
+}
+
+func TestHealth(t *testing.T) {
+	repo := &pingRepo{MetricStorager: storage.NewMetricsMemoryRepo(config.StoreConfig{})}
+	healthServer := NewHealth(repo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		healthServer.Run(ctx, time.Hour)
+		close(stopped)
+	}()
+
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		response, err := healthServer.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		return response.Status
+	}
+
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, check(""))
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, check(pb.Metrics_ServiceDesc.ServiceName))
+
+	// Состояние проверяется при каждом запросе, не дожидаясь интервала Run
+	atomic.StoreInt32(&repo.down, 1)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(""))
+	atomic.StoreInt32(&repo.down, 0)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, check(""))
+
+	_, err := healthServer.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	// После остановки сервер не обслуживает запросы, даже если хранилище доступно
+	cancel()
+	<-stopped
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(""))
+}
@@ -0,0 +1,67 @@
+package grpc
+
+import (
+	"context"
+	"crypto/x509"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"metrics/internal/server/agents"
+)
+
+// Identity - клиент gRPC, подтвердивший подлинность сертификатом при mTLS.
+type Identity struct {
+	// CommonName - CN сертификата, идентификатор агента
+	CommonName string
+	// Organizations - организации субъекта сертификата, например для разделения прав групп клиентов
+	Organizations []string
+	// DNSNames - DNS имена сертификата
+	DNSNames []string
+	// Certificate - проверенный сертификат клиента
+	Certificate *x509.Certificate
+}
+
+// IdentityFromContext - клиент запроса по сертификату mTLS,
+// false - соединение без TLS или клиент не предъявил проверенный сертификат.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return Identity{}, false
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return Identity{}, false
+	}
+
+	certificate := tlsInfo.State.VerifiedChains[0][0]
+	return Identity{
+		CommonName:    certificate.Subject.CommonName,
+		Organizations: certificate.Subject.Organization,
+		DNSNames:      certificate.DNSNames,
+		Certificate:   certificate,
+	}, true
+}
+
+// sourceFromContext - источник запроса. Идентификатор агента с сертификатом mTLS - CN сертификата,
+// запрос с идентификатором x-agent-id другого агента отклоняется.
+func sourceFromContext(ctx context.Context) (agents.Source, error) {
+	source := agents.SourceFromContext(ctx)
+
+	identity, ok := IdentityFromContext(ctx)
+	if !ok || identity.CommonName == "" {
+		return source, nil
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(agents.MetadataAgentID); len(values) > 0 && values[0] != identity.CommonName {
+			return source, status.Errorf(codes.PermissionDenied, "agent id %q does not match client certificate %q", values[0], identity.CommonName)
+		}
+	}
+	source.ID = identity.CommonName
+
+	return source, nil
+}
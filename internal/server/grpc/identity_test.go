@@ -0,0 +1,68 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"metrics/internal/server/agents"
+	"metrics/internal/server/config"
+	"metrics/internal/server/events"
+	"metrics/internal/server/storage"
+	"metrics/internal/tlsconfig"
+	pb "metrics/proto"
+)
+
+func TestMutualTLSIdentity(t *testing.T) {
+	serverTLS, err := tlsconfig.Server("../../tlsconfig/testdata/server.crt", "../../tlsconfig/testdata/server.key", "../../tlsconfig/testdata/ca.crt")
+	require.NoError(t, err)
+	clientTLS, err := tlsconfig.Client("../../tlsconfig/testdata/ca.crt", "../../tlsconfig/testdata/client.crt", "../../tlsconfig/testdata/client.key", "localhost")
+	require.NoError(t, err)
+
+	repo := storage.NewMetricsMemoryRepo(config.StoreConfig{})
+	hub := events.NewHub()
+	listener := bufconn.Listen(1024 * 1024)
+	serverGRPC := grpc.NewServer(grpc.Creds(credentials.NewTLS(serverTLS)))
+	pb.RegisterMetricsServer(serverGRPC, NewMetricsService(events.NewRepo(repo, hub), agents.NewRegistry(time.Minute), hub))
+	go serverGRPC.Serve(listener)
+	defer serverGRPC.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewMetricsClient(conn)
+
+	request := &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{gaugeMetric("Alloc", 1, nil)}}
+
+	// Агент определяется по CN сертификата
+	_, err = client.UpdateMetrics(context.Background(), request)
+	require.NoError(t, err)
+	_, err = repo.Read(context.Background(), storage.SeriesKey("Alloc", storage.Labels{storage.SourceLabel: "agent-1"}), storage.MeticTypeGauge)
+	require.NoError(t, err)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), agents.MetadataAgentID, "agent-1")
+	_, err = client.UpdateMetrics(ctx, request)
+	require.NoError(t, err)
+
+	// Агент не может отправлять метрики от имени другого агента
+	ctx = metadata.AppendToOutgoingContext(context.Background(), agents.MetadataAgentID, "agent-2")
+	_, err = client.UpdateMetrics(ctx, request)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err := client.UploadMetrics(ctx)
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
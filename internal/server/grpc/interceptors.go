@@ -0,0 +1,204 @@
+package grpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"log"
+	"net"
+	"runtime/debug"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"metrics/internal/server/agents"
+	pb "metrics/proto"
+)
+
+// Interceptors - цепочки перехватчиков запросов gRPC, повторяющие middleware HTTP сервера:
+// восстановление после паники, журнал запросов, учёт запросов в stats, доверенная подсеть и проверка подписи метрик.
+// Пустой trustedSubNet не ограничивает клиентов, пустой signKey отключает проверку подписи, nil stats - запросы не учитываются.
+func Interceptors(trustedSubNet string, signKey string, stats *Stats) ([]grpc.ServerOption, error) {
+	unary := []grpc.UnaryServerInterceptor{recoveryUnaryInterceptor, loggingUnaryInterceptor}
+	stream := []grpc.StreamServerInterceptor{recoveryStreamInterceptor, loggingStreamInterceptor}
+
+	// Отклонённые подсетью и подписью запросы тоже учитываются
+	if stats != nil {
+		unary = append(unary, stats.unaryInterceptor)
+		stream = append(stream, stats.streamInterceptor)
+	}
+
+	if trustedSubNet != "" {
+		_, subnet, err := net.ParseCIDR(trustedSubNet)
+		if err != nil {
+			return nil, err
+		}
+		unary = append(unary, subnetUnaryInterceptor(subnet))
+		stream = append(stream, subnetStreamInterceptor(subnet))
+	}
+
+	if signKey != "" {
+		unary = append(unary, signUnaryInterceptor(signKey))
+		stream = append(stream, signStreamInterceptor(signKey))
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}, nil
+}
+
+// recoverPanic - паника обработчика в виде ошибки Internal, стек пишется в журнал.
+func recoverPanic(method string, err *error) {
+	if recovered := recover(); recovered != nil {
+		log.Printf("gRPC %s panic: %v\n%s", method, recovered, debug.Stack())
+		*err = status.Errorf(codes.Internal, "internal error")
+	}
+}
+
+func recoveryUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer recoverPanic(info.FullMethod, &err)
+	return handler(ctx, req)
+}
+
+func recoveryStreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer recoverPanic(info.FullMethod, &err)
+	return handler(srv, stream)
+}
+
+// logRequest - запись о запросе в журнал: метод, источник, код ответа и длительность.
+func logRequest(ctx context.Context, method string, start time.Time, err error) {
+	source := agents.SourceFromContext(ctx)
+	log.Printf("gRPC %s from %s (%s) - %s in %v\n", method, source.ID, source.Address, status.Code(err), time.Since(start))
+}
+
+func loggingUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logRequest(ctx, info.FullMethod, start, err)
+
+	return resp, err
+}
+
+func loggingStreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, stream)
+	logRequest(stream.Context(), info.FullMethod, start, err)
+
+	return err
+}
+
+// checkSubnet - адрес клиента (x-real-ip, затем адрес соединения) входит в доверенную подсеть.
+func checkSubnet(ctx context.Context, subnet *net.IPNet) error {
+	clientIP := net.ParseIP(agents.SourceFromContext(ctx).Address)
+	if clientIP == nil {
+		return status.Errorf(codes.PermissionDenied, "unknown client IP")
+	}
+	if !subnet.Contains(clientIP) {
+		return status.Errorf(codes.PermissionDenied, "client IP is not in trusted subnet")
+	}
+
+	return nil
+}
+
+func subnetUnaryInterceptor(subnet *net.IPNet) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		err := checkSubnet(ctx, subnet)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func subnetStreamInterceptor(subnet *net.IPNet) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := checkSubnet(stream.Context(), subnet)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, stream)
+	}
+}
+
+// verifyHashes - проверка подписи каждой метрики запроса с метриками, остальные запросы не проверяются.
+func verifyHashes(req interface{}, signKey string) error {
+	var metrics []*pb.Metric
+	switch request := req.(type) {
+	case *pb.UpdateMetricsRequest:
+		metrics = request.Metrics
+	case *pb.UploadRequest:
+		metrics = request.Metrics
+	default:
+		return nil
+	}
+
+	for _, metric := range metrics {
+		metricBatch, err := metricsFromProto([]*pb.Metric{metric})
+		if err != nil {
+			return err
+		}
+
+		requestHash, err := hex.DecodeString(protoMetricHash(metric))
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, err.Error())
+		}
+		if !hmac.Equal(requestHash, metricBatch[0].GetHash(metricBatch[0].SeriesKey(), signKey)) {
+			return status.Errorf(codes.InvalidArgument, "invalid hash of metric %s", metricBatch[0].ID)
+		}
+	}
+
+	return nil
+}
+
+// protoMetricHash - подпись метрики запроса.
+func protoMetricHash(metric *pb.Metric) string {
+	switch metricOne := metric.Metric.(type) {
+	case *pb.Metric_Gauge:
+		return metricOne.Gauge.Hash
+	case *pb.Metric_Counter:
+		return metricOne.Counter.Hash
+	case *pb.Metric_Histogram:
+		return metricOne.Histogram.Hash
+	case *pb.Metric_Summary:
+		return metricOne.Summary.Hash
+	default:
+		return ""
+	}
+}
+
+func signUnaryInterceptor(signKey string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		err := verifyHashes(req, signKey)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// signedServerStream - поток, проверяющий подпись метрик каждого входящего сообщения.
+// Сообщение с неверной подписью завершает поток ошибкой.
+type signedServerStream struct {
+	grpc.ServerStream
+	signKey string
+}
+
+func (stream *signedServerStream) RecvMsg(m interface{}) error {
+	err := stream.ServerStream.RecvMsg(m)
+	if err != nil {
+		return err
+	}
+
+	return verifyHashes(m, stream.signKey)
+}
+
+func signStreamInterceptor(signKey string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &signedServerStream{ServerStream: stream, signKey: signKey})
+	}
+}
@@ -0,0 +1,102 @@
+package grpc
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"metrics/internal/server/agents"
+	"metrics/internal/server/config"
+	"metrics/internal/server/events"
+	"metrics/internal/server/storage"
+	pb "metrics/proto"
+)
+
+// panicService - сервис, паникующий при записи метрик.
+type panicService struct {
+	pb.UnimplementedMetricsServer
+}
+
+func (panicService) UpdateMetrics(context.Context, *pb.UpdateMetricsRequest) (*pb.Empty, error) {
+	panic("update failed")
+}
+
+func TestSubnetInterceptor(t *testing.T) {
+	options, err := Interceptors("10.0.0.0/8", "", nil)
+	require.NoError(t, err)
+	client := newTestClient(t, storage.NewMetricsMemoryRepo(config.StoreConfig{}), events.NewHub(), options...)
+
+	request := &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{gaugeMetric("Alloc", 1, nil)}}
+
+	// Адрес соединения bufconn - не IP адрес
+	_, err = client.UpdateMetrics(context.Background(), request)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), agents.MetadataRealIP, "10.1.2.3")
+	_, err = client.UpdateMetrics(ctx, request)
+	require.NoError(t, err)
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), agents.MetadataRealIP, "192.168.1.1")
+	_, err = client.UpdateMetrics(ctx, request)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err := client.UploadMetrics(ctx)
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = Interceptors("10.0.0.0", "", nil)
+	require.Error(t, err)
+}
+
+func TestSignInterceptor(t *testing.T) {
+	const signKey = "secret"
+
+	options, err := Interceptors("", signKey, nil)
+	require.NoError(t, err)
+	client := newTestClient(t, storage.NewMetricsMemoryRepo(config.StoreConfig{}), events.NewHub(), options...)
+
+	value := 1.5
+	hash := storage.MetricValue{MType: storage.MeticTypeGauge, Value: &value}.GetHash(`Alloc{host="a"}`, signKey)
+	signed := &pb.Metric{Metric: &pb.Metric_Gauge{Gauge: &pb.MetricGauge{
+		Id:     "Alloc",
+		Value:  value,
+		Labels: map[string]string{"host": "a"},
+		Hash:   hex.EncodeToString(hash),
+	}}}
+
+	_, err = client.UpdateMetrics(context.Background(), &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{signed}})
+	require.NoError(t, err)
+
+	unsigned := gaugeMetric("Alloc", 2, nil)
+	_, err = client.UpdateMetrics(context.Background(), &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{signed, unsigned}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Пачка с неверной подписью завершает поток
+	stream, err := client.UploadMetrics(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.UploadRequest{Session: "s1", Sequence: 1, Metrics: []*pb.Metric{signed}}))
+	ack, err := stream.Recv()
+	require.NoError(t, err)
+	require.EqualValues(t, codes.OK, ack.Code)
+
+	require.NoError(t, stream.Send(&pb.UploadRequest{Session: "s1", Sequence: 2, Metrics: []*pb.Metric{unsigned}}))
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestRecoveryInterceptor(t *testing.T) {
+	options, err := Interceptors("", "", nil)
+	require.NoError(t, err)
+	client := newTestServiceClient(t, panicService{}, options...)
+
+	// Паника обработчика не останавливает сервер
+	for i := 0; i < 2; i++ {
+		_, err = client.UpdateMetrics(context.Background(), &pb.UpdateMetricsRequest{})
+		require.Equal(t, codes.Internal, status.Code(err))
+	}
+}
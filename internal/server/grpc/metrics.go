@@ -2,37 +2,92 @@ package grpc
 
 import (
 	"context"
+	"errors"
+	"path"
+	"time"
 
 	"github.com/asaskevich/govalidator"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"metrics/internal/server/agents"
+	"metrics/internal/server/events"
 	"metrics/internal/server/storage"
 	pb "metrics/proto"
 )
 
 type MetricsService struct {
 	storage storage.MetricStorager
+	agents  *agents.Registry
+	uploads *uploadSessions
+	events  *events.Hub
 	pb.UnimplementedMetricsServer
 }
 
-func NewMetricsService(storage storage.MetricStorager) *MetricsService {
+// NewMetricsService - сервис метрик поверх storage, WatchMetrics получает изменения из hub.
+func NewMetricsService(storage storage.MetricStorager, agents *agents.Registry, hub *events.Hub) *MetricsService {
 	return &MetricsService{
 		storage: storage,
+		agents:  agents,
+		uploads: newUploadSessions(),
+		events:  hub,
 	}
 }
 
 func (s *MetricsService) UpdateMetrics(ctx context.Context, in *pb.UpdateMetricsRequest) (*pb.Empty, error) {
-	var MetricBatch []storage.Metric
+	source, err := sourceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.updateMetrics(ctx, source, in.Metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Empty{}, nil
+}
+
+// updateMetrics - запись пачки метрик источника source, ошибки возвращаются статусами gRPC.
+func (s *MetricsService) updateMetrics(ctx context.Context, source agents.Source, metrics []*pb.Metric) error {
+	if len(metrics) == 0 {
+		return status.Errorf(codes.OutOfRange, "empty metric list")
+	}
+
+	MetricBatch, err := metricsFromProto(metrics)
+	if err != nil {
+		return err
+	}
+
+	//Validation
+	for _, OneMetric := range MetricBatch {
+		_, err = govalidator.ValidateStruct(OneMetric)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	for i := range MetricBatch {
+		MetricBatch[i].Labels = MetricBatch[i].Labels.With(storage.SourceLabel, source.ID)
+	}
 
-	if len(in.Metrics) == 0 {
-		return nil, status.Errorf(codes.OutOfRange, "empty metric list")
+	err = s.storage.UpdateManySliceMetric(ctx, MetricBatch)
+	if err != nil {
+		return storageError(err)
 	}
+	s.agents.Seen(source, time.Now())
 
-	for _, metric := range in.Metrics {
+	return nil
+}
+
+// metricsFromProto - метрики запроса gRPC в формате хранилища.
+func metricsFromProto(metrics []*pb.Metric) ([]storage.Metric, error) {
+	MetricBatch := make([]storage.Metric, 0, len(metrics))
+	for _, metric := range metrics {
 		switch metricOne := metric.Metric.(type) {
 		case *pb.Metric_Gauge:
 			MetricBatch = append(MetricBatch, storage.Metric{
-				ID: metricOne.Gauge.Id,
+				ID:     metricOne.Gauge.Id,
+				Labels: metricOne.Gauge.Labels,
 				MetricValue: storage.MetricValue{
 					MType: storage.MeticTypeGauge,
 					Value: &metricOne.Gauge.Value,
@@ -40,30 +95,120 @@ func (s *MetricsService) UpdateMetrics(ctx context.Context, in *pb.UpdateMetrics
 			})
 		case *pb.Metric_Counter:
 			MetricBatch = append(MetricBatch, storage.Metric{
-				ID: metricOne.Counter.Id,
+				ID:     metricOne.Counter.Id,
+				Labels: metricOne.Counter.Labels,
 				MetricValue: storage.MetricValue{
 					MType: storage.MeticTypeCounter,
 					Delta: &metricOne.Counter.Delta,
 				},
 			})
+		case *pb.Metric_Histogram:
+			MetricBatch = append(MetricBatch, storage.Metric{
+				ID:     metricOne.Histogram.Id,
+				Labels: metricOne.Histogram.Labels,
+				MetricValue: storage.MetricValue{
+					MType: storage.MeticTypeHistogram,
+					Histogram: &storage.HistogramValue{
+						Buckets: metricOne.Histogram.Buckets,
+						Counts:  metricOne.Histogram.Counts,
+						Sum:     metricOne.Histogram.Sum,
+						Count:   metricOne.Histogram.Count,
+					},
+				},
+			})
+		case *pb.Metric_Summary:
+			quantiles := make([]storage.Quantile, 0, len(metricOne.Summary.Quantiles))
+			for _, quantile := range metricOne.Summary.Quantiles {
+				quantiles = append(quantiles, storage.Quantile{
+					Quantile: quantile.Quantile,
+					Value:    quantile.Value,
+				})
+			}
+
+			MetricBatch = append(MetricBatch, storage.Metric{
+				ID:     metricOne.Summary.Id,
+				Labels: metricOne.Summary.Labels,
+				MetricValue: storage.MetricValue{
+					MType: storage.MeticTypeSummary,
+					Summary: &storage.SummaryValue{
+						Quantiles: quantiles,
+						Sum:       metricOne.Summary.Sum,
+						Count:     metricOne.Summary.Count,
+					},
+				},
+			})
 		default:
 			return nil, status.Errorf(codes.InvalidArgument, "unknown metric type")
 		}
 	}
 
-	//Validation
-	var err error
-	for _, OneMetric := range MetricBatch {
-		_, err = govalidator.ValidateStruct(OneMetric)
-		if err != nil {
-			return nil, status.Errorf(codes.InvalidArgument, err.Error())
-		}
+	return MetricBatch, nil
+}
+
+func (s *MetricsService) DeleteMetric(ctx context.Context, in *pb.DeleteMetricRequest) (*pb.Empty, error) {
+	labels := storage.Labels(in.Labels)
+	if err := labels.Validate(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	err := s.storage.Delete(ctx, storage.SeriesKey(in.Id, labels), in.Type)
+	if err != nil {
+		return nil, storageError(err)
+	}
+
+	return &pb.Empty{}, nil
+}
+
+func (s *MetricsService) DeleteMetrics(ctx context.Context, in *pb.DeleteMetricsRequest) (*pb.DeleteMetricsResponse, error) {
+	if in.Pattern == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "empty pattern")
 	}
 
-	err = s.storage.UpdateManySliceMetric(MetricBatch)
+	deleted, err := s.storage.DeleteMatching(ctx, in.Type, in.Pattern)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, storageError(err)
+	}
+
+	return &pb.DeleteMetricsResponse{Deleted: int64(deleted)}, nil
+}
+
+func (s *MetricsService) ResetCounter(ctx context.Context, in *pb.ResetCounterRequest) (*pb.Empty, error) {
+	labels := storage.Labels(in.Labels)
+	if err := labels.Validate(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	err := s.storage.ResetCounter(ctx, storage.SeriesKey(in.Id, labels))
+	if err != nil {
+		return nil, storageError(err)
 	}
 
 	return &pb.Empty{}, nil
 }
+
+// storageError - ошибка хранилища в виде статуса gRPC с подходящим кодом.
+func storageError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, storage.ErrMetricNotFound):
+		code = codes.NotFound
+	case errors.Is(err, storage.ErrUnknownMetricType),
+		errors.Is(err, storage.ErrEmptyMetricValue),
+		errors.Is(err, storage.ErrInvalidHistogram),
+		errors.Is(err, storage.ErrInvalidSummary),
+		errors.Is(err, storage.ErrInvalidLabelName),
+		errors.Is(err, storage.ErrInvalidSeriesKey),
+		errors.Is(err, storage.ErrInvalidMetricID),
+		errors.Is(err, storage.ErrUnknownAggregation),
+		errors.Is(err, path.ErrBadPattern):
+		code = codes.InvalidArgument
+	case errors.Is(err, storage.ErrHistogramBucketsMismatch):
+		code = codes.FailedPrecondition
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	}
+
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,251 @@
+package grpc
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"metrics/internal/server/events"
+	"metrics/internal/server/storage"
+	pb "metrics/proto"
+)
+
+const (
+	// defaultPageSize - размер страницы ListMetrics, если page_size не задан
+	defaultPageSize = 100
+	// maxPageSize - наибольший размер страницы ListMetrics
+	maxPageSize = 1000
+)
+
+// eventKinds - виды событий Hub в потоке WatchMetrics
+var eventKinds = map[string]pb.MetricEvent_Kind{
+	events.KindUpdate: pb.MetricEvent_UPDATE,
+	events.KindDelete: pb.MetricEvent_DELETE,
+	events.KindReload: pb.MetricEvent_RELOAD,
+}
+
+func (s *MetricsService) GetMetric(ctx context.Context, in *pb.GetMetricRequest) (*pb.MetricRecord, error) {
+	labels := storage.Labels(in.Labels)
+	if err := labels.Validate(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	if !knownMetricType(in.Type) {
+		return nil, status.Errorf(codes.InvalidArgument, storage.ErrUnknownMetricType.Error())
+	}
+
+	key := storage.SeriesKey(in.Id, labels)
+	value, err := s.storage.Read(ctx, key, in.Type)
+	if err != nil {
+		return nil, storageError(err)
+	}
+
+	return metricRecord(key, in.Type, &value), nil
+}
+
+// seriesRef - серия хранилища в порядке выдачи ListMetrics.
+type seriesRef struct {
+	mType string
+	key   string
+}
+
+func (ref seriesRef) less(other seriesRef) bool {
+	if ref.mType != other.mType {
+		return ref.mType < other.mType
+	}
+	return ref.key < other.key
+}
+
+func (s *MetricsService) ListMetrics(ctx context.Context, in *pb.ListMetricsRequest) (*pb.ListMetricsResponse, error) {
+	if in.Type != "" && !knownMetricType(in.Type) {
+		return nil, status.Errorf(codes.InvalidArgument, storage.ErrUnknownMetricType.Error())
+	}
+
+	pageSize := int(in.PageSize)
+	switch {
+	case pageSize < 0:
+		return nil, status.Errorf(codes.InvalidArgument, "negative page size")
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	var after *seriesRef
+	if in.PageToken != "" {
+		ref, err := decodePageToken(in.PageToken)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid page token")
+		}
+		after = &ref
+	}
+
+	allValues, err := s.storage.ReadAll(ctx)
+	if err != nil {
+		return nil, storageError(err)
+	}
+
+	var refs []seriesRef
+	for metricType, metricMap := range allValues {
+		if in.Type != "" && metricType != in.Type {
+			continue
+		}
+		for key := range metricMap {
+			ref := seriesRef{mType: metricType, key: key}
+			if after != nil && !after.less(ref) {
+				continue
+			}
+			if in.Prefix != "" && !strings.HasPrefix(seriesID(key), in.Prefix) {
+				continue
+			}
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].less(refs[j])
+	})
+
+	response := &pb.ListMetricsResponse{}
+	if len(refs) > pageSize {
+		refs = refs[:pageSize]
+		response.NextPageToken = encodePageToken(refs[pageSize-1])
+	}
+
+	response.Metrics = make([]*pb.MetricRecord, 0, len(refs))
+	for _, ref := range refs {
+		value := allValues[ref.mType][ref.key]
+		response.Metrics = append(response.Metrics, metricRecord(ref.key, ref.mType, &value))
+	}
+
+	return response, nil
+}
+
+func (s *MetricsService) WatchMetrics(in *pb.WatchMetricsRequest, stream pb.Metrics_WatchMetricsServer) error {
+	if in.Type != "" && !knownMetricType(in.Type) {
+		return status.Errorf(codes.InvalidArgument, storage.ErrUnknownMetricType.Error())
+	}
+
+	changes, unsubscribe := s.events.Subscribe(events.Filter{MType: in.Type})
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return storageError(stream.Context().Err())
+		case event, ok := <-changes:
+			if !ok {
+				return status.Errorf(codes.Unavailable, "watch subscription closed")
+			}
+			if event.Kind != events.KindReload && in.Prefix != "" && !strings.HasPrefix(event.ID, in.Prefix) {
+				continue
+			}
+
+			response := &pb.MetricEvent{Kind: eventKinds[event.Kind]}
+			if event.Kind != events.KindReload {
+				response.Metric = metricRecord(event.Key, event.MType, event.Value)
+			}
+
+			err := stream.Send(response)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// knownMetricType - тип метрики поддерживается хранилищем.
+func knownMetricType(metricType string) bool {
+	switch metricType {
+	case storage.MeticTypeGauge, storage.MeticTypeCounter, storage.MeticTypeHistogram, storage.MeticTypeSummary:
+		return true
+	default:
+		return false
+	}
+}
+
+// seriesID - имя метрики серии key, для некорректного ключа - сам ключ.
+func seriesID(key string) string {
+	id, _, err := storage.ParseSeriesKey(key)
+	if err != nil {
+		return key
+	}
+
+	return id
+}
+
+// encodePageToken - next_page_token, следующая страница начинается после серии ref.
+func encodePageToken(ref seriesRef) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(ref.mType + "/" + ref.key))
+}
+
+func decodePageToken(token string) (seriesRef, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return seriesRef{}, err
+	}
+
+	mType, key, ok := strings.Cut(string(decoded), "/")
+	if !ok || !knownMetricType(mType) {
+		return seriesRef{}, storage.ErrInvalidSeriesKey
+	}
+
+	return seriesRef{mType: mType, key: key}, nil
+}
+
+// metricRecord - серия key хранилища в формате gRPC, для value == nil заполняются только имя и метки.
+func metricRecord(key string, metricType string, value *storage.MetricValue) *pb.MetricRecord {
+	id, labels, err := storage.ParseSeriesKey(key)
+	if err != nil {
+		id, labels = key, nil
+	}
+	if value == nil {
+		value = &storage.MetricValue{MType: metricType}
+	}
+
+	record := &pb.MetricRecord{}
+	if value.UpdatedAt != nil {
+		record.UpdatedAt = timestamppb.New(*value.UpdatedAt)
+	}
+
+	switch metricType {
+	case storage.MeticTypeGauge:
+		gauge := &pb.MetricGauge{Id: id, Labels: labels}
+		if value.Value != nil {
+			gauge.Value = *value.Value
+		}
+		record.Metric = &pb.Metric{Metric: &pb.Metric_Gauge{Gauge: gauge}}
+	case storage.MeticTypeCounter:
+		counter := &pb.MetricCounter{Id: id, Labels: labels}
+		if value.Delta != nil {
+			counter.Delta = *value.Delta
+		}
+		record.Metric = &pb.Metric{Metric: &pb.Metric_Counter{Counter: counter}}
+	case storage.MeticTypeHistogram:
+		histogram := &pb.MetricHistogram{Id: id, Labels: labels}
+		if value.Histogram != nil {
+			histogram.Buckets = value.Histogram.Buckets
+			histogram.Counts = value.Histogram.Counts
+			histogram.Sum = value.Histogram.Sum
+			histogram.Count = value.Histogram.Count
+		}
+		record.Metric = &pb.Metric{Metric: &pb.Metric_Histogram{Histogram: histogram}}
+	case storage.MeticTypeSummary:
+		summary := &pb.MetricSummary{Id: id, Labels: labels}
+		if value.Summary != nil {
+			for _, quantile := range value.Summary.Quantiles {
+				summary.Quantiles = append(summary.Quantiles, &pb.Quantile{
+					Quantile: quantile.Quantile,
+					Value:    quantile.Value,
+				})
+			}
+			summary.Sum = value.Summary.Sum
+			summary.Count = value.Summary.Count
+		}
+		record.Metric = &pb.Metric{Metric: &pb.Metric_Summary{Summary: summary}}
+	}
+
+	return record
+}
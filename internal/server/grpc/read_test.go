@@ -0,0 +1,142 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"metrics/internal/server/config"
+	"metrics/internal/server/events"
+	"metrics/internal/server/storage"
+	pb "metrics/proto"
+)
+
+func gaugeMetric(id string, value float64, labels map[string]string) *pb.Metric {
+	return &pb.Metric{Metric: &pb.Metric_Gauge{Gauge: &pb.MetricGauge{Id: id, Value: value, Labels: labels}}}
+}
+
+func TestGetMetric(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t, storage.NewMetricsMemoryRepo(config.StoreConfig{}), events.NewHub())
+
+	_, err := client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		gaugeMetric("Alloc", 1.5, map[string]string{"host": "a"}),
+	}})
+	require.NoError(t, err)
+
+	// Сервер добавляет метку источника, без неё серия не найдена
+	_, err = client.GetMetric(ctx, &pb.GetMetricRequest{Type: "gauge", Id: "Alloc", Labels: map[string]string{"host": "a"}})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	record, err := client.GetMetric(ctx, &pb.GetMetricRequest{
+		Type:   "gauge",
+		Id:     "Alloc",
+		Labels: map[string]string{"host": "a", storage.SourceLabel: "bufconn"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Alloc", record.Metric.GetGauge().Id)
+	require.Equal(t, 1.5, record.Metric.GetGauge().Value)
+	require.Equal(t, "a", record.Metric.GetGauge().Labels["host"])
+	require.WithinDuration(t, time.Now(), record.UpdatedAt.AsTime(), time.Minute)
+
+	_, err = client.GetMetric(ctx, &pb.GetMetricRequest{Type: "unknown", Id: "Alloc"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestListMetrics(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t, storage.NewMetricsMemoryRepo(config.StoreConfig{}), events.NewHub())
+
+	_, err := client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		gaugeMetric("HeapAlloc", 1, nil),
+		gaugeMetric("HeapIdle", 2, nil),
+		gaugeMetric("HeapInuse", 3, nil),
+		gaugeMetric("Alloc", 4, nil),
+		{Metric: &pb.Metric_Counter{Counter: &pb.MetricCounter{Id: "HeapCount", Delta: 5}}},
+	}})
+	require.NoError(t, err)
+
+	// Все страницы по две метрики, counter перед gauge
+	var ids []string
+	request := &pb.ListMetricsRequest{Prefix: "Heap", PageSize: 2}
+	for {
+		response, err := client.ListMetrics(ctx, request)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(response.Metrics), 2)
+
+		for _, record := range response.Metrics {
+			if counter := record.Metric.GetCounter(); counter != nil {
+				ids = append(ids, counter.Id)
+			} else {
+				ids = append(ids, record.Metric.GetGauge().Id)
+			}
+		}
+		if response.NextPageToken == "" {
+			break
+		}
+		request.PageToken = response.NextPageToken
+	}
+	require.Equal(t, []string{"HeapCount", "HeapAlloc", "HeapIdle", "HeapInuse"}, ids)
+
+	response, err := client.ListMetrics(ctx, &pb.ListMetricsRequest{Type: "counter"})
+	require.NoError(t, err)
+	require.Len(t, response.Metrics, 1)
+	require.EqualValues(t, 5, response.Metrics[0].Metric.GetCounter().Delta)
+	require.Empty(t, response.NextPageToken)
+
+	_, err = client.ListMetrics(ctx, &pb.ListMetricsRequest{PageToken: "not a token"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.ListMetrics(ctx, &pb.ListMetricsRequest{PageSize: -1})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestWatchMetrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := events.NewHub()
+	client := newTestClient(t, storage.NewMetricsMemoryRepo(config.StoreConfig{}), hub)
+
+	stream, err := client.WatchMetrics(ctx, &pb.WatchMetricsRequest{Prefix: "Heap", Type: "gauge"})
+	require.NoError(t, err)
+	require.Eventually(t, hub.HasSubscribers, time.Second, 10*time.Millisecond)
+
+	_, err = client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		gaugeMetric("Alloc", 1, nil),
+		gaugeMetric("HeapAlloc", 2, nil),
+	}})
+	require.NoError(t, err)
+	_, err = client.DeleteMetric(ctx, &pb.DeleteMetricRequest{
+		Type:   "gauge",
+		Id:     "HeapAlloc",
+		Labels: map[string]string{storage.SourceLabel: "bufconn"},
+	})
+	require.NoError(t, err)
+	_, err = client.DeleteMetrics(ctx, &pb.DeleteMetricsRequest{Type: "gauge", Pattern: "*"})
+	require.NoError(t, err)
+
+	// Изменение Alloc не проходит отбор по префиксу
+	event, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, pb.MetricEvent_UPDATE, event.Kind)
+	require.Equal(t, "HeapAlloc", event.Metric.Metric.GetGauge().Id)
+	require.EqualValues(t, 2, event.Metric.Metric.GetGauge().Value)
+
+	event, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, pb.MetricEvent_DELETE, event.Kind)
+	require.Equal(t, "HeapAlloc", event.Metric.Metric.GetGauge().Id)
+
+	event, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, pb.MetricEvent_RELOAD, event.Kind)
+	require.Nil(t, event.Metric)
+
+	// Закрытие Hub при остановке сервера завершает поток
+	hub.Close()
+	_, err = stream.Recv()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
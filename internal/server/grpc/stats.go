@@ -0,0 +1,127 @@
+package grpc
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"metrics/internal/server/storage"
+)
+
+const (
+	// MetricRPCHandled - counter завершённых запросов gRPC с метками method и code
+	MetricRPCHandled = "grpc_server_handled_total"
+	// MetricRPCDuration - histogram длительности запросов gRPC в секундах с меткой method,
+	// для потоков - время от открытия до закрытия потока
+	MetricRPCDuration = "grpc_server_handling_seconds"
+)
+
+// rpcDurationBuckets - границы интервалов гистограммы длительности запросов, секунды
+var rpcDurationBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 30}
+
+// Stats - счётчики и длительность запросов gRPC по методам.
+// Приросты с прошлой записи накапливаются в памяти и периодически записываются в хранилище
+// как собственные метрики сервера без метки source.
+type Stats struct {
+	mutex     *sync.Mutex
+	handled   map[string]int64
+	durations map[string]*storage.HistogramValue
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		mutex:     &sync.Mutex{},
+		handled:   make(map[string]int64),
+		durations: make(map[string]*storage.HistogramValue),
+	}
+}
+
+// observe - учёт завершённого запроса.
+func (stats *Stats) observe(method string, err error, duration time.Duration) {
+	handledKey := storage.SeriesKey(MetricRPCHandled, storage.Labels{"method": method, "code": status.Code(err).String()})
+	durationKey := storage.SeriesKey(MetricRPCDuration, storage.Labels{"method": method})
+
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	stats.handled[handledKey]++
+
+	histogram, ok := stats.durations[durationKey]
+	if !ok {
+		histogram = storage.NewHistogramValue(rpcDurationBuckets)
+		stats.durations[durationKey] = histogram
+	}
+	histogram.Observe(duration.Seconds())
+}
+
+func (stats *Stats) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	stats.observe(info.FullMethod, err, time.Since(start))
+
+	return resp, err
+}
+
+func (stats *Stats) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, stream)
+	stats.observe(info.FullMethod, err, time.Since(start))
+
+	return err
+}
+
+// take - накопленные приросты в виде пачки метрик, накопленные значения обнуляются.
+func (stats *Stats) take() []storage.Metric {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	metrics := make([]storage.Metric, 0, len(stats.handled)+len(stats.durations))
+	for key, handled := range stats.handled {
+		delta := handled
+		metrics = append(metrics, statsMetric(key, storage.MetricValue{MType: storage.MeticTypeCounter, Delta: &delta}))
+	}
+	for key, histogram := range stats.durations {
+		metrics = append(metrics, statsMetric(key, storage.MetricValue{MType: storage.MeticTypeHistogram, Histogram: histogram}))
+	}
+
+	stats.handled = make(map[string]int64)
+	stats.durations = make(map[string]*storage.HistogramValue)
+
+	return metrics
+}
+
+func statsMetric(key string, value storage.MetricValue) storage.Metric {
+	id, labels, _ := storage.ParseSeriesKey(key)
+	return storage.Metric{ID: id, Labels: labels, MetricValue: value}
+}
+
+// Flush - запись накопленных приростов в repo. При ошибке записи приросты теряются.
+func (stats *Stats) Flush(ctx context.Context, repo storage.MetricStorager) error {
+	metrics := stats.take()
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	return repo.UpdateManySliceMetric(ctx, metrics)
+}
+
+// Run - запись накопленных приростов в repo каждые interval до отмены ctx.
+// Приросты после последней записи записываются Flush при остановке сервера.
+func (stats *Stats) Run(ctx context.Context, repo storage.MetricStorager, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := stats.Flush(ctx, repo); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
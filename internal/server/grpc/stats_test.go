@@ -0,0 +1,52 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/config"
+	"metrics/internal/server/events"
+	"metrics/internal/server/storage"
+	pb "metrics/proto"
+)
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.NewMetricsMemoryRepo(config.StoreConfig{})
+	stats := NewStats()
+
+	options, err := Interceptors("", "", stats)
+	require.NoError(t, err)
+	client := newTestClient(t, repo, events.NewHub(), options...)
+
+	request := &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{gaugeMetric("Alloc", 1, nil)}}
+	for i := 0; i < 2; i++ {
+		_, err = client.UpdateMetrics(ctx, request)
+		require.NoError(t, err)
+		require.NoError(t, stats.Flush(ctx, repo))
+	}
+	_, err = client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{})
+	require.Error(t, err)
+	require.NoError(t, stats.Flush(ctx, repo))
+
+	const method = "/metrics.Metrics/UpdateMetrics"
+	handled, err := repo.Read(ctx, storage.SeriesKey(MetricRPCHandled, storage.Labels{"method": method, "code": "OK"}), storage.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, *handled.Delta)
+
+	handled, err = repo.Read(ctx, storage.SeriesKey(MetricRPCHandled, storage.Labels{"method": method, "code": "OutOfRange"}), storage.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, *handled.Delta)
+
+	duration, err := repo.Read(ctx, storage.SeriesKey(MetricRPCDuration, storage.Labels{"method": method}), storage.MeticTypeHistogram)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, duration.Histogram.Count)
+	require.Len(t, duration.Histogram.Counts, len(rpcDurationBuckets)+1)
+
+	// Без новых запросов Flush ничего не пишет
+	require.NoError(t, stats.Flush(ctx, repo))
+	handled, err = repo.Read(ctx, storage.SeriesKey(MetricRPCHandled, storage.Labels{"method": method, "code": "OK"}), storage.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, *handled.Delta)
+}
@@ -0,0 +1,154 @@
+package grpc
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/status"
+	pb "metrics/proto"
+)
+
+const (
+	// uploadSessionTTL - сколько помнить сессию потока UploadMetrics после последней пачки
+	uploadSessionTTL = time.Hour
+	// uploadSessionWindow - сколько последних номеров пачек сессии помнить поштучно.
+	// Пачки старше окна считаются записанными: агент хранит меньше пачек (очередь и окно отправки).
+	uploadSessionWindow = 16384
+)
+
+// uploadSessions - номера записанных пачек сессий потока UploadMetrics.
+// Агент после переподключения повторяет неподтверждённые пачки, уже записанные пачки подтверждаются без повторной записи.
+// Пачка с ошибкой записи не считается записанной, даже если следующие пачки записаны, и записывается при повторе.
+type uploadSessions struct {
+	mutex    *sync.Mutex
+	sessions map[string]*uploadSession
+}
+
+// uploadSession - записанные пачки сессии: все до sequence включительно и отдельные номера после него.
+type uploadSession struct {
+	sequence uint64
+	applied  map[uint64]struct{}
+	seen     time.Time
+}
+
+func newUploadSessions() *uploadSessions {
+	return &uploadSessions{
+		mutex:    &sync.Mutex{},
+		sessions: make(map[string]*uploadSession),
+	}
+}
+
+// applied - пачка sequence сессии уже записана.
+func (sessions *uploadSessions) applied(key string, sequence uint64, now time.Time) bool {
+	sessions.mutex.Lock()
+	defer sessions.mutex.Unlock()
+
+	session, ok := sessions.sessions[key]
+	if !ok {
+		return false
+	}
+	session.seen = now
+
+	if sequence <= session.sequence {
+		return true
+	}
+	_, ok = session.applied[sequence]
+
+	return ok
+}
+
+// apply - пачка sequence сессии записана.
+func (sessions *uploadSessions) apply(key string, sequence uint64, now time.Time) {
+	sessions.mutex.Lock()
+	defer sessions.mutex.Unlock()
+
+	session, ok := sessions.sessions[key]
+	if !ok {
+		session = &uploadSession{applied: make(map[uint64]struct{})}
+		sessions.sessions[key] = session
+	}
+	session.seen = now
+
+	if sequence <= session.sequence {
+		return
+	}
+	session.applied[sequence] = struct{}{}
+
+	// Пачки, не записанные до начала окна, агент уже не повторит
+	if len(session.applied) > uploadSessionWindow {
+		var highest uint64
+		for applied := range session.applied {
+			if applied > highest {
+				highest = applied
+			}
+		}
+		session.sequence = highest - uploadSessionWindow
+		for applied := range session.applied {
+			if applied <= session.sequence {
+				delete(session.applied, applied)
+			}
+		}
+	}
+
+	for {
+		if _, ok := session.applied[session.sequence+1]; !ok {
+			break
+		}
+		session.sequence++
+		delete(session.applied, session.sequence)
+	}
+}
+
+// expire - удаление сессий без пачек дольше uploadSessionTTL.
+func (sessions *uploadSessions) expire(now time.Time) {
+	sessions.mutex.Lock()
+	defer sessions.mutex.Unlock()
+
+	for key, session := range sessions.sessions {
+		if now.Sub(session.seen) > uploadSessionTTL {
+			delete(sessions.sessions, key)
+		}
+	}
+}
+
+// UploadMetrics - поток пачек метрик агента, на каждую пачку отправляется подтверждение с результатом записи.
+// Ошибка записи пачки не закрывает поток: агент по коду подтверждения решает, повторять ли пачку.
+func (s *MetricsService) UploadMetrics(stream pb.Metrics_UploadMetricsServer) error {
+	ctx := stream.Context()
+	source, err := sourceFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	s.uploads.expire(time.Now())
+
+	for {
+		request, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ack := &pb.UploadAck{Sequence: request.Sequence}
+		// Сессии разных агентов не пересекаются, даже если агенты выбрали одинаковый идентификатор сессии
+		sessionKey := source.ID + "/" + request.Session
+		if request.Session == "" || !s.uploads.applied(sessionKey, request.Sequence, time.Now()) {
+			err = s.updateMetrics(ctx, source, request.Metrics)
+			if err != nil {
+				st := status.Convert(err)
+				ack.Code = int32(st.Code())
+				ack.Error = st.Message()
+			} else if request.Session != "" {
+				s.uploads.apply(sessionKey, request.Sequence, time.Now())
+			}
+		}
+
+		err = stream.Send(ack)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"metrics/internal/server/agents"
+	"metrics/internal/server/config"
+	"metrics/internal/server/events"
+	"metrics/internal/server/storage"
+	pb "metrics/proto"
+)
+
+// newTestClient - клиент сервиса поверх repo, изменения метрик публикуются в hub.
+func newTestClient(t *testing.T, repo storage.MetricStorager, hub *events.Hub, options ...grpc.ServerOption) pb.MetricsClient {
+	return newTestServiceClient(t, NewMetricsService(events.NewRepo(repo, hub), agents.NewRegistry(time.Minute), hub), options...)
+}
+
+// newTestServiceClient - клиент сервиса service, запущенного с параметрами options.
+func newTestServiceClient(t *testing.T, service pb.MetricsServer, options ...grpc.ServerOption) pb.MetricsClient {
+	listener := bufconn.Listen(1024 * 1024)
+	serverGRPC := grpc.NewServer(options...)
+	pb.RegisterMetricsServer(serverGRPC, service)
+	go serverGRPC.Serve(listener)
+	t.Cleanup(serverGRPC.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewMetricsClient(conn)
+}
+
+func counterRequest(session string, sequence uint64, delta int64) *pb.UploadRequest {
+	return &pb.UploadRequest{
+		Session:  session,
+		Sequence: sequence,
+		Metrics: []*pb.Metric{{
+			Metric: &pb.Metric_Counter{Counter: &pb.MetricCounter{Id: "PollCount", Delta: delta}},
+		}},
+	}
+}
+
+func TestUploadMetrics(t *testing.T) {
+	repo := storage.NewMetricsMemoryRepo(config.StoreConfig{})
+	client := newTestClient(t, repo, events.NewHub())
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), agents.MetadataAgentID, "agent-1")
+	upload := func(requests ...*pb.UploadRequest) []*pb.UploadAck {
+		stream, err := client.UploadMetrics(ctx)
+		require.NoError(t, err)
+
+		acks := make([]*pb.UploadAck, 0, len(requests))
+		for _, request := range requests {
+			require.NoError(t, stream.Send(request))
+			ack, err := stream.Recv()
+			require.NoError(t, err)
+			acks = append(acks, ack)
+		}
+		require.NoError(t, stream.CloseSend())
+
+		return acks
+	}
+
+	acks := upload(counterRequest("s1", 1, 5), counterRequest("s1", 2, 5), &pb.UploadRequest{Session: "s1", Sequence: 3})
+	require.EqualValues(t, 1, acks[0].Sequence)
+	require.EqualValues(t, codes.OK, acks[1].Code)
+	// Ошибка пачки не закрывает поток
+	require.EqualValues(t, codes.OutOfRange, acks[2].Code)
+	require.NotEmpty(t, acks[2].Error)
+
+	// После переподключения записанная пачка подтверждается без повторной записи
+	acks = upload(counterRequest("s1", 2, 5), counterRequest("s1", 4, 1))
+	require.EqualValues(t, codes.OK, acks[0].Code)
+	require.EqualValues(t, codes.OK, acks[1].Code)
+
+	value, err := repo.Read(context.Background(), storage.SeriesKey("PollCount", storage.Labels{storage.SourceLabel: "agent-1"}), storage.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 11, *value.Delta)
+}
+
+func TestUploadMetricsRetryFailedBatch(t *testing.T) {
+	repo := storage.NewMetricsMemoryRepo(config.StoreConfig{})
+	client := newTestClient(t, repo, events.NewHub())
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), agents.MetadataAgentID, "agent-1")
+	stream, err := client.UploadMetrics(ctx)
+	require.NoError(t, err)
+	send := func(request *pb.UploadRequest) *pb.UploadAck {
+		require.NoError(t, stream.Send(request))
+		ack, err := stream.Recv()
+		require.NoError(t, err)
+		return ack
+	}
+
+	invalid := counterRequest("s1", 1, 5)
+	invalid.Metrics[0].GetCounter().Id = "Poll{Count"
+	require.EqualValues(t, codes.InvalidArgument, send(invalid).Code)
+	require.EqualValues(t, codes.OK, send(counterRequest("s1", 2, 5)).Code)
+
+	// Пачка 1 не записана, хотя пачка 2 записана, поэтому повтор пачки 1 записывается
+	require.EqualValues(t, codes.OK, send(counterRequest("s1", 1, 3)).Code)
+	// Повтор записанных пачек не записывается снова
+	require.EqualValues(t, codes.OK, send(counterRequest("s1", 1, 3)).Code)
+	require.EqualValues(t, codes.OK, send(counterRequest("s1", 2, 5)).Code)
+	require.NoError(t, stream.CloseSend())
+
+	value, err := repo.Read(context.Background(), storage.SeriesKey("PollCount", storage.Labels{storage.SourceLabel: "agent-1"}), storage.MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 8, *value.Delta)
+}
+
+func TestUploadSessionsWindow(t *testing.T) {
+	sessions := newUploadSessions()
+	now := time.Now()
+
+	sessions.apply("s", 1, now)
+	sessions.apply("s", 3, now)
+	require.True(t, sessions.applied("s", 1, now))
+	require.False(t, sessions.applied("s", 2, now))
+	require.True(t, sessions.applied("s", 3, now))
+
+	sessions.apply("s", 2, now)
+	require.EqualValues(t, 3, sessions.sessions["s"].sequence)
+	require.Empty(t, sessions.sessions["s"].applied)
+
+	// Пропуск старше окна считается записанным
+	sessions.apply("s", 5, now)
+	for sequence := uint64(6); sequence <= uploadSessionWindow+5; sequence++ {
+		sessions.apply("s", sequence, now)
+	}
+	require.True(t, sessions.applied("s", 4, now))
+	require.LessOrEqual(t, len(sessions.sessions["s"].applied), uploadSessionWindow)
+}
@@ -5,20 +5,36 @@ import (
 	"io"
 	"net/http"
 	"strings"
+
+	"metrics/internal/server/contenttype"
 )
 
 type gzipWriter struct {
 	http.ResponseWriter
-	Writer io.Writer
+	Writer *gzip.Writer
 }
 
 func (w gzipWriter) Write(b []byte) (int, error) {
 	return w.Writer.Write(b)
 }
 
+// Flush - отправка клиенту уже сжатых данных, например событий потока, если клиент не указал Accept.
+func (w gzipWriter) Flush() {
+	err := w.Writer.Flush()
+	if err != nil {
+		return
+	}
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 func GzipHandle(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		// Поток событий отправляется частями, сжатие буферизовало бы его
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") ||
+			contenttype.GetAcceptContentType(r.Header) == contenttype.ContentTypeEventStream {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGzipHandleFlush(t *testing.T) {
+	handler := GzipHandle(http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		flusher, ok := rw.(http.Flusher)
+		require.True(t, ok)
+
+		io.WriteString(rw, "retry: 3000\n\n")
+		flusher.Flush()
+	}))
+
+	// Клиент потока событий без Accept: text/event-stream получает сжатый ответ частями
+	request := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	require.True(t, recorder.Flushed)
+	require.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+
+	reader, err := gzip.NewReader(recorder.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "retry: 3000\n\n", string(body))
+}
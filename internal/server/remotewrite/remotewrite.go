@@ -0,0 +1,212 @@
+// Package remotewrite - приём метрик от Prometheus и экспортёров по протоколу remote write 1.0.
+package remotewrite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/proto"
+	"metrics/internal/server/storage"
+	"metrics/proto/prompb"
+)
+
+// NameLabel - метка с именем метрики в сериях remote write.
+const NameLabel = "__name__"
+
+var (
+	// ErrDecode - тело запроса не является сжатым snappy сообщением WriteRequest
+	ErrDecode = errors.New("invalid remote write request")
+	// ErrTooLarge - размер тела запроса больше допустимого
+	ErrTooLarge = errors.New("remote write request is too large")
+)
+
+// MaxBodySize - наибольший размер сжатого тела запроса, распакованный размер которого не больше maxSize.
+func MaxBodySize(maxSize int) int64 {
+	return int64(snappy.MaxEncodedLen(maxSize))
+}
+
+// Decode - разбор тела запроса: сообщение WriteRequest в protobuf, сжатое snappy (block format).
+// Распакованный размер из заголовка snappy проверяется до распаковки и не должен превышать maxSize.
+func Decode(body []byte, maxSize int) (*prompb.WriteRequest, error) {
+	size, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecode, err)
+	}
+	if size > maxSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTooLarge, size)
+	}
+
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecode, err)
+	}
+
+	request := &prompb.WriteRequest{}
+	if err = proto.Unmarshal(data, request); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecode, err)
+	}
+
+	return request, nil
+}
+
+// Result - количество значений (samples) запроса: записанных, отклонённых и вытесненных более поздним
+// значением той же серии.
+type Result struct {
+	Accepted int
+	Rejected int
+	Dropped  int
+}
+
+// sample - значение серии и его время в миллисекундах.
+type sample struct {
+	value     float64
+	timestamp int64
+}
+
+// Write - запись серий запроса в хранилище с меткой источника source.
+// Тип метрики определяется метаданными запроса, если они есть, иначе по суффиксу имени:
+// _total, _count и _bucket - counter, остальные - gauge.
+// Значения counter в Prometheus накопленные, поэтому counter хранилища устанавливается равным
+// значению из запроса (SetValues), в том числе после сброса счётчика.
+// Хранилище держит текущее значение серии, поэтому записывается только последнее по времени значение,
+// остальные допустимые значения серии считаются вытесненными (Dropped), а не принятыми.
+// Отклоняются серии без имени или с недопустимыми метками, нечисловые значения, отметки устаревания,
+// отрицательные и дробные значения counter: counter хранилища целый, а округление исказило бы его.
+func Write(ctx context.Context, repo storage.MetricStorager, request *prompb.WriteRequest, source string) (Result, error) {
+	result := Result{}
+	familyTypes := metadataTypes(request.Metadata)
+
+	latest := make(map[string]sample)
+	metricTypes := make(map[string]string)
+	valid := 0
+	for _, series := range request.Timeseries {
+		if len(series.Samples) == 0 {
+			continue
+		}
+
+		id, labels, ok := seriesLabels(series.Labels)
+		if !ok {
+			result.Rejected += len(series.Samples)
+			continue
+		}
+		key := storage.SeriesKey(id, labels.With(storage.SourceLabel, source))
+		metricType := seriesType(id, familyTypes)
+
+		for _, one := range series.Samples {
+			if !validValue(one.Value, metricType) {
+				result.Rejected++
+				continue
+			}
+			valid++
+
+			// Серия может повторяться в запросе, например при метках с пустым значением
+			if last, ok := latest[key]; !ok || one.Timestamp >= last.timestamp {
+				latest[key] = sample{value: one.Value, timestamp: one.Timestamp}
+			}
+			metricTypes[key] = metricType
+		}
+	}
+	result.Accepted = len(latest)
+	result.Dropped = valid - result.Accepted
+
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+	for key, last := range latest {
+		if metricTypes[key] == storage.MeticTypeCounter {
+			counters[key] = int64(last.value)
+		} else {
+			gauges[key] = last.value
+		}
+	}
+
+	// Gauge и counter записываются одной операцией: при ошибке повтор запроса Prometheus не задвоит историю gauge
+	if err := repo.SetValues(ctx, gauges, counters); err != nil {
+		return Result{}, err
+	}
+
+	return result, nil
+}
+
+// seriesLabels - имя метрики и остальные метки серии. Метки с пустым значением в Prometheus равнозначны отсутствующим.
+func seriesLabels(seriesLabels []*prompb.Label) (string, storage.Labels, bool) {
+	id := ""
+	labels := storage.Labels{}
+	for _, label := range seriesLabels {
+		switch {
+		case label.Name == NameLabel:
+			id = label.Value
+		case label.Value != "":
+			labels[label.Name] = label.Value
+		}
+	}
+
+	if storage.ValidateMetricID(id) != nil || labels.Validate() != nil {
+		return "", nil, false
+	}
+
+	return id, labels, true
+}
+
+// metadataTypes - типы семейств метрик из метаданных запроса.
+func metadataTypes(metadata []*prompb.MetricMetadata) map[string]prompb.MetricMetadata_MetricType {
+	familyTypes := make(map[string]prompb.MetricMetadata_MetricType, len(metadata))
+	for _, one := range metadata {
+		familyTypes[one.MetricFamilyName] = one.Type
+	}
+
+	return familyTypes
+}
+
+// seriesType - тип метрики хранилища для серии id.
+// Значения _bucket и _count гистограмм и summary - counter, _sum и квантили - gauge,
+// так как сумма наблюдений может уменьшаться и не всегда целая.
+func seriesType(id string, familyTypes map[string]prompb.MetricMetadata_MetricType) string {
+	if familyType, ok := familyTypes[id]; ok {
+		if familyType == prompb.MetricMetadata_COUNTER {
+			return storage.MeticTypeCounter
+		}
+		return storage.MeticTypeGauge
+	}
+
+	for _, suffix := range []string{"_total", "_bucket", "_count", "_sum"} {
+		family := strings.TrimSuffix(id, suffix)
+		if family == id {
+			continue
+		}
+
+		familyType, ok := familyTypes[family]
+		switch {
+		case !ok:
+			if suffix == "_sum" {
+				return storage.MeticTypeGauge
+			}
+			return storage.MeticTypeCounter
+		case familyType == prompb.MetricMetadata_COUNTER:
+			return storage.MeticTypeCounter
+		case familyType == prompb.MetricMetadata_HISTOGRAM, familyType == prompb.MetricMetadata_SUMMARY:
+			if suffix == "_bucket" || suffix == "_count" {
+				return storage.MeticTypeCounter
+			}
+		}
+		return storage.MeticTypeGauge
+	}
+
+	return storage.MeticTypeGauge
+}
+
+// validValue - значение можно записать в хранилище: конечное число, для counter - целое неотрицательное,
+// представимое в int64. Отметка устаревания серии (staleness marker) в Prometheus - особое значение NaN.
+func validValue(value float64, metricType string) bool {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return false
+	}
+	if metricType != storage.MeticTypeCounter {
+		return true
+	}
+
+	return value >= 0 && value < math.MaxInt64 && value == math.Trunc(value)
+}
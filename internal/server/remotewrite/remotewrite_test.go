@@ -0,0 +1,142 @@
+package remotewrite
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"metrics/internal/server/config"
+	"metrics/internal/server/storage"
+	"metrics/proto/prompb"
+)
+
+func timeSeries(name string, labels map[string]string, values ...float64) *prompb.TimeSeries {
+	series := &prompb.TimeSeries{Labels: []*prompb.Label{{Name: NameLabel, Value: name}}}
+	for labelName, labelValue := range labels {
+		series.Labels = append(series.Labels, &prompb.Label{Name: labelName, Value: labelValue})
+	}
+	for i, value := range values {
+		series.Samples = append(series.Samples, &prompb.Sample{Value: value, Timestamp: int64(i) * 1000})
+	}
+
+	return series
+}
+
+func TestDecode(t *testing.T) {
+	request := &prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{timeSeries("up", map[string]string{"job": "node"}, 1)}}
+	data, err := proto.Marshal(request)
+	require.NoError(t, err)
+
+	decoded, err := Decode(snappy.Encode(nil, data), len(data))
+	require.NoError(t, err)
+	require.True(t, proto.Equal(request, decoded))
+
+	_, err = Decode(data, 1<<20)
+	require.ErrorIs(t, err, ErrDecode)
+
+	_, err = Decode(snappy.Encode(nil, []byte{0xff, 0xff}), 1<<20)
+	require.ErrorIs(t, err, ErrDecode)
+
+	_, err = Decode(snappy.Encode(nil, data), len(data)-1)
+	require.ErrorIs(t, err, ErrTooLarge)
+
+	// Размер в заголовке проверяется до выделения памяти под распакованные данные
+	header := make([]byte, binary.MaxVarintLen64)
+	_, err = Decode(header[:binary.PutUvarint(header, 1<<30)], 1<<20)
+	require.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestWrite(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.NewMetricsMemoryRepo(config.StoreConfig{})
+
+	request := &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{
+			timeSeries("node_load1", map[string]string{"job": "node", "instance": ""}, 0.5, 0.75),
+			timeSeries("http_requests_total", map[string]string{"job": "api"}, 10, 12),
+			timeSeries("requests", nil, 3),
+			timeSeries("latency_sum", nil, 1.5),
+			timeSeries("latency_count", nil, 4),
+			timeSeries("temperature", nil, math.NaN(), math.Inf(1)),
+			timeSeries("errors_total", nil, -1),
+			timeSeries("cpu_seconds_total", nil, 0.37, math.MaxInt64*2),
+			{Labels: []*prompb.Label{{Name: "job", Value: "node"}}, Samples: []*prompb.Sample{{Value: 1}}},
+			timeSeries("up", map[string]string{"bad-label": "x"}, 1),
+		},
+		Metadata: []*prompb.MetricMetadata{{Type: prompb.MetricMetadata_COUNTER, MetricFamilyName: "requests"}},
+	}
+
+	result, err := Write(ctx, repo, request, "prometheus")
+	require.NoError(t, err)
+	require.Equal(t, Result{Accepted: 5, Rejected: 7, Dropped: 2}, result)
+
+	read := func(id string, labels storage.Labels, metricType string) storage.MetricValue {
+		value, err := repo.Read(ctx, storage.SeriesKey(id, labels.With(storage.SourceLabel, "prometheus")), metricType)
+		require.NoError(t, err)
+		return value
+	}
+
+	require.Equal(t, 0.75, *read("node_load1", storage.Labels{"job": "node"}, storage.MeticTypeGauge).Value)
+	require.EqualValues(t, 12, *read("http_requests_total", storage.Labels{"job": "api"}, storage.MeticTypeCounter).Delta)
+	require.EqualValues(t, 3, *read("requests", nil, storage.MeticTypeCounter).Delta)
+	require.Equal(t, 1.5, *read("latency_sum", nil, storage.MeticTypeGauge).Value)
+	require.EqualValues(t, 4, *read("latency_count", nil, storage.MeticTypeCounter).Delta)
+
+	// Дробные значения counter отклоняются, а не округляются
+	_, err = repo.Read(ctx, storage.SeriesKey("cpu_seconds_total", storage.Labels{storage.SourceLabel: "prometheus"}), storage.MeticTypeCounter)
+	require.ErrorIs(t, err, storage.ErrMetricNotFound)
+
+	// Counter хранилища повторяет накопленное значение, в том числе после сброса
+	for _, value := range []float64{20, 5} {
+		request = &prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{timeSeries("http_requests_total", map[string]string{"job": "api"}, value)}}
+		result, err = Write(ctx, repo, request, "prometheus")
+		require.NoError(t, err)
+		require.Equal(t, Result{Accepted: 1}, result)
+		require.EqualValues(t, value, *read("http_requests_total", storage.Labels{"job": "api"}, storage.MeticTypeCounter).Delta)
+	}
+
+	// Записывается последнее по времени значение серии, в том числе повторённой в запросе
+	request = &prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{
+		{Labels: []*prompb.Label{{Name: NameLabel, Value: "queue"}}, Samples: []*prompb.Sample{{Value: 3, Timestamp: 2000}, {Value: 1, Timestamp: 1000}}},
+		{Labels: []*prompb.Label{{Name: NameLabel, Value: "queue"}, {Name: "job", Value: ""}}, Samples: []*prompb.Sample{{Value: 2, Timestamp: 1500}}},
+	}}
+	result, err = Write(ctx, repo, request, "prometheus")
+	require.NoError(t, err)
+	require.Equal(t, Result{Accepted: 1, Dropped: 2}, result)
+	require.Equal(t, 3.0, *read("queue", nil, storage.MeticTypeGauge).Value)
+}
+
+func TestSeriesType(t *testing.T) {
+	familyTypes := map[string]prompb.MetricMetadata_MetricType{
+		"rpc":       prompb.MetricMetadata_HISTOGRAM,
+		"size":      prompb.MetricMetadata_SUMMARY,
+		"queue":     prompb.MetricMetadata_GAUGE,
+		"processed": prompb.MetricMetadata_COUNTER,
+	}
+
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{id: "rpc_bucket", want: storage.MeticTypeCounter},
+		{id: "rpc_count", want: storage.MeticTypeCounter},
+		{id: "rpc_sum", want: storage.MeticTypeGauge},
+		{id: "size", want: storage.MeticTypeGauge},
+		{id: "queue", want: storage.MeticTypeGauge},
+		{id: "queue_total", want: storage.MeticTypeGauge},
+		{id: "processed", want: storage.MeticTypeCounter},
+		{id: "processed_total", want: storage.MeticTypeCounter},
+		{id: "bytes_total", want: storage.MeticTypeCounter},
+		{id: "bytes_sum", want: storage.MeticTypeGauge},
+		{id: "bytes", want: storage.MeticTypeGauge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			require.Equal(t, tt.want, seriesType(tt.id, familyTypes))
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package responses
+
+import "encoding/json"
+
+type DeleteMetricsResponse struct {
+	DefaultResponse
+	Deleted int `json:"deleted"`
+}
+
+func NewDeleteMetricsResponse() DeleteMetricsResponse {
+	response := DeleteMetricsResponse{}
+	response.Status = StatusOk
+
+	return response
+}
+
+func (response *DeleteMetricsResponse) SetDeleted(deleted int) *DeleteMetricsResponse {
+	response.Deleted = deleted
+	return response
+}
+
+func (response DeleteMetricsResponse) GetJSONBytes() []byte {
+	jsonBytes, _ := json.Marshal(response)
+	return jsonBytes
+}
+
+func (response DeleteMetricsResponse) GetJSONString() string {
+	return string(response.GetJSONBytes())
+}
@@ -0,0 +1,33 @@
+package responses
+
+import "encoding/json"
+
+type RemoteWriteResponse struct {
+	DefaultResponse
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+	Dropped  int `json:"dropped"`
+}
+
+func NewRemoteWriteResponse() RemoteWriteResponse {
+	response := RemoteWriteResponse{}
+	response.Status = StatusOk
+
+	return response
+}
+
+func (response *RemoteWriteResponse) SetCounts(accepted, rejected, dropped int) *RemoteWriteResponse {
+	response.Accepted = accepted
+	response.Rejected = rejected
+	response.Dropped = dropped
+	return response
+}
+
+func (response RemoteWriteResponse) GetJSONBytes() []byte {
+	jsonBytes, _ := json.Marshal(response)
+	return jsonBytes
+}
+
+func (response RemoteWriteResponse) GetJSONString() string {
+	return string(response.GetJSONBytes())
+}
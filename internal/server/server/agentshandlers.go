@@ -0,0 +1,35 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"metrics/internal/server/responses"
+)
+
+// AgentsGetJSON
+// @Tags Agents
+// @Summary Agents that sent metrics
+// @ID agentsGetJSON
+// @Produce json
+// @Success 200 {array} agents.Agent
+// @Failure 500
+// @Router /agents [get]
+func (server Server) AgentsGetJSON(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	response := responses.NewDefaultResponse()
+
+	allValues, err := server.storage.ReadAll(request.Context())
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), storageErrorStatus(err))
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(rw).Encode(server.agents.List(allValues, time.Now()))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"metrics/internal/server/alerts"
+	"metrics/internal/server/config"
+	"metrics/internal/server/responses"
+	"metrics/internal/server/storage"
+)
+
+// AlertsGetJSON
+// @Tags Alerts
+// @Summary Pending, firing and recently resolved alerts
+// @ID alertsGetJSON
+// @Produce json
+// @Success 200 {array} alerts.Alert
+// @Router /alerts [get]
+func (server Server) AlertsGetJSON(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+
+	rw.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(rw).Encode(server.alerts.Alerts())
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// SilencesGetJSON
+// @Tags Alerts
+// @Summary Active and scheduled silences
+// @ID silencesGetJSON
+// @Produce json
+// @Success 200 {array} alerts.Silence
+// @Router /silences [get]
+func (server Server) SilencesGetJSON(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+
+	rw.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(rw).Encode(server.silences.List(time.Now()))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// SilencePostJSON
+// @Tags Alerts
+// @Summary Silence alert notifications
+// @Description starts_at по умолчанию - текущее время, вместо ends_at можно передать duration.
+// @ID silencePostJSON
+// @Accept json
+// @Produce json
+// @Success 201 {object} alerts.Silence
+// @Failure 400
+// @Router /silences [post]
+func (server Server) SilencePostJSON(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	response := responses.NewDefaultResponse()
+
+	inputJSON := struct {
+		alerts.Silence
+		Duration config.Duration `json:"duration,omitempty"`
+	}{}
+
+	err := json.NewDecoder(request.Body).Decode(&inputJSON)
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	silence := inputJSON.Silence
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = time.Now()
+	}
+	if silence.EndsAt.IsZero() && inputJSON.Duration > 0 {
+		silence.EndsAt = silence.StartsAt.Add(time.Duration(inputJSON.Duration))
+	}
+
+	silence, err = server.silences.Add(silence)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, alerts.ErrInvalidSilence) || errors.Is(err, storage.ErrInvalidLabelName) {
+			status = http.StatusBadRequest
+		}
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), status)
+		return
+	}
+
+	rw.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(rw).Encode(silence)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// DeleteSilence
+// @Tags Alerts
+// @Summary Delete silence
+// @ID deleteSilence
+// @Produce plain
+// @Param id path string true "Идентификатор заглушения"
+// @Success 200
+// @Failure 404
+// @Router /silences/{id} [delete]
+func (server Server) DeleteSilence(rw http.ResponseWriter, request *http.Request) {
+	err := server.silences.Delete(chi.URLParam(request, "id"))
+	if err != nil {
+		rw.WriteHeader(http.StatusNotFound)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte("Ok"))
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/alerts"
+	"metrics/internal/server/config"
+)
+
+func TestAlertsGetJSON(t *testing.T) {
+	server := newTestServer(t, config.Config{})
+
+	response := serve(t, server, http.MethodGet, "/alerts", nil)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, "application/json", response.Header().Get("Content-Type"))
+}
+
+func TestSilences(t *testing.T) {
+	server := newTestServer(t, config.Config{})
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "rule with duration", body: `{"rule":"HighAlloc","duration":"1h"}`, status: http.StatusCreated},
+		{name: "labels with ends_at", body: `{"labels":{"source":"web-1"},"ends_at":"2100-01-01T00:00:00Z"}`, status: http.StatusCreated},
+		{name: "no rule and labels", body: `{"duration":"1h"}`, status: http.StatusBadRequest},
+		{name: "no end", body: `{"rule":"HighAlloc"}`, status: http.StatusBadRequest},
+		{name: "invalid label", body: `{"labels":{"1source":"web-1"},"duration":"1h"}`, status: http.StatusBadRequest},
+		{name: "invalid duration", body: `{"rule":"HighAlloc","duration":"hour"}`, status: http.StatusBadRequest},
+		{name: "invalid json", body: `{`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := serve(t, server, http.MethodPost, "/silences", strings.NewReader(tt.body), "Content-Type", "application/json")
+			require.Equal(t, tt.status, response.Code, response.Body.String())
+		})
+	}
+
+	response := serve(t, server, http.MethodGet, "/silences", nil)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var silences []alerts.Silence
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&silences))
+	require.Len(t, silences, 2)
+
+	response = serve(t, server, http.MethodDelete, "/silences/"+silences[0].ID, nil)
+	require.Equal(t, http.StatusOK, response.Code)
+	response = serve(t, server, http.MethodDelete, "/silences/"+silences[0].ID, nil)
+	require.Equal(t, http.StatusNotFound, response.Code)
+}
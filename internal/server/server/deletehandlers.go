@@ -0,0 +1,143 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"metrics/internal/server/responses"
+	"metrics/internal/server/storage"
+)
+
+// DeleteMetric
+// @Tags Delete
+// @Summary Delete metric
+// @ID deleteMetric
+// @Produce plain
+// @Param statType path string true "Тип метрики" Enums(gauge, counter, histogram, summary)
+// @Param statName path string true "Имя метрики"
+// @Param label query []string false "Селектор меток в формате name:value"
+// @Param source query string false "Источник (агент)"
+// @Success 200
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /value/{statType}/{statName} [delete]
+func (server Server) DeleteMetric(rw http.ResponseWriter, request *http.Request) {
+	statType := chi.URLParam(request, "statType")
+	statName := chi.URLParam(request, "statName")
+
+	labels, err := parseSelectorQuery(request.URL.Query())
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+
+	keys, err := server.selectSeries(request.Context(), statName, statType, labels)
+	if err != nil {
+		rw.WriteHeader(storageErrorStatus(err))
+		rw.Write([]byte(err.Error()))
+		return
+	}
+
+	for _, key := range keys {
+		err = server.storage.Delete(request.Context(), key, statType)
+		if err != nil {
+			rw.WriteHeader(storageErrorStatus(err))
+			rw.Write([]byte(err.Error()))
+			return
+		}
+
+		log.Printf("Delete %v: %v\n", statType, key)
+	}
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte("Ok"))
+}
+
+// DeleteMetrics
+// @Tags Delete
+// @Summary Delete metrics by name pattern
+// @ID deleteMetrics
+// @Produce json
+// @Param pattern query string true "Шаблон имени метрики (path.Match), например Alloc*"
+// @Param type query string false "Тип метрики, по умолчанию все типы" Enums(gauge, counter, histogram, summary)
+// @Success 200 {object} responses.DeleteMetricsResponse
+// @Failure 400 {object} responses.DeleteMetricsResponse
+// @Failure 500 {object} responses.DeleteMetricsResponse
+// @Router /value/ [delete]
+func (server Server) DeleteMetrics(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	response := responses.NewDeleteMetricsResponse()
+
+	query := request.URL.Query()
+	pattern := query.Get("pattern")
+	if pattern == "" {
+		http.Error(rw, response.SetStatusError(errors.New("pattern is required")).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	metricType := query.Get("type")
+	switch metricType {
+	case "", storage.MeticTypeGauge, storage.MeticTypeCounter, storage.MeticTypeHistogram, storage.MeticTypeSummary:
+	default:
+		http.Error(rw, response.SetStatusError(errors.New("unknown type")).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := server.storage.DeleteMatching(request.Context(), metricType, pattern)
+	response.SetDeleted(deleted)
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), storageErrorStatus(err))
+		return
+	}
+
+	log.Printf("Delete %d metrics by pattern %q\n", deleted, pattern)
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(response.GetJSONBytes())
+}
+
+// ResetCounterPost
+// @Tags Delete
+// @Summary Reset counter metric to 0
+// @ID resetCounterPost
+// @Produce plain
+// @Param statName path string true "Имя метрики"
+// @Param label query []string false "Селектор меток в формате name:value"
+// @Param source query string false "Источник (агент)"
+// @Success 200
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /reset/counter/{statName} [post]
+func (server Server) ResetCounterPost(rw http.ResponseWriter, request *http.Request) {
+	statName := chi.URLParam(request, "statName")
+
+	labels, err := parseSelectorQuery(request.URL.Query())
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+
+	keys, err := server.selectSeries(request.Context(), statName, storage.MeticTypeCounter, labels)
+	if err != nil {
+		rw.WriteHeader(storageErrorStatus(err))
+		rw.Write([]byte(err.Error()))
+		return
+	}
+
+	for _, key := range keys {
+		err = server.storage.ResetCounter(request.Context(), key)
+		if err != nil {
+			rw.WriteHeader(storageErrorStatus(err))
+			rw.Write([]byte(err.Error()))
+			return
+		}
+
+		log.Printf("Reset counter: %v\n", key)
+	}
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte("Ok"))
+}
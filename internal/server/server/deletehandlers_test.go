@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/agents"
+	"metrics/internal/server/config"
+)
+
+func TestResetCounterPost(t *testing.T) {
+	server := newTestServer(t, config.Config{})
+
+	for _, agentID := range []string{"web-1", "web-2"} {
+		response := serve(t, server, http.MethodPost, "/update/counter/PollCount/5", nil, agents.HeaderAgentID, agentID)
+		require.Equal(t, http.StatusOK, response.Code)
+	}
+
+	response := serve(t, server, http.MethodPost, "/reset/counter/PollCount?source=web-1", nil)
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	require.Equal(t, "0", serve(t, server, http.MethodGet, "/value/counter/PollCount?source=web-1", nil).Body.String())
+	require.Equal(t, "5", serve(t, server, http.MethodGet, "/value/counter/PollCount?source=web-2", nil).Body.String())
+
+	// Без source сбрасываются серии всех источников
+	response = serve(t, server, http.MethodPost, "/reset/counter/PollCount", nil)
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	require.Equal(t, "0", serve(t, server, http.MethodGet, "/value/counter/PollCount?aggregate=sum", nil).Body.String())
+
+	response = serve(t, server, http.MethodPost, "/reset/counter/Frees", nil)
+	require.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestDeleteMetric(t *testing.T) {
+	server := newTestServer(t, config.Config{})
+
+	for _, agentID := range []string{"web-1", "web-2", "web-3"} {
+		response := serve(t, server, http.MethodPost, "/update/gauge/Alloc/1", nil, agents.HeaderAgentID, agentID)
+		require.Equal(t, http.StatusOK, response.Code)
+	}
+
+	response := serve(t, server, http.MethodDelete, "/value/gauge/Alloc?source=web-1", nil)
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	require.Equal(t, http.StatusNotFound, serve(t, server, http.MethodGet, "/value/gauge/Alloc?source=web-1", nil).Code)
+	require.Equal(t, http.StatusOK, serve(t, server, http.MethodGet, "/value/gauge/Alloc?source=web-2", nil).Code)
+
+	// Без source удаляются серии всех источников
+	response = serve(t, server, http.MethodDelete, "/value/gauge/Alloc", nil)
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	require.Equal(t, http.StatusNotFound, serve(t, server, http.MethodGet, "/value/gauge/Alloc", nil).Code)
+
+	response = serve(t, server, http.MethodDelete, "/value/gauge/Alloc", nil)
+	require.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestDeleteMetrics(t *testing.T) {
+	server := newTestServer(t, config.Config{})
+
+	for _, target := range []string{"/update/gauge/Alloc/1", "/update/gauge/AllocRate/2", "/update/counter/AllocCount/3", "/update/gauge/Frees/4"} {
+		response := serve(t, server, http.MethodPost, target, nil)
+		require.Equal(t, http.StatusOK, response.Code)
+	}
+
+	response := serve(t, server, http.MethodDelete, "/value/?pattern=Alloc*&type=gauge", nil)
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	require.JSONEq(t, `{"status":"ok","deleted":2}`, response.Body.String())
+	require.Equal(t, http.StatusOK, serve(t, server, http.MethodGet, "/value/counter/AllocCount", nil).Code)
+
+	require.Equal(t, http.StatusBadRequest, serve(t, server, http.MethodDelete, "/value/", nil).Code)
+	require.Equal(t, http.StatusBadRequest, serve(t, server, http.MethodDelete, "/value/?pattern=[", nil).Code)
+	require.Equal(t, http.StatusBadRequest, serve(t, server, http.MethodDelete, "/value/?pattern=A*&type=unknown", nil).Code)
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+
+	"metrics/internal/server/storage"
+)
+
+// storageErrorStatus - HTTP статус ответа по ошибке хранилища.
+// Неизвестные ошибки считаются ошибками сервера.
+func storageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrMetricNotFound),
+		errors.Is(err, storage.ErrUnknownMetricType):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrEmptyMetricValue),
+		errors.Is(err, storage.ErrInvalidHistogram),
+		errors.Is(err, storage.ErrInvalidSummary),
+		errors.Is(err, storage.ErrInvalidLabelName),
+		errors.Is(err, storage.ErrInvalidSeriesKey),
+		errors.Is(err, storage.ErrInvalidMetricID),
+		errors.Is(err, storage.ErrUnknownAggregation),
+		errors.Is(err, path.ErrBadPattern):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrHistogramBucketsMismatch):
+		return http.StatusConflict
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
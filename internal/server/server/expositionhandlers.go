@@ -0,0 +1,39 @@
+package server
+
+import (
+	"log"
+	"net/http"
+
+	"metrics/internal/server/contenttype"
+	"metrics/internal/server/exposition"
+	"metrics/internal/server/responses"
+)
+
+// MetricsExpositionGet
+// @Tags Value
+// @Summary All metrics in Prometheus text format, or in OpenMetrics format if it is requested by Accept header
+// @ID metricsExpositionGet
+// @Produce plain,application/openmetrics-text
+// @Success 200 {string} string
+// @Failure 500
+// @Router /metrics [get]
+func (server Server) MetricsExpositionGet(rw http.ResponseWriter, request *http.Request) {
+	format := exposition.FormatPrometheus
+	if contenttype.GetAcceptContentType(request.Header) == contenttype.ContentTypeOpenMetrics {
+		format = exposition.FormatOpenMetrics
+	}
+
+	allValues, err := server.storage.ReadAll(request.Context())
+	if err != nil {
+		response := responses.NewDefaultResponse()
+		rw.Header().Set("Content-Type", "application/json")
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), storageErrorStatus(err))
+		return
+	}
+
+	rw.Header().Set("Content-Type", format.ContentType())
+	rw.WriteHeader(http.StatusOK)
+	if err = exposition.Write(rw, allValues, format); err != nil {
+		log.Println(err)
+	}
+}
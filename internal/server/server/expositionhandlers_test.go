@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/agents"
+	"metrics/internal/server/config"
+	"metrics/internal/server/exposition"
+)
+
+func TestMetricsExpositionGet(t *testing.T) {
+	server := newTestServer(t, config.Config{})
+
+	response := serve(t, server, http.MethodPost, "/update/gauge/Alloc/1.5", nil, agents.HeaderAgentID, "web-1")
+	require.Equal(t, http.StatusOK, response.Code)
+	response = serve(t, server, http.MethodPost, "/update/counter/PollCount/3", nil)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	response = serve(t, server, http.MethodGet, "/metrics", nil)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, exposition.FormatPrometheus.ContentType(), response.Header().Get("Content-Type"))
+	require.Contains(t, response.Body.String(), "# TYPE Alloc gauge\n")
+	require.Contains(t, response.Body.String(), `Alloc{source="web-1"} 1.5`)
+	require.NotContains(t, response.Body.String(), "# EOF")
+
+	response = serve(t, server, http.MethodGet, "/metrics", nil, "Accept", "application/openmetrics-text; version=1.0.0")
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, exposition.FormatOpenMetrics.ContentType(), response.Header().Get("Content-Type"))
+	require.Contains(t, response.Body.String(), "# TYPE Alloc gauge\n")
+	require.Contains(t, response.Body.String(), "# EOF\n")
+}
@@ -7,8 +7,10 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi"
+	"metrics/internal/server/agents"
 	"metrics/internal/server/storage"
 )
 
@@ -19,6 +21,7 @@ import (
 // @Produce plain
 // @Param statName query string false "Имя метрики"
 // @Param statValue query string false "Значение"
+// @Param label query []string false "Метки в формате name:value"
 // @Success 200
 // @Failure 400
 // @Failure 500
@@ -34,15 +37,31 @@ func (server Server) UpdateGaugePost(rw http.ResponseWriter, request *http.Reque
 		return
 	}
 
-	err = server.storage.Update(statName, storage.MetricValue{
+	err = storage.ValidateMetricID(statName)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+
+	labels, err := parseLabelsQuery(request.URL.Query())
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+
+	source := agents.SourceFromRequest(request)
+	err = server.storage.Update(request.Context(), storage.SeriesKey(statName, labels.With(storage.SourceLabel, source.ID)), storage.MetricValue{
 		MType: storage.MeticTypeGauge,
 		Value: &statValueFloat,
 	})
 	if err != nil {
-		rw.WriteHeader(http.StatusInternalServerError)
-		rw.Write([]byte("Server error"))
+		rw.WriteHeader(storageErrorStatus(err))
+		rw.Write([]byte(err.Error()))
 		return
 	}
+	server.agents.Seen(source, time.Now())
 
 	log.Println("Update gauge:")
 	log.Printf("%v: %v\n", statName, statValue)
@@ -57,6 +76,7 @@ func (server Server) UpdateGaugePost(rw http.ResponseWriter, request *http.Reque
 // @Produce plain
 // @Param statName query string false "Имя метрики"
 // @Param statValue query string false "Значение"
+// @Param label query []string false "Метки в формате name:value"
 // @Success 200
 // @Failure 400
 // @Failure 500
@@ -71,15 +91,31 @@ func (server Server) UpdateCounterPost(rw http.ResponseWriter, request *http.Req
 		return
 	}
 
-	err = server.storage.Update(statName, storage.MetricValue{
+	err = storage.ValidateMetricID(statName)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+
+	labels, err := parseLabelsQuery(request.URL.Query())
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+
+	source := agents.SourceFromRequest(request)
+	err = server.storage.Update(request.Context(), storage.SeriesKey(statName, labels.With(storage.SourceLabel, source.ID)), storage.MetricValue{
 		MType: storage.MeticTypeCounter,
 		Delta: &statValueInt,
 	})
 	if err != nil {
-		rw.WriteHeader(http.StatusInternalServerError)
+		rw.WriteHeader(storageErrorStatus(err))
 		rw.Write([]byte(err.Error()))
 		return
 	}
+	server.agents.Seen(source, time.Now())
 
 	log.Println("Inc counter:")
 	log.Printf("%v: %v\n", statName, statValue)
@@ -109,19 +145,37 @@ func (server Server) UpdateNotImplementedPost(rw http.ResponseWriter, _ *http.Re
 // @Summary Metric value
 // @ID printMetricGet
 // @Produce plain
-// @Param statType query string false "Тип метрики" Enums(gauge, counter) default(gauge)
+// @Param statType query string false "Тип метрики" Enums(gauge, counter, histogram, summary) default(gauge)
 // @Param statName query string false "Имя метрики"
+// @Param label query []string false "Селектор меток в формате name:value"
+// @Param source query string false "Источник (агент)"
+// @Param aggregate query string false "Агрегация серий всех подходящих источников" Enums(sum, avg, min, max)
 // @Success 200
+// @Failure 400
 // @Failure 404
+// @Failure 500
 // @Router /value/{statType}/{statName} [get]
 func (server Server) PrintMetricGet(rw http.ResponseWriter, request *http.Request) {
 	statType := chi.URLParam(request, "statType")
 	statName := chi.URLParam(request, "statName")
+	query := request.URL.Query()
 
-	metric, err := server.storage.Read(statName, statType)
+	labels, err := parseSelectorQuery(query)
 	if err != nil {
-		rw.WriteHeader(http.StatusNotFound)
-		rw.Write([]byte("Unknown statName"))
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+
+	var metric storage.MetricValue
+	if aggregation := query.Get("aggregate"); aggregation != "" {
+		metric, err = server.aggregateSeries(request.Context(), statName, statType, labels, aggregation)
+	} else {
+		_, metric, err = server.readSeries(request.Context(), statName, statType, labels)
+	}
+	if err != nil {
+		rw.WriteHeader(storageErrorStatus(err))
+		rw.Write([]byte(err.Error()))
 		return
 	}
 
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/agents"
+	"metrics/internal/server/config"
+	"metrics/internal/server/storage"
+)
+
+func TestPrintMetricGetSourceSelection(t *testing.T) {
+	server := newTestServer(t, config.Config{})
+
+	update := func(target, agentID string) {
+		response := serve(t, server, http.MethodPost, target, nil, agents.HeaderAgentID, agentID)
+		require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	}
+	update("/update/gauge/Alloc/2", "web-2")
+	update("/update/gauge/Alloc/1", "web-1")
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "source", target: "/value/gauge/Alloc?source=web-2", wantStatus: http.StatusOK, wantBody: "2"},
+		{name: "source label", target: "/value/gauge/Alloc?label=source:web-1", wantStatus: http.StatusOK, wantBody: "1"},
+		{name: "latest without source", target: "/value/gauge/Alloc", wantStatus: http.StatusOK, wantBody: "1"},
+		{name: "aggregate", target: "/value/gauge/Alloc?aggregate=sum", wantStatus: http.StatusOK, wantBody: "3"},
+		{name: "unknown aggregation", target: "/value/gauge/Alloc?aggregate=median", wantStatus: http.StatusBadRequest},
+		{name: "unknown source", target: "/value/gauge/Alloc?source=web-3", wantStatus: http.StatusNotFound},
+		{name: "unknown metric", target: "/value/gauge/Frees", wantStatus: http.StatusNotFound},
+		{name: "other type", target: "/value/counter/Alloc", wantStatus: http.StatusNotFound},
+		{name: "unknown type", target: "/value/unknown/Alloc", wantStatus: http.StatusNotFound},
+		{name: "invalid label", target: "/value/gauge/Alloc?label=source", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := serve(t, server, http.MethodGet, tt.target, nil)
+			require.Equal(t, tt.wantStatus, response.Code, response.Body.String())
+			if tt.wantBody != "" {
+				require.Equal(t, tt.wantBody, response.Body.String())
+			}
+		})
+	}
+
+	// Без source возвращается серия, обновлённая последней
+	time.Sleep(time.Millisecond)
+	update("/update/gauge/Alloc/5", "web-2")
+	response := serve(t, server, http.MethodGet, "/value/gauge/Alloc", nil)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, "5", response.Body.String())
+}
+
+func TestMetricValuePostJSONSourceSelection(t *testing.T) {
+	server := newTestServer(t, config.Config{})
+
+	for _, agentID := range []string{"web-1", "web-2"} {
+		response := serve(t, server, http.MethodPost, "/update/counter/PollCount/3", nil, agents.HeaderAgentID, agentID)
+		require.Equal(t, http.StatusOK, response.Code)
+	}
+
+	response := serve(t, server, http.MethodPost, "/value/", strings.NewReader(`{"id":"PollCount","type":"counter","source":"web-1"}`))
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	var metric storage.Metric
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&metric))
+	require.Equal(t, storage.Labels{storage.SourceLabel: "web-1"}, metric.Labels)
+	require.EqualValues(t, 3, *metric.Delta)
+
+	// Без source отвечает одна из серий с её метками, а не ошибка
+	response = serve(t, server, http.MethodPost, "/value/", strings.NewReader(`{"id":"PollCount","type":"counter"}`))
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	metric = storage.Metric{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&metric))
+	require.Contains(t, []string{"web-1", "web-2"}, metric.Labels[storage.SourceLabel])
+
+	response = serve(t, server, http.MethodPost, "/value/", strings.NewReader(`{"id":"PollCount","type":"counter","aggregate":"sum"}`))
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	metric = storage.Metric{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&metric))
+	require.EqualValues(t, 6, *metric.Delta)
+
+	response = serve(t, server, http.MethodPost, "/value/", strings.NewReader(`{"id":"PollCount","type":"counter","source":"web-3"}`))
+	require.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestAgentsGetJSON(t *testing.T) {
+	server := newTestServer(t, config.Config{})
+
+	for _, agentID := range []string{"web-1", "web-2"} {
+		response := serve(t, server, http.MethodPost, "/update/gauge/Alloc/1", nil, agents.HeaderAgentID, agentID)
+		require.Equal(t, http.StatusOK, response.Code)
+	}
+
+	response := serve(t, server, http.MethodGet, "/agents", nil)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var list []agents.Agent
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&list))
+	require.Len(t, list, 2)
+	for _, agent := range list {
+		require.Equal(t, 1, agent.Metrics)
+	}
+}
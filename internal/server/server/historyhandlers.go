@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"metrics/internal/server/responses"
+	"metrics/internal/server/storage"
+)
+
+// defaultHistoryRange - интервал истории по умолчанию, если не передан параметр from.
+const defaultHistoryRange = time.Hour
+
+// parseHistoryTime - разбор времени в формате RFC3339 или unix timestamp (секунды).
+func parseHistoryTime(value string, defaultValue time.Time) (time.Time, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	unixTime, err := strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		return time.Unix(unixTime, 0), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// HistoryMetricGet
+// @Tags Value
+// @Summary Metric history
+// @ID historyMetricGet
+// @Produce json
+// @Param statType path string true "Тип метрики" Enums(gauge, counter)
+// @Param statName path string true "Имя метрики"
+// @Param from query string false "Начало интервала (RFC3339 или unix timestamp), по умолчанию час назад"
+// @Param to query string false "Конец интервала (RFC3339 или unix timestamp), по умолчанию текущее время"
+// @Param step query string false "Шаг прореживания (например 1m)"
+// @Param label query []string false "Селектор меток в формате name:value"
+// @Param source query string false "Источник (агент)"
+// @Success 200
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /history/{statType}/{statName} [get]
+func (server Server) HistoryMetricGet(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	response := responses.NewDefaultResponse()
+
+	statType := chi.URLParam(request, "statType")
+	statName := chi.URLParam(request, "statName")
+	query := request.URL.Query()
+
+	to, err := parseHistoryTime(query.Get("to"), time.Now())
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	from, err := parseHistoryTime(query.Get("from"), to.Add(-defaultHistoryRange))
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	if from.After(to) {
+		http.Error(rw, response.SetStatusError(errors.New("from is after to")).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	var step time.Duration
+	if query.Get("step") != "" {
+		step, err = time.ParseDuration(query.Get("step"))
+		if err != nil || step < 0 {
+			http.Error(rw, response.SetStatusError(errors.New("invalid step")).GetJSONString(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	labels, err := parseSelectorQuery(query)
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	if statType != storage.MeticTypeGauge && statType != storage.MeticTypeCounter {
+		http.Error(rw, response.SetStatusError(errors.New("unknown statType")).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	// История ищется так же, как значение; для несуществующей серии возвращается пустая история
+	key, _, err := server.readSeries(request.Context(), statName, statType, labels)
+	if errors.Is(err, storage.ErrMetricNotFound) {
+		key, err = storage.SeriesKey(statName, labels), nil
+	}
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), storageErrorStatus(err))
+		return
+	}
+
+	_, seriesLabels, err := storage.ParseSeriesKey(key)
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), storageErrorStatus(err))
+		return
+	}
+
+	samples, err := server.storage.ReadHistory(request.Context(), key, statType, from, to, step)
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), storageErrorStatus(err))
+		return
+	}
+
+	answerJSON := struct {
+		ID      string                 `json:"id"`
+		Labels  storage.Labels         `json:"labels,omitempty"`
+		MType   string                 `json:"type"`
+		From    time.Time              `json:"from"`
+		To      time.Time              `json:"to"`
+		Samples []storage.MetricSample `json:"samples"`
+	}{
+		ID:      statName,
+		Labels:  seriesLabels,
+		MType:   statType,
+		From:    from,
+		To:      to,
+		Samples: samples,
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(rw).Encode(answerJSON)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/agents"
+	"metrics/internal/server/config"
+	"metrics/internal/server/storage"
+)
+
+func TestHistoryMetricGet(t *testing.T) {
+	server := newTestServer(t, config.Config{})
+
+	for _, target := range []string{"/update/gauge/Alloc/1", "/update/gauge/Alloc/2"} {
+		response := serve(t, server, http.MethodPost, target, nil, agents.HeaderAgentID, "web-1")
+		require.Equal(t, http.StatusOK, response.Code)
+	}
+	response := serve(t, server, http.MethodPost, "/update/gauge/Alloc/7", nil, agents.HeaderAgentID, "web-2")
+	require.Equal(t, http.StatusOK, response.Code)
+
+	response = serve(t, server, http.MethodGet, "/history/gauge/Alloc?source=web-1", nil)
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	history := struct {
+		ID      string                 `json:"id"`
+		Labels  storage.Labels         `json:"labels"`
+		Samples []storage.MetricSample `json:"samples"`
+	}{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&history))
+	require.Equal(t, "Alloc", history.ID)
+	require.Equal(t, "web-1", history.Labels[storage.SourceLabel])
+	require.Len(t, history.Samples, 2)
+	require.Equal(t, 1.0, *history.Samples[0].Value)
+	require.Equal(t, 2.0, *history.Samples[1].Value)
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{name: "unknown series", target: "/history/gauge/Frees", status: http.StatusOK},
+		{name: "unknown type", target: "/history/unknown/Alloc", status: http.StatusBadRequest},
+		{name: "invalid from", target: "/history/gauge/Alloc?from=yesterday", status: http.StatusBadRequest},
+		{name: "from after to", target: "/history/gauge/Alloc?from=200&to=100", status: http.StatusBadRequest},
+		{name: "invalid step", target: "/history/gauge/Alloc?step=-1m", status: http.StatusBadRequest},
+		{name: "invalid label", target: "/history/gauge/Alloc?label=source", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := serve(t, server, http.MethodGet, tt.target, nil)
+			require.Equal(t, tt.status, response.Code, response.Body.String())
+		})
+	}
+}
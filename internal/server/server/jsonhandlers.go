@@ -6,8 +6,10 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/asaskevich/govalidator"
+	"metrics/internal/server/agents"
 	"metrics/internal/server/responses"
 	"metrics/internal/server/storage"
 )
@@ -19,6 +21,8 @@ import (
 // @Produce json
 // @Success 200
 // @Failure 400
+// @Failure 409
+// @Failure 500
 // @Router /update/ [post]
 func (server Server) UpdateMetricPostJSON(rw http.ResponseWriter, request *http.Request) {
 	rw.Header().Set("Content-Type", "application/json")
@@ -44,9 +48,11 @@ func (server Server) UpdateMetricPostJSON(rw http.ResponseWriter, request *http.
 	}
 
 	newMetricValue := storage.MetricValue{
-		MType: inputJSON.MType,
-		Value: inputJSON.Value,
-		Delta: inputJSON.Delta,
+		MType:     inputJSON.MType,
+		Value:     inputJSON.Value,
+		Delta:     inputJSON.Delta,
+		Histogram: inputJSON.Histogram,
+		Summary:   inputJSON.Summary,
 	}
 
 	//Check sign
@@ -59,7 +65,7 @@ func (server Server) UpdateMetricPostJSON(rw http.ResponseWriter, request *http.
 			return
 		}
 
-		metricHash = newMetricValue.GetHash(inputJSON.ID, server.config.SignKey)
+		metricHash = newMetricValue.GetHash(inputJSON.SeriesKey(), server.config.SignKey)
 		if !hmac.Equal(requestMetricHash, metricHash) {
 			http.Error(rw, response.SetStatusError(errors.New("invalid hash")).GetJSONString(), http.StatusBadRequest)
 			return
@@ -67,11 +73,13 @@ func (server Server) UpdateMetricPostJSON(rw http.ResponseWriter, request *http.
 	}
 
 	//Update value
-	err = server.storage.Update(inputJSON.ID, newMetricValue)
+	source := agents.SourceFromRequest(request)
+	err = server.storage.Update(request.Context(), storage.SeriesKey(inputJSON.ID, inputJSON.Labels.With(storage.SourceLabel, source.ID)), newMetricValue)
 	if err != nil {
-		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), storageErrorStatus(err))
 		return
 	}
+	server.agents.Seen(source, time.Now())
 
 	rw.WriteHeader(http.StatusOK)
 	rw.Write(response.SetHash(hex.EncodeToString(metricHash)).GetJSONBytes())
@@ -85,6 +93,8 @@ func (server Server) UpdateMetricPostJSON(rw http.ResponseWriter, request *http.
 // @Param JSON body []storage.Metric true "JSON"
 // @Success 200
 // @Failure 400
+// @Failure 409
+// @Failure 500
 // @Router /updates/ [post]
 func (server Server) UpdateMetricBatchJSON(rw http.ResponseWriter, request *http.Request) {
 	rw.Header().Set("Content-Type", "application/json")
@@ -108,11 +118,17 @@ func (server Server) UpdateMetricBatchJSON(rw http.ResponseWriter, request *http
 		}
 	}
 
-	err = server.storage.UpdateManySliceMetric(MetricBatch)
+	source := agents.SourceFromRequest(request)
+	for i := range MetricBatch {
+		MetricBatch[i].Labels = MetricBatch[i].Labels.With(storage.SourceLabel, source.ID)
+	}
+
+	err = server.storage.UpdateManySliceMetric(request.Context(), MetricBatch)
 	if err != nil {
-		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), storageErrorStatus(err))
 		return
 	}
+	server.agents.Seen(source, time.Now())
 
 	rw.WriteHeader(http.StatusOK)
 	rw.Write(response.GetJSONBytes())
@@ -127,12 +143,16 @@ func (server Server) UpdateMetricBatchJSON(rw http.ResponseWriter, request *http
 // @Success 200
 // @Failure 400
 // @Failure 404
+// @Failure 500
 // @Router /value/ [post]
 func (server Server) MetricValuePostJSON(rw http.ResponseWriter, request *http.Request) {
 	rw.Header().Set("Content-Type", "application/json")
 	var InputMetricsJSON struct {
-		ID    string `json:"id" valid:"required"`
-		MType string `json:"type" valid:"required,in(counter|gauge)"`
+		ID        string         `json:"id" valid:"required"`
+		MType     string         `json:"type" valid:"required,in(counter|gauge|histogram|summary)"`
+		Labels    storage.Labels `json:"labels,omitempty" valid:"labels"`
+		Source    string         `json:"source,omitempty"`
+		Aggregate string         `json:"aggregate,omitempty" valid:"in(sum|avg|min|max)"`
 	}
 
 	err := json.NewDecoder(request.Body).Decode(&InputMetricsJSON)
@@ -147,28 +167,55 @@ func (server Server) MetricValuePostJSON(rw http.ResponseWriter, request *http.R
 		return
 	}
 
-	statValue, err := server.storage.Read(InputMetricsJSON.ID, InputMetricsJSON.MType)
+	selector := storage.Labels{}
+	for name, value := range InputMetricsJSON.Labels {
+		selector[name] = value
+	}
+	if InputMetricsJSON.Source != "" {
+		selector[storage.SourceLabel] = InputMetricsJSON.Source
+	}
+
+	// Агрегированное значение описывается селектором, значение серии - её метками
+	seriesLabels := selector
+	var statValue storage.MetricValue
+	if InputMetricsJSON.Aggregate != "" {
+		statValue, err = server.aggregateSeries(request.Context(), InputMetricsJSON.ID, InputMetricsJSON.MType, selector, InputMetricsJSON.Aggregate)
+	} else {
+		var seriesKey string
+		seriesKey, statValue, err = server.readSeries(request.Context(), InputMetricsJSON.ID, InputMetricsJSON.MType, selector)
+		if err == nil {
+			_, seriesLabels, err = storage.ParseSeriesKey(seriesKey)
+		}
+	}
 	if err != nil {
-		http.Error(rw, "Unknown statName", http.StatusNotFound)
+		http.Error(rw, err.Error(), storageErrorStatus(err))
 		return
 	}
 
 	answerJSON := struct {
 		storage.Metric
-		Hash string `json:"hash"`
+		Hash  string `json:"hash"`
+		Stale bool   `json:"stale,omitempty"`
 	}{
 		Metric: storage.Metric{
-			ID: InputMetricsJSON.ID,
+			ID:     InputMetricsJSON.ID,
+			Labels: seriesLabels,
 			MetricValue: storage.MetricValue{
-				MType: statValue.MType,
-				Delta: statValue.Delta,
-				Value: statValue.Value,
+				MType:     statValue.MType,
+				Delta:     statValue.Delta,
+				Value:     statValue.Value,
+				Histogram: statValue.Histogram,
+				Summary:   statValue.Summary,
+				UpdatedAt: statValue.UpdatedAt,
 			},
 		},
+		Stale: server.isStale(statValue, time.Now()),
 	}
 
+	// Подпись не зависит от источника: агент проверяет её по своим меткам
 	if server.config.SignKey != "" {
-		answerJSON.Hash = hex.EncodeToString(answerJSON.GetHash(InputMetricsJSON.ID, server.config.SignKey))
+		hashKey := storage.SeriesKey(InputMetricsJSON.ID, seriesLabels.Without(storage.SourceLabel))
+		answerJSON.Hash = hex.EncodeToString(answerJSON.GetHash(hashKey, server.config.SignKey))
 	}
 
 	rw.WriteHeader(http.StatusOK)
@@ -186,13 +233,13 @@ func (server Server) MetricValuePostJSON(rw http.ResponseWriter, request *http.R
 // @Success 200
 // @Failure 500
 // @Router /ping [get]
-func (server Server) PingGetJSON(rw http.ResponseWriter, _ *http.Request) {
+func (server Server) PingGetJSON(rw http.ResponseWriter, request *http.Request) {
 	rw.Header().Set("Content-Type", "application/json")
 	response := responses.NewDefaultResponse()
-	pingError := server.storage.Ping()
+	pingError := server.storage.Ping(request.Context())
 
 	if pingError != nil {
-		http.Error(rw, response.SetStatusError(pingError).GetJSONString(), http.StatusInternalServerError)
+		http.Error(rw, response.SetStatusError(pingError).GetJSONString(), storageErrorStatus(pingError))
 		return
 	}
 
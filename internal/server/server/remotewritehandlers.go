@@ -0,0 +1,68 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"metrics/internal/server/agents"
+	"metrics/internal/server/remotewrite"
+	"metrics/internal/server/responses"
+)
+
+// RemoteWritePost
+// @Tags Update
+// @Summary Prometheus remote write: snappy compressed protobuf WriteRequest, samples are stored as gauges and counters
+// @ID remoteWritePost
+// @Accept application/x-protobuf
+// @Produce json
+// @Success 200 {object} responses.RemoteWriteResponse
+// @Failure 400
+// @Failure 413
+// @Failure 500
+// @Router /api/v1/write [post]
+func (server Server) RemoteWritePost(rw http.ResponseWriter, request *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	response := responses.NewRemoteWriteResponse()
+
+	maxBodySize := remotewrite.MaxBodySize(server.config.RemoteWriteMaxSize)
+	if request.ContentLength > maxBodySize {
+		http.Error(rw, response.SetStatusError(remotewrite.ErrTooLarge).GetJSONString(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Без Content-Length (chunked) размер известен только после чтения: читается на байт больше допустимого
+	body, err := io.ReadAll(io.LimitReader(request.Body, maxBodySize+1))
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > maxBodySize {
+		http.Error(rw, response.SetStatusError(remotewrite.ErrTooLarge).GetJSONString(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	writeRequest, err := remotewrite.Decode(body, server.config.RemoteWriteMaxSize)
+	if errors.Is(err, remotewrite.ErrTooLarge) {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), http.StatusBadRequest)
+		return
+	}
+
+	source := agents.SourceFromRequest(request)
+	result, err := remotewrite.Write(request.Context(), server.storage, writeRequest, source.ID)
+	if err != nil {
+		http.Error(rw, response.SetStatusError(err).GetJSONString(), storageErrorStatus(err))
+		return
+	}
+	if result.Accepted > 0 {
+		server.agents.Seen(source, time.Now())
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(response.SetCounts(result.Accepted, result.Rejected, result.Dropped).GetJSONBytes())
+}
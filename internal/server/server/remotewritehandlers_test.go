@@ -0,0 +1,58 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"metrics/internal/server/config"
+	"metrics/internal/server/remotewrite"
+	"metrics/proto/prompb"
+)
+
+func TestRemoteWritePost(t *testing.T) {
+	server := newTestServer(t, config.Config{RemoteWriteMaxSize: 1024})
+
+	writeRequest := &prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []*prompb.Sample{{Value: 1, Timestamp: 1000}},
+	}}}
+	data, err := proto.Marshal(writeRequest)
+	require.NoError(t, err)
+	body := snappy.Encode(nil, data)
+
+	// Размер тела проверяется до распаковки
+	large := bytes.Repeat([]byte{0xff}, int(remotewrite.MaxBodySize(1024))+1)
+
+	tests := []struct {
+		name          string
+		body          []byte
+		contentLength bool
+		wantStatus    int
+	}{
+		{name: "ok", body: body, contentLength: true, wantStatus: http.StatusOK},
+		{name: "content length over limit", body: large, contentLength: true, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "chunked over limit", body: large, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "not snappy", body: []byte("metrics"), contentLength: true, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/v1/write", nil)
+			// Без ContentLength тело читается как chunked: размер заранее неизвестен
+			request.Body = io.NopCloser(bytes.NewReader(tt.body))
+			request.ContentLength = -1
+			if tt.contentLength {
+				request.ContentLength = int64(len(tt.body))
+			}
+
+			recorder := httptest.NewRecorder()
+			server.chiRouter.ServeHTTP(recorder, request)
+			require.Equal(t, tt.wantStatus, recorder.Code, recorder.Body.String())
+		})
+	}
+}
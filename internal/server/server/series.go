@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"metrics/internal/server/storage"
+)
+
+var (
+	ErrInvalidLabelQuery = errors.New("invalid label, expected label=name:value")
+)
+
+// parseLabelsQuery - метки из query параметров вида label=name:value.
+func parseLabelsQuery(query url.Values) (storage.Labels, error) {
+	labels := storage.Labels{}
+
+	for _, label := range query["label"] {
+		name, value, ok := strings.Cut(label, ":")
+		if !ok {
+			return nil, ErrInvalidLabelQuery
+		}
+		labels[name] = value
+	}
+
+	return labels, labels.Validate()
+}
+
+// parseSelectorQuery - селектор серий из query параметров label=name:value и source.
+func parseSelectorQuery(query url.Values) (storage.Labels, error) {
+	labels, err := parseLabelsQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if source := query.Get("source"); source != "" {
+		labels[storage.SourceLabel] = source
+	}
+
+	return labels, nil
+}
+
+// isStale - gauge устарел: в него не было записи дольше, чем Stale.Factor интервалов отправки метрик агентами.
+func (server Server) isStale(metric storage.MetricValue, now time.Time) bool {
+	staleAfter := server.config.Stale.StaleAfter()
+	return staleAfter > 0 && metric.IsStale(now.Add(-staleAfter))
+}
+
+// readSeries - чтение серии метрики по имени и селектору меток.
+// Сначала ищется серия с точно таким набором меток, затем серии, содержащие метки селектора.
+// Если селектору соответствует несколько серий (например, запрос без source при нескольких агентах),
+// возвращается последняя обновлённая - как до появления меток, когда метрику перезаписывал любой агент.
+// Поиск по селектору выполняется, только если точной серии нет, остальные ошибки хранилища возвращаются сразу.
+func (server Server) readSeries(ctx context.Context, id, metricType string, selector storage.Labels) (string, storage.MetricValue, error) {
+	key := storage.SeriesKey(id, selector)
+	metric, err := server.storage.Read(ctx, key, metricType)
+	if !errors.Is(err, storage.ErrMetricNotFound) {
+		return key, metric, err
+	}
+
+	series, keys, readErr := server.matchSeries(ctx, id, metricType, selector)
+	if readErr != nil {
+		return "", storage.MetricValue{}, readErr
+	}
+	if len(keys) == 0 {
+		return "", storage.MetricValue{}, err
+	}
+
+	key = latestSeries(series, keys)
+	return key, series[key], nil
+}
+
+// selectSeries - ключи серий для удаления и сброса: серия с точно таким набором меток,
+// а если её нет - все серии, содержащие метки селектора, например метрика всех источников при запросе без source.
+func (server Server) selectSeries(ctx context.Context, id, metricType string, selector storage.Labels) ([]string, error) {
+	key := storage.SeriesKey(id, selector)
+	_, err := server.storage.Read(ctx, key, metricType)
+	if !errors.Is(err, storage.ErrMetricNotFound) {
+		return []string{key}, err
+	}
+
+	_, keys, readErr := server.matchSeries(ctx, id, metricType, selector)
+	if readErr != nil {
+		return nil, readErr
+	}
+	if len(keys) == 0 {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// matchSeries - серии метрики id и отсортированные ключи тех из них, метки которых соответствуют селектору.
+func (server Server) matchSeries(ctx context.Context, id, metricType string, selector storage.Labels) (storage.MetricMap, []string, error) {
+	series, err := server.storage.ReadSeries(ctx, id, metricType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return series, storage.MatchSeries(series, id, selector), nil
+}
+
+// latestSeries - ключ последней обновлённой серии, при равном времени обновления - первый по порядку ключей.
+func latestSeries(series storage.MetricMap, keys []string) string {
+	latest := keys[0]
+	for _, key := range keys[1:] {
+		updatedAt := series[key].UpdatedAt
+		latestUpdatedAt := series[latest].UpdatedAt
+		if updatedAt != nil && (latestUpdatedAt == nil || updatedAt.After(*latestUpdatedAt)) {
+			latest = key
+		}
+	}
+
+	return latest
+}
+
+// aggregateSeries - агрегация значений всех серий метрики, метки которых соответствуют селектору,
+// например одной метрики всех источников.
+func (server Server) aggregateSeries(ctx context.Context, id, metricType string, selector storage.Labels, aggregation string) (storage.MetricValue, error) {
+	series, keys, err := server.matchSeries(ctx, id, metricType, selector)
+	if err != nil {
+		return storage.MetricValue{}, err
+	}
+
+	values := make([]storage.MetricValue, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, series[key])
+	}
+
+	return storage.AggregateValues(values, aggregation)
+}
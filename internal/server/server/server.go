@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rsa"
 	"errors"
+	"html/template"
 	"io/fs"
 	"log"
 	"net"
@@ -12,37 +13,73 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 	handlerRSA "metrics/internal/rsa"
 	grpcServices "metrics/internal/server/grpc"
+	"metrics/internal/tlsconfig"
 
 	_ "net/http/pprof"
 
 	"github.com/go-chi/chi"
 	chimiddleware "github.com/go-chi/chi/middleware"
+	"metrics/internal/server/agents"
+	"metrics/internal/server/alerts"
 	"metrics/internal/server/config"
+	"metrics/internal/server/events"
 	"metrics/internal/server/middleware"
+	"metrics/internal/server/statsd"
 	"metrics/internal/server/storage"
 	pb "metrics/proto"
 )
 
+// grpcShutdownTimeout - сколько ждать завершения запросов gRPC при остановке,
+// потоки UploadMetrics агенты держат открытыми и сами не завершают
+const grpcShutdownTimeout = 2 * time.Second
+
+// grpcHealthInterval - интервал проверки хранилища для подписчиков Watch сервиса проверки состояния gRPC
+const grpcHealthInterval = 5 * time.Second
+
 type Server struct {
 	storage       storage.MetricStorager
+	agents        *agents.Registry
+	alerts        *alerts.Engine
+	silences      *alerts.Silences
+	dispatcher    *alerts.Dispatcher
+	events        *events.Hub
+	templates     *template.Template
+	static        fs.FS
 	chiRouter     chi.Router
 	config        config.Config
 	privateKeyRSA *rsa.PrivateKey
 	startTime     time.Time
 	serverGRPC    *grpc.Server
+	grpcStats     *grpcServices.Stats
+	statsd        *statsd.Aggregator
 }
 
 func NewServer(config config.Config) (server *Server) {
-	var err error
-
 	server = &Server{
-		config:     config,
-		serverGRPC: grpc.NewServer(),
+		config: config,
+		agents: agents.NewRegistry(config.Stale.StaleAfter()),
+		events: events.NewHub(),
 	}
 	log.Println(server.config)
 
+	if config.GRPCStatsInterval > 0 {
+		server.grpcStats = grpcServices.NewStats()
+	}
+	grpcOptions, err := grpcServerOptions(config, server.grpcStats)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server.serverGRPC = grpc.NewServer(grpcOptions...)
+
+	if config.ServerStatsDAddr != "" || config.ServerStatsDTCPAddr != "" {
+		server.statsd = statsd.NewAggregator(server.agents)
+	}
+
 	if config.PrivateKeyRSA != "" {
 		server.privateKeyRSA, err = handlerRSA.ParsePrivateKeyRSA(config.PrivateKeyRSA)
 	}
@@ -50,12 +87,38 @@ func NewServer(config config.Config) (server *Server) {
 		log.Fatal("Parsing RSA key error")
 	}
 
+	var rulesFile alerts.RulesFile
+	if config.Alerts.RulesFile != "" {
+		rulesFile, err = alerts.LoadRules(config.Alerts.RulesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	server.templates, server.static, err = loadTemplates(config.TemplatesAbsPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server.alerts = alerts.NewEngine(rulesFile.Rules)
+	server.silences = alerts.NewSilences()
+	server.dispatcher = alerts.NewDispatcher(rulesFile.Routes, alerts.NewNotifiers(rulesFile.Receivers), server.silences)
+
 	return
 }
 
 func (server *Server) selectStorage() storage.MetricStorager {
 	storageConfig := server.config.Store
 
+	if storage.IsSQLiteDSN(storageConfig.DatabaseDSN) {
+		log.Println("SQLite Storage")
+		repository, err := storage.NewSQLiteRepo(storageConfig)
+		if err != nil {
+			panic(err)
+		}
+
+		return repository
+	}
+
 	if storageConfig.DatabaseDSN != "" {
 		log.Println("DB Storage")
 		repository, err := storage.NewDBRepo(storageConfig)
@@ -73,11 +136,20 @@ func (server *Server) selectStorage() storage.MetricStorager {
 }
 
 func (server *Server) initStorage() {
-	metricsMemoryRepo := server.selectStorage()
-	server.storage = metricsMemoryRepo
+	repository := server.selectStorage()
+
+	if server.config.Store.Cache.FlushInterval > 0 {
+		log.Println("Write-behind cache enabled")
+		cachedRepo, err := storage.NewCachedRepo(repository, server.config.Store.Cache)
+		if err != nil {
+			panic(err)
+		}
+		repository = cachedRepo
+	}
+	server.storage = events.NewRepo(repository, server.events)
 
 	if server.config.Store.Restore {
-		server.storage.InitFromFile()
+		server.storage.InitFromFile(context.Background())
 	}
 }
 
@@ -99,11 +171,25 @@ func (server *Server) initRouter() {
 	}
 
 	router.Get("/", server.PrintAllMetricStatic)
+	router.Handle("/static/*", http.StripPrefix("/static/", http.FileServer(http.FS(server.static))))
 	router.Get("/ping", server.PingGetJSON)
+	router.Get("/stream", server.StreamGet)
+	router.Get("/metrics", server.MetricsExpositionGet)
+	router.Get("/agents", server.AgentsGetJSON)
+	router.Get("/alerts", server.AlertsGetJSON)
+	router.Get("/silences", server.SilencesGetJSON)
+	router.Post("/silences", server.SilencePostJSON)
+	router.Delete("/silences/{id}", server.DeleteSilence)
 	router.Get("/value/{statType}/{statName}", server.PrintMetricGet)
+	router.Get("/history/{statType}/{statName}", server.HistoryMetricGet)
+
+	router.Delete("/value/{statType}/{statName}", server.DeleteMetric)
 
 	router.Post("/value/", server.MetricValuePostJSON)
+	router.Delete("/value/", server.DeleteMetrics)
 	router.Post("/updates/", server.UpdateMetricBatchJSON)
+	router.Post("/api/v1/write", server.RemoteWritePost)
+	router.Post("/reset/counter/{statName}", server.ResetCounterPost)
 
 	router.Route("/update/", func(router chi.Router) {
 		router.Post("/", server.UpdateMetricPostJSON)
@@ -116,13 +202,26 @@ func (server *Server) initRouter() {
 	server.chiRouter = router
 }
 
-func (server *Server) RunServerGRPC() (err error) {
+// RunServerGRPC - запуск gRPC сервера: сервис метрик, проверка состояния и, если включён, reflection.
+// Состояние хранилища и учёт запросов обновляются до отмены ctx.
+func (server *Server) RunServerGRPC(ctx context.Context) (err error) {
 	lis, err := net.Listen("tcp", server.config.ServerGRPCAddr)
 	if err != nil {
 		return
 	}
 
-	pb.RegisterMetricsServer(server.serverGRPC, grpcServices.NewMetricsService(server.storage))
+	pb.RegisterMetricsServer(server.serverGRPC, grpcServices.NewMetricsService(server.storage, server.agents, server.events))
+
+	healthServer := grpcServices.NewHealth(server.storage)
+	healthpb.RegisterHealthServer(server.serverGRPC, healthServer)
+	go healthServer.Run(ctx, grpcHealthInterval)
+
+	if server.config.GRPCReflection {
+		reflection.Register(server.serverGRPC)
+	}
+	if server.grpcStats != nil {
+		go server.grpcStats.Run(ctx, server.storage, time.Duration(server.config.GRPCStatsInterval))
+	}
 
 	go func() {
 		err = server.serverGRPC.Serve(lis)
@@ -134,15 +233,102 @@ func (server *Server) RunServerGRPC() (err error) {
 	return
 }
 
+// RunStatsD - запуск приёма метрик StatsD по UDP и TCP на заданных адресах.
+// Значения записываются в хранилище каждые StatsDFlushInterval до отмены ctx.
+func (server *Server) RunStatsD(ctx context.Context) error {
+	interval := time.Duration(server.config.StatsDFlushInterval)
+	if interval <= 0 {
+		return errors.New("StatsD flush interval must be positive")
+	}
+
+	if addr := server.config.ServerStatsDAddr; addr != "" {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return err
+		}
+		go statsd.ServeUDP(ctx, conn, server.statsd)
+	}
+	if addr := server.config.ServerStatsDTCPAddr; addr != "" {
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		go statsd.ServeTCP(ctx, lis, server.statsd)
+	}
+
+	go server.statsd.Run(ctx, server.storage, interval)
+
+	return nil
+}
+
+// grpcServerOptions - параметры gRPC сервера: перехватчики запросов с учётом в stats, TLS, если задан сертификат, и mTLS, если заданы CA клиентов.
+func grpcServerOptions(config config.Config, stats *grpcServices.Stats) ([]grpc.ServerOption, error) {
+	options, err := grpcServices.Interceptors(config.TrustedSubNet, config.SignKey, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := config.GRPCTLS
+	if tlsConfig.CertFile == "" {
+		if tlsConfig.ClientCAFile != "" {
+			return nil, errors.New("gRPC client CA requires server TLS certificate")
+		}
+		return options, nil
+	}
+
+	serverTLS, err := tlsconfig.Server(tlsConfig.CertFile, tlsConfig.KeyFile, tlsConfig.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(options, grpc.Creds(credentials.NewTLS(serverTLS))), nil
+}
+
+// gracefulStopGRPC - остановка gRPC сервера с ожиданием текущих запросов не дольше timeout, затем соединения закрываются.
+func gracefulStopGRPC(serverGRPC *grpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		serverGRPC.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		serverGRPC.Stop()
+	}
+}
+
 func (server *Server) Run(ctx context.Context) (err error) {
+	if server.config.Store.MigrateDryRun {
+		return server.printPendingMigrations()
+	}
+
 	server.initStorage()
-	defer server.storage.Close()
+	// Закрытие хранилища записывает изменения, накопленные в кеше
+	defer func() {
+		if closeErr := server.storage.Close(); closeErr != nil {
+			log.Println(closeErr)
+		}
+	}()
+
+	if interval := time.Duration(server.config.Store.Retention.CompactInterval); interval > 0 {
+		go server.runCompactor(ctx, interval)
+	}
+	if ttl := time.Duration(server.config.Stale.MetricTTL); ttl > 0 {
+		go server.runExpirer(ctx, ttl)
+	}
+	if interval := time.Duration(server.config.Alerts.EvalInterval); interval > 0 && len(server.alerts.Rules()) > 0 {
+		go server.runAlerts(ctx, interval)
+	}
 
 	server.initRouter()
 	serverHTTP := &http.Server{
 		Addr:    server.config.ServerAddr,
 		Handler: server.chiRouter,
 	}
+	// Потоки событий не завершаются сами, без закрытия подписок Shutdown ждал бы их бесконечно
+	serverHTTP.RegisterOnShutdown(server.events.Close)
 
 	eventServerStopped := sync.WaitGroup{}
 	eventServerStopped.Add(1)
@@ -152,10 +338,20 @@ func (server *Server) Run(ctx context.Context) (err error) {
 		if err = serverHTTP.Shutdown(context.Background()); err != nil {
 			log.Printf("HTTP server shutdown error: %v", err)
 		}
-		server.serverGRPC.GracefulStop()
+		gracefulStopGRPC(server.serverGRPC, grpcShutdownTimeout)
+		if server.grpcStats != nil {
+			if statsErr := server.grpcStats.Flush(context.Background(), server.storage); statsErr != nil {
+				log.Println(statsErr)
+			}
+		}
+		if server.statsd != nil {
+			if statsdErr := server.statsd.Flush(context.Background(), server.storage); statsdErr != nil {
+				log.Println(statsdErr)
+			}
+		}
 
 		if server.config.Store.Interval != storage.SyncUploadSymbol {
-			err = server.storage.Save()
+			err = server.storage.Save(context.Background())
 			if err != nil {
 				log.Println(err)
 			}
@@ -165,7 +361,13 @@ func (server *Server) Run(ctx context.Context) (err error) {
 	}()
 
 	if server.config.ServerGRPCAddr != "" {
-		err = server.RunServerGRPC()
+		err = server.RunServerGRPC(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if server.statsd != nil {
+		err = server.RunStatsD(ctx)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -185,6 +387,151 @@ func (server *Server) Run(ctx context.Context) (err error) {
 	return
 }
 
+// printPendingMigrations - вывод неприменённых миграций БД без их применения.
+func (server *Server) printPendingMigrations() error {
+	if server.config.Store.DatabaseDSN == "" {
+		return errors.New("migrations dry run requires database DSN")
+	}
+
+	var repository interface {
+		PendingMigrations() ([]storage.Migration, error)
+		Close() error
+	}
+	var err error
+	if storage.IsSQLiteDSN(server.config.Store.DatabaseDSN) {
+		repository, err = storage.NewSQLiteRepo(server.config.Store)
+	} else {
+		repository, err = storage.NewDBRepo(server.config.Store)
+	}
+	if err != nil {
+		return err
+	}
+	defer repository.Close()
+
+	pending, err := repository.PendingMigrations()
+	if err != nil {
+		return err
+	}
+
+	if len(pending) == 0 {
+		log.Println("No pending migrations")
+		return nil
+	}
+
+	log.Printf("Pending migrations (%d):\n", len(pending))
+	for _, migration := range pending {
+		log.Println(migration)
+	}
+
+	return nil
+}
+
+// runCompactor - периодическое прореживание истории по правилам хранения.
+func (server *Server) runCompactor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			err := server.storage.Compact(ctx, now)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// runExpirer - периодическое удаление серий, в которые не было записи дольше ttl.
+// Проверка идёт с интервалом отправки метрик агентами, но не реже ttl.
+func (server *Server) runExpirer(ctx context.Context, ttl time.Duration) {
+	interval := time.Duration(server.config.Stale.ReportInterval)
+	if interval <= 0 || interval > ttl {
+		interval = ttl
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expired, err := server.storage.Expire(ctx, now.Add(-ttl))
+			if err != nil {
+				log.Println(err)
+			}
+			if expired > 0 {
+				log.Printf("Expired %d series not written for %s\n", expired, ttl)
+			}
+		}
+	}
+}
+
+// alertsState - оповещения на момент проверки правил.
+type alertsState struct {
+	alerts []alerts.Alert
+	now    time.Time
+}
+
+// runAlerts - периодическая проверка правил оповещений. Уведомления отправляет runNotifications,
+// поэтому медленный или недоступный получатель не задерживает проверку правил.
+func (server *Server) runAlerts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	states := make(chan alertsState, 1)
+	go server.runNotifications(ctx, states)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			allValues, err := server.storage.ReadAll(ctx)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			for _, alert := range server.alerts.Evaluate(allValues, now) {
+				log.Printf("Alert %s %s: %s %s %v (value %v)\n", alert.Rule, alert.State, alert.Series, alert.Op, alert.Threshold, alert.Value)
+			}
+
+			queueAlertsState(states, alertsState{alerts: server.alerts.Alerts(), now: now})
+		}
+	}
+}
+
+// queueAlertsState - передача состояния оповещений на отправку уведомлений без ожидания.
+// Неотправленное предыдущее состояние заменяется новым: Dispatch сравнивает оповещения с тем,
+// о чём уже сообщено, поэтому достаточно последнего состояния. Вызывается только из runAlerts.
+func queueAlertsState(states chan alertsState, state alertsState) {
+	select {
+	case <-states:
+	default:
+	}
+	states <- state
+}
+
+// runNotifications - отправка уведомлений по состояниям оповещений до отмены ctx.
+func (server *Server) runNotifications(ctx context.Context, states <-chan alertsState) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case state := <-states:
+			err := server.dispatcher.Dispatch(ctx, state.alerts, state.now)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
 func (server *Server) Config() (config config.Config) {
 	return server.config
 }
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/agents"
+	"metrics/internal/server/alerts"
+	"metrics/internal/server/config"
+	"metrics/internal/server/events"
+	"metrics/internal/server/storage"
+)
+
+// newTestServer - сервер с хранилищем в ОП и маршрутами HTTP API, без gRPC, StatsD и правил оповещений.
+func newTestServer(t *testing.T, serverConfig config.Config) *Server {
+	server := &Server{
+		config:   serverConfig,
+		agents:   agents.NewRegistry(serverConfig.Stale.StaleAfter()),
+		events:   events.NewHub(),
+		alerts:   alerts.NewEngine(nil),
+		silences: alerts.NewSilences(),
+	}
+	server.dispatcher = alerts.NewDispatcher(nil, nil, server.silences)
+	server.storage = events.NewRepo(storage.NewMetricsMemoryRepo(serverConfig.Store), server.events)
+	server.initRouter()
+	t.Cleanup(func() {
+		require.NoError(t, server.storage.Close())
+	})
+
+	return server
+}
+
+// serve - ответ сервера на запрос, headers - заголовки запроса парами имя, значение.
+func serve(t *testing.T, server *Server, method, target string, body io.Reader, headers ...string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, body)
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+
+	recorder := httptest.NewRecorder()
+	server.chiRouter.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+// blockingNotifier - получатель, отправка которому не завершается до отмены контекста.
+type blockingNotifier struct {
+	started chan struct{}
+}
+
+func (notifier blockingNotifier) Notify(ctx context.Context, notification alerts.Notification) error {
+	select {
+	case notifier.started <- struct{}{}:
+	default:
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRunAlertsSlowReceiver(t *testing.T) {
+	server := newTestServer(t, config.Config{})
+	server.alerts = alerts.NewEngine([]alerts.Rule{{Name: "HighAlloc", Metric: "Alloc", Type: storage.MeticTypeGauge, Op: ">", Threshold: 100}})
+	notifier := blockingNotifier{started: make(chan struct{}, 1)}
+	server.dispatcher = alerts.NewDispatcher([]alerts.Route{{Receiver: "slow"}}, map[string]alerts.Notifier{"slow": notifier}, alerts.NewSilences())
+
+	value := 150.0
+	require.NoError(t, server.storage.Update(context.Background(), "Alloc", storage.MetricValue{MType: storage.MeticTypeGauge, Value: &value}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.runAlerts(ctx, 10*time.Millisecond)
+
+	select {
+	case <-notifier.started:
+	case <-time.After(time.Second):
+		t.Fatal("notification is not sent")
+	}
+
+	// Пока уведомление не отправлено, правила продолжают проверяться
+	value = 50
+	require.NoError(t, server.storage.Update(context.Background(), "Alloc", storage.MetricValue{MType: storage.MeticTypeGauge, Value: &value}))
+	require.Eventually(t, func() bool {
+		for _, alert := range server.alerts.Alerts() {
+			if alert.State == alerts.StateFiring {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 10*time.Millisecond)
+}
@@ -2,26 +2,113 @@ package server
 
 import (
 	"html/template"
+	"io/fs"
 	"log"
 	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"metrics/internal/server/alerts"
+	"metrics/internal/server/storage"
+	"metrics/templates"
 )
 
+// dashboardSeries - серия на странице метрик, страница строится скриптом из этих данных.
+type dashboardSeries struct {
+	Key    string              `json:"key"`
+	ID     string              `json:"id"`
+	MType  string              `json:"type"`
+	Labels storage.Labels      `json:"labels,omitempty"`
+	Source string              `json:"source,omitempty"`
+	Value  storage.MetricValue `json:"value"`
+	Text   string              `json:"text"`
+	Stale  bool                `json:"stale,omitempty"`
+}
+
+// dashboardData - данные страницы метрик для скрипта.
+type dashboardData struct {
+	Series []dashboardSeries `json:"series"`
+	// StaleAfter - через сколько миллисекунд без записи gauge считается устаревшим, 0 - не устаревает
+	StaleAfter int64 `json:"stale_after_ms"`
+}
+
+// loadTemplates - разбор шаблонов страниц и статические файлы: встроенные в бинарный файл или из каталога dir.
+func loadTemplates(dir string) (*template.Template, fs.FS, error) {
+	var files fs.FS = templates.FS
+	if dir != "" {
+		files = os.DirFS(dir)
+	}
+
+	parsed, err := template.ParseFS(files, "*.html")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	static, err := fs.Sub(files, "static")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return parsed, static, nil
+}
+
 // PrintAllMetricStatic
 // @Tags Static
-// @Summary Metric list
+// @Summary Metrics dashboard
 // @ID printAllMetricStatic
 // @Produce html
 // @Success 200
+// @Failure 500
 // @Router / [get]
-func (server Server) PrintAllMetricStatic(rw http.ResponseWriter, _ *http.Request) {
-	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
-	t, err := template.ParseFiles(server.config.TemplatesAbsPath + "/index.html")
+func (server Server) PrintAllMetricStatic(rw http.ResponseWriter, request *http.Request) {
+	allValues, err := server.storage.ReadAll(request.Context())
 	if err != nil {
-		log.Println("Cant parse template ", err)
+		http.Error(rw, err.Error(), storageErrorStatus(err))
 		return
 	}
 
-	err = t.Execute(rw, server.storage.ReadAll())
+	now := time.Now()
+	data := dashboardData{
+		Series:     []dashboardSeries{},
+		StaleAfter: server.config.Stale.StaleAfter().Milliseconds(),
+	}
+	for metricType, metricMap := range allValues {
+		for key, value := range metricMap {
+			id, labels, err := storage.ParseSeriesKey(key)
+			if err != nil {
+				id = key
+			}
+
+			data.Series = append(data.Series, dashboardSeries{
+				Key:    key,
+				ID:     id,
+				MType:  metricType,
+				Labels: labels,
+				Source: labels[storage.SourceLabel],
+				Value:  value,
+				Text:   value.GetStringValue(),
+				Stale:  server.isStale(value, now),
+			})
+		}
+	}
+	sort.Slice(data.Series, func(i, j int) bool {
+		if data.Series[i].MType != data.Series[j].MType {
+			return data.Series[i].MType < data.Series[j].MType
+		}
+		return data.Series[i].Key < data.Series[j].Key
+	})
+
+	page := struct {
+		Alerts []alerts.Alert
+		Data   dashboardData
+	}{
+		Alerts: server.alerts.Alerts(),
+		Data:   data,
+	}
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = server.templates.ExecuteTemplate(rw, "index.html", page)
 	if err != nil {
 		log.Println("Cant render template ", err)
 		return
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"metrics/internal/server/contenttype"
+	"metrics/internal/server/events"
+	"metrics/internal/server/storage"
+)
+
+const (
+	// streamHeartbeat - интервал комментария в потоке событий, чтобы прокси не закрывали простаивающее соединение
+	streamHeartbeat = 15 * time.Second
+	// streamRetry - через сколько миллисекунд браузер переподключается после обрыва
+	streamRetry = 3000
+)
+
+// StreamGet
+// @Tags Static
+// @Summary Metric changes stream (Server-Sent Events)
+// @Description События update (новое значение серии), delete (серия удалена) и reload (значения нужно перечитать).
+// @ID streamGet
+// @Produce text/event-stream
+// @Param name query string false "Шаблон имени метрики (path.Match)"
+// @Param type query string false "Тип метрики" Enums(gauge, counter, histogram, summary)
+// @Success 200
+// @Failure 400
+// @Failure 500
+// @Router /stream [get]
+func (server Server) StreamGet(rw http.ResponseWriter, request *http.Request) {
+	filter := events.Filter{
+		Name:  request.URL.Query().Get("name"),
+		MType: request.URL.Query().Get("type"),
+	}
+	err := filter.Validate()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch filter.MType {
+	case "", storage.MeticTypeGauge, storage.MeticTypeCounter, storage.MeticTypeHistogram, storage.MeticTypeSummary:
+	default:
+		http.Error(rw, storage.ErrUnknownMetricType.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	stream, unsubscribe := server.events.Subscribe(filter)
+	defer unsubscribe()
+
+	rw.Header().Set("Content-Type", contenttype.ContentTypeEventStream.String())
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.WriteHeader(http.StatusOK)
+	fmt.Fprintf(rw, "retry: %d\n\n", streamRetry)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case event, ok := <-stream:
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", event.Kind, data)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(rw, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/config"
+	"metrics/internal/server/contenttype"
+)
+
+// readEvent - строки следующего события потока до пустой строки.
+func readEvent(t *testing.T, reader *bufio.Reader) string {
+	var event strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\n" {
+			return event.String()
+		}
+		event.WriteString(line)
+	}
+}
+
+func TestStreamGet(t *testing.T) {
+	server := newTestServer(t, config.Config{})
+	httpServer := httptest.NewServer(server.chiRouter)
+	defer httpServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Поток сжимается, события должны доходить до клиента сразу, а не по закрытии ответа
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, httpServer.URL+"/stream?type=gauge", nil)
+	require.NoError(t, err)
+	request.Header.Set("Accept-Encoding", "gzip")
+
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	response, err := client.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, contenttype.ContentTypeEventStream.String(), response.Header.Get("Content-Type"))
+	require.Equal(t, "gzip", response.Header.Get("Content-Encoding"))
+
+	gz, err := gzip.NewReader(response.Body)
+	require.NoError(t, err)
+	reader := bufio.NewReader(gz)
+	require.Equal(t, "retry: 3000\n", readEvent(t, reader))
+
+	update := serve(t, server, http.MethodPost, "/update/counter/PollCount/1", nil)
+	require.Equal(t, http.StatusOK, update.Code)
+	update = serve(t, server, http.MethodPost, "/update/gauge/Alloc/2", nil)
+	require.Equal(t, http.StatusOK, update.Code)
+
+	event := readEvent(t, reader)
+	require.True(t, strings.HasPrefix(event, "event: update\n"), event)
+	require.Contains(t, event, `"Alloc"`)
+	require.NotContains(t, event, "PollCount")
+
+	invalid := serve(t, server, http.MethodGet, "/stream?type=unknown", nil)
+	require.Equal(t, http.StatusBadRequest, invalid.Code)
+}
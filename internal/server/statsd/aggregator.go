@@ -0,0 +1,240 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"metrics/internal/server/agents"
+	"metrics/internal/server/storage"
+)
+
+// TimerBuckets - границы интервалов гистограмм таймеров, миллисекунды
+var TimerBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Aggregator - накопление значений StatsD между записями в хранилище.
+// Counter за интервал записывается как прирост, таймеры - как гистограмма наблюдений за интервал,
+// gauge - последним значением, если он менялся. Значения хранятся только за текущий интервал,
+// поэтому память не растёт с числом когда-либо присланных серий: относительные изменения gauge (+N, -N)
+// применяются при записи к значению из хранилища, в том числе после перезапуска сервера.
+// Серии получают метку source с адресом отправителя, отправители учитываются как агенты.
+type Aggregator struct {
+	mutex    *sync.Mutex
+	registry *agents.Registry
+	current  *interval
+	invalid  int
+}
+
+// interval - значения, накопленные за интервал между записями.
+type interval struct {
+	counters map[string]float64
+	gauges   map[string]gaugeValue
+	timers   map[string]*storage.HistogramValue
+	sources  map[string]struct{}
+}
+
+// gaugeValue - gauge за интервал: установленное значение с последующими изменениями или,
+// если значение за интервал не устанавливалось, сумма относительных изменений к значению хранилища.
+type gaugeValue struct {
+	value    float64
+	absolute bool
+}
+
+func newInterval() *interval {
+	return &interval{
+		counters: make(map[string]float64),
+		gauges:   make(map[string]gaugeValue),
+		timers:   make(map[string]*storage.HistogramValue),
+		sources:  make(map[string]struct{}),
+	}
+}
+
+func NewAggregator(registry *agents.Registry) *Aggregator {
+	return &Aggregator{
+		mutex:    &sync.Mutex{},
+		registry: registry,
+		current:  newInterval(),
+	}
+}
+
+// AddLine - разбор и учёт строки от отправителя source, неверные строки подсчитываются и пропускаются.
+func (aggregator *Aggregator) AddLine(line string, source string) {
+	sample, err := ParseLine(line)
+	if err != nil {
+		aggregator.mutex.Lock()
+		aggregator.invalid++
+		aggregator.mutex.Unlock()
+		return
+	}
+
+	aggregator.Add(sample, source)
+}
+
+// Add - учёт значения от отправителя source.
+func (aggregator *Aggregator) Add(sample Sample, source string) {
+	key := storage.SeriesKey(sample.Name, sample.Labels.With(storage.SourceLabel, source))
+	weight := 1 / sample.SampleRate
+
+	aggregator.mutex.Lock()
+	defer aggregator.mutex.Unlock()
+
+	current := aggregator.current
+	current.sources[source] = struct{}{}
+
+	switch sample.Type {
+	case TypeCounter:
+		current.counters[key] += sample.Value * weight
+	case TypeGauge:
+		gauge := current.gauges[key]
+		if sample.Relative {
+			gauge.value += sample.Value
+		} else {
+			gauge = gaugeValue{value: sample.Value, absolute: true}
+		}
+		current.gauges[key] = gauge
+	default:
+		histogram, ok := current.timers[key]
+		if !ok {
+			histogram = storage.NewHistogramValue(TimerBuckets)
+			current.timers[key] = histogram
+		}
+		observe(histogram, sample.Value, uint64(math.Round(weight)))
+	}
+}
+
+// observe - добавление count одинаковых наблюдений в гистограмму.
+func observe(histogram *storage.HistogramValue, value float64, count uint64) {
+	i := sort.SearchFloat64s(histogram.Buckets, value)
+	histogram.Counts[i] += count
+	histogram.Sum += value * float64(count)
+	histogram.Count += count
+}
+
+// take - накопленные за интервал значения и число неверных строк, накопление начинается заново.
+func (aggregator *Aggregator) take() (*interval, int) {
+	aggregator.mutex.Lock()
+	defer aggregator.mutex.Unlock()
+
+	taken, invalid := aggregator.current, aggregator.invalid
+	aggregator.current = newInterval()
+	aggregator.invalid = 0
+
+	return taken, invalid
+}
+
+func (taken *interval) empty() bool {
+	return len(taken.counters)+len(taken.gauges)+len(taken.timers) == 0
+}
+
+// batch - значения интервала в виде пачки метрик. Относительные изменения gauge применяются к значению из repo,
+// серии без значения в хранилище начинаются с 0.
+// Серии разных типов могут совпадать по ключу (foo:1|c и foo:2|g), поэтому пачка - список, а не map по ключу.
+func (taken *interval) batch(ctx context.Context, repo storage.MetricStorager) ([]storage.Metric, error) {
+	batch := make([]storage.Metric, 0, len(taken.counters)+len(taken.gauges)+len(taken.timers))
+	for key, value := range taken.counters {
+		delta := int64(math.Round(value))
+		batch = append(batch, storage.Metric{ID: key, MetricValue: storage.MetricValue{MType: storage.MeticTypeCounter, Delta: &delta}})
+	}
+	for key, gauge := range taken.gauges {
+		value := gauge.value
+		if !gauge.absolute {
+			stored, err := repo.Read(ctx, key, storage.MeticTypeGauge)
+			switch {
+			case err == nil && stored.Value != nil:
+				value += *stored.Value
+			case err != nil && !errors.Is(err, storage.ErrMetricNotFound):
+				return nil, err
+			}
+		}
+		batch = append(batch, storage.Metric{ID: key, MetricValue: storage.MetricValue{MType: storage.MeticTypeGauge, Value: &value}})
+	}
+	for key, histogram := range taken.timers {
+		batch = append(batch, storage.Metric{ID: key, MetricValue: storage.MetricValue{MType: storage.MeticTypeHistogram, Histogram: histogram}})
+	}
+
+	return batch, nil
+}
+
+// restore - возврат незаписанного интервала, значения после него применяются поверх.
+func (aggregator *Aggregator) restore(failed *interval) {
+	aggregator.mutex.Lock()
+	defer aggregator.mutex.Unlock()
+
+	current := aggregator.current
+	for key, value := range failed.counters {
+		current.counters[key] += value
+	}
+	for key, gauge := range failed.gauges {
+		newer, ok := current.gauges[key]
+		if ok && newer.absolute {
+			continue
+		}
+		gauge.value += newer.value
+		current.gauges[key] = gauge
+	}
+	for key, histogram := range failed.timers {
+		newer, ok := current.timers[key]
+		if !ok {
+			current.timers[key] = histogram
+			continue
+		}
+		for i := range newer.Counts {
+			newer.Counts[i] += histogram.Counts[i]
+		}
+		newer.Sum += histogram.Sum
+		newer.Count += histogram.Count
+	}
+	for source := range failed.sources {
+		current.sources[source] = struct{}{}
+	}
+}
+
+// Flush - запись накопленных за интервал значений в repo.
+// При ошибке значения интервала возвращаются в накопление и записываются следующим Flush.
+func (aggregator *Aggregator) Flush(ctx context.Context, repo storage.MetricStorager) error {
+	taken, invalid := aggregator.take()
+	if invalid > 0 {
+		log.Printf("statsd: %d invalid lines skipped\n", invalid)
+	}
+	if taken.empty() {
+		return nil
+	}
+
+	batch, err := taken.batch(ctx, repo)
+	if err == nil {
+		err = repo.UpdateManySliceMetric(ctx, batch)
+	}
+	if err != nil {
+		aggregator.restore(taken)
+		return err
+	}
+
+	now := time.Now()
+	for source := range taken.sources {
+		aggregator.registry.Seen(agents.Source{ID: source, Address: source}, now)
+	}
+
+	return nil
+}
+
+// Run - запись накопленных значений в repo каждые interval до отмены ctx.
+// Значения после последней записи записываются Flush при остановке сервера.
+func (aggregator *Aggregator) Run(ctx context.Context, repo storage.MetricStorager, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := aggregator.Flush(ctx, repo); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
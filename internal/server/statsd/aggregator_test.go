@@ -0,0 +1,126 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/agents"
+	"metrics/internal/server/config"
+	"metrics/internal/server/storage"
+)
+
+func TestAggregator(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.NewMetricsMemoryRepo(config.StoreConfig{})
+	registry := agents.NewRegistry(0)
+	aggregator := NewAggregator(registry)
+
+	for _, line := range []string{
+		"requests:1|c|#env:prod",
+		"requests:2|c|@0.5|#env:prod",
+		"queue:10|g",
+		"queue:-3|g",
+		"db.query:7|ms",
+		"db.query:300|ms|@0.5",
+		"users:42|s",
+	} {
+		aggregator.AddLine(line, "10.0.0.1")
+	}
+	require.NoError(t, aggregator.Flush(ctx, repo))
+
+	read := func(id string, labels storage.Labels, metricType string) storage.MetricValue {
+		value, err := repo.Read(ctx, storage.SeriesKey(id, labels.With(storage.SourceLabel, "10.0.0.1")), metricType)
+		require.NoError(t, err)
+		return value
+	}
+
+	require.EqualValues(t, 5, *read("requests", storage.Labels{"env": "prod"}, storage.MeticTypeCounter).Delta)
+	require.Equal(t, 7.0, *read("queue", nil, storage.MeticTypeGauge).Value)
+
+	histogram := read("db.query", nil, storage.MeticTypeHistogram).Histogram
+	require.EqualValues(t, 3, histogram.Count)
+	require.Equal(t, 607.0, histogram.Sum)
+	require.EqualValues(t, 1, histogram.Counts[1])
+	require.EqualValues(t, 2, histogram.Counts[6])
+
+	list := registry.List(map[string]storage.MetricMap{}, time.Now())
+	require.Len(t, list, 1)
+	require.Equal(t, "10.0.0.1", list[0].ID)
+
+	// Counter и таймеры записываются приростами, относительное изменение gauge - к записанному значению
+	aggregator.AddLine("requests:1|c|#env:prod", "10.0.0.1")
+	aggregator.AddLine("queue:+1|g", "10.0.0.1")
+	aggregator.AddLine("db.query:7|ms", "10.0.0.1")
+	require.NoError(t, aggregator.Flush(ctx, repo))
+
+	require.EqualValues(t, 6, *read("requests", storage.Labels{"env": "prod"}, storage.MeticTypeCounter).Delta)
+	require.Equal(t, 8.0, *read("queue", nil, storage.MeticTypeGauge).Value)
+	require.EqualValues(t, 4, read("db.query", nil, storage.MeticTypeHistogram).Histogram.Count)
+
+	// Gauge не хранится в памяти после записи, относительное изменение после перезапуска применяется к значению хранилища
+	require.Empty(t, aggregator.current.gauges)
+	restarted := NewAggregator(registry)
+	restarted.AddLine("queue:+2|g", "10.0.0.1")
+	restarted.AddLine("fresh:-1|g", "10.0.0.1")
+	require.NoError(t, restarted.Flush(ctx, repo))
+
+	require.Equal(t, 10.0, *read("queue", nil, storage.MeticTypeGauge).Value)
+	require.Equal(t, -1.0, *read("fresh", nil, storage.MeticTypeGauge).Value)
+
+	// Серии разных типов с одним именем не вытесняют друг друга
+	aggregator.AddLine("jobs:1|c", "10.0.0.1")
+	aggregator.AddLine("jobs:2|g", "10.0.0.1")
+	require.NoError(t, aggregator.Flush(ctx, repo))
+
+	require.EqualValues(t, 1, *read("jobs", nil, storage.MeticTypeCounter).Delta)
+	require.Equal(t, 2.0, *read("jobs", nil, storage.MeticTypeGauge).Value)
+
+	// Без новых значений Flush ничего не пишет
+	require.NoError(t, aggregator.Flush(ctx, repo))
+	require.EqualValues(t, 6, *read("requests", storage.Labels{"env": "prod"}, storage.MeticTypeCounter).Delta)
+}
+
+// failingRepo - хранилище, запись пачки в которое завершается ошибкой, пока fail не сброшен.
+type failingRepo struct {
+	storage.MetricsMemoryRepo
+	fail bool
+}
+
+func (repo *failingRepo) UpdateManySliceMetric(ctx context.Context, MetricBatch []storage.Metric) error {
+	if repo.fail {
+		return errors.New("storage is unavailable")
+	}
+
+	return repo.MetricsMemoryRepo.UpdateManySliceMetric(ctx, MetricBatch)
+}
+
+func TestAggregatorFlushRetry(t *testing.T) {
+	ctx := context.Background()
+	repo := &failingRepo{MetricsMemoryRepo: storage.NewMetricsMemoryRepo(config.StoreConfig{}), fail: true}
+	aggregator := NewAggregator(agents.NewRegistry(0))
+
+	aggregator.AddLine("requests:2|c", "10.0.0.1")
+	aggregator.AddLine("queue:5|g", "10.0.0.1")
+	aggregator.AddLine("db.query:7|ms", "10.0.0.1")
+	require.Error(t, aggregator.Flush(ctx, repo))
+
+	// Значения после ошибки применяются поверх незаписанных
+	aggregator.AddLine("requests:1|c", "10.0.0.1")
+	aggregator.AddLine("queue:+1|g", "10.0.0.1")
+	aggregator.AddLine("db.query:300|ms", "10.0.0.1")
+	repo.fail = false
+	require.NoError(t, aggregator.Flush(ctx, repo))
+
+	read := func(id string, metricType string) storage.MetricValue {
+		value, err := repo.Read(ctx, storage.SeriesKey(id, storage.Labels{storage.SourceLabel: "10.0.0.1"}), metricType)
+		require.NoError(t, err)
+		return value
+	}
+
+	require.EqualValues(t, 3, *read("requests", storage.MeticTypeCounter).Delta)
+	require.Equal(t, 6.0, *read("queue", storage.MeticTypeGauge).Value)
+	require.EqualValues(t, 2, read("db.query", storage.MeticTypeHistogram).Histogram.Count)
+}
@@ -0,0 +1,103 @@
+package statsd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+)
+
+// maxPacketSize - наибольший размер датаграммы UDP
+const maxPacketSize = 65535
+
+// ServeUDP - приём датаграмм StatsD до отмены ctx, строки датаграммы разделяются переводом строки.
+// Отправителем считается IP адрес датаграммы.
+func ServeUDP(ctx context.Context, conn net.PacketConn, aggregator *Aggregator) {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buffer := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Println(err)
+			}
+			return
+		}
+
+		source := sourceFromAddr(addr)
+		for _, line := range strings.Split(string(buffer[:n]), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				aggregator.AddLine(line, source)
+			}
+		}
+	}
+}
+
+// ServeTCP - приём соединений StatsD до отмены ctx, строки в соединении разделяются переводом строки.
+// При отмене ctx открытые соединения закрываются.
+func ServeTCP(ctx context.Context, listener net.Listener, aggregator *Aggregator) {
+	connections := sync.WaitGroup{}
+	defer connections.Wait()
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Println(err)
+			}
+			return
+		}
+
+		connections.Add(1)
+		go func() {
+			defer connections.Done()
+			serveConn(ctx, conn, aggregator)
+		}()
+	}
+}
+
+// serveConn - чтение строк соединения до его закрытия клиентом или отмены ctx.
+func serveConn(ctx context.Context, conn net.Conn, aggregator *Aggregator) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	source := sourceFromAddr(conn.RemoteAddr())
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			aggregator.AddLine(line, source)
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Println(err)
+	}
+}
+
+// sourceFromAddr - IP адрес отправителя без порта.
+func sourceFromAddr(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return host
+}
@@ -0,0 +1,62 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/agents"
+	"metrics/internal/server/config"
+	"metrics/internal/server/storage"
+)
+
+func TestServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	repo := storage.NewMetricsMemoryRepo(config.StoreConfig{})
+	aggregator := NewAggregator(agents.NewRegistry(0))
+
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	udpStopped := make(chan struct{})
+	go func() {
+		ServeUDP(ctx, packetConn, aggregator)
+		close(udpStopped)
+	}()
+	tcpStopped := make(chan struct{})
+	go func() {
+		ServeTCP(ctx, listener, aggregator)
+		close(tcpStopped)
+	}()
+
+	udpClient, err := net.Dial("udp", packetConn.LocalAddr().String())
+	require.NoError(t, err)
+	defer udpClient.Close()
+	_, err = udpClient.Write([]byte("udp.requests:1|c\nudp.requests:2|c\n"))
+	require.NoError(t, err)
+
+	tcpClient, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	_, err = tcpClient.Write([]byte("tcp.load:0.5|g\r\ntcp.load:0.75|g\n"))
+	require.NoError(t, err)
+
+	key := func(id string) string {
+		return storage.SeriesKey(id, storage.Labels{storage.SourceLabel: "127.0.0.1"})
+	}
+	require.Eventually(t, func() bool {
+		require.NoError(t, aggregator.Flush(ctx, repo))
+		counter, counterErr := repo.Read(ctx, key("udp.requests"), storage.MeticTypeCounter)
+		gauge, gaugeErr := repo.Read(ctx, key("tcp.load"), storage.MeticTypeGauge)
+		return counterErr == nil && *counter.Delta == 3 && gaugeErr == nil && *gauge.Value == 0.75
+	}, time.Second, 10*time.Millisecond)
+
+	// Отмена закрывает сокеты и открытые соединения TCP
+	cancel()
+	<-udpStopped
+	<-tcpStopped
+	tcpClient.Close()
+}
@@ -0,0 +1,100 @@
+// Package statsd - приём метрик в формате StatsD с тегами DogStatsD по UDP и TCP.
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"metrics/internal/server/exposition"
+	"metrics/internal/server/storage"
+)
+
+const (
+	// TypeCounter - счётчик, значения за интервал складываются
+	TypeCounter = "c"
+	// TypeGauge - gauge, записывается последнее значение
+	TypeGauge = "g"
+	// TypeTimer - длительность в миллисекундах, значения за интервал собираются в гистограмму
+	TypeTimer = "ms"
+	// TypeHistogram - histogram DogStatsD, обрабатывается как таймер
+	TypeHistogram = "h"
+	// TypeDistribution - distribution DogStatsD, обрабатывается как таймер
+	TypeDistribution = "d"
+)
+
+var (
+	// ErrInvalidLine - строка не в формате name:value|type[|@rate][|#tags]
+	ErrInvalidLine = errors.New("invalid statsd line")
+	// ErrUnsupportedType - тип метрики StatsD не поддерживается (например, set)
+	ErrUnsupportedType = errors.New("unsupported statsd metric type")
+)
+
+// Sample - значение из строки StatsD.
+type Sample struct {
+	Name  string
+	Type  string
+	Value float64
+	// Relative - изменение gauge на Value (+N, -N) вместо установки значения
+	Relative bool
+	// SampleRate - доля отправленных значений, counter и таймер учитываются с весом 1/SampleRate
+	SampleRate float64
+	// Labels - теги DogStatsD tag:value, имена приведены к допустимым именам меток
+	Labels storage.Labels
+}
+
+// ParseLine - разбор строки вида name:value|type[|@rate][|#tag:value,...].
+// Теги без значения и неизвестные секции DogStatsD (|c:container, |T timestamp) пропускаются.
+func ParseLine(line string) (Sample, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || storage.ValidateMetricID(name) != nil {
+		return Sample{}, fmt.Errorf("%w: %q", ErrInvalidLine, line)
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return Sample{}, fmt.Errorf("%w: %q", ErrInvalidLine, line)
+	}
+
+	sample := Sample{
+		Name:       name,
+		Type:       parts[1],
+		SampleRate: 1,
+		Labels:     storage.Labels{},
+	}
+	switch sample.Type {
+	case TypeCounter, TypeGauge, TypeTimer, TypeHistogram, TypeDistribution:
+	default:
+		return Sample{}, fmt.Errorf("%w: %q", ErrUnsupportedType, sample.Type)
+	}
+
+	value, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return Sample{}, fmt.Errorf("%w: %q", ErrInvalidLine, line)
+	}
+	sample.Value = value
+	sample.Relative = sample.Type == TypeGauge && (parts[0][0] == '+' || parts[0][0] == '-')
+
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || !(rate > 0 && rate <= 1) {
+				return Sample{}, fmt.Errorf("%w: %q", ErrInvalidLine, line)
+			}
+			sample.SampleRate = rate
+		case strings.HasPrefix(part, "#"):
+			for _, tag := range strings.Split(part[1:], ",") {
+				tagName, tagValue, ok := strings.Cut(tag, ":")
+				if !ok || tagName == "" || tagValue == "" {
+					continue
+				}
+				sample.Labels[exposition.SanitizeLabelName(tagName)] = tagValue
+			}
+		}
+	}
+
+	return sample, nil
+}
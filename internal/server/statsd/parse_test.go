@@ -0,0 +1,57 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/storage"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    Sample
+		wantErr error
+	}{
+		{
+			line: "app.requests:1|c",
+			want: Sample{Name: "app.requests", Type: TypeCounter, Value: 1, SampleRate: 1, Labels: storage.Labels{}},
+		},
+		{
+			line: "app.requests:2|c|@0.5|#env:prod,region:eu-west,canary",
+			want: Sample{Name: "app.requests", Type: TypeCounter, Value: 2, SampleRate: 0.5, Labels: storage.Labels{"env": "prod", "region": "eu-west"}},
+		},
+		{
+			line: "queue.size:-3|g",
+			want: Sample{Name: "queue.size", Type: TypeGauge, Value: -3, Relative: true, SampleRate: 1, Labels: storage.Labels{}},
+		},
+		{
+			line: "temperature:21.5|g|#sensor.id:a1|T1656581400",
+			want: Sample{Name: "temperature", Type: TypeGauge, Value: 21.5, SampleRate: 1, Labels: storage.Labels{"sensor_id": "a1"}},
+		},
+		{
+			line: "db.query:12.5|ms",
+			want: Sample{Name: "db.query", Type: TypeTimer, Value: 12.5, SampleRate: 1, Labels: storage.Labels{}},
+		},
+		{line: "users:42|s", wantErr: ErrUnsupportedType},
+		{line: "no-value", wantErr: ErrInvalidLine},
+		{line: ":1|c", wantErr: ErrInvalidLine},
+		{line: "requests:1", wantErr: ErrInvalidLine},
+		{line: "requests:abc|c", wantErr: ErrInvalidLine},
+		{line: "requests:NaN|g", wantErr: ErrInvalidLine},
+		{line: "requests:1|c|@0", wantErr: ErrInvalidLine},
+		{line: "requests:1|c|@2", wantErr: ErrInvalidLine},
+		{line: "req{uests}:1|c", wantErr: ErrInvalidLine},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			sample, err := ParseLine(tt.line)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, sample)
+		})
+	}
+}
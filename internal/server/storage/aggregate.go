@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrInvalidHistogram         = errors.New("invalid histogram")
+	ErrInvalidSummary           = errors.New("invalid summary")
+	ErrHistogramBucketsMismatch = errors.New("histogram buckets do not match stored buckets")
+	ErrUnknownAggregation       = errors.New("unknown aggregation")
+)
+
+// Агрегации значений нескольких серий (например, одной метрики разных агентов).
+const (
+	AggregationSum = "sum"
+	AggregationAvg = "avg"
+	AggregationMin = "min"
+	AggregationMax = "max"
+)
+
+// HistogramValue - значение гистограммы.
+// Buckets - верхние границы интервалов по возрастанию, Counts - количество наблюдений в каждом интервале,
+// последний элемент Counts - интервал (последняя граница; +Inf).
+type HistogramValue struct {
+	Buckets []float64 `json:"buckets"`
+	Counts  []uint64  `json:"counts"`
+	Sum     float64   `json:"sum"`
+	Count   uint64    `json:"count"`
+}
+
+// NewHistogramValue - пустая гистограмма с заданными границами интервалов.
+func NewHistogramValue(buckets []float64) *HistogramValue {
+	histogram := &HistogramValue{
+		Buckets: make([]float64, len(buckets)),
+		Counts:  make([]uint64, len(buckets)+1),
+	}
+	copy(histogram.Buckets, buckets)
+	sort.Float64s(histogram.Buckets)
+
+	return histogram
+}
+
+// Observe - добавление наблюдения в гистограмму.
+func (histogram *HistogramValue) Observe(value float64) {
+	i := sort.SearchFloat64s(histogram.Buckets, value)
+	histogram.Counts[i]++
+	histogram.Sum += value
+	histogram.Count++
+}
+
+// Validate - проверка согласованности гистограммы.
+func (histogram HistogramValue) Validate() error {
+	if len(histogram.Counts) != len(histogram.Buckets)+1 {
+		return fmt.Errorf("%w: expected %d counts, got %d", ErrInvalidHistogram, len(histogram.Buckets)+1, len(histogram.Counts))
+	}
+
+	for i := 1; i < len(histogram.Buckets); i++ {
+		if !(histogram.Buckets[i-1] < histogram.Buckets[i]) {
+			return fmt.Errorf("%w: buckets must be strictly increasing", ErrInvalidHistogram)
+		}
+	}
+
+	var count uint64
+	for _, bucketCount := range histogram.Counts {
+		count += bucketCount
+	}
+	if count != histogram.Count {
+		return fmt.Errorf("%w: count %d does not match bucket counts %d", ErrInvalidHistogram, histogram.Count, count)
+	}
+
+	return nil
+}
+
+// Merge - сложение гистограмм с одинаковыми границами интервалов.
+func (histogram HistogramValue) Merge(other HistogramValue) (HistogramValue, error) {
+	if len(histogram.Buckets) != len(other.Buckets) {
+		return HistogramValue{}, ErrHistogramBucketsMismatch
+	}
+	for i := range histogram.Buckets {
+		if histogram.Buckets[i] != other.Buckets[i] {
+			return HistogramValue{}, ErrHistogramBucketsMismatch
+		}
+	}
+
+	merged := HistogramValue{
+		Buckets: make([]float64, len(histogram.Buckets)),
+		Counts:  make([]uint64, len(histogram.Counts)),
+		Sum:     histogram.Sum + other.Sum,
+		Count:   histogram.Count + other.Count,
+	}
+	copy(merged.Buckets, histogram.Buckets)
+	for i := range histogram.Counts {
+		merged.Counts[i] = histogram.Counts[i] + other.Counts[i]
+	}
+
+	return merged, nil
+}
+
+// BucketBound - строковое представление верхней границы i-го интервала.
+func (histogram HistogramValue) BucketBound(i int) string {
+	if i >= len(histogram.Buckets) {
+		return "+Inf"
+	}
+
+	return fmt.Sprintf("%v", histogram.Buckets[i])
+}
+
+func (histogram HistogramValue) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "count=%d sum=%v buckets=[", histogram.Count, histogram.Sum)
+	for i, bucketCount := range histogram.Counts {
+		if i > 0 {
+			builder.WriteByte(' ')
+		}
+		fmt.Fprintf(&builder, "%s:%d", histogram.BucketBound(i), bucketCount)
+	}
+	builder.WriteByte(']')
+
+	return builder.String()
+}
+
+// Quantile - значение квантиля.
+type Quantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// SummaryValue - значение summary.
+// Sum и Count накапливаются между отправками, квантили берутся из последней отправки,
+// так как квантили разных выборок корректно не складываются.
+type SummaryValue struct {
+	Quantiles []Quantile `json:"quantiles"`
+	Sum       float64    `json:"sum"`
+	Count     uint64     `json:"count"`
+}
+
+// Validate - проверка квантилей summary.
+func (summary SummaryValue) Validate() error {
+	for _, quantile := range summary.Quantiles {
+		if quantile.Quantile < 0 || quantile.Quantile > 1 || math.IsNaN(quantile.Quantile) {
+			return fmt.Errorf("%w: quantile %v is out of range [0, 1]", ErrInvalidSummary, quantile.Quantile)
+		}
+	}
+
+	return nil
+}
+
+// Merge - сложение summary: суммы и количества складываются, квантили заменяются новыми.
+func (summary SummaryValue) Merge(other SummaryValue) SummaryValue {
+	merged := SummaryValue{
+		Quantiles: make([]Quantile, len(other.Quantiles)),
+		Sum:       summary.Sum + other.Sum,
+		Count:     summary.Count + other.Count,
+	}
+	copy(merged.Quantiles, other.Quantiles)
+	sort.Slice(merged.Quantiles, func(i, j int) bool {
+		return merged.Quantiles[i].Quantile < merged.Quantiles[j].Quantile
+	})
+
+	return merged
+}
+
+func (summary SummaryValue) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "count=%d sum=%v quantiles=[", summary.Count, summary.Sum)
+	for i, quantile := range summary.Quantiles {
+		if i > 0 {
+			builder.WriteByte(' ')
+		}
+		fmt.Fprintf(&builder, "%v:%v", quantile.Quantile, quantile.Value)
+	}
+	builder.WriteByte(']')
+
+	return builder.String()
+}
+
+// prepareAggregateValue - проверка значения histogram или summary перед записью.
+func prepareAggregateValue(newMetricValue MetricValue) (MetricValue, error) {
+	newMetricValue.Delta, newMetricValue.Value = nil, nil
+
+	switch newMetricValue.MType {
+	case MeticTypeHistogram:
+		if newMetricValue.Histogram == nil {
+			return newMetricValue, fmt.Errorf("%w: Histogram", ErrEmptyMetricValue)
+		}
+		newMetricValue.Summary = nil
+
+		return newMetricValue, newMetricValue.Histogram.Validate()
+	case MeticTypeSummary:
+		if newMetricValue.Summary == nil {
+			return newMetricValue, fmt.Errorf("%w: Summary", ErrEmptyMetricValue)
+		}
+		newMetricValue.Histogram = nil
+
+		return newMetricValue, newMetricValue.Summary.Validate()
+	default:
+		return newMetricValue, ErrUnknownMetricType
+	}
+}
+
+// MergeMetricValue - объединение сохранённого значения с новым по правилам типа метрики:
+// gauge заменяется, counter суммируется, histogram и summary объединяются.
+// oldMetricValue равен nil, если значения ещё нет.
+func MergeMetricValue(oldMetricValue *MetricValue, newMetricValue MetricValue) (MetricValue, error) {
+	if oldMetricValue == nil {
+		return newMetricValue, nil
+	}
+
+	switch newMetricValue.MType {
+	case MeticTypeCounter:
+		newValue := *oldMetricValue.Delta + *newMetricValue.Delta
+		newMetricValue.Delta = &newValue
+	case MeticTypeHistogram:
+		merged, err := oldMetricValue.Histogram.Merge(*newMetricValue.Histogram)
+		if err != nil {
+			return MetricValue{}, err
+		}
+		newMetricValue.Histogram = &merged
+	case MeticTypeSummary:
+		merged := oldMetricValue.Summary.Merge(*newMetricValue.Summary)
+		newMetricValue.Summary = &merged
+	}
+
+	return newMetricValue, nil
+}
+
+// AggregateValues - агрегация значений одного типа нескольких серий.
+// gauge поддерживает sum, avg, min и max, counter - sum, min и max,
+// histogram и summary - только sum: гистограммы объединяются, у summary складываются Sum и Count,
+// а квантили отбрасываются, так как квантили разных выборок корректно не складываются.
+// Время записи агрегата - последнее время записи среди серий.
+func AggregateValues(values []MetricValue, aggregation string) (MetricValue, error) {
+	if len(values) == 0 {
+		return MetricValue{}, ErrMetricNotFound
+	}
+
+	aggregated, err := aggregateValues(values, aggregation)
+	if err != nil {
+		return MetricValue{}, err
+	}
+
+	aggregated.UpdatedAt = nil
+	for _, value := range values {
+		if value.UpdatedAt != nil && (aggregated.UpdatedAt == nil || value.UpdatedAt.After(*aggregated.UpdatedAt)) {
+			aggregated.UpdatedAt = value.UpdatedAt
+		}
+	}
+
+	return aggregated, nil
+}
+
+func aggregateValues(values []MetricValue, aggregation string) (MetricValue, error) {
+
+	metricType := values[0].MType
+	for _, value := range values {
+		if value.MType != metricType {
+			return MetricValue{}, ErrUnknownMetricType
+		}
+	}
+
+	switch metricType {
+	case MeticTypeGauge:
+		return aggregateGauge(values, aggregation)
+	case MeticTypeCounter:
+		return aggregateCounter(values, aggregation)
+	case MeticTypeHistogram, MeticTypeSummary:
+		if aggregation != AggregationSum {
+			return MetricValue{}, fmt.Errorf("%w %q for %s", ErrUnknownAggregation, aggregation, metricType)
+		}
+
+		aggregated := values[0]
+		for _, value := range values[1:] {
+			merged, err := MergeMetricValue(&aggregated, value)
+			if err != nil {
+				return MetricValue{}, err
+			}
+			aggregated = merged
+		}
+		if aggregated.Summary != nil {
+			aggregated.Summary = &SummaryValue{Sum: aggregated.Summary.Sum, Count: aggregated.Summary.Count}
+		}
+
+		return aggregated, nil
+	default:
+		return MetricValue{}, ErrUnknownMetricType
+	}
+}
+
+func aggregateGauge(values []MetricValue, aggregation string) (MetricValue, error) {
+	switch aggregation {
+	case AggregationSum, AggregationAvg, AggregationMin, AggregationMax:
+	default:
+		return MetricValue{}, fmt.Errorf("%w %q for %s", ErrUnknownAggregation, aggregation, MeticTypeGauge)
+	}
+
+	result := *values[0].Value
+	for _, value := range values[1:] {
+		switch aggregation {
+		case AggregationSum, AggregationAvg:
+			result += *value.Value
+		case AggregationMin:
+			result = math.Min(result, *value.Value)
+		case AggregationMax:
+			result = math.Max(result, *value.Value)
+		}
+	}
+	if aggregation == AggregationAvg {
+		result /= float64(len(values))
+	}
+
+	return MetricValue{MType: MeticTypeGauge, Value: &result}, nil
+}
+
+func aggregateCounter(values []MetricValue, aggregation string) (MetricValue, error) {
+	switch aggregation {
+	case AggregationSum, AggregationMin, AggregationMax:
+	default:
+		return MetricValue{}, fmt.Errorf("%w %q for %s", ErrUnknownAggregation, aggregation, MeticTypeCounter)
+	}
+
+	result := *values[0].Delta
+	for _, value := range values[1:] {
+		switch {
+		case aggregation == AggregationSum:
+			result += *value.Delta
+		case aggregation == AggregationMin && *value.Delta < result,
+			aggregation == AggregationMax && *value.Delta > result:
+			result = *value.Delta
+		}
+	}
+
+	return MetricValue{MType: MeticTypeCounter, Delta: &result}, nil
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateValues(t *testing.T) {
+	gauges := []float64{1, 4, 2.5}
+	counters := []int64{3, 10, 7}
+	var gaugeValues, counterValues []MetricValue
+	for i := range gauges {
+		gaugeValues = append(gaugeValues, MetricValue{MType: MeticTypeGauge, Value: &gauges[i]})
+		counterValues = append(counterValues, MetricValue{MType: MeticTypeCounter, Delta: &counters[i]})
+	}
+
+	tests := []struct {
+		name        string
+		values      []MetricValue
+		aggregation string
+		want        float64
+		wantErr     error
+	}{
+		{name: "gauge sum", values: gaugeValues, aggregation: AggregationSum, want: 7.5},
+		{name: "gauge avg", values: gaugeValues, aggregation: AggregationAvg, want: 2.5},
+		{name: "gauge min", values: gaugeValues, aggregation: AggregationMin, want: 1},
+		{name: "gauge max", values: gaugeValues, aggregation: AggregationMax, want: 4},
+		{name: "counter sum", values: counterValues, aggregation: AggregationSum, want: 20},
+		{name: "counter min", values: counterValues, aggregation: AggregationMin, want: 3},
+		{name: "counter max", values: counterValues, aggregation: AggregationMax, want: 10},
+		{name: "counter avg", values: counterValues, aggregation: AggregationAvg, wantErr: ErrUnknownAggregation},
+		{name: "unknown", values: gaugeValues, aggregation: "median", wantErr: ErrUnknownAggregation},
+		{name: "empty", aggregation: AggregationSum, wantErr: ErrMetricNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregated, err := AggregateValues(tt.values, tt.aggregation)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			if aggregated.MType == MeticTypeGauge {
+				require.InDelta(t, tt.want, *aggregated.Value, 1e-9)
+			} else {
+				require.EqualValues(t, tt.want, *aggregated.Delta)
+			}
+		})
+	}
+
+	histograms := []MetricValue{
+		{MType: MeticTypeHistogram, Histogram: &HistogramValue{Buckets: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5, Count: 1}},
+		{MType: MeticTypeHistogram, Histogram: &HistogramValue{Buckets: []float64{1}, Counts: []uint64{0, 2}, Sum: 5, Count: 2}},
+	}
+	aggregated, err := AggregateValues(histograms, AggregationSum)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 2}, aggregated.Histogram.Counts)
+	require.EqualValues(t, 3, aggregated.Histogram.Count)
+
+	summaries := []MetricValue{
+		{MType: MeticTypeSummary, Summary: &SummaryValue{Quantiles: []Quantile{{Quantile: 0.5, Value: 1}}, Sum: 2, Count: 2}},
+		{MType: MeticTypeSummary, Summary: &SummaryValue{Quantiles: []Quantile{{Quantile: 0.5, Value: 3}}, Sum: 6, Count: 2}},
+	}
+	aggregated, err = AggregateValues(summaries, AggregationSum)
+	require.NoError(t, err)
+	require.EqualValues(t, 8, aggregated.Summary.Sum)
+	require.Empty(t, aggregated.Summary.Quantiles)
+}
+
+func TestAggregateValuesHash(t *testing.T) {
+	signKey := "bhHN02mqZa8"
+
+	histogram := MetricValue{MType: MeticTypeHistogram, Histogram: &HistogramValue{
+		Buckets: []float64{1, 5}, Counts: []uint64{2, 1, 0}, Sum: 4, Count: 3,
+	}}
+	moved := MetricValue{MType: MeticTypeHistogram, Histogram: &HistogramValue{
+		Buckets: []float64{1, 5}, Counts: []uint64{1, 2, 0}, Sum: 4, Count: 3,
+	}}
+	rebucketed := MetricValue{MType: MeticTypeHistogram, Histogram: &HistogramValue{
+		Buckets: []float64{2, 5}, Counts: []uint64{2, 1, 0}, Sum: 4, Count: 3,
+	}}
+	require.NotEqual(t, histogram.GetHash("Latency", signKey), moved.GetHash("Latency", signKey))
+	require.NotEqual(t, histogram.GetHash("Latency", signKey), rebucketed.GetHash("Latency", signKey))
+
+	summary := MetricValue{MType: MeticTypeSummary, Summary: &SummaryValue{
+		Quantiles: []Quantile{{Quantile: 0.5, Value: 1}, {Quantile: 0.9, Value: 3}}, Sum: 4, Count: 3,
+	}}
+	changed := MetricValue{MType: MeticTypeSummary, Summary: &SummaryValue{
+		Quantiles: []Quantile{{Quantile: 0.5, Value: 1}, {Quantile: 0.9, Value: 4}}, Sum: 4, Count: 3,
+	}}
+	require.NotEqual(t, summary.GetHash("Latency", signKey), changed.GetHash("Latency", signKey))
+	require.Equal(t, summary.GetHash("Latency", signKey), summary.GetHash("Latency", signKey))
+}
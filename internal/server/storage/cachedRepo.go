@@ -0,0 +1,543 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"metrics/internal/server/config"
+)
+
+// CachedRepo - кеш с отложенной записью (write-behind) перед хранилищем.
+// Все значения хранилища держатся в ОП и читаются оттуда, изменения накапливаются и записываются
+// в хранилище одной пачкой по интервалу или при накоплении FlushSize изменённых серий.
+// Приращения counter между записями складываются, поэтому в истории хранилища остаётся одно значение серии за запись.
+// Удаление, сброс и установка значений (SetValues) выполняются в хранилище сразу, в обход накопленных изменений.
+// Кеш считает себя единственным источником изменений: хранилище не должно меняться в обход него.
+type CachedRepo struct {
+	repo   MetricStorager
+	config config.CacheConfig
+	// mutex - блокировка значений и накопленных изменений
+	mutex *sync.RWMutex
+	// flushMutex - очерёдность записей в хранилище: пачка не должна обогнать удаление и сброс
+	flushMutex *sync.Mutex
+	values     map[string]MetricMap
+	pending    map[string]MetricMap
+	flushReady chan struct{}
+	stop       chan struct{}
+	stopped    chan struct{}
+	closeOnce  *sync.Once
+}
+
+// NewCachedRepo - кеш перед хранилищем repo, значения загружаются из хранилища сразу.
+func NewCachedRepo(repo MetricStorager, config config.CacheConfig) (*CachedRepo, error) {
+	cache := &CachedRepo{
+		repo:       repo,
+		config:     config,
+		mutex:      &sync.RWMutex{},
+		flushMutex: &sync.Mutex{},
+		pending:    newMetricMaps(),
+		flushReady: make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+		closeOnce:  &sync.Once{},
+	}
+
+	err := cache.load(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	go cache.run()
+
+	return cache, nil
+}
+
+func newMetricMaps() map[string]MetricMap {
+	return map[string]MetricMap{
+		MeticTypeGauge:     {},
+		MeticTypeCounter:   {},
+		MeticTypeHistogram: {},
+		MeticTypeSummary:   {},
+	}
+}
+
+// load - замена значений кеша значениями хранилища.
+func (cache *CachedRepo) load(ctx context.Context) error {
+	allValues, err := cache.repo.ReadAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	values := newMetricMaps()
+	for metricType, metricMap := range allValues {
+		if _, ok := values[metricType]; !ok {
+			continue
+		}
+		for key, value := range metricMap {
+			values[metricType][key] = value
+		}
+	}
+
+	cache.mutex.Lock()
+	cache.values = values
+	cache.mutex.Unlock()
+
+	return nil
+}
+
+// run - запись накопленных изменений по интервалу и по заполнению до остановки кеша.
+func (cache *CachedRepo) run() {
+	defer close(cache.stopped)
+
+	// Без интервала изменения записываются только по заполнению и при закрытии
+	var tick <-chan time.Time
+	if cache.config.FlushInterval > 0 {
+		ticker := time.NewTicker(time.Duration(cache.config.FlushInterval))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-cache.stop:
+			return
+		case <-tick:
+		case <-cache.flushReady:
+		}
+
+		err := cache.Flush(context.Background())
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// Flush - запись накопленных изменений в хранилище.
+// При ошибке изменения возвращаются в кеш и записываются при следующем сбросе.
+func (cache *CachedRepo) Flush(ctx context.Context) error {
+	cache.flushMutex.Lock()
+	defer cache.flushMutex.Unlock()
+
+	return cache.flush(ctx)
+}
+
+// flush - запись накопленных изменений при взятом flushMutex.
+// Изменения забираются под mutex, запись в хранилище идёт без него, чтобы не останавливать чтение и обновления.
+func (cache *CachedRepo) flush(ctx context.Context) error {
+	cache.mutex.Lock()
+	batch := cache.takePending()
+	cache.mutex.Unlock()
+
+	err := cache.writeBatch(ctx, batch)
+	if err != nil {
+		cache.mutex.Lock()
+		cache.restorePending(batch)
+		cache.mutex.Unlock()
+	}
+
+	return err
+}
+
+func (cache *CachedRepo) takePending() []Metric {
+	var batch []Metric
+	for _, metricMap := range cache.pending {
+		for key, value := range metricMap {
+			batch = append(batch, Metric{
+				ID:          key,
+				MetricValue: value,
+			})
+		}
+	}
+	cache.pending = newMetricMaps()
+
+	return batch
+}
+
+func (cache *CachedRepo) writeBatch(ctx context.Context, batch []Metric) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	return cache.repo.UpdateManySliceMetric(ctx, batch)
+}
+
+// restorePending - возврат незаписанной пачки, изменения после неё применяются поверх.
+func (cache *CachedRepo) restorePending(batch []Metric) {
+	for _, metric := range batch {
+		value := metric.MetricValue
+		if newer, ok := cache.pending[value.MType][metric.ID]; ok {
+			merged, err := MergeMetricValue(&value, newer)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			value = merged
+		}
+		cache.pending[value.MType][metric.ID] = value
+	}
+}
+
+func (cache *CachedRepo) pendingLen() int {
+	var length int
+	for _, metricMap := range cache.pending {
+		length += len(metricMap)
+	}
+
+	return length
+}
+
+func (cache *CachedRepo) Update(ctx context.Context, key string, newMetricValue MetricValue) error {
+	return cache.UpdateManySliceMetric(ctx, []Metric{{ID: key, MetricValue: newMetricValue}})
+}
+
+func (cache *CachedRepo) UpdateMany(ctx context.Context, DBSchema map[string]MetricValue) error {
+	MetricBatch := make([]Metric, 0, len(DBSchema))
+	for key, value := range DBSchema {
+		MetricBatch = append(MetricBatch, Metric{ID: key, MetricValue: value})
+	}
+
+	return cache.UpdateManySliceMetric(ctx, MetricBatch)
+}
+
+// UpdateManySliceMetric - обновление пачки метрик в кеше, при ошибке не применяется ни одно значение.
+func (cache *CachedRepo) UpdateManySliceMetric(ctx context.Context, MetricBatch []Metric) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, metric := range MetricBatch {
+		if err := ValidateSeriesKey(metric.SeriesKey()); err != nil {
+			return err
+		}
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return cache.updateLocked(MetricBatch)
+}
+
+// SetValues - установка значений gauge и накопленных значений counter в хранилище в обход кеша.
+// Приращение counter считает хранилище, поэтому после сброса счётчика история совпадает с историей без кеша,
+// а не получает отрицательное приращение.
+func (cache *CachedRepo) SetValues(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	return cache.writeThrough(ctx, func() error {
+		return cache.repo.SetValues(ctx, gauges, counters)
+	}, func() {
+		now := time.Now()
+		for key, value := range gauges {
+			value := value
+			cache.replaceValue(MeticTypeGauge, key, &MetricValue{MType: MeticTypeGauge, Value: &value, UpdatedAt: &now})
+		}
+		for key, value := range counters {
+			value := value
+			cache.replaceValue(MeticTypeCounter, key, &MetricValue{MType: MeticTypeCounter, Delta: &value, UpdatedAt: &now})
+		}
+	})
+}
+
+// updateLocked - обновление пачки метрик при взятом mutex, при ошибке не применяется ни одно значение.
+func (cache *CachedRepo) updateLocked(MetricBatch []Metric) error {
+	type stagedKey struct {
+		metricType string
+		key        string
+	}
+	type stagedValue struct {
+		value   MetricValue
+		pending MetricValue
+	}
+
+	now := time.Now()
+
+	// Новые значения вычисляются до записи, чтобы при ошибке ничего не изменить
+	staged := make(map[stagedKey]stagedValue, len(MetricBatch))
+	order := make([]stagedKey, 0, len(MetricBatch))
+	for _, metric := range MetricBatch {
+		newMetricValue, err := prepareMetricValue(metric.MetricValue)
+		if err != nil {
+			return err
+		}
+
+		key := stagedKey{metricType: newMetricValue.MType, key: metric.SeriesKey()}
+		var current, currentPending *MetricValue
+		if value, ok := staged[key]; ok {
+			current, currentPending = &value.value, &value.pending
+		} else {
+			order = append(order, key)
+			if value, ok := cache.values[key.metricType][key.key]; ok {
+				current = &value
+			}
+			if value, ok := cache.pending[key.metricType][key.key]; ok {
+				currentPending = &value
+			}
+		}
+
+		value, err := MergeMetricValue(current, newMetricValue)
+		if err != nil {
+			return err
+		}
+		value.UpdatedAt = &now
+		pending, err := MergeMetricValue(currentPending, newMetricValue)
+		if err != nil {
+			return err
+		}
+		staged[key] = stagedValue{value: value, pending: pending}
+	}
+
+	for _, key := range order {
+		cache.values[key.metricType][key.key] = staged[key].value
+		cache.pending[key.metricType][key.key] = staged[key].pending
+	}
+
+	if cache.config.FlushSize > 0 && cache.pendingLen() >= cache.config.FlushSize {
+		select {
+		case cache.flushReady <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+func (cache *CachedRepo) Read(ctx context.Context, key string, metricType string) (MetricValue, error) {
+	if err := ctx.Err(); err != nil {
+		return MetricValue{}, err
+	}
+
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+
+	metricMap, ok := cache.values[metricType]
+	if !ok {
+		return MetricValue{}, ErrUnknownMetricType
+	}
+
+	value, ok := metricMap[key]
+	if !ok {
+		return MetricValue{}, ErrMetricNotFound
+	}
+
+	return value, nil
+}
+
+// ReadSeries - все серии метрики id из кеша.
+func (cache *CachedRepo) ReadSeries(ctx context.Context, id string, metricType string) (MetricMap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+
+	metricMap, ok := cache.values[metricType]
+	if !ok {
+		return nil, ErrUnknownMetricType
+	}
+
+	series := MetricMap{}
+	for key, value := range metricMap {
+		if IsSeriesOf(key, id) {
+			series[key] = value
+		}
+	}
+
+	return series, nil
+}
+
+func (cache *CachedRepo) ReadAll(ctx context.Context) (map[string]MetricMap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+
+	allValues := make(map[string]MetricMap, len(cache.values))
+	for metricType, metricMap := range cache.values {
+		allValues[metricType] = make(MetricMap, len(metricMap))
+		for key, value := range metricMap {
+			allValues[metricType][key] = value
+		}
+	}
+
+	return allValues, nil
+}
+
+// ReadHistory - история из хранилища, перед чтением накопленные изменения записываются.
+func (cache *CachedRepo) ReadHistory(ctx context.Context, key string, metricType string, from, to time.Time, step time.Duration) ([]MetricSample, error) {
+	err := cache.Flush(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return cache.repo.ReadHistory(ctx, key, metricType, from, to, step)
+}
+
+// Delete - удаление значения.
+func (cache *CachedRepo) Delete(ctx context.Context, key string, metricType string) error {
+	return cache.writeThrough(ctx, func() error {
+		return cache.repo.Delete(ctx, key, metricType)
+	}, func() {
+		cache.replaceValue(metricType, key, nil)
+	})
+}
+
+// DeleteMatching - удаление всех серий метрик, имя которых соответствует шаблону path.Match.
+func (cache *CachedRepo) DeleteMatching(ctx context.Context, metricType string, pattern string) (int, error) {
+	var deleted int
+	err := cache.writeThrough(ctx, func() error {
+		var err error
+		deleted, err = cache.repo.DeleteMatching(ctx, metricType, pattern)
+		return err
+	}, func() {
+		for valuesType, metricMap := range cache.values {
+			if metricType != "" && metricType != valuesType {
+				continue
+			}
+			for key := range metricMap {
+				if matchSeriesName(pattern, key) {
+					cache.replaceValue(valuesType, key, nil)
+				}
+			}
+		}
+	})
+
+	return deleted, err
+}
+
+// ResetCounter - сброс counter в 0.
+func (cache *CachedRepo) ResetCounter(ctx context.Context, key string) error {
+	return cache.writeThrough(ctx, func() error {
+		return cache.repo.ResetCounter(ctx, key)
+	}, func() {
+		var zero int64
+		now := time.Now()
+		cache.replaceValue(MeticTypeCounter, key, &MetricValue{MType: MeticTypeCounter, Delta: &zero, UpdatedAt: &now})
+	})
+}
+
+// Expire - удаление серий, в которые не было записи с момента before.
+// Устаревшие серии выбираются по времени записи в кеш: в хранилище время записи пачки, оно позже.
+func (cache *CachedRepo) Expire(ctx context.Context, before time.Time) (int, error) {
+	type expiredKey struct {
+		metricType string
+		key        string
+	}
+	var expired []expiredKey
+	err := cache.writeThrough(ctx, func() error {
+		cache.mutex.RLock()
+		for metricType, metricMap := range cache.values {
+			for key, value := range metricMap {
+				if value.UpdatedAt != nil && value.UpdatedAt.Before(before) {
+					expired = append(expired, expiredKey{metricType: metricType, key: key})
+				}
+			}
+		}
+		cache.mutex.RUnlock()
+
+		for _, one := range expired {
+			err := cache.repo.Delete(ctx, one.key, one.metricType)
+			if err != nil && !errors.Is(err, ErrMetricNotFound) {
+				return err
+			}
+		}
+		return nil
+	}, func() {
+		for _, one := range expired {
+			cache.replaceValue(one.metricType, one.key, nil)
+		}
+	})
+
+	return len(expired), err
+}
+
+// writeThrough - операция operation над хранилищем в обход кеша и применение её результата к кешу apply.
+// Накопленные изменения записываются перед операцией, следующая запись пачки ждёт её окончания,
+// поэтому изменения, пришедшие во время операции, записываются в хранилище после неё.
+// Операция выполняется без mutex, apply - под ним.
+func (cache *CachedRepo) writeThrough(ctx context.Context, operation func() error, apply func()) error {
+	cache.flushMutex.Lock()
+	defer cache.flushMutex.Unlock()
+
+	err := cache.flush(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = operation()
+	if err != nil {
+		return err
+	}
+
+	cache.mutex.Lock()
+	apply()
+	cache.mutex.Unlock()
+
+	return nil
+}
+
+// replaceValue - значение серии после операции в обход кеша, nil - серия удалена.
+// Изменения, пришедшие во время операции, ещё не записаны и будут применены поверх неё следующей пачкой,
+// поэтому в кеше они применяются поверх результата операции. Вызывается под mutex.
+func (cache *CachedRepo) replaceValue(metricType string, key string, value *MetricValue) {
+	if pending, ok := cache.pending[metricType][key]; ok {
+		merged, err := MergeMetricValue(value, pending)
+		if err != nil {
+			log.Println(err)
+		} else {
+			merged.UpdatedAt = cache.values[metricType][key].UpdatedAt
+			value = &merged
+		}
+	}
+
+	if value == nil {
+		delete(cache.values[metricType], key)
+		return
+	}
+	cache.values[metricType][key] = *value
+}
+
+func (cache *CachedRepo) Compact(ctx context.Context, now time.Time) error {
+	return cache.repo.Compact(ctx, now)
+}
+
+// InitFromFile - восстановление хранилища и повторная загрузка значений в кеш.
+func (cache *CachedRepo) InitFromFile(ctx context.Context) {
+	cache.repo.InitFromFile(ctx)
+
+	err := cache.load(ctx)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func (cache *CachedRepo) Save(ctx context.Context) error {
+	err := cache.Flush(ctx)
+	if err != nil {
+		return err
+	}
+
+	return cache.repo.Save(ctx)
+}
+
+// Close - остановка фоновой записи, запись накопленных изменений и закрытие хранилища.
+func (cache *CachedRepo) Close() error {
+	cache.closeOnce.Do(func() {
+		close(cache.stop)
+	})
+	<-cache.stopped
+
+	flushErr := cache.Flush(context.Background())
+	err := cache.repo.Close()
+	if flushErr != nil {
+		return flushErr
+	}
+
+	return err
+}
+
+func (cache *CachedRepo) Ping(ctx context.Context) error {
+	return cache.repo.Ping(ctx)
+}
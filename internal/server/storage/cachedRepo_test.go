@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/config"
+)
+
+// failingRepo - хранилище, запись пачки в которое завершается ошибкой, пока fail не сброшен.
+type failingRepo struct {
+	MetricsMemoryRepo
+	fail *bool
+}
+
+func (repo failingRepo) UpdateManySliceMetric(ctx context.Context, MetricBatch []Metric) error {
+	if *repo.fail {
+		return errors.New("storage is unavailable")
+	}
+
+	return repo.MetricsMemoryRepo.UpdateManySliceMetric(ctx, MetricBatch)
+}
+
+// blockingRepo - хранилище, сброс counter в котором ждёт закрытия release.
+type blockingRepo struct {
+	MetricsMemoryRepo
+	started chan struct{}
+	release chan struct{}
+}
+
+func (repo blockingRepo) ResetCounter(ctx context.Context, key string) error {
+	close(repo.started)
+	<-repo.release
+
+	return repo.MetricsMemoryRepo.ResetCounter(ctx, key)
+}
+
+func TestCachedRepoWriteBehind(t *testing.T) {
+	repo := NewMetricsMemoryRepo(config.StoreConfig{})
+	value := 1.5
+	err := repo.Update(context.Background(), "Alloc", MetricValue{MType: MeticTypeGauge, Value: &value})
+	require.NoError(t, err)
+
+	cache, err := NewCachedRepo(repo, config.CacheConfig{})
+	require.NoError(t, err)
+
+	// Значения хранилища загружены в кеш
+	alloc, err := cache.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, 1.5, *alloc.Value)
+
+	var delta int64 = 5
+	for i := 0; i < 3; i++ {
+		err = cache.Update(context.Background(), `PollCount{host="a"}`, MetricValue{MType: MeticTypeCounter, Delta: &delta})
+		require.NoError(t, err)
+	}
+
+	pollCount, err := cache.Read(context.Background(), `PollCount{host="a"}`, MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 15, *pollCount.Delta)
+
+	_, err = repo.Read(context.Background(), `PollCount{host="a"}`, MeticTypeCounter)
+	require.ErrorIs(t, err, ErrMetricNotFound)
+
+	// Приращения складываются и записываются одним значением
+	require.NoError(t, cache.Flush(context.Background()))
+	pollCount, err = repo.Read(context.Background(), `PollCount{host="a"}`, MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 15, *pollCount.Delta)
+	require.Equal(t, 1, repo.counterHistory.Len(`PollCount{host="a"}`))
+
+	// Ошибка в пачке не меняет ни кеш, ни накопленные изменения
+	err = cache.UpdateManySliceMetric(context.Background(), []Metric{
+		{ID: "PollCount", Labels: Labels{"host": "a"}, MetricValue: MetricValue{MType: MeticTypeCounter, Delta: &delta}},
+		{ID: "Broken", MetricValue: MetricValue{MType: MeticTypeGauge}},
+	})
+	require.ErrorIs(t, err, ErrEmptyMetricValue)
+	pollCount, err = cache.Read(context.Background(), `PollCount{host="a"}`, MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 15, *pollCount.Delta)
+
+	// Удаление записывает накопленные изменения до удаления
+	err = cache.Update(context.Background(), "HeapAlloc", MetricValue{MType: MeticTypeGauge, Value: &value})
+	require.NoError(t, err)
+	err = cache.Update(context.Background(), `PollCount{host="a"}`, MetricValue{MType: MeticTypeCounter, Delta: &delta})
+	require.NoError(t, err)
+	require.NoError(t, cache.Delete(context.Background(), "HeapAlloc", MeticTypeGauge))
+
+	_, err = cache.Read(context.Background(), "HeapAlloc", MeticTypeGauge)
+	require.ErrorIs(t, err, ErrMetricNotFound)
+	_, err = repo.Read(context.Background(), "HeapAlloc", MeticTypeGauge)
+	require.ErrorIs(t, err, ErrMetricNotFound)
+	pollCount, err = repo.Read(context.Background(), `PollCount{host="a"}`, MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 20, *pollCount.Delta)
+
+	// Закрытие записывает оставшиеся изменения
+	err = cache.Update(context.Background(), "Alloc", MetricValue{MType: MeticTypeGauge, Value: &value})
+	require.NoError(t, err)
+	require.NoError(t, cache.ResetCounter(context.Background(), `PollCount{host="a"}`))
+	err = cache.Update(context.Background(), `PollCount{host="a"}`, MetricValue{MType: MeticTypeCounter, Delta: &delta})
+	require.NoError(t, err)
+	require.NoError(t, cache.Close())
+
+	pollCount, err = repo.Read(context.Background(), `PollCount{host="a"}`, MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, *pollCount.Delta)
+}
+
+func TestCachedRepoFlushRetry(t *testing.T) {
+	fail := true
+	repo := failingRepo{
+		MetricsMemoryRepo: NewMetricsMemoryRepo(config.StoreConfig{}),
+		fail:              &fail,
+	}
+
+	cache, err := NewCachedRepo(repo, config.CacheConfig{})
+	require.NoError(t, err)
+
+	var delta int64 = 5
+	err = cache.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+	require.NoError(t, err)
+	require.Error(t, cache.Flush(context.Background()))
+
+	// Изменения после неудачной записи складываются с возвращёнными в кеш
+	err = cache.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+	require.NoError(t, err)
+
+	fail = false
+	require.NoError(t, cache.Flush(context.Background()))
+	pollCount, err := repo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, *pollCount.Delta)
+	require.NoError(t, cache.Close())
+}
+
+func TestCachedRepoFlushSize(t *testing.T) {
+	repo := NewMetricsMemoryRepo(config.StoreConfig{})
+	cache, err := NewCachedRepo(repo, config.CacheConfig{FlushSize: 2})
+	require.NoError(t, err)
+	defer cache.Close()
+
+	value := 1.5
+	err = cache.UpdateMany(context.Background(), map[string]MetricValue{
+		"Alloc":     {MType: MeticTypeGauge, Value: &value},
+		"HeapAlloc": {MType: MeticTypeGauge, Value: &value},
+	})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		_, err := repo.Read(context.Background(), "HeapAlloc", MeticTypeGauge)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCachedRepoExpire(t *testing.T) {
+	repo := NewMetricsMemoryRepo(config.StoreConfig{})
+	cache, err := NewCachedRepo(repo, config.CacheConfig{})
+	require.NoError(t, err)
+	defer cache.Close()
+
+	value := 1.5
+	err = cache.Update(context.Background(), "Alloc", MetricValue{MType: MeticTypeGauge, Value: &value})
+	require.NoError(t, err)
+	before := time.Now().Add(time.Millisecond)
+
+	alloc, err := cache.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.NoError(t, err)
+	require.NotNil(t, alloc.UpdatedAt)
+
+	// Накопленные изменения записываются, затем устаревшие серии удаляются и из кеша, и из хранилища
+	expired, err := cache.Expire(context.Background(), before)
+	require.NoError(t, err)
+	require.Equal(t, 1, expired)
+
+	_, err = cache.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.ErrorIs(t, err, ErrMetricNotFound)
+	_, err = repo.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.ErrorIs(t, err, ErrMetricNotFound)
+}
+
+func TestCachedRepoWriteThroughUnlocked(t *testing.T) {
+	repo := blockingRepo{
+		MetricsMemoryRepo: NewMetricsMemoryRepo(config.StoreConfig{}),
+		started:           make(chan struct{}),
+		release:           make(chan struct{}),
+	}
+	cache, err := NewCachedRepo(repo, config.CacheConfig{})
+	require.NoError(t, err)
+	defer cache.Close()
+
+	var delta int64 = 5
+	err = cache.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+	require.NoError(t, err)
+
+	reset := make(chan error)
+	go func() {
+		reset <- cache.ResetCounter(context.Background(), "PollCount")
+	}()
+	<-repo.started
+
+	// Пока хранилище выполняет сброс, кеш читается и обновляется
+	pollCount, err := cache.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, *pollCount.Delta)
+	err = cache.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+	require.NoError(t, err)
+
+	close(repo.release)
+	require.NoError(t, <-reset)
+
+	// Изменение во время сброса применяется после него и в кеше, и в хранилище
+	pollCount, err = cache.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, *pollCount.Delta)
+
+	require.NoError(t, cache.Flush(context.Background()))
+	pollCount, err = repo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, *pollCount.Delta)
+}
+
+func TestCachedRepoSetValues(t *testing.T) {
+	repo := NewMetricsMemoryRepo(config.StoreConfig{})
+	from := time.Now().Add(-time.Minute)
+	cache, err := NewCachedRepo(repo, config.CacheConfig{})
+	require.NoError(t, err)
+	defer cache.Close()
+
+	for _, value := range []int64{10, 15, 4} {
+		err = cache.SetValues(context.Background(), nil, map[string]int64{"requests_total": value})
+		require.NoError(t, err)
+	}
+
+	counter, err := cache.Read(context.Background(), "requests_total", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, *counter.Delta)
+
+	require.NoError(t, cache.Flush(context.Background()))
+	counter, err = repo.Read(context.Background(), "requests_total", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, *counter.Delta)
+
+	// История как без кеша: после сброса счётчика приращение - само значение, а не отрицательная разница
+	history, err := repo.ReadHistory(context.Background(), "requests_total", MeticTypeCounter, from, time.Now().Add(time.Minute), 0)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	for i, increment := range []int64{10, 5, 4} {
+		require.EqualValues(t, increment, *history[i].Increment)
+	}
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// aggregateTables - таблицы для типов метрик, значения которых хранятся в JSON и объединяются при обновлении.
+var aggregateTables = map[string]string{
+	MeticTypeHistogram: "histogram",
+	MeticTypeSummary:   "summary",
+}
+
+// marshalAggregate - JSON значения histogram или summary.
+func marshalAggregate(metricValue MetricValue) ([]byte, error) {
+	switch metricValue.MType {
+	case MeticTypeHistogram:
+		return json.Marshal(metricValue.Histogram)
+	case MeticTypeSummary:
+		return json.Marshal(metricValue.Summary)
+	default:
+		return nil, errors.New("metric type is not aggregate")
+	}
+}
+
+// unmarshalAggregate - значение histogram или summary из JSON.
+func unmarshalAggregate(metricType string, data []byte) (MetricValue, error) {
+	metricValue := MetricValue{
+		MType: metricType,
+	}
+
+	var err error
+	switch metricType {
+	case MeticTypeHistogram:
+		metricValue.Histogram = &HistogramValue{}
+		err = json.Unmarshal(data, metricValue.Histogram)
+	case MeticTypeSummary:
+		metricValue.Summary = &SummaryValue{}
+		err = json.Unmarshal(data, metricValue.Summary)
+	default:
+		err = errors.New("metric type is not aggregate")
+	}
+
+	return metricValue, err
+}
+
+func (repository DBRepo) updateAggregate(ctx context.Context, key string, newMetricValue MetricValue) error {
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = repository.updateAggregateTX(ctx, tx, key, newMetricValue)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateAggregateTX - объединение значения с сохранённым в рамках транзакции.
+// Advisory lock по ключу защищает от потери обновлений при конкурентной записи, в том числе первой.
+func (repository DBRepo) updateAggregateTX(ctx context.Context, tx *sql.Tx, key string, newMetricValue MetricValue) error {
+	table := aggregateTables[newMetricValue.MType]
+
+	_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", table+":"+key)
+	if err != nil {
+		return err
+	}
+
+	var oldMetricValuePtr *MetricValue
+	var oldData []byte
+	err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT value FROM %s WHERE name = $1", table), key).Scan(&oldData)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return err
+	default:
+		oldMetricValue, err := unmarshalAggregate(newMetricValue.MType, oldData)
+		if err != nil {
+			return err
+		}
+		oldMetricValuePtr = &oldMetricValue
+	}
+
+	newMetricValue, err = MergeMetricValue(oldMetricValuePtr, newMetricValue)
+	if err != nil {
+		return err
+	}
+
+	newData, err := marshalAggregate(newMetricValue)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %[1]s (name, value) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET value = $2, updated_at = now()", table), key, newData)
+	return err
+}
+
+func (repository DBRepo) readAggregate(ctx context.Context, key string, metricType string) (MetricValue, error) {
+	var data []byte
+	var updatedAt time.Time
+	err := repository.db.QueryRowContext(ctx, fmt.Sprintf("SELECT value, updated_at FROM %s WHERE name = $1", aggregateTables[metricType]), key).Scan(&data, &updatedAt)
+	if err != nil {
+		return MetricValue{MType: metricType}, fmt.Errorf("%s select error : %w", metricType, err)
+	}
+
+	metricValue, err := unmarshalAggregate(metricType, data)
+	metricValue.UpdatedAt = &updatedAt
+	return metricValue, err
+}
+
+func (repository DBRepo) readAllAggregate(ctx context.Context, metricType string) (map[string]MetricValue, error) {
+	return repository.selectAggregates(ctx, metricType, "")
+}
+
+func (repository DBRepo) selectAggregates(ctx context.Context, metricType string, condition string, args ...interface{}) (map[string]MetricValue, error) {
+	allValues := map[string]MetricValue{}
+
+	rows, err := repository.db.QueryContext(ctx, fmt.Sprintf("SELECT name, value, updated_at from %s", aggregateTables[metricType])+condition, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var vKey string
+		var data []byte
+		var updatedAt time.Time
+
+		err = rows.Scan(&vKey, &data, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := unmarshalAggregate(metricType, data)
+		if err != nil {
+			return nil, err
+		}
+		v.UpdatedAt = &updatedAt
+		allValues[vKey] = v
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return allValues, nil
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+)
+
+const queryResetCounter = `WITH reset AS (
+		UPDATE counter SET value = 0, updated_at = now() WHERE name = $1 RETURNING name, value
+	) INSERT INTO counter_history (name, value, delta) SELECT name, value, 0 FROM reset`
+
+// metricTables - таблицы, в которых хранятся значения, история и агрегаты метрики, основная таблица первая.
+var metricTables = map[string][]string{
+	MeticTypeGauge:     {"gauge", "gauge_history", "gauge_rollup"},
+	MeticTypeCounter:   {"counter", "counter_history", "counter_rollup"},
+	MeticTypeHistogram: {aggregateTables[MeticTypeHistogram]},
+	MeticTypeSummary:   {aggregateTables[MeticTypeSummary]},
+}
+
+// Delete - удаление значения вместе с историей.
+func (repository DBRepo) Delete(ctx context.Context, key string, metricType string) error {
+	deleted, err := repository.deleteKeys(ctx, metricType, []string{key})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrMetricNotFound
+	}
+
+	return nil
+}
+
+// DeleteMatching - удаление всех серий метрик, имя которых соответствует шаблону path.Match.
+// Пустой metricType - удаление среди всех типов.
+func (repository DBRepo) DeleteMatching(ctx context.Context, metricType string, pattern string) (int, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, err
+	}
+
+	metricTypes := []string{metricType}
+	if metricType == "" {
+		metricTypes = []string{MeticTypeGauge, MeticTypeCounter, MeticTypeHistogram, MeticTypeSummary}
+	}
+
+	var deleted int
+	for _, metricType := range metricTypes {
+		tables, ok := metricTables[metricType]
+		if !ok {
+			return deleted, ErrUnknownMetricType
+		}
+
+		keys, err := repository.matchingKeys(ctx, tables[0], pattern)
+		if err != nil {
+			return deleted, err
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		count, err := repository.deleteKeys(ctx, metricType, keys)
+		deleted += count
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+func (repository DBRepo) matchingKeys(ctx context.Context, table string, pattern string) ([]string, error) {
+	rows, err := repository.db.QueryContext(ctx, fmt.Sprintf("SELECT name FROM %s", table))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		err = rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+
+		if matchSeriesName(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, rows.Err()
+}
+
+// deleteKeys - удаление ключей из всех таблиц типа метрики в одной транзакции,
+// возвращает количество удалённых значений из основной таблицы.
+func (repository DBRepo) deleteKeys(ctx context.Context, metricType string, keys []string) (int, error) {
+	tables, ok := metricTables[metricType]
+	if !ok {
+		return 0, ErrUnknownMetricType
+	}
+
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var deleted int64
+	for i, table := range tables {
+		result, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE name = ANY($1::text[])", table), keys)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+
+		if i == 0 {
+			deleted, err = result.RowsAffected()
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return int(deleted), tx.Commit()
+}
+
+// ResetCounter - сброс counter в 0, сброс попадает в историю.
+func (repository DBRepo) ResetCounter(ctx context.Context, key string) error {
+	result, err := repository.db.ExecContext(ctx, queryResetCounter, key)
+	if err != nil {
+		return err
+	}
+
+	reset, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if reset == 0 {
+		return ErrMetricNotFound
+	}
+
+	return nil
+}
+
+// Expire - удаление серий всех типов, в которые не было записи с момента before, вместе с историей.
+func (repository DBRepo) Expire(ctx context.Context, before time.Time) (int, error) {
+	var expired int
+	for _, metricType := range []string{MeticTypeGauge, MeticTypeCounter, MeticTypeHistogram, MeticTypeSummary} {
+		count, err := repository.expireType(ctx, metricType, before)
+		expired += count
+		if err != nil {
+			return expired, err
+		}
+	}
+
+	return expired, nil
+}
+
+// expireType - удаление устаревших серий типа метрики в одной транзакции: серии выбираются и удаляются
+// из основной таблицы одним запросом, поэтому серия, обновлённая параллельно, не удаляется.
+func (repository DBRepo) expireType(ctx context.Context, metricType string, before time.Time) (int, error) {
+	tables := metricTables[metricType]
+
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE updated_at < $1 RETURNING name", tables[0]), before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete from %s: %w", tables[0], err)
+	}
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		err = rows.Scan(&key)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	for _, table := range tables[1:] {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE name = ANY($1::text[])", table), keys)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+	}
+
+	return len(keys), tx.Commit()
+}
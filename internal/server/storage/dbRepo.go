@@ -3,9 +3,9 @@ package storage
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"time"
@@ -15,6 +15,23 @@ import (
 	"metrics/internal/server/config"
 )
 
+const (
+	queryUpdateGauge = `WITH upsert AS (
+		INSERT INTO gauge (name, value) VALUES ($1, $2) ON CONFLICT(name) DO UPDATE set value = $2, updated_at = now() RETURNING name, value
+	) INSERT INTO gauge_history (name, value) SELECT name, value FROM upsert`
+	queryUpdateCounter = `WITH upsert AS (
+		INSERT INTO counter (name, value) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET value = counter.value + $2, updated_at = now() RETURNING name, value
+	) INSERT INTO counter_history (name, value, delta) SELECT name, value, $2 FROM upsert`
+	// querySetCounter - установка накопленного значения counter, в историю пишется разница с предыдущим значением,
+	// а если значение уменьшилось (счётчик сброшен) - само значение
+	querySetCounter = `WITH previous AS (
+		SELECT value FROM counter WHERE name = $1 FOR UPDATE
+	), upsert AS (
+		INSERT INTO counter (name, value) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET value = $2, updated_at = now() RETURNING name, value
+	) INSERT INTO counter_history (name, value, delta)
+	SELECT name, value, CASE WHEN value >= COALESCE((SELECT value FROM previous), 0) THEN value - COALESCE((SELECT value FROM previous), 0) ELSE value END FROM upsert`
+)
+
 // DBRepo - хранилище метрик в SQL БД.
 type DBRepo struct {
 	config config.StoreConfig
@@ -33,6 +50,10 @@ func NewDBRepo(config config.StoreConfig) (DBRepo, error) {
 	repository.db = db
 
 	repository.PrepareDB()
+	if repository.config.MigrateDryRun {
+		return repository, nil
+	}
+
 	err = repository.InitTables()
 	if err != nil {
 		return DBRepo{}, err
@@ -52,137 +73,226 @@ func (repository DBRepo) PrepareDB() {
 	repository.db.SetConnMaxLifetime(time.Minute * 2)
 }
 
+// InitTables - применение миграций схемы.
 func (repository DBRepo) InitTables() error {
-	_, err := repository.db.Exec("CREATE TABLE IF NOT EXISTS counter (id serial PRIMARY KEY, name VARCHAR (128) UNIQUE NOT NULL, value BIGINT NOT NULL)")
-	if err != nil {
-		return fmt.Errorf("failed to create counter table: %w", err)
-	}
+	return repository.Migrate()
+}
 
-	_, err = repository.db.Exec("CREATE TABLE IF NOT EXISTS gauge (id serial PRIMARY KEY, name VARCHAR (128) UNIQUE NOT NULL, value DOUBLE PRECISION NOT NULL)")
-	if err != nil {
-		return fmt.Errorf("failed to create gauge table: %w", err)
+func (repository DBRepo) Update(ctx context.Context, key string, newMetricValue MetricValue) error {
+	if err := ValidateSeriesKey(key); err != nil {
+		return err
 	}
 
-	return nil
-}
-
-func (repository DBRepo) Update(key string, newMetricValue MetricValue) error {
 	switch newMetricValue.MType {
 	case MeticTypeGauge:
 		if newMetricValue.Value == nil {
-			return errors.New("metric Value is empty")
+			return fmt.Errorf("%w: Value", ErrEmptyMetricValue)
 		}
 		newMetricValue.Delta = nil
 
-		return repository.updateGauge(key, newMetricValue)
+		return repository.updateGauge(ctx, key, newMetricValue)
 	case MeticTypeCounter:
 		if newMetricValue.Delta == nil {
-			return errors.New("metric Delta is empty")
+			return fmt.Errorf("%w: Delta", ErrEmptyMetricValue)
 		}
 		newMetricValue.Value = nil
 
-		return repository.updateCounter(key, newMetricValue)
+		return repository.updateCounter(ctx, key, newMetricValue)
+	case MeticTypeHistogram, MeticTypeSummary:
+		newMetricValue, err := prepareAggregateValue(newMetricValue)
+		if err != nil {
+			return err
+		}
+
+		return repository.updateAggregate(ctx, key, newMetricValue)
 	default:
-		return errors.New("metric type is not defined")
+		return ErrUnknownMetricType
 	}
 }
 
-func (repository DBRepo) UpdateTX(key string, newMetricValue MetricValue, stmt *sql.Stmt) error {
+func (repository DBRepo) UpdateTX(ctx context.Context, key string, newMetricValue MetricValue, stmt *sql.Stmt) error {
 	switch newMetricValue.MType {
 	case MeticTypeGauge:
 		if newMetricValue.Value == nil {
-			return errors.New("metric Value is empty")
+			return fmt.Errorf("%w: Value", ErrEmptyMetricValue)
 		}
 		newMetricValue.Delta = nil
 
-		return repository.updateGaugeTX(key, newMetricValue, stmt)
+		return repository.updateGaugeTX(ctx, key, newMetricValue, stmt)
 	case MeticTypeCounter:
 		if newMetricValue.Delta == nil {
-			return errors.New("metric Delta is empty")
+			return fmt.Errorf("%w: Delta", ErrEmptyMetricValue)
 		}
 		newMetricValue.Value = nil
 
-		return repository.updateCounterTX(key, newMetricValue, stmt)
+		return repository.updateCounterTX(ctx, key, newMetricValue, stmt)
 	default:
-		return errors.New("metric type is not defined")
+		return ErrUnknownMetricType
 	}
 }
 
-func (repository DBRepo) updateGauge(key string, newMetricValue MetricValue) error {
-	_, err := repository.db.Exec("INSERT INTO gauge (name, value) VALUES ($1, $2) ON CONFLICT(name) DO UPDATE set value = $2", key, *newMetricValue.Value)
+func (repository DBRepo) updateGauge(ctx context.Context, key string, newMetricValue MetricValue) error {
+	_, err := repository.db.ExecContext(ctx, queryUpdateGauge, key, *newMetricValue.Value)
 	return err
 }
 
-func (repository DBRepo) updateGaugeTX(key string, newMetricValue MetricValue, stmt *sql.Stmt) error {
-	_, err := stmt.Exec(key, *newMetricValue.Value)
+func (repository DBRepo) updateGaugeTX(ctx context.Context, key string, newMetricValue MetricValue, stmt *sql.Stmt) error {
+	_, err := stmt.ExecContext(ctx, key, *newMetricValue.Value)
 	return err
 }
 
-func (repository DBRepo) updateCounter(key string, newMetricValue MetricValue) error {
-	_, err := repository.db.Exec("INSERT INTO counter (name, value) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET value = counter.value + $2", key, *newMetricValue.Delta)
+func (repository DBRepo) updateCounter(ctx context.Context, key string, newMetricValue MetricValue) error {
+	_, err := repository.db.ExecContext(ctx, queryUpdateCounter, key, *newMetricValue.Delta)
 	return err
 }
 
-func (repository DBRepo) updateCounterTX(key string, newMetricValue MetricValue, stmt *sql.Stmt) error {
-	_, err := stmt.Exec(key, *newMetricValue.Delta)
+func (repository DBRepo) updateCounterTX(ctx context.Context, key string, newMetricValue MetricValue, stmt *sql.Stmt) error {
+	_, err := stmt.ExecContext(ctx, key, *newMetricValue.Delta)
 	return err
 }
 
-func (repository DBRepo) Read(key string, metricType string) (MetricValue, error) {
+func (repository DBRepo) Read(ctx context.Context, key string, metricType string) (MetricValue, error) {
+	var metricValue MetricValue
+	var err error
 	switch metricType {
 	case MeticTypeGauge:
-		return repository.readGauge(key)
+		metricValue, err = repository.readGauge(ctx, key)
 	case MeticTypeCounter:
-		return repository.readCounter(key)
+		metricValue, err = repository.readCounter(ctx, key)
+	case MeticTypeHistogram, MeticTypeSummary:
+		metricValue, err = repository.readAggregate(ctx, key, metricType)
 	default:
-		return MetricValue{}, errors.New("metricType not found")
+		return MetricValue{}, ErrUnknownMetricType
 	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return metricValue, ErrMetricNotFound
+	}
+
+	return metricValue, err
 }
 
-func (repository DBRepo) readGauge(key string) (MetricValue, error) {
+func (repository DBRepo) readGauge(ctx context.Context, key string) (MetricValue, error) {
 	metricValue := MetricValue{
 		MType: MeticTypeGauge,
 	}
 
-	err := repository.db.QueryRow("SELECT value FROM gauge WHERE name = $1", key).Scan(&metricValue.Value)
+	err := repository.db.QueryRowContext(ctx, "SELECT value, updated_at FROM gauge WHERE name = $1", key).Scan(&metricValue.Value, &metricValue.UpdatedAt)
 	if err != nil {
 		return metricValue, fmt.Errorf("gauge select error : %w", err)
 	}
 	return metricValue, nil
 }
 
-func (repository DBRepo) readCounter(key string) (MetricValue, error) {
+func (repository DBRepo) readCounter(ctx context.Context, key string) (MetricValue, error) {
 	metricValue := MetricValue{
 		MType: MeticTypeCounter,
 	}
 
-	err := repository.db.QueryRow("SELECT value FROM counter WHERE name = $1", key).Scan(&metricValue.Delta)
+	err := repository.db.QueryRowContext(ctx, "SELECT value, updated_at FROM counter WHERE name = $1", key).Scan(&metricValue.Delta, &metricValue.UpdatedAt)
 	if err != nil {
 		return metricValue, fmt.Errorf("counter select error : %w", err)
 	}
 	return metricValue, nil
 }
 
-func (repository DBRepo) UpdateManySliceMetric(MetricBatch []Metric) error {
-	tx, err := repository.db.Begin()
+// ReadHistory - история за интервал [from, to].
+// Если исходные значения за from уже удалены по правилам хранения, используются агрегаты прореживания.
+func (repository DBRepo) ReadHistory(ctx context.Context, key string, metricType string, from, to time.Time, step time.Duration) ([]MetricSample, error) {
+	var query string
+	switch metricType {
+	case MeticTypeGauge:
+		query = "SELECT created_at, value FROM gauge_history WHERE name = $1 AND created_at BETWEEN $2 AND $3 ORDER BY created_at"
+	case MeticTypeCounter:
+		query = "SELECT created_at, value, delta FROM counter_history WHERE name = $1 AND created_at BETWEEN $2 AND $3 ORDER BY created_at, id"
+	default:
+		return nil, ErrUnknownMetricType
+	}
+
+	tier := historyTier(repository.config.Retention, key, from, time.Now())
+	if tier != 0 {
+		samples, err := repository.readRollups(ctx, key, metricType, tier, from, to)
+		if err != nil || step <= tier {
+			return samples, err
+		}
+
+		return DownsampleHistory(samples, from, step), nil
+	}
+
+	rows, err := repository.db.QueryContext(ctx, query, key, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	samples := []MetricSample{}
+	for rows.Next() {
+		sample := MetricSample{
+			MetricValue: MetricValue{
+				MType: metricType,
+			},
+		}
+
+		if metricType == MeticTypeGauge {
+			err = rows.Scan(&sample.Timestamp, &sample.Value)
+		} else {
+			err = rows.Scan(&sample.Timestamp, &sample.Delta, &sample.Increment)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		samples = append(samples, sample)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return DownsampleHistory(samples, from, step), nil
+}
+
+func (repository DBRepo) UpdateManySliceMetric(ctx context.Context, MetricBatch []Metric) error {
+	for _, metricValue := range MetricBatch {
+		if err := ValidateSeriesKey(metricValue.SeriesKey()); err != nil {
+			return err
+		}
+	}
+
+	tx, err := repository.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	stmtUpdateGauge, err := tx.Prepare("INSERT INTO gauge (name, value) VALUES ($1, $2) ON CONFLICT(name) DO UPDATE set value = $2")
+	stmtUpdateGauge, err := tx.PrepareContext(ctx, queryUpdateGauge)
 	if err != nil {
 		return err
 	}
 	defer stmtUpdateGauge.Close()
 
-	stmtCounterGauge, err := tx.Prepare("INSERT INTO counter (name, value) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET value = counter.value + $2")
+	stmtCounterGauge, err := tx.PrepareContext(ctx, queryUpdateCounter)
 	if err != nil {
 		return err
 	}
 	defer stmtCounterGauge.Close()
 
 	for _, metricValue := range MetricBatch {
+		if _, ok := aggregateTables[metricValue.MType]; ok {
+			var aggregateValue MetricValue
+			aggregateValue, err = prepareAggregateValue(metricValue.MetricValue)
+			if err != nil {
+				return err
+			}
+
+			err = repository.updateAggregateTX(ctx, tx, metricValue.SeriesKey(), aggregateValue)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
 		var stmtMetric *sql.Stmt
 		if metricValue.MType == MeticTypeGauge {
 			stmtMetric = stmtUpdateGauge
@@ -190,8 +300,57 @@ func (repository DBRepo) UpdateManySliceMetric(MetricBatch []Metric) error {
 			stmtMetric = stmtCounterGauge
 		}
 
-		err = repository.UpdateTX(metricValue.ID, metricValue.MetricValue, stmtMetric)
+		err = repository.UpdateTX(ctx, metricValue.SeriesKey(), metricValue.MetricValue, stmtMetric)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SetValues - установка значений gauge и накопленных значений counter в одной транзакции.
+func (repository DBRepo) SetValues(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	for key := range gauges {
+		if err := ValidateSeriesKey(key); err != nil {
+			return err
+		}
+	}
+	for key := range counters {
+		if err := ValidateSeriesKey(key); err != nil {
+			return err
+		}
+	}
+
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmtUpdateGauge, err := tx.PrepareContext(ctx, queryUpdateGauge)
+	if err != nil {
+		return err
+	}
+	defer stmtUpdateGauge.Close()
+
+	for key, value := range gauges {
+		value := value
+		err = repository.UpdateTX(ctx, key, MetricValue{MType: MeticTypeGauge, Value: &value}, stmtUpdateGauge)
+		if err != nil {
+			return err
+		}
+	}
+
+	stmtSetCounter, err := tx.PrepareContext(ctx, querySetCounter)
+	if err != nil {
+		return err
+	}
+	defer stmtSetCounter.Close()
 
+	for key, value := range counters {
+		_, err = stmtSetCounter.ExecContext(ctx, key, value)
 		if err != nil {
 			return err
 		}
@@ -200,7 +359,7 @@ func (repository DBRepo) UpdateManySliceMetric(MetricBatch []Metric) error {
 	return tx.Commit()
 }
 
-func (repository DBRepo) UpdateMany(DBSchema map[string]MetricValue) error {
+func (repository DBRepo) UpdateMany(ctx context.Context, DBSchema map[string]MetricValue) error {
 	var MetricBatch []Metric
 
 	for metricKey, metricValue := range DBSchema {
@@ -210,13 +369,20 @@ func (repository DBRepo) UpdateMany(DBSchema map[string]MetricValue) error {
 		})
 	}
 
-	return repository.UpdateManySliceMetric(MetricBatch)
+	return repository.UpdateManySliceMetric(ctx, MetricBatch)
 }
 
-func (repository DBRepo) readAllCounter() (map[string]MetricValue, error) {
+// dbSeriesCondition - условие выборки всех серий метрики: $1 - имя метрики, $2 - начало ключей её серий с метками.
+const dbSeriesCondition = " WHERE name = $1 OR left(name, length($2)) = $2"
+
+func (repository DBRepo) readAllCounter(ctx context.Context) (map[string]MetricValue, error) {
+	return repository.selectCounters(ctx, "")
+}
+
+func (repository DBRepo) selectCounters(ctx context.Context, condition string, args ...interface{}) (map[string]MetricValue, error) {
 	allValues := map[string]MetricValue{}
 
-	rows, err := repository.db.Query("SELECT name, value from counter")
+	rows, err := repository.db.QueryContext(ctx, "SELECT name, value, updated_at from counter"+condition, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -229,7 +395,7 @@ func (repository DBRepo) readAllCounter() (map[string]MetricValue, error) {
 			MType: MeticTypeCounter,
 		}
 
-		err = rows.Scan(&vKey, &v.Delta)
+		err = rows.Scan(&vKey, &v.Delta, &v.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -245,10 +411,14 @@ func (repository DBRepo) readAllCounter() (map[string]MetricValue, error) {
 	return allValues, nil
 }
 
-func (repository DBRepo) readAllGauge() (map[string]MetricValue, error) {
+func (repository DBRepo) readAllGauge(ctx context.Context) (map[string]MetricValue, error) {
+	return repository.selectGauges(ctx, "")
+}
+
+func (repository DBRepo) selectGauges(ctx context.Context, condition string, args ...interface{}) (map[string]MetricValue, error) {
 	allValues := map[string]MetricValue{}
 
-	rows, err := repository.db.Query("SELECT name, value from gauge")
+	rows, err := repository.db.QueryContext(ctx, "SELECT name, value, updated_at from gauge"+condition, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -261,7 +431,7 @@ func (repository DBRepo) readAllGauge() (map[string]MetricValue, error) {
 			MType: MeticTypeGauge,
 		}
 
-		err = rows.Scan(&vKey, &v.Value)
+		err = rows.Scan(&vKey, &v.Value, &v.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -277,29 +447,50 @@ func (repository DBRepo) readAllGauge() (map[string]MetricValue, error) {
 	return allValues, nil
 }
 
-func (repository DBRepo) ReadAll() map[string]MetricMap {
+// ReadSeries - все серии метрики id одним запросом к таблице типа.
+func (repository DBRepo) ReadSeries(ctx context.Context, id string, metricType string) (MetricMap, error) {
+	switch metricType {
+	case MeticTypeGauge:
+		return repository.selectGauges(ctx, dbSeriesCondition, id, seriesPrefix(id))
+	case MeticTypeCounter:
+		return repository.selectCounters(ctx, dbSeriesCondition, id, seriesPrefix(id))
+	case MeticTypeHistogram, MeticTypeSummary:
+		return repository.selectAggregates(ctx, metricType, dbSeriesCondition, id, seriesPrefix(id))
+	default:
+		return nil, ErrUnknownMetricType
+	}
+}
+
+// ReadAll - все значения всех типов, при ошибке чтения любого типа возвращается ошибка, а не часть значений.
+func (repository DBRepo) ReadAll(ctx context.Context) (map[string]MetricMap, error) {
 	var err error
 	AllValues := map[string]MetricMap{}
 
-	AllValues[MeticTypeCounter], err = repository.readAllCounter()
+	AllValues[MeticTypeCounter], err = repository.readAllCounter(ctx)
 	if err != nil {
-		return AllValues
+		return nil, err
 	}
 
-	AllValues[MeticTypeGauge], err = repository.readAllGauge()
+	AllValues[MeticTypeGauge], err = repository.readAllGauge(ctx)
 	if err != nil {
-		return AllValues
+		return nil, err
+	}
+
+	for metricType := range aggregateTables {
+		AllValues[metricType], err = repository.readAllAggregate(ctx, metricType)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return AllValues
+	return AllValues, nil
 }
 
 func (repository DBRepo) Close() error {
 	return repository.db.Close()
 }
 
-func (repository DBRepo) Ping() error {
-	ctx := context.Background()
+func (repository DBRepo) Ping(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
@@ -309,27 +500,30 @@ func (repository DBRepo) Ping() error {
 	return nil
 }
 
-func (repository DBRepo) InitFromFile() {
+func (repository DBRepo) InitFromFile(ctx context.Context) {
 	file, err := os.OpenFile(repository.config.File, os.O_RDONLY|os.O_CREATE, 0777)
 	if err != nil {
 		panic(err.Error())
 	}
 	defer file.Close()
 
-	var metricsDump map[string]MetricMap
-	err = json.NewDecoder(file).Decode(&metricsDump)
+	data, err := io.ReadAll(file)
+	if err != nil {
+		panic(err.Error())
+	}
+	fileSnapshot, err := readSnapshot(data)
 	if err != nil {
 		log.Println(err)
 	}
 
-	for _, metricList := range metricsDump {
-		err = repository.UpdateMany(metricList)
+	for _, metricList := range fileSnapshot.Metrics {
+		err = repository.UpdateMany(ctx, metricList)
 	}
 	if err != nil {
 		log.Println(err)
 	}
 }
 
-func (repository DBRepo) Save() error {
+func (repository DBRepo) Save(_ context.Context) error {
 	return nil
 }
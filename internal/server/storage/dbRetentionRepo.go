@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	queryRollupGauge = `WITH watermark AS (
+		SELECT name, max(bucket) + $2::bigint * interval '1 millisecond' AS start
+		FROM gauge_rollup WHERE name = ANY($1::text[]) AND step_ms = $2::bigint GROUP BY name
+	), raw AS (
+		SELECT h.id, h.name, h.value, h.created_at,
+			to_timestamp(floor(extract(epoch FROM h.created_at) * 1000 / $2::bigint) * $2::bigint / 1000.0) AS bucket
+		FROM gauge_history AS h LEFT JOIN watermark AS w ON w.name = h.name
+		WHERE h.name = ANY($1::text[]) AND h.created_at < $3 AND (w.start IS NULL OR h.created_at >= w.start)
+	) INSERT INTO gauge_rollup (name, step_ms, bucket, samples, min_value, max_value, avg_value, last_value)
+	SELECT name, $2::bigint, bucket, count(*), min(value), max(value), avg(value), (array_agg(value ORDER BY created_at DESC, id DESC))[1]
+	FROM raw GROUP BY name, bucket
+	ON CONFLICT (name, step_ms, bucket) DO NOTHING`
+	queryRollupCounter = `WITH watermark AS (
+		SELECT name, max(bucket) + $2::bigint * interval '1 millisecond' AS start
+		FROM counter_rollup WHERE name = ANY($1::text[]) AND step_ms = $2::bigint GROUP BY name
+	), raw AS (
+		SELECT h.id, h.name, h.value, h.delta, h.created_at,
+			to_timestamp(floor(extract(epoch FROM h.created_at) * 1000 / $2::bigint) * $2::bigint / 1000.0) AS bucket
+		FROM counter_history AS h LEFT JOIN watermark AS w ON w.name = h.name
+		WHERE h.name = ANY($1::text[]) AND h.created_at < $3 AND (w.start IS NULL OR h.created_at >= w.start)
+	) INSERT INTO counter_rollup (name, step_ms, bucket, samples, increment, last_value)
+	SELECT name, $2::bigint, bucket, count(*), sum(delta), (array_agg(value ORDER BY created_at DESC, id DESC))[1]
+	FROM raw GROUP BY name, bucket
+	ON CONFLICT (name, step_ms, bucket) DO NOTHING`
+)
+
+// rollupTables - таблицы исходных значений и агрегатов прореживания для типов метрик с историей.
+var rollupTables = map[string]struct {
+	history string
+	rollup  string
+	query   string
+}{
+	MeticTypeGauge:   {history: "gauge_history", rollup: "gauge_rollup", query: queryRollupGauge},
+	MeticTypeCounter: {history: "counter_history", rollup: "counter_rollup", query: queryRollupCounter},
+}
+
+func (repository DBRepo) readRollups(ctx context.Context, key string, metricType string, step time.Duration, from, to time.Time) ([]MetricSample, error) {
+	var query string
+	switch metricType {
+	case MeticTypeGauge:
+		query = "SELECT bucket, samples, min_value, max_value, avg_value, last_value FROM gauge_rollup WHERE name = $1 AND step_ms = $2 AND bucket BETWEEN $3 AND $4 ORDER BY bucket"
+	case MeticTypeCounter:
+		query = "SELECT bucket, samples, increment, last_value FROM counter_rollup WHERE name = $1 AND step_ms = $2 AND bucket BETWEEN $3 AND $4 ORDER BY bucket"
+	default:
+		return nil, ErrUnknownMetricType
+	}
+
+	rows, err := repository.db.QueryContext(ctx, query, key, step.Milliseconds(), from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	samples := []MetricSample{}
+	for rows.Next() {
+		sample := MetricSample{
+			MetricValue: MetricValue{
+				MType: metricType,
+			},
+			Rollup: &Rollup{},
+		}
+
+		if metricType == MeticTypeGauge {
+			err = rows.Scan(&sample.Timestamp, &sample.Rollup.Count, &sample.Rollup.Min, &sample.Rollup.Max, &sample.Value, &sample.Rollup.Last)
+		} else {
+			err = rows.Scan(&sample.Timestamp, &sample.Rollup.Count, &sample.Increment, &sample.Delta)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		samples = append(samples, sample)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// Compact - прореживание истории и удаление устаревших значений по правилам хранения.
+// Агрегаты считаются по исходным значениям только для закрытых интервалов,
+// начиная с интервала, следующего за последним посчитанным.
+func (repository DBRepo) Compact(ctx context.Context, now time.Time) error {
+	retention := repository.config.Retention
+	if len(retention.Rules) == 0 {
+		return nil
+	}
+
+	for _, tables := range rollupTables {
+		keysByRule, err := repository.rollupKeysByRule(ctx, tables.history, tables.rollup)
+		if err != nil {
+			return err
+		}
+
+		for i, keys := range keysByRule {
+			rule := retention.Rules[i]
+
+			for _, rollupRule := range rule.Rollups {
+				step := time.Duration(rollupRule.Step)
+				_, err = repository.db.ExecContext(ctx, tables.query, keys, step.Milliseconds(), rollupBucket(now, step))
+				if err != nil {
+					return fmt.Errorf("failed to compact %s: %w", tables.history, err)
+				}
+
+				if rollupRule.Retention != 0 {
+					_, err = repository.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE name = ANY($1::text[]) AND step_ms = $2 AND bucket < $3", tables.rollup),
+						keys, step.Milliseconds(), now.Add(-time.Duration(rollupRule.Retention)))
+					if err != nil {
+						return fmt.Errorf("failed to clean %s: %w", tables.rollup, err)
+					}
+				}
+			}
+
+			if rule.Raw != 0 {
+				_, err = repository.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE name = ANY($1::text[]) AND created_at < $2", tables.history),
+					keys, now.Add(-time.Duration(rule.Raw)))
+				if err != nil {
+					return fmt.Errorf("failed to clean %s: %w", tables.history, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// rollupKeysByRule - ключи серий с историей, сгруппированные по индексу правила хранения.
+func (repository DBRepo) rollupKeysByRule(ctx context.Context, historyTable, rollupTable string) (map[int][]string, error) {
+	rows, err := repository.db.QueryContext(ctx, fmt.Sprintf("SELECT DISTINCT name FROM %s UNION SELECT DISTINCT name FROM %s", historyTable, rollupTable))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	retention := repository.config.Retention
+	keysByRule := map[int][]string{}
+	for rows.Next() {
+		var key string
+		err = rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+
+		if i := retention.MatchIndex(seriesName(key)); i >= 0 {
+			keysByRule[i] = append(keysByRule[i], key)
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return keysByRule, nil
+}
@@ -0,0 +1,298 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MetricSample - значение метрики в момент времени.
+// Для counter Delta - накопленное значение, Increment - приращение с предыдущего значения.
+// У агрегатов прореживания Timestamp - начало интервала, для gauge Value - среднее за интервал.
+type MetricSample struct {
+	Timestamp time.Time `json:"timestamp"`
+	MetricValue
+	Increment *int64  `json:"increment,omitempty"`
+	Rollup    *Rollup `json:"rollup,omitempty"`
+}
+
+// Rollup - агрегаты значений за интервал прореживания.
+type Rollup struct {
+	Count int64    `json:"count"`
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+	Last  *float64 `json:"last,omitempty"`
+}
+
+// historyShard - сегмент истории со своей блокировкой.
+type historyShard struct {
+	db map[string][]MetricSample
+	sync.RWMutex
+}
+
+// HistoryRepo - потокобезопасное хранилище истории значений в ОП с блокировкой по сегментам, как MemoryRepo.
+type HistoryRepo struct {
+	shards []*historyShard
+}
+
+func NewHistoryRepo() (*HistoryRepo, error) {
+	return newHistoryRepo(memoryRepoShards), nil
+}
+
+func newHistoryRepo(shards int) *HistoryRepo {
+	h := &HistoryRepo{
+		shards: make([]*historyShard, shards),
+	}
+	for i := range h.shards {
+		h.shards[i] = &historyShard{
+			db: make(map[string][]MetricSample),
+		}
+	}
+
+	return h
+}
+
+func (h *HistoryRepo) shard(key string) *historyShard {
+	return h.shards[shardIndex(key, len(h.shards))]
+}
+
+func (h *HistoryRepo) Len(key string) int {
+	shard := h.shard(key)
+	shard.RLock()
+	defer shard.RUnlock()
+	return len(shard.db[key])
+}
+
+// Append - добавление значения в историю, значения хранятся отсортированными по времени.
+func (h *HistoryRepo) Append(key string, sample MetricSample) error {
+	shard := h.shard(key)
+	shard.Lock()
+	defer shard.Unlock()
+
+	samples := shard.db[key]
+	if len(samples) == 0 || !sample.Timestamp.Before(samples[len(samples)-1].Timestamp) {
+		shard.db[key] = append(samples, sample)
+		return nil
+	}
+
+	i := sort.Search(len(samples), func(i int) bool {
+		return samples[i].Timestamp.After(sample.Timestamp)
+	})
+	samples = append(samples, MetricSample{})
+	copy(samples[i+1:], samples[i:])
+	samples[i] = sample
+	shard.db[key] = samples
+
+	return nil
+}
+
+// Range - значения из истории в интервале [from, to].
+func (h *HistoryRepo) Range(key string, from, to time.Time) []MetricSample {
+	shard := h.shard(key)
+	shard.RLock()
+	defer shard.RUnlock()
+
+	samples := shard.db[key]
+	start := sort.Search(len(samples), func(i int) bool {
+		return !samples[i].Timestamp.Before(from)
+	})
+	end := sort.Search(len(samples), func(i int) bool {
+		return samples[i].Timestamp.After(to)
+	})
+	if start >= end {
+		return []MetricSample{}
+	}
+
+	result := make([]MetricSample, end-start)
+	copy(result, samples[start:end])
+	return result
+}
+
+// Keys - ключи, для которых есть история.
+func (h *HistoryRepo) Keys() []string {
+	var keys []string
+	for _, shard := range h.shards {
+		shard.RLock()
+		for key := range shard.db {
+			keys = append(keys, key)
+		}
+		shard.RUnlock()
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Last - последнее по времени значение.
+func (h *HistoryRepo) Last(key string) (MetricSample, bool) {
+	shard := h.shard(key)
+	shard.RLock()
+	defer shard.RUnlock()
+
+	samples := shard.db[key]
+	if len(samples) == 0 {
+		return MetricSample{}, false
+	}
+
+	return samples[len(samples)-1], true
+}
+
+// Delete - удаление всей истории ключа.
+func (h *HistoryRepo) Delete(key string) {
+	shard := h.shard(key)
+	shard.Lock()
+	defer shard.Unlock()
+	delete(shard.db, key)
+}
+
+// DeleteBefore - удаление значений старше before, возвращает количество удалённых значений.
+func (h *HistoryRepo) DeleteBefore(key string, before time.Time) int {
+	shard := h.shard(key)
+	shard.Lock()
+	defer shard.Unlock()
+
+	samples := shard.db[key]
+	i := sort.Search(len(samples), func(i int) bool {
+		return !samples[i].Timestamp.Before(before)
+	})
+	if i == 0 {
+		return 0
+	}
+
+	if i == len(samples) {
+		delete(shard.db, key)
+		return i
+	}
+
+	shard.db[key] = append([]MetricSample(nil), samples[i:]...)
+	return i
+}
+
+// dump - копия истории всех ключей для снимка.
+func (h *HistoryRepo) dump() map[string][]MetricSample {
+	result := make(map[string][]MetricSample)
+	for _, shard := range h.shards {
+		shard.RLock()
+		for key, samples := range shard.db {
+			result[key] = append([]MetricSample(nil), samples...)
+		}
+		shard.RUnlock()
+	}
+
+	return result
+}
+
+// load - замена истории ключей значениями из снимка.
+func (h *HistoryRepo) load(history map[string][]MetricSample) {
+	for key, samples := range history {
+		samples := append([]MetricSample(nil), samples...)
+		sort.SliceStable(samples, func(i, j int) bool {
+			return samples[i].Timestamp.Before(samples[j].Timestamp)
+		})
+
+		shard := h.shard(key)
+		shard.Lock()
+		shard.db[key] = samples
+		shard.Unlock()
+	}
+}
+
+func (h *HistoryRepo) Close() error {
+	return nil
+}
+
+// DownsampleHistory - прореживание истории с шагом step, интервалы начинаются с from.
+// Для gauge в интервал попадает среднее значение, для counter - последнее накопленное значение
+// и сумма приращений. Агрегаты (min, max, last, количество) сохраняются в Rollup,
+// поэтому прореживать можно как исходные значения, так и уже агрегированные.
+func DownsampleHistory(samples []MetricSample, from time.Time, step time.Duration) []MetricSample {
+	if step <= 0 || len(samples) == 0 {
+		return samples
+	}
+
+	var result []MetricSample
+	for _, sample := range samples {
+		sampleBucket := from.Add(sample.Timestamp.Sub(from) / step * step)
+		if len(result) == 0 || !result[len(result)-1].Timestamp.Equal(sampleBucket) {
+			bucket := rollupSample(sample)
+			bucket.Timestamp = sampleBucket
+			result = append(result, bucket)
+			continue
+		}
+
+		mergeRollupSample(&result[len(result)-1], sample)
+	}
+
+	return result
+}
+
+// rollupSample - копия значения в виде агрегата, исходное значение считается агрегатом из одного элемента.
+func rollupSample(sample MetricSample) MetricSample {
+	result := MetricSample{
+		Timestamp: sample.Timestamp,
+		MetricValue: MetricValue{
+			MType: sample.MType,
+		},
+		Rollup: &Rollup{Count: 1},
+	}
+	if sample.Rollup != nil {
+		result.Rollup.Count = sample.Rollup.Count
+	}
+	if sample.Delta != nil {
+		delta := *sample.Delta
+		result.Delta = &delta
+	}
+	if sample.Increment != nil {
+		increment := *sample.Increment
+		result.Increment = &increment
+	}
+
+	if sample.Value != nil {
+		value := *sample.Value
+		minValue, maxValue, lastValue := value, value, value
+		if sample.Rollup != nil && sample.Rollup.Min != nil && sample.Rollup.Max != nil && sample.Rollup.Last != nil {
+			minValue, maxValue, lastValue = *sample.Rollup.Min, *sample.Rollup.Max, *sample.Rollup.Last
+		}
+		result.Value = &value
+		result.Rollup.Min = &minValue
+		result.Rollup.Max = &maxValue
+		result.Rollup.Last = &lastValue
+	}
+
+	return result
+}
+
+// mergeRollupSample - добавление значения в агрегат интервала.
+func mergeRollupSample(bucket *MetricSample, sample MetricSample) {
+	next := rollupSample(sample)
+	count := bucket.Rollup.Count + next.Rollup.Count
+
+	if next.Value != nil {
+		if bucket.Value == nil {
+			bucket.Value, bucket.Rollup.Min, bucket.Rollup.Max = next.Value, next.Rollup.Min, next.Rollup.Max
+		} else {
+			avg := (*bucket.Value*float64(bucket.Rollup.Count) + *next.Value*float64(next.Rollup.Count)) / float64(count)
+			*bucket.Value = avg
+			if *next.Rollup.Min < *bucket.Rollup.Min {
+				bucket.Rollup.Min = next.Rollup.Min
+			}
+			if *next.Rollup.Max > *bucket.Rollup.Max {
+				bucket.Rollup.Max = next.Rollup.Max
+			}
+		}
+		bucket.Rollup.Last = next.Rollup.Last
+	}
+
+	if next.Delta != nil {
+		bucket.Delta = next.Delta
+	}
+	if next.Increment != nil {
+		if bucket.Increment == nil {
+			bucket.Increment = next.Increment
+		} else {
+			*bucket.Increment += *next.Increment
+		}
+	}
+
+	bucket.Rollup.Count = count
+}
@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+)
+
+var (
+	ErrInvalidLabelName = errors.New("invalid label name")
+	ErrInvalidSeriesKey = errors.New("invalid series key")
+	// ErrInvalidMetricID - пустое имя метрики или имя с символами { и }, которые в ключе серии отделяют метки
+	ErrInvalidMetricID = errors.New("invalid metric id")
+)
+
+// SourceLabel - метка источника метрики (агента), её значение назначает сервер.
+const SourceLabel = "source"
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func init() {
+	govalidator.CustomTypeTagMap.Set("labels", func(i interface{}, _ interface{}) bool {
+		labels, ok := i.(Labels)
+		return ok && labels.Validate() == nil
+	})
+	govalidator.CustomTypeTagMap.Set("metricid", func(i interface{}, _ interface{}) bool {
+		id, ok := i.(string)
+		return ok && ValidateMetricID(id) == nil
+	})
+}
+
+// ValidateMetricID - проверка имени метрики.
+// Имя с { и } дало бы ключ серии, совпадающий с ключом другой метрики с метками, или ключ, который не разбирается.
+func ValidateMetricID(id string) error {
+	if id == "" || strings.ContainsAny(id, "{}") {
+		return fmt.Errorf("%w: %q", ErrInvalidMetricID, id)
+	}
+
+	return nil
+}
+
+// Labels - набор меток метрики (host, service, env и т.д.).
+type Labels map[string]string
+
+// Validate - проверка имён меток.
+func (labels Labels) Validate() error {
+	for name := range labels {
+		if !labelNameRegexp.MatchString(name) {
+			return fmt.Errorf("%w: %q", ErrInvalidLabelName, name)
+		}
+	}
+
+	return nil
+}
+
+// String - каноничное представление меток {k1="v1",k2="v2"}, для пустого набора - пустая строка.
+func (labels Labels) String() string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	builder.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(name)
+		builder.WriteByte('=')
+		builder.WriteString(strconv.Quote(labels[name]))
+	}
+	builder.WriteByte('}')
+
+	return builder.String()
+}
+
+// Without - копия набора меток без метки name.
+func (labels Labels) Without(name string) Labels {
+	copied := make(Labels, len(labels))
+	for labelName, value := range labels {
+		if labelName != name {
+			copied[labelName] = value
+		}
+	}
+
+	return copied
+}
+
+// With - копия набора меток с меткой name, существующая метка с тем же именем заменяется.
+func (labels Labels) With(name, value string) Labels {
+	copied := labels.Without(name)
+	copied[name] = value
+
+	return copied
+}
+
+// Match - true, если набор меток содержит все метки селектора с теми же значениями.
+func (labels Labels) Match(selector Labels) bool {
+	for name, value := range selector {
+		labelValue, ok := labels[name]
+		if !ok || labelValue != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SeriesKey - ключ серии в хранилище: имя метрики и каноничное представление меток.
+func SeriesKey(id string, labels Labels) string {
+	return id + labels.String()
+}
+
+// ParseSeriesKey - разбор ключа серии на имя метрики и метки.
+func ParseSeriesKey(key string) (string, Labels, error) {
+	labelsStart := strings.IndexByte(key, '{')
+	if labelsStart == -1 {
+		return key, Labels{}, nil
+	}
+
+	id := key[:labelsStart]
+	rest := key[labelsStart+1:]
+	labels := Labels{}
+
+	for rest != "}" {
+		nameEnd := strings.IndexByte(rest, '=')
+		if nameEnd <= 0 {
+			return "", nil, ErrInvalidSeriesKey
+		}
+		name := rest[:nameEnd]
+
+		quoted, err := strconv.QuotedPrefix(rest[nameEnd+1:])
+		if err != nil {
+			return "", nil, ErrInvalidSeriesKey
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return "", nil, ErrInvalidSeriesKey
+		}
+		labels[name] = value
+
+		rest = rest[nameEnd+1+len(quoted):]
+		if strings.HasPrefix(rest, ",") {
+			rest = rest[1:]
+		} else if rest != "}" {
+			return "", nil, ErrInvalidSeriesKey
+		}
+	}
+
+	return id, labels, nil
+}
+
+// ValidateSeriesKey - проверка ключа серии перед записью: допустимые имя и метки в каноничной записи SeriesKey.
+func ValidateSeriesKey(key string) error {
+	id, labels, err := ParseSeriesKey(key)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrInvalidSeriesKey, key)
+	}
+	if err = ValidateMetricID(id); err != nil {
+		return err
+	}
+	if err = labels.Validate(); err != nil {
+		return err
+	}
+	if SeriesKey(id, labels) != key {
+		return fmt.Errorf("%w: %q", ErrInvalidSeriesKey, key)
+	}
+
+	return nil
+}
+
+// MatchSeries - ключи серий метрики id, метки которых соответствуют селектору.
+func MatchSeries(metricMap MetricMap, id string, selector Labels) []string {
+	var keys []string
+
+	for key := range metricMap {
+		seriesID, labels, err := ParseSeriesKey(key)
+		if err != nil || seriesID != id || !labels.Match(selector) {
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// IsSeriesOf - ключ принадлежит серии метрики id: без меток или с любым набором меток.
+func IsSeriesOf(key string, id string) bool {
+	return key == id || strings.HasPrefix(key, seriesPrefix(id))
+}
+
+// seriesPrefix - начало ключей всех серий метрики id с метками.
+func seriesPrefix(id string) string {
+	return id + "{"
+}
+
+// seriesName - имя метрики без меток, для некорректного ключа - сам ключ.
+func seriesName(key string) string {
+	id, _, err := ParseSeriesKey(key)
+	if err != nil {
+		return key
+	}
+
+	return id
+}
+
+// matchSeriesName - соответствие имени метрики серии шаблону path.Match.
+func matchSeriesName(pattern, key string) bool {
+	ok, _ := path.Match(pattern, seriesName(key))
+	return ok
+}
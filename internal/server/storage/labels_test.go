@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesKey(t *testing.T) {
+	require.Equal(t, "HeapAlloc", SeriesKey("HeapAlloc", nil))
+	require.Equal(t, "HeapAlloc", SeriesKey("HeapAlloc", Labels{}))
+
+	key := SeriesKey("HeapAlloc", Labels{"service": "api", "host": `srv "1",{a}`})
+	require.Equal(t, `HeapAlloc{host="srv \"1\",{a}",service="api"}`, key)
+
+	id, labels, err := ParseSeriesKey(key)
+	require.NoError(t, err)
+	require.Equal(t, "HeapAlloc", id)
+	require.Equal(t, Labels{"service": "api", "host": `srv "1",{a}`}, labels)
+
+	id, labels, err = ParseSeriesKey("PollCount")
+	require.NoError(t, err)
+	require.Equal(t, "PollCount", id)
+	require.Empty(t, labels)
+
+	for _, invalidKey := range []string{`a{host}`, `a{host="1"`, `a{host="1"x}`, `a{="1"}`} {
+		_, _, err = ParseSeriesKey(invalidKey)
+		require.ErrorIs(t, err, ErrInvalidSeriesKey, invalidKey)
+	}
+}
+
+func TestMatchSeries(t *testing.T) {
+	var value = 1.5
+	metricValue := MetricValue{MType: MeticTypeGauge, Value: &value}
+	metricMap := MetricMap{
+		SeriesKey("HeapAlloc", Labels{"host": "a", "env": "prod"}): metricValue,
+		SeriesKey("HeapAlloc", Labels{"host": "b", "env": "prod"}): metricValue,
+		SeriesKey("HeapSys", Labels{"host": "a", "env": "prod"}):   metricValue,
+	}
+
+	require.Len(t, MatchSeries(metricMap, "HeapAlloc", Labels{"env": "prod"}), 2)
+	require.Equal(t, []string{`HeapAlloc{env="prod",host="b"}`}, MatchSeries(metricMap, "HeapAlloc", Labels{"host": "b"}))
+	require.Empty(t, MatchSeries(metricMap, "HeapAlloc", Labels{"host": "c"}))
+}
+
+func TestLabelsWith(t *testing.T) {
+	labels := Labels{"host": "a", SourceLabel: "spoofed"}
+
+	withSource := labels.With(SourceLabel, "agent-1")
+	require.Equal(t, Labels{"host": "a", SourceLabel: "agent-1"}, withSource)
+	require.Equal(t, "spoofed", labels[SourceLabel])
+
+	require.Equal(t, Labels{"host": "a"}, withSource.Without(SourceLabel))
+	require.Equal(t, Labels{SourceLabel: "agent-1"}, Labels(nil).With(SourceLabel, "agent-1"))
+}
+
+func TestLabelsValidation(t *testing.T) {
+	var value = 1.5
+	metric := Metric{
+		ID:          "HeapAlloc",
+		Labels:      Labels{"host": "a"},
+		MetricValue: MetricValue{MType: MeticTypeGauge, Value: &value},
+	}
+
+	_, err := govalidator.ValidateStruct(metric)
+	require.NoError(t, err)
+
+	metric.Labels = Labels{"host-name": "a"}
+	_, err = govalidator.ValidateStruct(metric)
+	require.Error(t, err)
+}
+
+func TestValidateMetricID(t *testing.T) {
+	require.NoError(t, ValidateMetricID("HeapAlloc"))
+	require.ErrorIs(t, ValidateMetricID(""), ErrInvalidMetricID)
+	require.ErrorIs(t, ValidateMetricID("a{b"), ErrInvalidMetricID)
+	require.ErrorIs(t, ValidateMetricID("a}"), ErrInvalidMetricID)
+
+	require.NoError(t, ValidateSeriesKey("HeapAlloc"))
+	require.NoError(t, ValidateSeriesKey(`HeapAlloc{host="a"}`))
+	require.Error(t, ValidateSeriesKey(`HeapAlloc{host="a"`))
+	require.Error(t, ValidateSeriesKey(`HeapAlloc{host-name="a"}`))
+	require.Error(t, ValidateSeriesKey(`HeapAlloc{host="a"}{b="c"}`))
+
+	var value = 1.5
+	metric := Metric{ID: "HeapAlloc{host=\"a\"}", MetricValue: MetricValue{MType: MeticTypeGauge, Value: &value}}
+	_, err := govalidator.ValidateStruct(metric)
+	require.Error(t, err)
+}
@@ -1,61 +1,181 @@
 package storage
 
 import (
-	"errors"
+	"hash/fnv"
+	"sort"
 	"sync"
+	"sync/atomic"
 )
 
-// MemoryRepo - потокобезопасное хранилище в ОП.
-type MemoryRepo struct {
+// memoryRepoShards - количество сегментов хранилища в ОП.
+// Ключи распределяются по сегментам по хешу, поэтому запись в разные ключи не ждёт общую блокировку.
+const memoryRepoShards = 64
+
+// memoryShardSeq - сквозная нумерация сегментов всех хранилищ, задаёт порядок их блокировки.
+var memoryShardSeq uint64
+
+// memoryShard - сегмент хранилища со своей блокировкой.
+type memoryShard struct {
+	id uint64
 	db map[string]MetricValue
-	*sync.RWMutex
+	sync.RWMutex
+}
+
+func (shard *memoryShard) get(key string) (MetricValue, bool) {
+	value, ok := shard.db[key]
+	return value, ok
+}
+
+func (shard *memoryShard) set(key string, value MetricValue) {
+	shard.db[key] = value
+}
+
+func (shard *memoryShard) remove(key string) {
+	delete(shard.db, key)
+}
+
+// MemoryRepo - потокобезопасное хранилище в ОП с блокировкой по сегментам.
+type MemoryRepo struct {
+	shards []*memoryShard
 }
 
 func NewMemoryRepo() (*MemoryRepo, error) {
-	return &MemoryRepo{
-		db:      make(map[string]MetricValue),
-		RWMutex: &sync.RWMutex{},
-	}, nil
+	return newMemoryRepo(memoryRepoShards), nil
+}
+
+func newMemoryRepo(shards int) *MemoryRepo {
+	m := &MemoryRepo{
+		shards: make([]*memoryShard, shards),
+	}
+	for i := range m.shards {
+		m.shards[i] = &memoryShard{
+			id: atomic.AddUint64(&memoryShardSeq, 1),
+			db: make(map[string]MetricValue),
+		}
+	}
+
+	return m
+}
+
+// shardIndex - номер сегмента ключа (FNV-1a).
+func shardIndex(key string, shards int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(shards))
+}
+
+func (m *MemoryRepo) shard(key string) *memoryShard {
+	return m.shards[shardIndex(key, len(m.shards))]
+}
+
+// lockShards - блокировка сегментов на запись в порядке их номеров, чтобы
+// пересекающиеся пачки не блокировали друг друга. Возвращает функцию снятия блокировки.
+func lockShards(shards []*memoryShard) func() {
+	unique := make([]*memoryShard, 0, len(shards))
+	seen := make(map[*memoryShard]struct{}, len(shards))
+	for _, shard := range shards {
+		if _, ok := seen[shard]; ok {
+			continue
+		}
+		seen[shard] = struct{}{}
+		unique = append(unique, shard)
+	}
+	sort.Slice(unique, func(i, j int) bool {
+		return unique[i].id < unique[j].id
+	})
+
+	for _, shard := range unique {
+		shard.Lock()
+	}
+
+	return func() {
+		for i := len(unique) - 1; i >= 0; i-- {
+			unique[i].Unlock()
+		}
+	}
 }
 
 func (m *MemoryRepo) Len() int {
-	m.RLock()
-	defer m.RUnlock()
-	return len(m.db)
+	var length int
+	for _, shard := range m.shards {
+		shard.RLock()
+		length += len(shard.db)
+		shard.RUnlock()
+	}
+	return length
 }
 
 func (m MemoryRepo) Write(key string, value MetricValue) error {
-	m.Lock()
-	defer m.Unlock()
-	m.db[key] = value
+	shard := m.shard(key)
+	shard.Lock()
+	defer shard.Unlock()
+	shard.set(key, value)
 	return nil
 }
 
 func (m *MemoryRepo) Delete(key string) (MetricValue, bool) {
-	m.Lock()
-	defer m.Unlock()
-	oldValue, ok := m.db[key]
+	shard := m.shard(key)
+	shard.Lock()
+	defer shard.Unlock()
+	oldValue, ok := shard.get(key)
 	if ok {
-		delete(m.db, key)
+		shard.remove(key)
 	}
 	return oldValue, ok
 }
 
 func (m MemoryRepo) Read(key string) (MetricValue, error) {
-	m.RLock()
-	defer m.RUnlock()
-	value, err := m.db[key]
+	shard := m.shard(key)
+	shard.RLock()
+	defer shard.RUnlock()
+	value, err := shard.get(key)
 	if !err {
-		return MetricValue{}, errors.New("Значение по ключу не найдено, ключ: " + key)
+		return MetricValue{}, ErrMetricNotFound
 	}
 
 	return value, nil
 }
 
+// Keys - все ключи хранилища.
+func (m MemoryRepo) Keys() []string {
+	var keys []string
+	for _, shard := range m.shards {
+		shard.RLock()
+		for key := range shard.db {
+			keys = append(keys, key)
+		}
+		shard.RUnlock()
+	}
+
+	return keys
+}
+
+// Series - копия значений всех серий метрики id.
+func (m MemoryRepo) Series(id string) map[string]MetricValue {
+	series := make(map[string]MetricValue)
+	for _, shard := range m.shards {
+		shard.RLock()
+		for key, value := range shard.db {
+			if IsSeriesOf(key, id) {
+				series[key] = value
+			}
+		}
+		shard.RUnlock()
+	}
+	return series
+}
+
+// GetSchemaDump - копия всех значений хранилища.
 func (m MemoryRepo) GetSchemaDump() map[string]MetricValue {
-	m.RLock()
-	defer m.RUnlock()
-	return m.db
+	dump := make(map[string]MetricValue)
+	for _, shard := range m.shards {
+		shard.RLock()
+		for key, value := range shard.db {
+			dump[key] = value
+		}
+		shard.RUnlock()
+	}
+	return dump
 }
 
 func (m *MemoryRepo) Close() error {
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/config"
+)
+
+func TestMemoryRepoConcurrentUpdates(t *testing.T) {
+	storeConfig := config.StoreConfig{
+		File:    filepath.Join(t.TempDir(), "metrics.json"),
+		Restore: true,
+	}
+	metricsMemoryRepo := NewMetricsMemoryRepo(storeConfig)
+
+	const (
+		workers    = 16
+		iterations = 200
+	)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				var delta int64 = 1
+				var batchDelta int64 = 2
+				value := float64(worker)
+
+				err := metricsMemoryRepo.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+				require.NoError(t, err)
+
+				// Пачки пересекаются по ключам в разном порядке
+				batch := []Metric{
+					{ID: "BatchCount", MetricValue: MetricValue{MType: MeticTypeCounter, Delta: &batchDelta}},
+					{ID: "PollCount", MetricValue: MetricValue{MType: MeticTypeCounter, Delta: &delta}},
+					{ID: fmt.Sprintf("Worker%d", worker), MetricValue: MetricValue{MType: MeticTypeGauge, Value: &value}},
+				}
+				if i%2 == 0 {
+					batch[0], batch[1] = batch[1], batch[0]
+				}
+				err = metricsMemoryRepo.UpdateManySliceMetric(context.Background(), batch)
+				require.NoError(t, err)
+
+				if i%50 == 0 {
+					require.NoError(t, metricsMemoryRepo.Save(context.Background()))
+				}
+				_, err = metricsMemoryRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+				require.NoError(t, err)
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	pollCount, err := metricsMemoryRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 2*workers*iterations, *pollCount.Delta)
+
+	batchCount, err := metricsMemoryRepo.Read(context.Background(), "BatchCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 2*workers*iterations, *batchCount.Delta)
+	require.Equal(t, 2*workers*iterations, metricsMemoryRepo.counterHistory.Len("PollCount"))
+
+	// Снимок и журнал согласованы: после восстановления значения те же
+	require.NoError(t, metricsMemoryRepo.Close())
+	restoredRepo := NewMetricsMemoryRepo(storeConfig)
+	restoredRepo.InitFromFile(context.Background())
+
+	pollCount, err = restoredRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 2*workers*iterations, *pollCount.Delta)
+	require.NoError(t, restoredRepo.Close())
+}
+
+func TestMemoryRepoUpdateManySliceAtomic(t *testing.T) {
+	storeConfig := config.StoreConfig{
+		File:    filepath.Join(t.TempDir(), "metrics.json"),
+		Restore: true,
+	}
+	metricsMemoryRepo := NewMetricsMemoryRepo(storeConfig)
+
+	var delta int64 = 5
+	value := 1.5
+	err := metricsMemoryRepo.UpdateManySliceMetric(context.Background(), []Metric{
+		{ID: "PollCount", MetricValue: MetricValue{MType: MeticTypeCounter, Delta: &delta}},
+		{ID: "PollCount", MetricValue: MetricValue{MType: MeticTypeCounter, Delta: &delta}},
+	})
+	require.NoError(t, err)
+
+	// Ошибка в любом элементе пачки отменяет всю пачку
+	err = metricsMemoryRepo.UpdateManySliceMetric(context.Background(), []Metric{
+		{ID: "PollCount", MetricValue: MetricValue{MType: MeticTypeCounter, Delta: &delta}},
+		{ID: "Alloc", MetricValue: MetricValue{MType: MeticTypeGauge, Value: &value}},
+		{ID: "Latency", MetricValue: MetricValue{MType: MeticTypeHistogram, Histogram: &HistogramValue{Buckets: []float64{1}, Counts: []uint64{1}}}},
+	})
+	require.Error(t, err)
+
+	err = metricsMemoryRepo.UpdateManySliceMetric(context.Background(), []Metric{
+		{ID: "Latency", MetricValue: MetricValue{MType: MeticTypeHistogram, Histogram: &HistogramValue{Buckets: []float64{1}, Counts: []uint64{1, 0}, Count: 1}}},
+		{ID: "PollCount", MetricValue: MetricValue{MType: MeticTypeCounter, Delta: &delta}},
+		{ID: "Latency", MetricValue: MetricValue{MType: MeticTypeHistogram, Histogram: &HistogramValue{Buckets: []float64{2}, Counts: []uint64{1, 0}, Count: 1}}},
+	})
+	require.Error(t, err)
+
+	pollCount, err := metricsMemoryRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, *pollCount.Delta)
+	require.Equal(t, 2, metricsMemoryRepo.counterHistory.Len("PollCount"))
+
+	_, err = metricsMemoryRepo.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.Error(t, err)
+	_, err = metricsMemoryRepo.Read(context.Background(), "Latency", MeticTypeHistogram)
+	require.Error(t, err)
+
+	// Отменённые пачки не попадают в журнал
+	require.Equal(t, 1, metricsMemoryRepo.wal.Len())
+	require.NoError(t, metricsMemoryRepo.Close())
+
+	restoredRepo := NewMetricsMemoryRepo(storeConfig)
+	restoredRepo.InitFromFile(context.Background())
+
+	pollCount, err = restoredRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, *pollCount.Delta)
+	require.NoError(t, restoredRepo.Close())
+}
+
+func BenchmarkMemoryRepoUpdateParallel(b *testing.B) {
+	repo := NewMetricsMemoryRepo(config.StoreConfig{})
+	var worker int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		key := fmt.Sprintf("PollCount%d", atomic.AddInt64(&worker, 1))
+		var delta int64 = 1
+		for pb.Next() {
+			err := repo.Update(context.Background(), key, MetricValue{MType: MeticTypeCounter, Delta: &delta})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkMemoryRepoUpdateSameKeyParallel(b *testing.B) {
+	repo := NewMetricsMemoryRepo(config.StoreConfig{})
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var delta int64 = 1
+		for pb.Next() {
+			err := repo.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkMemoryRepoUpdateManySliceParallel(b *testing.B) {
+	repo := NewMetricsMemoryRepo(config.StoreConfig{})
+	var worker int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		id := atomic.AddInt64(&worker, 1)
+		var delta int64 = 1
+		value := 1.5
+		batch := make([]Metric, 0, 2*runtime.GOMAXPROCS(0))
+		for i := 0; i < cap(batch)/2; i++ {
+			batch = append(batch,
+				Metric{ID: fmt.Sprintf("Counter%d_%d", id, i), MetricValue: MetricValue{MType: MeticTypeCounter, Delta: &delta}},
+				Metric{ID: fmt.Sprintf("Gauge%d_%d", id, i), MetricValue: MetricValue{MType: MeticTypeGauge, Value: &value}},
+			)
+		}
+
+		for pb.Next() {
+			err := repo.UpdateManySliceMetric(context.Background(), batch)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -4,11 +4,13 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/ory/dockertest/v3"
@@ -73,8 +75,8 @@ func (suite *MetricsDBRepoSuite) SetupSuite() {
 			return err
 		}
 
-		log.Println(metricsRepo.Ping())
-		return metricsRepo.Ping()
+		log.Println(metricsRepo.Ping(context.Background()))
+		return metricsRepo.Ping(context.Background())
 	})
 	suite.NoError(err)
 	suite.metricsRepo = &metricsRepo
@@ -85,7 +87,7 @@ func (suite *MetricsDBRepoSuite) SetupSuite() {
 
 	suite.repoFile, err = os.OpenFile(TempDBRepoFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	suite.NoError(err)
-	suite.metricsRepo.InitFromFile()
+	suite.metricsRepo.InitFromFile(context.Background())
 
 	cleanerEngine := engine.NewPostgresEngine(DSN)
 	suite.cleaner = dbcleaner.New()
@@ -100,7 +102,7 @@ func (suite *MetricsDBRepoSuite) TearDownSuite() {
 		}
 	}()
 
-	err := suite.metricsRepo.Save()
+	err := suite.metricsRepo.Save(context.Background())
 	suite.NoError(err)
 
 	err = suite.metricsRepo.Close()
@@ -118,66 +120,78 @@ func (suite *MetricsDBRepoSuite) TearDownSuite() {
 func (suite *MetricsDBRepoSuite) SetupTest() {
 	suite.cleaner.Acquire("counter")
 	suite.cleaner.Acquire("gauge")
+	suite.cleaner.Acquire("counter_history")
+	suite.cleaner.Acquire("gauge_history")
+	suite.cleaner.Acquire("histogram")
+	suite.cleaner.Acquire("summary")
+	suite.cleaner.Acquire("gauge_rollup")
+	suite.cleaner.Acquire("counter_rollup")
 }
 
 func (suite *MetricsDBRepoSuite) TearDownTest() {
 	suite.cleaner.Clean("counter")
 	suite.cleaner.Clean("gauge")
+	suite.cleaner.Clean("counter_history")
+	suite.cleaner.Clean("gauge_history")
+	suite.cleaner.Clean("histogram")
+	suite.cleaner.Clean("summary")
+	suite.cleaner.Clean("gauge_rollup")
+	suite.cleaner.Clean("counter_rollup")
 }
 
 func (suite *MetricsDBRepoSuite) TestDBRepo_Ping() {
-	err := suite.metricsRepo.Ping()
+	err := suite.metricsRepo.Ping(context.Background())
 	suite.NoError(err)
 }
 
 func (suite *MetricsDBRepoSuite) TestDBRepo_ReadEmpty() {
-	err := suite.metricsRepo.Ping()
+	err := suite.metricsRepo.Ping(context.Background())
 	suite.NoError(err)
 
-	_, err = suite.metricsRepo.Read("PollCount", MeticTypeCounter)
+	_, err = suite.metricsRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
 	suite.Error(err)
 
-	_, err = suite.metricsRepo.Read("gauge", MeticTypeGauge)
+	_, err = suite.metricsRepo.Read(context.Background(), "gauge", MeticTypeGauge)
 	suite.Error(err)
 }
 
 func (suite *MetricsDBRepoSuite) TestDBRepo_ReadWrite() {
-	err := suite.metricsRepo.Ping()
+	err := suite.metricsRepo.Ping(context.Background())
 	suite.NoError(err)
 
 	var metricValue1 int64 = 7
-	err = suite.metricsRepo.Update("PollCount", MetricValue{
+	err = suite.metricsRepo.Update(context.Background(), "PollCount", MetricValue{
 		MType: MeticTypeCounter,
 		Delta: &metricValue1,
 	})
 	suite.NoError(err)
 
 	var metricGauge1 float64 = 27.1
-	err = suite.metricsRepo.Update("Gauge", MetricValue{
+	err = suite.metricsRepo.Update(context.Background(), "Gauge", MetricValue{
 		MType: MeticTypeGauge,
 		Value: &metricGauge1,
 	})
 	suite.NoError(err)
 
-	metricValueCounter, err := suite.metricsRepo.Read("PollCount", MeticTypeCounter)
+	metricValueCounter, err := suite.metricsRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
 	suite.NoError(err)
 	suite.EqualValues(metricValue1, *metricValueCounter.Delta)
 
-	metricValueGauge, err := suite.metricsRepo.Read("Gauge", MeticTypeGauge)
+	metricValueGauge, err := suite.metricsRepo.Read(context.Background(), "Gauge", MeticTypeGauge)
 	suite.NoError(err)
 	suite.EqualValues(metricGauge1, *metricValueGauge.Value)
 
-	metricValueCounter, err = suite.metricsRepo.readCounter("PollCount")
+	metricValueCounter, err = suite.metricsRepo.readCounter(context.Background(), "PollCount")
 	suite.NoError(err)
 	suite.EqualValues(metricValue1, *metricValueCounter.Delta)
 
-	metricValueGauge, err = suite.metricsRepo.Read("Gauge", MeticTypeGauge)
+	metricValueGauge, err = suite.metricsRepo.Read(context.Background(), "Gauge", MeticTypeGauge)
 	suite.NoError(err)
 	suite.EqualValues(metricGauge1, *metricValueGauge.Value)
 }
 
 func (suite *MetricsDBRepoSuite) TestDBRepo_ReadWriteMany() {
-	err := suite.metricsRepo.Ping()
+	err := suite.metricsRepo.Ping(context.Background())
 	suite.NoError(err)
 
 	var metricValueRaw1 int64 = 27
@@ -193,22 +207,178 @@ func (suite *MetricsDBRepoSuite) TestDBRepo_ReadWriteMany() {
 	}
 
 	repoMetricMap := MetricMap{"Counter1": metricValue1, "Gauge1": metricGauge1}
-	err = suite.metricsRepo.UpdateMany(repoMetricMap)
+	err = suite.metricsRepo.UpdateMany(context.Background(), repoMetricMap)
 	suite.NoError(err)
 
-	repoCounterMap, err := suite.metricsRepo.readAllCounter()
+	repoCounterMap, err := suite.metricsRepo.readAllCounter(context.Background())
 	suite.NoError(err)
 	suite.EqualValues(MetricMap{"Counter1": metricValue1}, repoCounterMap)
 
-	repoGaugeMap, err := suite.metricsRepo.readAllGauge()
+	repoGaugeMap, err := suite.metricsRepo.readAllGauge(context.Background())
 	suite.NoError(err)
 	suite.EqualValues(MetricMap{"Gauge1": metricGauge1}, repoGaugeMap)
 
-	repoAllMetricsMap := suite.metricsRepo.ReadAll()
+	repoAllMetricsMap, err := suite.metricsRepo.ReadAll(context.Background())
+	suite.NoError(err)
 	suite.EqualValues(MetricMap{"Counter1": metricValue1}, repoAllMetricsMap[MeticTypeCounter])
 	suite.EqualValues(MetricMap{"Gauge1": metricGauge1}, repoAllMetricsMap[MeticTypeGauge])
 }
 
+func (suite *MetricsDBRepoSuite) TestDBRepo_ReadHistory() {
+	from := time.Now().Add(-time.Minute)
+
+	var metricValueRaw1 int64 = 5
+	var metricValueRaw2 int64 = 7
+	for _, delta := range []*int64{&metricValueRaw1, &metricValueRaw2} {
+		err := suite.metricsRepo.Update(context.Background(), "PollCount", MetricValue{
+			MType: MeticTypeCounter,
+			Delta: delta,
+		})
+		suite.NoError(err)
+	}
+
+	counterHistory, err := suite.metricsRepo.ReadHistory(context.Background(), "PollCount", MeticTypeCounter, from, time.Now().Add(time.Minute), 0)
+	suite.NoError(err)
+	suite.Len(counterHistory, 2)
+	suite.EqualValues(5, *counterHistory[0].Delta)
+	suite.EqualValues(12, *counterHistory[1].Delta)
+}
+
+func (suite *MetricsDBRepoSuite) TestDBRepo_UpdateAggregate() {
+	histogram := NewHistogramValue([]float64{0.1, 1})
+	histogram.Observe(0.5)
+
+	err := suite.metricsRepo.UpdateManySliceMetric(context.Background(), []Metric{
+		{ID: "Latency", MetricValue: MetricValue{MType: MeticTypeHistogram, Histogram: histogram}},
+		{ID: "Latency", MetricValue: MetricValue{MType: MeticTypeHistogram, Histogram: histogram}},
+	})
+	suite.NoError(err)
+
+	latency, err := suite.metricsRepo.Read(context.Background(), "Latency", MeticTypeHistogram)
+	suite.NoError(err)
+	suite.Equal([]uint64{0, 2, 0}, latency.Histogram.Counts)
+
+	err = suite.metricsRepo.Update(context.Background(), "Duration", MetricValue{
+		MType:   MeticTypeSummary,
+		Summary: &SummaryValue{Quantiles: []Quantile{{Quantile: 0.5, Value: 1}}, Sum: 2, Count: 2},
+	})
+	suite.NoError(err)
+
+	allMetrics, err := suite.metricsRepo.ReadAll(context.Background())
+	suite.NoError(err)
+	suite.EqualValues(2, allMetrics[MeticTypeSummary]["Duration"].Summary.Count)
+}
+
+func (suite *MetricsDBRepoSuite) TestDBRepo_Compact() {
+	repository := *suite.metricsRepo
+	repository.config.Retention = config.RetentionConfig{
+		Rules: []config.RetentionRule{
+			{
+				Pattern: "*",
+				Raw:     config.Duration(time.Hour),
+				Rollups: []config.RollupRule{{Step: config.Duration(time.Minute)}},
+			},
+		},
+	}
+
+	now := time.Now()
+	base := rollupBucket(now.Add(-3*time.Hour), time.Minute)
+	for i, value := range []float64{1, 3} {
+		_, err := suite.db.Exec("INSERT INTO gauge_history (name, value, created_at) VALUES ($1, $2, $3)", "Alloc", value, base.Add(time.Duration(i)*time.Second))
+		suite.NoError(err)
+		_, err = suite.db.Exec("INSERT INTO counter_history (name, value, delta, created_at) VALUES ($1, $2, $3, $4)", "PollCount", 5*(i+1), 5, base.Add(time.Duration(i)*time.Second))
+		suite.NoError(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		suite.NoError(repository.Compact(context.Background(), now))
+	}
+
+	var rawCount int
+	suite.NoError(suite.db.QueryRow("SELECT count(*) FROM gauge_history WHERE name = 'Alloc'").Scan(&rawCount))
+	suite.Equal(0, rawCount)
+
+	gaugeHistory, err := repository.ReadHistory(context.Background(), "Alloc", MeticTypeGauge, base, now, 0)
+	suite.NoError(err)
+	suite.Len(gaugeHistory, 1)
+	suite.True(base.Equal(gaugeHistory[0].Timestamp))
+	suite.EqualValues(2, *gaugeHistory[0].Value)
+	suite.EqualValues(3, *gaugeHistory[0].Rollup.Max)
+
+	counterHistory, err := repository.ReadHistory(context.Background(), "PollCount", MeticTypeCounter, base, now, 0)
+	suite.NoError(err)
+	suite.Len(counterHistory, 1)
+	suite.EqualValues(10, *counterHistory[0].Increment)
+	suite.EqualValues(10, *counterHistory[0].Delta)
+}
+
+func (suite *MetricsDBRepoSuite) TestDBRepo_DeleteAndReset() {
+	var delta int64 = 5
+	value := 1.5
+	for _, key := range []string{"PollCount", `PollCount{host="a"}`, "RandomValue"} {
+		suite.NoError(suite.metricsRepo.Update(context.Background(), key, MetricValue{MType: MeticTypeCounter, Delta: &delta}))
+	}
+	suite.NoError(suite.metricsRepo.Update(context.Background(), "Alloc", MetricValue{MType: MeticTypeGauge, Value: &value}))
+
+	suite.NoError(suite.metricsRepo.ResetCounter(context.Background(), "PollCount"))
+	pollCount, err := suite.metricsRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	suite.NoError(err)
+	suite.EqualValues(0, *pollCount.Delta)
+	suite.ErrorIs(suite.metricsRepo.ResetCounter(context.Background(), "Unknown"), ErrMetricNotFound)
+
+	suite.NoError(suite.metricsRepo.Delete(context.Background(), "Alloc", MeticTypeGauge))
+	suite.ErrorIs(suite.metricsRepo.Delete(context.Background(), "Alloc", MeticTypeGauge), ErrMetricNotFound)
+
+	deleted, err := suite.metricsRepo.DeleteMatching(context.Background(), "", "Poll*")
+	suite.NoError(err)
+	suite.Equal(2, deleted)
+	allMetrics, err := suite.metricsRepo.ReadAll(context.Background())
+	suite.NoError(err)
+	suite.Len(allMetrics[MeticTypeCounter], 1)
+}
+
+func (suite *MetricsDBRepoSuite) TestDBRepo_Expire() {
+	var delta int64 = 5
+	value := 1.5
+	suite.NoError(suite.metricsRepo.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta}))
+	suite.NoError(suite.metricsRepo.Update(context.Background(), "Alloc", MetricValue{MType: MeticTypeGauge, Value: &value}))
+
+	alloc, err := suite.metricsRepo.Read(context.Background(), "Alloc", MeticTypeGauge)
+	suite.NoError(err)
+	suite.WithinDuration(time.Now(), *alloc.UpdatedAt, time.Minute)
+
+	_, err = suite.db.Exec("UPDATE counter SET updated_at = now() - interval '1 hour' WHERE name = $1", "PollCount")
+	suite.NoError(err)
+
+	expired, err := suite.metricsRepo.Expire(context.Background(), time.Now().Add(-time.Minute))
+	suite.NoError(err)
+	suite.Equal(1, expired)
+
+	_, err = suite.metricsRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	suite.ErrorIs(err, ErrMetricNotFound)
+	_, err = suite.metricsRepo.Read(context.Background(), "Alloc", MeticTypeGauge)
+	suite.NoError(err)
+
+	var history int
+	suite.NoError(suite.db.QueryRow("SELECT count(*) FROM counter_history WHERE name = $1", "PollCount").Scan(&history))
+	suite.Equal(0, history)
+}
+
+func (suite *MetricsDBRepoSuite) TestDBRepo_Migrate() {
+	migrations, err := Migrations()
+	suite.NoError(err)
+
+	suite.NoError(suite.metricsRepo.Migrate())
+
+	pending, err := suite.metricsRepo.PendingMigrations()
+	suite.NoError(err)
+	suite.Empty(pending)
+
+	var applied int
+	suite.NoError(suite.db.QueryRow("SELECT count(*) FROM schema_version").Scan(&applied))
+	suite.Equal(len(migrations), applied)
+}
+
 func TestUploaderSuite(t *testing.T) {
 	suite.Run(t, new(MetricsDBRepoSuite))
 }
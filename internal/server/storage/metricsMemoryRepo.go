@@ -1,13 +1,18 @@
 package storage
 
 import (
+	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,27 +22,49 @@ import (
 const SyncUploadSymbol = time.Duration(0)
 
 type MetricValue struct {
-	MType string   `json:"type" valid:"required,in(counter|gauge)"`
-	Delta *int64   `json:"delta,omitempty"`
-	Value *float64 `json:"value,omitempty"`
+	MType     string          `json:"type" valid:"required,in(counter|gauge|histogram|summary)"`
+	Delta     *int64          `json:"delta,omitempty"`
+	Value     *float64        `json:"value,omitempty"`
+	Histogram *HistogramValue `json:"histogram,omitempty"`
+	Summary   *SummaryValue   `json:"summary,omitempty"`
+	// UpdatedAt - время последней записи значения, заполняется хранилищем
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
 }
 
 type Metric struct {
-	ID string `json:"id" valid:"required"`
+	ID     string `json:"id" valid:"required,metricid"`
+	Labels Labels `json:"labels,omitempty" valid:"labels"`
 	MetricValue
 }
 
+// SeriesKey - ключ серии метрики с учётом меток.
+func (metric Metric) SeriesKey() string {
+	return SeriesKey(metric.ID, metric.Labels)
+}
+
 func (metric MetricValue) GetStringValue() string {
 	switch metric.MType {
 	case MeticTypeGauge:
 		return fmt.Sprintf("%v", *metric.Value)
 	case MeticTypeCounter:
 		return fmt.Sprintf("%v", *metric.Delta)
+	case MeticTypeHistogram:
+		return metric.Histogram.String()
+	case MeticTypeSummary:
+		return metric.Summary.String()
 	default:
 		return ""
 	}
 }
 
+// IsStale - gauge не обновлялся с момента before, например агент перестал отправлять метрики.
+// Значения counter, histogram и summary накопительные и не устаревают.
+func (metric MetricValue) IsStale(before time.Time) bool {
+	return metric.MType == MeticTypeGauge && metric.UpdatedAt != nil && metric.UpdatedAt.Before(before)
+}
+
+// GetHash - HMAC SHA256 значения метрики id с ключом signKey.
+// Для histogram подписываются границы и количества всех интервалов, для summary - все квантили и их значения.
 func (metric MetricValue) GetHash(id, signKey string) []byte {
 	if signKey == "" {
 		return nil
@@ -49,6 +76,23 @@ func (metric MetricValue) GetHash(id, signKey string) []byte {
 		metricLabel = fmt.Sprintf("%s:gauge:%f", id, *metric.Value)
 	case MeticTypeCounter:
 		metricLabel = fmt.Sprintf("%s:counter:%d", id, *metric.Delta)
+	case MeticTypeHistogram:
+		var builder strings.Builder
+		fmt.Fprintf(&builder, "%s:histogram:%d:%f", id, metric.Histogram.Count, metric.Histogram.Sum)
+		for _, bucket := range metric.Histogram.Buckets {
+			fmt.Fprintf(&builder, ":%g", bucket)
+		}
+		for _, count := range metric.Histogram.Counts {
+			fmt.Fprintf(&builder, ":%d", count)
+		}
+		metricLabel = builder.String()
+	case MeticTypeSummary:
+		var builder strings.Builder
+		fmt.Fprintf(&builder, "%s:summary:%d:%f", id, metric.Summary.Count, metric.Summary.Sum)
+		for _, quantile := range metric.Summary.Quantiles {
+			fmt.Fprintf(&builder, ":%g=%g", quantile.Quantile, quantile.Value)
+		}
+		metricLabel = builder.String()
 	default:
 		return nil
 	}
@@ -60,10 +104,17 @@ func (metric MetricValue) GetHash(id, signKey string) []byte {
 
 //MetricsMemoryRepo - репозиторий в оперативной памяти для приходящей статистики.
 type MetricsMemoryRepo struct {
-	uploadMutex    *sync.RWMutex
-	gaugeStorage   *MemoryRepo
-	counterStorage *MemoryRepo
-	config         config.StoreConfig
+	uploadMutex      *sync.RWMutex
+	gaugeStorage     *MemoryRepo
+	counterStorage   *MemoryRepo
+	histogramStorage *MemoryRepo
+	summaryStorage   *MemoryRepo
+	gaugeHistory     *HistoryRepo
+	counterHistory   *HistoryRepo
+	gaugeRollups     *RollupRepo
+	counterRollups   *RollupRepo
+	wal              *WAL
+	config           config.StoreConfig
 }
 
 func NewMetricsMemoryRepo(config config.StoreConfig) MetricsMemoryRepo {
@@ -80,6 +131,45 @@ func NewMetricsMemoryRepo(config config.StoreConfig) MetricsMemoryRepo {
 	if err != nil {
 		panic("counterMemoryRepo init error")
 	}
+	metricsMemoryRepo.histogramStorage, err = NewMemoryRepo()
+	if err != nil {
+		panic("histogramMemoryRepo init error")
+	}
+	metricsMemoryRepo.summaryStorage, err = NewMemoryRepo()
+	if err != nil {
+		panic("summaryMemoryRepo init error")
+	}
+	metricsMemoryRepo.gaugeHistory, err = NewHistoryRepo()
+	if err != nil {
+		panic("gaugeHistoryRepo init error")
+	}
+	metricsMemoryRepo.counterHistory, err = NewHistoryRepo()
+	if err != nil {
+		panic("counterHistoryRepo init error")
+	}
+	metricsMemoryRepo.gaugeRollups, err = NewRollupRepo()
+	if err != nil {
+		panic("gaugeRollupRepo init error")
+	}
+	metricsMemoryRepo.counterRollups, err = NewRollupRepo()
+	if err != nil {
+		panic("counterRollupRepo init error")
+	}
+
+	if metricsMemoryRepo.config.File != "" {
+		metricsMemoryRepo.wal, err = OpenWAL(metricsMemoryRepo.config.File+WALSuffix, metricsMemoryRepo.config.Interval == SyncUploadSymbol)
+		if err != nil {
+			panic(err.Error())
+		}
+
+		// Без восстановления старые снимок и журнал не нужны, иначе они будут применены при следующем запуске
+		if !metricsMemoryRepo.config.Restore {
+			err = metricsMemoryRepo.UploadToFile()
+			if err != nil {
+				panic(err.Error())
+			}
+		}
+	}
 
 	if metricsMemoryRepo.config.Interval != SyncUploadSymbol {
 		metricsMemoryRepo.IterativeUploadToFile()
@@ -88,78 +178,616 @@ func NewMetricsMemoryRepo(config config.StoreConfig) MetricsMemoryRepo {
 	return metricsMemoryRepo
 }
 
-func (metricsMemoryRepo MetricsMemoryRepo) Update(key string, newMetricValue MetricValue) error {
+func (metricsMemoryRepo MetricsMemoryRepo) Update(ctx context.Context, key string, newMetricValue MetricValue) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := ValidateSeriesKey(key); err != nil {
+		return err
+	}
+
+	err := metricsMemoryRepo.update(key, newMetricValue, time.Now(), updateFromClient)
+	if err != nil {
+		return err
+	}
+
+	return metricsMemoryRepo.compactIfNeeded()
+}
+
+// updateSource - источник обновления, от него зависит запись в журнал и в историю.
+type updateSource int
+
+const (
+	// updateFromClient - новое значение: запись в журнал и в историю
+	updateFromClient updateSource = iota
+	// updateFromWAL - воспроизведение журнала: только история
+	updateFromWAL
+	// updateFromSnapshot - загрузка снимка: без журнала и истории, история загружается из снимка отдельно
+	updateFromSnapshot
+)
+
+func (metricsMemoryRepo MetricsMemoryRepo) update(key string, newMetricValue MetricValue, timestamp time.Time, source updateSource) error {
+	return metricsMemoryRepo.apply([]walRecord{{
+		Op:        walOpUpdate,
+		Key:       key,
+		Value:     newMetricValue,
+		Timestamp: timestamp,
+	}}, source)
+}
+
+// prepareMetricValue - проверка нового значения по типу метрики, поля других типов очищаются.
+func prepareMetricValue(newMetricValue MetricValue) (MetricValue, error) {
 	switch newMetricValue.MType {
 	case MeticTypeGauge:
 		if newMetricValue.Value == nil {
-			return errors.New("metric Value is empty")
+			return newMetricValue, fmt.Errorf("%w: Value", ErrEmptyMetricValue)
 		}
 		newMetricValue.Delta = nil
-
-		return metricsMemoryRepo.updateGaugeValue(key, newMetricValue)
 	case MeticTypeCounter:
 		if newMetricValue.Delta == nil {
-			return errors.New("metric Delta is empty")
+			return newMetricValue, fmt.Errorf("%w: Delta", ErrEmptyMetricValue)
 		}
 		newMetricValue.Value = nil
+	case MeticTypeHistogram, MeticTypeSummary:
+		return prepareAggregateValue(newMetricValue)
+	default:
+		return newMetricValue, ErrUnknownMetricType
+	}
+
+	return newMetricValue, nil
+}
+
+// memoryChange - проверенное изменение одного ключа и хранилища, которые оно затрагивает.
+type memoryChange struct {
+	record  walRecord
+	repo    *MemoryRepo
+	history *HistoryRepo
+	rollups *RollupRepo
+}
+
+// prepareChange - проверка записи и выбор хранилищ по типу метрики.
+func (metricsMemoryRepo MetricsMemoryRepo) prepareChange(record walRecord) (memoryChange, error) {
+	change := memoryChange{
+		record: record,
+	}
 
-		return metricsMemoryRepo.updateCounterValue(key, newMetricValue)
+	switch record.Op {
+	case walOpUpdate:
+		value, err := prepareMetricValue(record.Value)
+		if err != nil {
+			return change, err
+		}
+		change.record.Value = value
+	case walOpDelete, walOpExpire:
+	case walOpReset:
+		change.record.Value = MetricValue{MType: MeticTypeCounter}
+	case walOpSet:
+		if change.record.Value.Delta == nil {
+			return change, ErrEmptyMetricValue
+		}
+		change.record.Value = MetricValue{MType: MeticTypeCounter, Delta: change.record.Value.Delta}
 	default:
-		return errors.New("metric type is not defined")
+		return change, fmt.Errorf("unknown WAL operation %q", record.Op)
+	}
+
+	repo, err := metricsMemoryRepo.storageByType(change.record.Value.MType)
+	if err != nil {
+		return change, err
 	}
+	change.repo = repo
+	change.history, change.rollups, _ = metricsMemoryRepo.historyByType(change.record.Value.MType)
+
+	return change, nil
 }
 
-func (metricsMemoryRepo MetricsMemoryRepo) updateGaugeValue(key string, newMetricValue MetricValue) error {
-	metricsMemoryRepo.uploadMutex.Lock()
-	err := metricsMemoryRepo.gaugeStorage.Write(key, newMetricValue)
-	metricsMemoryRepo.uploadMutex.Unlock()
+// apply - применение изменений целиком или никак.
+// Сегменты всех ключей заблокированы на время чтения, объединения значений, записи в журнал и в память,
+// поэтому приращения counter не теряются при конкурентной записи, а пачка не видна частично.
+// uploadMutex берётся на чтение: изменения не ждут друг друга, но снимок не попадает между журналом и памятью.
+func (metricsMemoryRepo MetricsMemoryRepo) apply(records []walRecord, source updateSource) error {
+	changes := make([]memoryChange, 0, len(records))
+	shards := make([]*memoryShard, 0, len(records))
+	for _, record := range records {
+		change, err := metricsMemoryRepo.prepareChange(record)
+		if err != nil {
+			return err
+		}
+
+		changes = append(changes, change)
+		shards = append(shards, change.repo.shard(record.Key))
+	}
+
+	metricsMemoryRepo.uploadMutex.RLock()
+	defer metricsMemoryRepo.uploadMutex.RUnlock()
+	unlock := lockShards(shards)
+	defer unlock()
+
+	// Новые значения вычисляются до записи, чтобы при ошибке ничего не изменить.
+	// Повторы ключа в пачке применяются к уже вычисленному значению, nil - значение удалено.
+	type stagedKey struct {
+		repo *MemoryRepo
+		key  string
+	}
+	staged := make(map[stagedKey]*MetricValue, len(changes))
+	values := make([]*MetricValue, len(changes))
+	previous := make([]*MetricValue, len(changes))
+	for i, change := range changes {
+		key := stagedKey{repo: change.repo, key: change.record.Key}
+		current, ok := staged[key]
+		if !ok {
+			if value, found := change.repo.shard(key.key).get(key.key); found {
+				current = &value
+			}
+		}
+
+		// Время записи берётся из журнала, при загрузке снимка сохраняется время из снимка
+		timestamp := change.record.Timestamp
+		switch change.record.Op {
+		case walOpUpdate:
+			merged, err := MergeMetricValue(current, change.record.Value)
+			if err != nil {
+				return err
+			}
+			if source != updateFromSnapshot || merged.UpdatedAt == nil {
+				merged.UpdatedAt = &timestamp
+			}
+			values[i] = &merged
+		case walOpDelete:
+			if current == nil {
+				return ErrMetricNotFound
+			}
+		case walOpExpire:
+			// Серия, в которую успели записать после выбора устаревших, не удаляется
+			if current == nil || current.UpdatedAt == nil || !current.UpdatedAt.Before(timestamp) {
+				return ErrMetricNotFound
+			}
+		case walOpReset:
+			if current == nil {
+				return ErrMetricNotFound
+			}
+			var zero int64
+			values[i] = &MetricValue{MType: MeticTypeCounter, Delta: &zero, UpdatedAt: &timestamp}
+		case walOpSet:
+			value := *change.record.Value.Delta
+			values[i] = &MetricValue{MType: MeticTypeCounter, Delta: &value, UpdatedAt: &timestamp}
+		}
+		previous[i] = current
+		staged[key] = values[i]
+	}
 
+	if source == updateFromClient && metricsMemoryRepo.wal != nil {
+		record := changes[0].record
+		if len(changes) > 1 {
+			record = walRecord{
+				Op:        walOpBatch,
+				Records:   make([]walRecord, 0, len(changes)),
+				Timestamp: changes[0].record.Timestamp,
+			}
+			for _, change := range changes {
+				record.Records = append(record.Records, change.record)
+			}
+		}
+
+		err := metricsMemoryRepo.wal.Append(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, change := range changes {
+		key := change.record.Key
+		shard := change.repo.shard(key)
+
+		if values[i] == nil {
+			shard.remove(key)
+			if change.history != nil {
+				change.history.Delete(key)
+				change.rollups.Delete(key)
+			}
+			continue
+		}
+
+		shard.set(key, *values[i])
+		if change.history == nil || source == updateFromSnapshot {
+			continue
+		}
+
+		// История пишется под блокировкой сегмента, чтобы накопленные значения counter шли в ней по порядку
+		sample := MetricSample{
+			Timestamp:   change.record.Timestamp,
+			MetricValue: *values[i],
+		}
+		// Время записи в истории хранит Timestamp
+		sample.UpdatedAt = nil
+		if change.record.Value.Delta != nil || change.record.Op == walOpReset {
+			var increment int64
+			switch {
+			case change.record.Op == walOpSet:
+				// Приращение установленного значения - разница с предыдущим, после сброса счётчика - само значение
+				increment = *values[i].Delta
+				if previous[i] != nil && previous[i].Delta != nil && *previous[i].Delta <= increment {
+					increment -= *previous[i].Delta
+				}
+			case change.record.Value.Delta != nil:
+				increment = *change.record.Value.Delta
+			}
+			sample.Increment = &increment
+		}
+
+		err := change.history.Append(key, sample)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compactIfNeeded - в синхронном режиме снимок делается, когда журнал вырос до walCompactThreshold записей.
+func (metricsMemoryRepo MetricsMemoryRepo) compactIfNeeded() error {
+	if metricsMemoryRepo.wal == nil || metricsMemoryRepo.config.Interval != SyncUploadSymbol {
+		return nil
+	}
+
+	if metricsMemoryRepo.wal.Len() < walCompactThreshold {
+		return nil
+	}
+
+	return metricsMemoryRepo.UploadToFile()
+}
+
+func (metricsMemoryRepo MetricsMemoryRepo) Read(ctx context.Context, key string, metricType string) (MetricValue, error) {
+	if err := ctx.Err(); err != nil {
+		return MetricValue{}, err
+	}
+
+	repo, err := metricsMemoryRepo.storageByType(metricType)
+	if err != nil {
+		return MetricValue{}, err
+	}
+
+	return repo.Read(key)
+}
+
+// ReadSeries - все серии метрики id без чтения остальных метрик.
+func (metricsMemoryRepo MetricsMemoryRepo) ReadSeries(ctx context.Context, id string, metricType string) (MetricMap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo, err := metricsMemoryRepo.storageByType(metricType)
 	if err != nil {
+		return nil, err
+	}
+
+	return repo.Series(id), nil
+}
+
+func (metricsMemoryRepo MetricsMemoryRepo) storageByType(metricType string) (*MemoryRepo, error) {
+	switch metricType {
+	case MeticTypeGauge:
+		return metricsMemoryRepo.gaugeStorage, nil
+	case MeticTypeCounter:
+		return metricsMemoryRepo.counterStorage, nil
+	case MeticTypeHistogram:
+		return metricsMemoryRepo.histogramStorage, nil
+	case MeticTypeSummary:
+		return metricsMemoryRepo.summaryStorage, nil
+	default:
+		return nil, ErrUnknownMetricType
+	}
+}
+
+// Delete - удаление значения вместе с историей.
+func (metricsMemoryRepo MetricsMemoryRepo) Delete(ctx context.Context, key string, metricType string) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
-	if metricsMemoryRepo.config.Interval == SyncUploadSymbol {
-		return metricsMemoryRepo.UploadToFile()
+	err := metricsMemoryRepo.delete(key, metricType, time.Now(), updateFromClient)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return metricsMemoryRepo.compactIfNeeded()
+}
+
+func (metricsMemoryRepo MetricsMemoryRepo) delete(key string, metricType string, timestamp time.Time, source updateSource) error {
+	return metricsMemoryRepo.apply([]walRecord{{
+		Op:        walOpDelete,
+		Key:       key,
+		Value:     MetricValue{MType: metricType},
+		Timestamp: timestamp,
+	}}, source)
+}
+
+// DeleteMatching - удаление всех серий метрик, имя которых соответствует шаблону path.Match.
+// Пустой metricType - удаление среди всех типов.
+func (metricsMemoryRepo MetricsMemoryRepo) DeleteMatching(ctx context.Context, metricType string, pattern string) (int, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, err
+	}
+
+	metricTypes := []string{metricType}
+	if metricType == "" {
+		metricTypes = []string{MeticTypeGauge, MeticTypeCounter, MeticTypeHistogram, MeticTypeSummary}
+	}
+
+	var deleted int
+	for _, metricType := range metricTypes {
+		repo, err := metricsMemoryRepo.storageByType(metricType)
+		if err != nil {
+			return deleted, err
+		}
+
+		for _, key := range repo.Keys() {
+			if !matchSeriesName(pattern, key) {
+				continue
+			}
+			if err = ctx.Err(); err != nil {
+				return deleted, err
+			}
+
+			err = metricsMemoryRepo.delete(key, metricType, time.Now(), updateFromClient)
+			if errors.Is(err, ErrMetricNotFound) {
+				continue
+			}
+			if err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+
+	return deleted, metricsMemoryRepo.compactIfNeeded()
 }
 
-func (metricsMemoryRepo MetricsMemoryRepo) updateCounterValue(key string, newMetricValue MetricValue) error {
-	//Чтение старого значения
-	oldMetricValue, err := metricsMemoryRepo.Read(key, MeticTypeCounter)
+// Expire - удаление серий всех типов, в которые не было записи с момента before, вместе с историей.
+func (metricsMemoryRepo MetricsMemoryRepo) Expire(ctx context.Context, before time.Time) (int, error) {
+	var expired int
+	for _, metricType := range []string{MeticTypeGauge, MeticTypeCounter, MeticTypeHistogram, MeticTypeSummary} {
+		repo, err := metricsMemoryRepo.storageByType(metricType)
+		if err != nil {
+			return expired, err
+		}
+
+		for key, value := range repo.GetSchemaDump() {
+			if value.UpdatedAt == nil || !value.UpdatedAt.Before(before) {
+				continue
+			}
+			if err = ctx.Err(); err != nil {
+				return expired, err
+			}
+
+			err = metricsMemoryRepo.expire(key, metricType, before, updateFromClient)
+			if errors.Is(err, ErrMetricNotFound) {
+				continue
+			}
+			if err != nil {
+				return expired, err
+			}
+			expired++
+		}
+	}
+
+	return expired, metricsMemoryRepo.compactIfNeeded()
+}
+
+// expire - удаление серии, если в неё не было записи с момента before.
+// В журнал пишется граница, а не факт удаления, поэтому воспроизведение журнала не удалит серию, обновлённую после неё.
+func (metricsMemoryRepo MetricsMemoryRepo) expire(key string, metricType string, before time.Time, source updateSource) error {
+	return metricsMemoryRepo.apply([]walRecord{{
+		Op:        walOpExpire,
+		Key:       key,
+		Value:     MetricValue{MType: metricType},
+		Timestamp: before,
+	}}, source)
+}
+
+// ResetCounter - сброс counter в 0, сброс попадает в историю.
+func (metricsMemoryRepo MetricsMemoryRepo) ResetCounter(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := metricsMemoryRepo.resetCounter(key, time.Now(), updateFromClient)
 	if err != nil {
-		var delta int64 = 0
-		oldMetricValue = MetricValue{
-			Delta: &delta,
+		return err
+	}
+
+	return metricsMemoryRepo.compactIfNeeded()
+}
+
+func (metricsMemoryRepo MetricsMemoryRepo) resetCounter(key string, timestamp time.Time, source updateSource) error {
+	return metricsMemoryRepo.apply([]walRecord{{
+		Op:        walOpReset,
+		Key:       key,
+		Timestamp: timestamp,
+	}}, source)
+}
+
+// SetValues - установка значений gauge и накопленных значений counter, например метрик Prometheus.
+// Значения устанавливаются одной пачкой целиком или никак, в историю counter пишется разница с предыдущим значением.
+func (metricsMemoryRepo MetricsMemoryRepo) SetValues(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(gauges)+len(counters) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	records := make([]walRecord, 0, len(gauges)+len(counters))
+	for key, value := range gauges {
+		if err := ValidateSeriesKey(key); err != nil {
+			return err
+		}
+
+		value := value
+		records = append(records, walRecord{
+			Op:        walOpUpdate,
+			Key:       key,
+			Value:     MetricValue{MType: MeticTypeGauge, Value: &value},
+			Timestamp: now,
+		})
+	}
+	for key, value := range counters {
+		if err := ValidateSeriesKey(key); err != nil {
+			return err
 		}
+
+		value := value
+		records = append(records, walRecord{
+			Op:        walOpSet,
+			Key:       key,
+			Value:     MetricValue{MType: MeticTypeCounter, Delta: &value},
+			Timestamp: now,
+		})
 	}
 
-	newValue := *oldMetricValue.Delta + *newMetricValue.Delta
-	newMetricValue.Delta = &newValue
+	err := metricsMemoryRepo.apply(records, updateFromClient)
+	if err != nil {
+		return err
+	}
 
-	metricsMemoryRepo.uploadMutex.Lock()
-	metricsMemoryRepo.counterStorage.Write(key, newMetricValue)
-	metricsMemoryRepo.uploadMutex.Unlock()
+	return metricsMemoryRepo.compactIfNeeded()
+}
 
-	if metricsMemoryRepo.config.Interval == SyncUploadSymbol {
-		return metricsMemoryRepo.UploadToFile()
+// ReadHistory - история за интервал [from, to].
+// Если исходные значения за from уже удалены по правилам хранения, используются агрегаты прореживания.
+func (metricsMemoryRepo MetricsMemoryRepo) ReadHistory(ctx context.Context, key string, metricType string, from, to time.Time, step time.Duration) ([]MetricSample, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	return nil
+	history, rollups, err := metricsMemoryRepo.historyByType(metricType)
+	if err != nil {
+		return nil, err
+	}
+
+	tier := historyTier(metricsMemoryRepo.config.Retention, key, from, time.Now())
+	if tier == 0 {
+		return DownsampleHistory(history.Range(key, from, to), from, step), nil
+	}
+
+	samples := rollups.Level(tier).Range(key, from, to)
+	if step <= tier {
+		return samples, nil
+	}
+
+	return DownsampleHistory(samples, from, step), nil
 }
 
-func (metricsMemoryRepo MetricsMemoryRepo) Read(key string, metricType string) (MetricValue, error) {
+func (metricsMemoryRepo MetricsMemoryRepo) historyByType(metricType string) (*HistoryRepo, *RollupRepo, error) {
 	switch metricType {
 	case MeticTypeGauge:
-		return metricsMemoryRepo.gaugeStorage.Read(key)
+		return metricsMemoryRepo.gaugeHistory, metricsMemoryRepo.gaugeRollups, nil
 	case MeticTypeCounter:
-		return metricsMemoryRepo.counterStorage.Read(key)
+		return metricsMemoryRepo.counterHistory, metricsMemoryRepo.counterRollups, nil
 	default:
-		return MetricValue{}, errors.New("metricType not found")
+		return nil, nil, ErrUnknownMetricType
+	}
+}
+
+// Compact - прореживание истории и удаление устаревших значений по правилам хранения.
+func (metricsMemoryRepo MetricsMemoryRepo) Compact(ctx context.Context, now time.Time) error {
+	for _, metricType := range []string{MeticTypeGauge, MeticTypeCounter} {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		history, rollups, err := metricsMemoryRepo.historyByType(metricType)
+		if err != nil {
+			return err
+		}
+
+		err = compactHistory(metricsMemoryRepo.config.Retention, history, rollups, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// snapshot - содержимое файла снимка.
+// WAL - поколение журнала, изменения которого снимок уже содержит: журнал воспроизводится, только если
+// его поколение совпадает с поколением снимка, поэтому падение между записью снимка и очисткой журнала
+// не применяет изменения журнала повторно.
+// History - история и агрегаты прореживания по типам метрик, чтобы после перезапуска не терялись данные за срок хранения.
+type snapshot struct {
+	WAL     string                     `json:"wal"`
+	Metrics map[string]MetricMap       `json:"metrics"`
+	History map[string]snapshotHistory `json:"history,omitempty"`
+}
+
+// snapshotHistory - история значений и агрегаты одного типа метрик.
+type snapshotHistory struct {
+	Samples map[string][]MetricSample `json:"samples"`
+	Rollups []snapshotRollup          `json:"rollups,omitempty"`
+}
+
+// snapshotRollup - агрегаты с шагом Step.
+type snapshotRollup struct {
+	Step    time.Duration             `json:"step"`
+	Samples map[string][]MetricSample `json:"samples"`
+}
+
+// readHistory - история и агрегаты для снимка. История копируется раньше агрегатов: прореживание
+// сначала добавляет агрегаты и только потом удаляет исходные значения, поэтому значения,
+// удалённые из скопированной истории, уже есть в агрегатах.
+func (metricsMemoryRepo MetricsMemoryRepo) readHistory() map[string]snapshotHistory {
+	result := make(map[string]snapshotHistory)
+	for _, metricType := range []string{MeticTypeGauge, MeticTypeCounter} {
+		history, rollups, _ := metricsMemoryRepo.historyByType(metricType)
+
+		typeHistory := snapshotHistory{Samples: history.dump()}
+		for _, step := range rollups.Steps() {
+			typeHistory.Rollups = append(typeHistory.Rollups, snapshotRollup{Step: step, Samples: rollups.Level(step).dump()})
+		}
+		result[metricType] = typeHistory
+	}
+
+	return result
+}
+
+// loadHistory - восстановление истории и агрегатов из снимка.
+func (metricsMemoryRepo MetricsMemoryRepo) loadHistory(fileHistory map[string]snapshotHistory) {
+	for metricType, typeHistory := range fileHistory {
+		history, rollups, err := metricsMemoryRepo.historyByType(metricType)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		history.load(typeHistory.Samples)
+		for _, rollup := range typeHistory.Rollups {
+			if rollup.Step > 0 {
+				rollups.Level(rollup.Step).load(rollup.Samples)
+			}
+		}
+	}
+}
+
+// readSnapshot - разбор файла снимка. Пустой файл - пустой снимок,
+// файл прежнего формата (только значения по типам) - снимок без поколения журнала.
+func readSnapshot(data []byte) (snapshot, error) {
+	var fileSnapshot snapshot
+	if len(bytes.TrimSpace(data)) == 0 {
+		return fileSnapshot, nil
 	}
+
+	err := json.Unmarshal(data, &fileSnapshot)
+	if err != nil || fileSnapshot.Metrics != nil {
+		return fileSnapshot, err
+	}
+
+	err = json.Unmarshal(data, &fileSnapshot.Metrics)
+	return fileSnapshot, err
 }
 
+// UploadToFile - запись снимка всех значений и очистка журнала (компактификация).
+// Журнал получает новое поколение, записанное в снимке.
 func (metricsMemoryRepo MetricsMemoryRepo) UploadToFile() error {
 	metricsMemoryRepo.uploadMutex.Lock()
 	defer metricsMemoryRepo.uploadMutex.Unlock()
@@ -167,18 +795,31 @@ func (metricsMemoryRepo MetricsMemoryRepo) UploadToFile() error {
 		return nil
 	}
 
-	file, err := os.OpenFile(metricsMemoryRepo.config.File, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	generation, err := newWALGeneration()
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	allStates := metricsMemoryRepo.ReadAll()
-	json.NewEncoder(file).Encode(allStates)
 
-	return nil
+	fileSnapshot := snapshot{
+		WAL:     generation,
+		Metrics: metricsMemoryRepo.readAll(),
+		History: metricsMemoryRepo.readHistory(),
+	}
+	err = writeFileAtomic(metricsMemoryRepo.config.File, func(file *os.File) error {
+		return json.NewEncoder(file).Encode(fileSnapshot)
+	})
+	if err != nil {
+		return err
+	}
+
+	if metricsMemoryRepo.wal == nil {
+		return nil
+	}
+
+	return metricsMemoryRepo.wal.Reset(generation)
 }
 
-func (metricsMemoryRepo MetricsMemoryRepo) Save() error {
+func (metricsMemoryRepo MetricsMemoryRepo) Save(_ context.Context) error {
 	return metricsMemoryRepo.UploadToFile()
 }
 
@@ -200,55 +841,134 @@ func (metricsMemoryRepo MetricsMemoryRepo) IterativeUploadToFile() {
 	}()
 }
 
-func (metricsMemoryRepo MetricsMemoryRepo) InitFromFile() {
+// InitFromFile - восстановление значений из снимка и журнала.
+// Повреждённый снимок не перезаписывается: запуск прерывается, чтобы значения не были потеряны.
+func (metricsMemoryRepo MetricsMemoryRepo) InitFromFile(_ context.Context) {
 	file, err := os.OpenFile(metricsMemoryRepo.config.File, os.O_RDONLY|os.O_CREATE, 0777)
 	if err != nil {
 		panic(err.Error())
 	}
-	defer file.Close()
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		panic(err.Error())
+	}
 
-	var metricsDump map[string]MetricMap
-	err = json.NewDecoder(file).Decode(&metricsDump)
+	fileSnapshot, err := readSnapshot(data)
 	if err != nil {
-		log.Println(err)
+		panic(fmt.Sprintf("snapshot %s is corrupted: %v", metricsMemoryRepo.config.File, err))
+	}
+
+	now := time.Now()
+	for _, metricList := range fileSnapshot.Metrics {
+		for metricKey, metricValue := range metricList {
+			err = metricsMemoryRepo.update(metricKey, metricValue, now, updateFromSnapshot)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+	metricsMemoryRepo.loadHistory(fileSnapshot.History)
+
+	if metricsMemoryRepo.wal == nil {
+		return
 	}
 
-	for _, metricList := range metricsDump {
-		err = metricsMemoryRepo.UpdateMany(metricList)
+	// Изменения после последнего снимка воспроизводятся из журнала
+	err = metricsMemoryRepo.wal.Replay(fileSnapshot.WAL, func(record walRecord) error {
+		switch record.Op {
+		case walOpUpdate:
+			return metricsMemoryRepo.update(record.Key, record.Value, record.Timestamp, updateFromWAL)
+		case walOpDelete:
+			return metricsMemoryRepo.delete(record.Key, record.Value.MType, record.Timestamp, updateFromWAL)
+		case walOpReset:
+			return metricsMemoryRepo.resetCounter(record.Key, record.Timestamp, updateFromWAL)
+		case walOpSet:
+			return metricsMemoryRepo.apply([]walRecord{record}, updateFromWAL)
+		case walOpExpire:
+			return metricsMemoryRepo.expire(record.Key, record.Value.MType, record.Timestamp, updateFromWAL)
+		case walOpBatch:
+			return metricsMemoryRepo.apply(record.Records, updateFromWAL)
+		default:
+			return fmt.Errorf("unknown WAL operation %q", record.Op)
+		}
+	})
+	if err != nil {
+		log.Println(err)
 	}
+
+	err = metricsMemoryRepo.UploadToFile()
 	if err != nil {
 		log.Println(err)
 	}
 }
 
-func (metricsMemoryRepo MetricsMemoryRepo) UpdateManySliceMetric(MetricBatch []Metric) error {
+// UpdateManySliceMetric - обновление пачки метрик, при ошибке не применяется ни одно значение.
+func (metricsMemoryRepo MetricsMemoryRepo) UpdateManySliceMetric(ctx context.Context, MetricBatch []Metric) error {
+	now := time.Now()
+	records := make([]walRecord, 0, len(MetricBatch))
 	for _, metricValue := range MetricBatch {
-		err := metricsMemoryRepo.Update(metricValue.ID, metricValue.MetricValue)
-
-		if err != nil {
-			return err
-		}
+		records = append(records, walRecord{
+			Op:        walOpUpdate,
+			Key:       metricValue.SeriesKey(),
+			Value:     metricValue.MetricValue,
+			Timestamp: now,
+		})
 	}
 
-	return nil
+	return metricsMemoryRepo.updateBatch(ctx, records)
 }
 
-func (metricsMemoryRepo MetricsMemoryRepo) UpdateMany(DBSchema map[string]MetricValue) error {
+func (metricsMemoryRepo MetricsMemoryRepo) UpdateMany(ctx context.Context, DBSchema map[string]MetricValue) error {
+	now := time.Now()
+	records := make([]walRecord, 0, len(DBSchema))
 	for metricKey, metricValue := range DBSchema {
-		err := metricsMemoryRepo.Update(metricKey, metricValue)
+		records = append(records, walRecord{
+			Op:        walOpUpdate,
+			Key:       metricKey,
+			Value:     metricValue,
+			Timestamp: now,
+		})
+	}
 
-		if err != nil {
+	return metricsMemoryRepo.updateBatch(ctx, records)
+}
+
+func (metricsMemoryRepo MetricsMemoryRepo) updateBatch(ctx context.Context, records []walRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := ValidateSeriesKey(record.Key); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	err := metricsMemoryRepo.apply(records, updateFromClient)
+	if err != nil {
+		return err
+	}
+
+	return metricsMemoryRepo.compactIfNeeded()
+}
+
+func (metricsMemoryRepo MetricsMemoryRepo) ReadAll(ctx context.Context) (map[string]MetricMap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return metricsMemoryRepo.readAll(), nil
 }
 
-func (metricsMemoryRepo MetricsMemoryRepo) ReadAll() map[string]MetricMap {
+func (metricsMemoryRepo MetricsMemoryRepo) readAll() map[string]MetricMap {
 	return map[string]MetricMap{
-		MeticTypeGauge:   metricsMemoryRepo.gaugeStorage.GetSchemaDump(),
-		MeticTypeCounter: metricsMemoryRepo.counterStorage.GetSchemaDump(),
+		MeticTypeGauge:     metricsMemoryRepo.gaugeStorage.GetSchemaDump(),
+		MeticTypeCounter:   metricsMemoryRepo.counterStorage.GetSchemaDump(),
+		MeticTypeHistogram: metricsMemoryRepo.histogramStorage.GetSchemaDump(),
+		MeticTypeSummary:   metricsMemoryRepo.summaryStorage.GetSchemaDump(),
 	}
 }
 
@@ -258,11 +978,42 @@ func (metricsMemoryRepo MetricsMemoryRepo) Close() error {
 		return err
 	}
 	err = metricsMemoryRepo.counterStorage.Close()
+	if err != nil {
+		return err
+	}
+	err = metricsMemoryRepo.histogramStorage.Close()
+	if err != nil {
+		return err
+	}
+	err = metricsMemoryRepo.summaryStorage.Close()
+	if err != nil {
+		return err
+	}
+	err = metricsMemoryRepo.gaugeHistory.Close()
+	if err != nil {
+		return err
+	}
+	err = metricsMemoryRepo.counterHistory.Close()
+	if err != nil {
+		return err
+	}
+	err = metricsMemoryRepo.gaugeRollups.Close()
+	if err != nil {
+		return err
+	}
+	err = metricsMemoryRepo.counterRollups.Close()
+	if err != nil {
+		return err
+	}
+
+	if metricsMemoryRepo.wal == nil {
+		return nil
+	}
 
-	return err
+	return metricsMemoryRepo.wal.Close()
 }
 
-func (metricsMemoryRepo MetricsMemoryRepo) Ping() error {
+func (metricsMemoryRepo MetricsMemoryRepo) Ping(_ context.Context) error {
 	if metricsMemoryRepo.gaugeStorage.Ping() != nil {
 		return metricsMemoryRepo.gaugeStorage.Ping()
 	}
@@ -1,11 +1,13 @@
 package storage
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"metrics/internal/server/config"
@@ -87,39 +89,69 @@ func TestMemoryRepoReadEmpty(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestMemoryRepoErrors(t *testing.T) {
+	metricsMemoryRepo := NewMetricsMemoryRepo(config.StoreConfig{})
+
+	_, err := metricsMemoryRepo.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.ErrorIs(t, err, ErrMetricNotFound)
+
+	_, err = metricsMemoryRepo.Read(context.Background(), "Alloc", "unknown")
+	require.ErrorIs(t, err, ErrUnknownMetricType)
+
+	err = metricsMemoryRepo.Update(context.Background(), "Alloc", MetricValue{MType: MeticTypeGauge})
+	require.ErrorIs(t, err, ErrEmptyMetricValue)
+
+	value := 1.5
+	err = metricsMemoryRepo.Update(context.Background(), "Alloc}", MetricValue{MType: MeticTypeGauge, Value: &value})
+	require.ErrorIs(t, err, ErrInvalidMetricID)
+
+	// Отменённый запрос не меняет хранилище
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = metricsMemoryRepo.Update(ctx, "Alloc", MetricValue{MType: MeticTypeGauge, Value: &value})
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = metricsMemoryRepo.ReadAll(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = metricsMemoryRepo.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.ErrorIs(t, err, ErrMetricNotFound)
+}
+
 func TestMemoryRepoUpdateValues(t *testing.T) {
 	metricsMemoryRepo := NewMetricsMemoryRepo(config.StoreConfig{})
 
-	err := metricsMemoryRepo.Ping()
+	err := metricsMemoryRepo.Ping(context.Background())
 	require.NoError(t, err)
 
 	var metricValue1 int64 = 7
 	var metricValue2 int64 = 22
 	var metricValue3 = 27.5
 
-	err = metricsMemoryRepo.Update("PollCount", MetricValue{
+	err = metricsMemoryRepo.Update(context.Background(), "PollCount", MetricValue{
 		MType: MeticTypeCounter,
 		Delta: &metricValue1,
 	})
 	require.NoError(t, err)
 
-	err = metricsMemoryRepo.Update("PollCount", MetricValue{
+	err = metricsMemoryRepo.Update(context.Background(), "PollCount", MetricValue{
 		MType: MeticTypeCounter,
 		Delta: &metricValue2,
 	})
 	require.NoError(t, err)
 
-	err = metricsMemoryRepo.Update("Gauge1", MetricValue{
+	err = metricsMemoryRepo.Update(context.Background(), "Gauge1", MetricValue{
 		MType: MeticTypeGauge,
 		Value: &metricValue3,
 	})
 	require.NoError(t, err)
 
-	PollCount, err := metricsMemoryRepo.Read("PollCount", MeticTypeCounter)
+	PollCount, err := metricsMemoryRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
 	require.NoError(t, err)
 	require.EqualValues(t, 29, *PollCount.Delta)
 
-	Gauge1, err := metricsMemoryRepo.Read("Gauge1", MeticTypeGauge)
+	Gauge1, err := metricsMemoryRepo.Read(context.Background(), "Gauge1", MeticTypeGauge)
 	require.NoError(t, err)
 	require.EqualValues(t, 27.5, *Gauge1.Value)
 
@@ -130,7 +162,7 @@ func TestMemoryRepoUpdateValues(t *testing.T) {
 func TestMemoryRepoReadAll(t *testing.T) {
 	metricsMemoryRepo := NewMetricsMemoryRepo(config.StoreConfig{})
 
-	err := metricsMemoryRepo.Ping()
+	err := metricsMemoryRepo.Ping(context.Background())
 	require.NoError(t, err)
 
 	var metricValueDelta1 int64 = 11
@@ -138,7 +170,7 @@ func TestMemoryRepoReadAll(t *testing.T) {
 		MType: MeticTypeCounter,
 		Delta: &metricValueDelta1,
 	}
-	err = metricsMemoryRepo.Update("PollCount1", metricValue1)
+	err = metricsMemoryRepo.Update(context.Background(), "PollCount1", metricValue1)
 	require.NoError(t, err)
 
 	var metricValueDelta2 int64 = 22
@@ -146,22 +178,32 @@ func TestMemoryRepoReadAll(t *testing.T) {
 		MType: MeticTypeCounter,
 		Delta: &metricValueDelta2,
 	}
-	err = metricsMemoryRepo.Update("PollCount2", metricValue2)
+	err = metricsMemoryRepo.Update(context.Background(), "PollCount2", metricValue2)
+	require.NoError(t, err)
+
+	repoValues, err := metricsMemoryRepo.ReadAll(context.Background())
 	require.NoError(t, err)
 
-	repoValues := metricsMemoryRepo.ReadAll()
+	// Время записи проставляет хранилище
+	for key, value := range repoValues[MeticTypeCounter] {
+		require.WithinDuration(t, time.Now(), *value.UpdatedAt, time.Minute)
+		value.UpdatedAt = nil
+		repoValues[MeticTypeCounter][key] = value
+	}
 
 	repoMetricMap := MetricMap{"PollCount1": metricValue1, "PollCount2": metricValue2}
 	repoValuesExpected := map[string]MetricMap{
-		MeticTypeGauge:   {},
-		MeticTypeCounter: repoMetricMap,
+		MeticTypeGauge:     {},
+		MeticTypeCounter:   repoMetricMap,
+		MeticTypeHistogram: {},
+		MeticTypeSummary:   {},
 	}
 	require.EqualValues(t, repoValues, repoValuesExpected)
 
-	actualMetricValue1, err := metricsMemoryRepo.Read("PollCount1", MeticTypeCounter)
+	actualMetricValue1, err := metricsMemoryRepo.Read(context.Background(), "PollCount1", MeticTypeCounter)
 	require.NoError(t, err)
 
-	actualMetricValue2, err := metricsMemoryRepo.Read("PollCount2", MeticTypeCounter)
+	actualMetricValue2, err := metricsMemoryRepo.Read(context.Background(), "PollCount2", MeticTypeCounter)
 	require.NoError(t, err)
 
 	require.Equal(t, "11", actualMetricValue1.GetStringValue())
@@ -183,13 +225,13 @@ func TestMemoryRepoFileIterativeWrite(t *testing.T) {
 
 	repoFile, err := os.OpenFile(TempMemoryRepoFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	require.NoError(t, err)
-	metricsMemoryRepo.InitFromFile()
+	metricsMemoryRepo.InitFromFile(context.Background())
 
-	err = metricsMemoryRepo.Ping()
+	err = metricsMemoryRepo.Ping(context.Background())
 	require.NoError(t, err)
 
 	metricsMemoryRepo.IterativeUploadToFile()
-	err = metricsMemoryRepo.Save()
+	err = metricsMemoryRepo.Save(context.Background())
 	require.NoError(t, err)
 
 	err = metricsMemoryRepo.Close()
@@ -199,12 +241,14 @@ func TestMemoryRepoFileIterativeWrite(t *testing.T) {
 	require.NoError(t, err)
 	err = os.Remove(TempMemoryRepoFilePath)
 	require.NoError(t, err)
+	err = os.Remove(TempMemoryRepoFilePath + WALSuffix)
+	require.NoError(t, err)
 }
 
 func TestMemoryRepoUpdateMany(t *testing.T) {
 	metricsMemoryRepo := NewMetricsMemoryRepo(config.StoreConfig{})
 
-	err := metricsMemoryRepo.Ping()
+	err := metricsMemoryRepo.Ping(context.Background())
 	require.NoError(t, err)
 
 	var metricValueDelta1 int64 = 11
@@ -226,16 +270,16 @@ func TestMemoryRepoUpdateMany(t *testing.T) {
 		},
 	}
 
-	err = metricsMemoryRepo.UpdateMany(metricValueList)
+	err = metricsMemoryRepo.UpdateMany(context.Background(), metricValueList)
 	require.NoError(t, err)
 
-	_, err = metricsMemoryRepo.Read("PollCount1", MeticTypeCounter)
+	_, err = metricsMemoryRepo.Read(context.Background(), "PollCount1", MeticTypeCounter)
 	require.NoError(t, err)
 
-	_, err = metricsMemoryRepo.Read("PollCount2", MeticTypeCounter)
+	_, err = metricsMemoryRepo.Read(context.Background(), "PollCount2", MeticTypeCounter)
 	require.NoError(t, err)
 
-	_, err = metricsMemoryRepo.Read("Gauge1", MeticTypeGauge)
+	_, err = metricsMemoryRepo.Read(context.Background(), "Gauge1", MeticTypeGauge)
 	require.NoError(t, err)
 
 	err = metricsMemoryRepo.Close()
@@ -245,7 +289,7 @@ func TestMemoryRepoUpdateMany(t *testing.T) {
 func TestMemoryRepoUpdateManySlice(t *testing.T) {
 	metricsMemoryRepo := NewMetricsMemoryRepo(config.StoreConfig{})
 
-	err := metricsMemoryRepo.Ping()
+	err := metricsMemoryRepo.Ping(context.Background())
 	require.NoError(t, err)
 
 	var metricValueDelta1 int64 = 11
@@ -276,18 +320,294 @@ func TestMemoryRepoUpdateManySlice(t *testing.T) {
 		},
 	}
 
-	err = metricsMemoryRepo.UpdateManySliceMetric(metricValueList)
+	err = metricsMemoryRepo.UpdateManySliceMetric(context.Background(), metricValueList)
+	require.NoError(t, err)
+
+	_, err = metricsMemoryRepo.Read(context.Background(), "PollCount1", MeticTypeCounter)
+	require.NoError(t, err)
+
+	_, err = metricsMemoryRepo.Read(context.Background(), "PollCount2", MeticTypeCounter)
+	require.NoError(t, err)
+
+	_, err = metricsMemoryRepo.Read(context.Background(), "Gauge1", MeticTypeGauge)
+	require.NoError(t, err)
+
+	err = metricsMemoryRepo.Close()
+	require.NoError(t, err)
+}
+
+func TestMemoryRepoReadHistory(t *testing.T) {
+	metricsMemoryRepo := NewMetricsMemoryRepo(config.StoreConfig{})
+
+	var metricValueDelta1 int64 = 5
+	var metricValueDelta2 int64 = 7
+	var metricValueGauge1 = 1.5
+	var metricValueGauge2 = 2.5
+
+	from := time.Now().Add(-time.Minute)
+
+	err := metricsMemoryRepo.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &metricValueDelta1})
+	require.NoError(t, err)
+	err = metricsMemoryRepo.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &metricValueDelta2})
+	require.NoError(t, err)
+	err = metricsMemoryRepo.Update(context.Background(), "Gauge1", MetricValue{MType: MeticTypeGauge, Value: &metricValueGauge1})
+	require.NoError(t, err)
+	err = metricsMemoryRepo.Update(context.Background(), "Gauge1", MetricValue{MType: MeticTypeGauge, Value: &metricValueGauge2})
+	require.NoError(t, err)
+
+	to := time.Now().Add(time.Minute)
+
+	counterHistory, err := metricsMemoryRepo.ReadHistory(context.Background(), "PollCount", MeticTypeCounter, from, to, 0)
+	require.NoError(t, err)
+	require.Len(t, counterHistory, 2)
+	require.EqualValues(t, 5, *counterHistory[0].Delta)
+	require.EqualValues(t, 12, *counterHistory[1].Delta)
+
+	gaugeHistory, err := metricsMemoryRepo.ReadHistory(context.Background(), "Gauge1", MeticTypeGauge, from, to, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, gaugeHistory, 1)
+	require.EqualValues(t, 2, *gaugeHistory[0].Value)
+	require.Equal(t, from, gaugeHistory[0].Timestamp)
+
+	emptyHistory, err := metricsMemoryRepo.ReadHistory(context.Background(), "Gauge1", MeticTypeGauge, to, to.Add(time.Minute), 0)
+	require.NoError(t, err)
+	require.Empty(t, emptyHistory)
+
+	_, err = metricsMemoryRepo.ReadHistory(context.Background(), "Gauge1", "unknown", from, to, 0)
+	require.Error(t, err)
+
+	err = metricsMemoryRepo.Close()
+	require.NoError(t, err)
+}
+
+func TestDownsampleHistory(t *testing.T) {
+	from := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	values := []float64{1, 3, 10, 20}
+	offsets := []time.Duration{0, 30 * time.Second, time.Minute, 90 * time.Second}
+
+	samples := make([]MetricSample, len(values))
+	for i := range values {
+		samples[i] = MetricSample{
+			Timestamp:   from.Add(offsets[i]),
+			MetricValue: MetricValue{MType: MeticTypeGauge, Value: &values[i]},
+		}
+	}
+
+	result := DownsampleHistory(samples, from, time.Minute)
+	require.Len(t, result, 2)
+	require.Equal(t, from, result[0].Timestamp)
+	require.EqualValues(t, 2, *result[0].Value)
+	require.Equal(t, from.Add(time.Minute), result[1].Timestamp)
+	require.EqualValues(t, 15, *result[1].Value)
+	require.EqualValues(t, 1, *samples[0].Value)
+}
+
+func TestMemoryRepoUpdateManySliceLabels(t *testing.T) {
+	metricsMemoryRepo := NewMetricsMemoryRepo(config.StoreConfig{})
+
+	var metricValueGauge1 = 1.5
+	var metricValueGauge2 = 2.5
+
+	err := metricsMemoryRepo.UpdateManySliceMetric(context.Background(), []Metric{
+		{
+			ID:          "HeapAlloc",
+			Labels:      Labels{"host": "a"},
+			MetricValue: MetricValue{MType: MeticTypeGauge, Value: &metricValueGauge1},
+		},
+		{
+			ID:          "HeapAlloc",
+			Labels:      Labels{"host": "b"},
+			MetricValue: MetricValue{MType: MeticTypeGauge, Value: &metricValueGauge2},
+		},
+	})
+	require.NoError(t, err)
+
+	gaugeA, err := metricsMemoryRepo.Read(context.Background(), SeriesKey("HeapAlloc", Labels{"host": "a"}), MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, 1.5, *gaugeA.Value)
+
+	gaugeB, err := metricsMemoryRepo.Read(context.Background(), SeriesKey("HeapAlloc", Labels{"host": "b"}), MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, 2.5, *gaugeB.Value)
+
+	_, err = metricsMemoryRepo.Read(context.Background(), "HeapAlloc", MeticTypeGauge)
+	require.Error(t, err)
+
+	err = metricsMemoryRepo.Close()
+	require.NoError(t, err)
+}
+
+func TestMemoryRepoUpdateAggregate(t *testing.T) {
+	metricsMemoryRepo := NewMetricsMemoryRepo(config.StoreConfig{})
+
+	histogram := NewHistogramValue([]float64{0.5, 0.1, 1})
+	for _, observation := range []float64{0.05, 0.3, 0.7, 5} {
+		histogram.Observe(observation)
+	}
+	require.Equal(t, []float64{0.1, 0.5, 1}, histogram.Buckets)
+	require.Equal(t, []uint64{1, 1, 1, 1}, histogram.Counts)
+
+	for i := 0; i < 2; i++ {
+		err := metricsMemoryRepo.Update(context.Background(), "Latency", MetricValue{MType: MeticTypeHistogram, Histogram: histogram})
+		require.NoError(t, err)
+	}
+
+	latency, err := metricsMemoryRepo.Read(context.Background(), "Latency", MeticTypeHistogram)
 	require.NoError(t, err)
+	require.EqualValues(t, 8, latency.Histogram.Count)
+	require.Equal(t, []uint64{2, 2, 2, 2}, latency.Histogram.Counts)
+	require.InDelta(t, 12.1, latency.Histogram.Sum, 1e-9)
+	require.Equal(t, "count=8 sum=12.1 buckets=[0.1:2 0.5:2 1:2 +Inf:2]", latency.GetStringValue())
+
+	err = metricsMemoryRepo.Update(context.Background(), "Latency", MetricValue{MType: MeticTypeHistogram, Histogram: NewHistogramValue([]float64{1, 2})})
+	require.ErrorIs(t, err, ErrHistogramBucketsMismatch)
+
+	err = metricsMemoryRepo.Update(context.Background(), "Latency", MetricValue{MType: MeticTypeHistogram, Histogram: &HistogramValue{Buckets: []float64{1}, Counts: []uint64{1}}})
+	require.ErrorIs(t, err, ErrInvalidHistogram)
+
+	for _, summary := range []SummaryValue{
+		{Quantiles: []Quantile{{Quantile: 0.99, Value: 10}, {Quantile: 0.5, Value: 2}}, Sum: 20, Count: 5},
+		{Quantiles: []Quantile{{Quantile: 0.5, Value: 3}}, Sum: 10, Count: 2},
+	} {
+		summary := summary
+		err = metricsMemoryRepo.Update(context.Background(), "Duration", MetricValue{MType: MeticTypeSummary, Summary: &summary})
+		require.NoError(t, err)
+	}
 
-	_, err = metricsMemoryRepo.Read("PollCount1", MeticTypeCounter)
+	duration, err := metricsMemoryRepo.Read(context.Background(), "Duration", MeticTypeSummary)
 	require.NoError(t, err)
+	require.EqualValues(t, 7, duration.Summary.Count)
+	require.EqualValues(t, 30, duration.Summary.Sum)
+	require.Equal(t, []Quantile{{Quantile: 0.5, Value: 3}}, duration.Summary.Quantiles)
+
+	err = metricsMemoryRepo.Update(context.Background(), "Duration", MetricValue{MType: MeticTypeSummary, Summary: &SummaryValue{Quantiles: []Quantile{{Quantile: 1.5}}}})
+	require.ErrorIs(t, err, ErrInvalidSummary)
+
+	err = metricsMemoryRepo.Update(context.Background(), "Duration", MetricValue{MType: MeticTypeSummary})
+	require.Error(t, err)
+
+	err = metricsMemoryRepo.Close()
+	require.NoError(t, err)
+}
+
+func TestMemoryRepoDeleteAndReset(t *testing.T) {
+	metricsMemoryRepo := NewMetricsMemoryRepo(config.StoreConfig{})
+
+	var delta int64 = 5
+	value := 1.5
+	for _, key := range []string{"PollCount", `PollCount{host="a"}`, "RandomValue"} {
+		err := metricsMemoryRepo.Update(context.Background(), key, MetricValue{MType: MeticTypeCounter, Delta: &delta})
+		require.NoError(t, err)
+	}
+	for _, key := range []string{"Alloc", "HeapAlloc"} {
+		err := metricsMemoryRepo.Update(context.Background(), key, MetricValue{MType: MeticTypeGauge, Value: &value})
+		require.NoError(t, err)
+	}
+
+	err := metricsMemoryRepo.ResetCounter(context.Background(), "PollCount")
+	require.NoError(t, err)
+	pollCount, err := metricsMemoryRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, *pollCount.Delta)
+
+	err = metricsMemoryRepo.ResetCounter(context.Background(), "Unknown")
+	require.ErrorIs(t, err, ErrMetricNotFound)
 
-	_, err = metricsMemoryRepo.Read("PollCount2", MeticTypeCounter)
+	err = metricsMemoryRepo.Delete(context.Background(), "Alloc", MeticTypeGauge)
 	require.NoError(t, err)
+	_, err = metricsMemoryRepo.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.Error(t, err)
+	require.Equal(t, 0, metricsMemoryRepo.gaugeHistory.Len("Alloc"))
+
+	err = metricsMemoryRepo.Delete(context.Background(), "Alloc", MeticTypeGauge)
+	require.ErrorIs(t, err, ErrMetricNotFound)
 
-	_, err = metricsMemoryRepo.Read("Gauge1", MeticTypeGauge)
+	deleted, err := metricsMemoryRepo.DeleteMatching(context.Background(), "", "Poll*")
+	require.NoError(t, err)
+	require.Equal(t, 2, deleted)
+	allValues, err := metricsMemoryRepo.ReadAll(context.Background())
 	require.NoError(t, err)
+	require.Len(t, allValues[MeticTypeCounter], 1)
+	require.Len(t, allValues[MeticTypeGauge], 1)
+
+	_, err = metricsMemoryRepo.DeleteMatching(context.Background(), MeticTypeGauge, "[")
+	require.Error(t, err)
 
 	err = metricsMemoryRepo.Close()
 	require.NoError(t, err)
 }
+
+func TestMemoryRepoExpire(t *testing.T) {
+	metricsMemoryRepo := NewMetricsMemoryRepo(config.StoreConfig{})
+
+	now := time.Now()
+	old := now.Add(-time.Hour)
+	value := 1.5
+	var delta int64 = 5
+	err := metricsMemoryRepo.update("Alloc", MetricValue{MType: MeticTypeGauge, Value: &value}, old, updateFromClient)
+	require.NoError(t, err)
+	err = metricsMemoryRepo.update("PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta}, old, updateFromClient)
+	require.NoError(t, err)
+	err = metricsMemoryRepo.update("HeapAlloc", MetricValue{MType: MeticTypeGauge, Value: &value}, now, updateFromClient)
+	require.NoError(t, err)
+
+	alloc, err := metricsMemoryRepo.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, old, *alloc.UpdatedAt)
+	require.True(t, alloc.IsStale(now.Add(-time.Minute)))
+
+	// Counter не устаревает, но удаляется по сроку хранения так же, как gauge
+	pollCount, err := metricsMemoryRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.False(t, pollCount.IsStale(now.Add(-time.Minute)))
+
+	expired, err := metricsMemoryRepo.Expire(context.Background(), now.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 2, expired)
+
+	_, err = metricsMemoryRepo.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.ErrorIs(t, err, ErrMetricNotFound)
+	_, err = metricsMemoryRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.ErrorIs(t, err, ErrMetricNotFound)
+	require.Equal(t, 0, metricsMemoryRepo.gaugeHistory.Len("Alloc"))
+
+	heapAlloc, err := metricsMemoryRepo.Read(context.Background(), "HeapAlloc", MeticTypeGauge)
+	require.NoError(t, err)
+	require.False(t, heapAlloc.IsStale(now.Add(-time.Minute)))
+
+	// Серия, обновлённая после выбора устаревших, не удаляется
+	err = metricsMemoryRepo.expire("HeapAlloc", MeticTypeGauge, now.Add(-time.Minute), updateFromClient)
+	require.ErrorIs(t, err, ErrMetricNotFound)
+}
+
+// seedSeries - серии метрики load и метрик с похожими именами.
+func seedSeries(t *testing.T, repository MetricStorager) {
+	value := 1.5
+	for _, key := range []string{`load`, `load{source="a"}`, `load{source="b"}`, `loadavg`, `loadavg{source="a"}`, `lo`} {
+		err := repository.Update(context.Background(), key, MetricValue{MType: MeticTypeGauge, Value: &value})
+		require.NoError(t, err)
+	}
+}
+
+func TestMemoryRepoReadSeries(t *testing.T) {
+	repo := NewMetricsMemoryRepo(config.StoreConfig{})
+	cache, err := NewCachedRepo(NewMetricsMemoryRepo(config.StoreConfig{}), config.CacheConfig{})
+	require.NoError(t, err)
+	defer cache.Close()
+
+	for _, repository := range []MetricStorager{repo, cache} {
+		seedSeries(t, repository)
+
+		series, err := repository.ReadSeries(context.Background(), "load", MeticTypeGauge)
+		require.NoError(t, err)
+		require.Len(t, series, 3)
+		require.Contains(t, series, `load{source="b"}`)
+
+		series, err = repository.ReadSeries(context.Background(), "load", MeticTypeCounter)
+		require.NoError(t, err)
+		require.Empty(t, series)
+
+		_, err = repository.ReadSeries(context.Background(), "load", "unknown")
+		require.ErrorIs(t, err, ErrUnknownMetricType)
+	}
+}
@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+//go:embed migrations/postgres/*.up.sql migrations/sqlite/*.up.sql
+var migrationsFS embed.FS
+
+// migrationDialect - особенности СУБД при применении миграций.
+type migrationDialect struct {
+	// dir - каталог миграций в migrationsFS
+	dir string
+	// tableExistsQuery - запрос существования таблицы schema_version
+	tableExistsQuery string
+	// lockQuery и unlockQuery - блокировка, под которой применяются миграции,
+	// чтобы несколько экземпляров сервера не применяли их одновременно
+	lockQuery   string
+	unlockQuery string
+}
+
+var (
+	postgresMigrations = migrationDialect{
+		dir:              "migrations/postgres",
+		tableExistsQuery: "SELECT to_regclass('schema_version') IS NOT NULL",
+		lockQuery:        "SELECT pg_advisory_lock(hashtext('metrics:schema_migrations'))",
+		unlockQuery:      "SELECT pg_advisory_unlock(hashtext('metrics:schema_migrations'))",
+	}
+	// В SQLite запись в файл и так сериализуется блокировкой БД
+	sqliteMigrations = migrationDialect{
+		dir:              "migrations/sqlite",
+		tableExistsQuery: "SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'",
+	}
+)
+
+var (
+	ErrInvalidMigration = errors.New("invalid migration")
+	ErrUnknownMigration = errors.New("database schema is newer than known migrations")
+)
+
+var migrationNameRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.up\.sql$`)
+
+// Migration - миграция схемы БД.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+func (migration Migration) String() string {
+	return fmt.Sprintf("%04d_%s", migration.Version, migration.Name)
+}
+
+// loadMigrations - миграции из файлов вида NNNN_name.up.sql по возрастанию версии.
+func loadMigrations(migrationsFS fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	for _, entry := range entries {
+		matches := migrationNameRegexp.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			return nil, fmt.Errorf("%w: unexpected file %s", ErrInvalidMigration, entry.Name())
+		}
+
+		version, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidMigration, entry.Name(), err)
+		}
+
+		data, err := fs.ReadFile(migrationsFS, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    matches[2],
+			SQL:     string(data),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("%w: expected version %d, got %s", ErrInvalidMigration, i+1, migration)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Migrations - встроенные миграции схемы Postgres.
+func Migrations() ([]Migration, error) {
+	return loadMigrations(migrationsFS, postgresMigrations.dir)
+}
+
+// rowQueryer - *sql.DB или *sql.Conn.
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// schemaVersion - текущая версия схемы, 0 если миграции ещё не применялись.
+func schemaVersion(ctx context.Context, queryer rowQueryer, dialect migrationDialect) (int, error) {
+	var exists bool
+	err := queryer.QueryRowContext(ctx, dialect.tableExistsQuery).Scan(&exists)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version int
+	err = queryer.QueryRowContext(ctx, "SELECT COALESCE(max(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+// pendingMigrations - миграции новее версии схемы.
+func pendingMigrations(migrations []Migration, version int) ([]Migration, error) {
+	if version > len(migrations) {
+		return nil, fmt.Errorf("%w: schema version %d, latest migration %d", ErrUnknownMigration, version, len(migrations))
+	}
+
+	return migrations[version:], nil
+}
+
+// PendingMigrations - миграции, которые будут применены при запуске.
+func (repository DBRepo) PendingMigrations() ([]Migration, error) {
+	return readPendingMigrations(repository.db, postgresMigrations)
+}
+
+// Migrate - применение недостающих миграций.
+func (repository DBRepo) Migrate() error {
+	return migrate(repository.db, postgresMigrations)
+}
+
+func readPendingMigrations(db *sql.DB, dialect migrationDialect) ([]Migration, error) {
+	migrations, err := loadMigrations(migrationsFS, dialect.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := schemaVersion(context.Background(), db, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return pendingMigrations(migrations, version)
+}
+
+// migrate - применение недостающих миграций.
+// Каждая миграция выполняется в отдельной транзакции вместе с записью в schema_version,
+// всё под блокировкой на отдельном соединении.
+func migrate(db *sql.DB, dialect migrationDialect) error {
+	migrations, err := loadMigrations(migrationsFS, dialect.dir)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if dialect.lockQuery != "" {
+		_, err = conn.ExecContext(ctx, dialect.lockQuery)
+		if err != nil {
+			return fmt.Errorf("failed to lock migrations: %w", err)
+		}
+		defer conn.ExecContext(ctx, dialect.unlockQuery)
+	}
+
+	_, err = conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_version (version INT PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)")
+	if err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	version, err := schemaVersion(ctx, conn, dialect)
+	if err != nil {
+		return err
+	}
+
+	pending, err := pendingMigrations(migrations, version)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range pending {
+		err = applyMigration(ctx, conn, migration)
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", migration, err)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, migration.SQL)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO schema_version (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
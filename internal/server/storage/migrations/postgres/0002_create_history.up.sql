@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS counter_history (id bigserial PRIMARY KEY, name VARCHAR (128) NOT NULL, value BIGINT NOT NULL, created_at TIMESTAMPTZ NOT NULL DEFAULT now());
+CREATE INDEX IF NOT EXISTS counter_history_name_created_at_idx ON counter_history (name, created_at);
+CREATE TABLE IF NOT EXISTS gauge_history (id bigserial PRIMARY KEY, name VARCHAR (128) NOT NULL, value DOUBLE PRECISION NOT NULL, created_at TIMESTAMPTZ NOT NULL DEFAULT now());
+CREATE INDEX IF NOT EXISTS gauge_history_name_created_at_idx ON gauge_history (name, created_at);
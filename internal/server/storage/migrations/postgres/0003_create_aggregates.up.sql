@@ -0,0 +1,2 @@
+CREATE TABLE IF NOT EXISTS histogram (id serial PRIMARY KEY, name TEXT UNIQUE NOT NULL, value JSONB NOT NULL);
+CREATE TABLE IF NOT EXISTS summary (id serial PRIMARY KEY, name TEXT UNIQUE NOT NULL, value JSONB NOT NULL);
@@ -0,0 +1,5 @@
+-- Ключ серии содержит метки и может быть длиннее 128 символов
+ALTER TABLE counter ALTER COLUMN name TYPE TEXT;
+ALTER TABLE gauge ALTER COLUMN name TYPE TEXT;
+ALTER TABLE counter_history ALTER COLUMN name TYPE TEXT;
+ALTER TABLE gauge_history ALTER COLUMN name TYPE TEXT;
@@ -0,0 +1,4 @@
+-- Приращение нужно для сумм при прореживании
+ALTER TABLE counter_history ADD COLUMN IF NOT EXISTS delta BIGINT NOT NULL DEFAULT 0;
+CREATE TABLE IF NOT EXISTS gauge_rollup (name TEXT NOT NULL, step_ms BIGINT NOT NULL, bucket TIMESTAMPTZ NOT NULL, samples BIGINT NOT NULL, min_value DOUBLE PRECISION NOT NULL, max_value DOUBLE PRECISION NOT NULL, avg_value DOUBLE PRECISION NOT NULL, last_value DOUBLE PRECISION NOT NULL, PRIMARY KEY (name, step_ms, bucket));
+CREATE TABLE IF NOT EXISTS counter_rollup (name TEXT NOT NULL, step_ms BIGINT NOT NULL, bucket TIMESTAMPTZ NOT NULL, samples BIGINT NOT NULL, increment BIGINT NOT NULL, last_value BIGINT NOT NULL, PRIMARY KEY (name, step_ms, bucket));
@@ -0,0 +1,11 @@
+-- Время хранится в наносекундах unix, чтобы сравнивать и группировать его как числа
+CREATE TABLE IF NOT EXISTS counter (name TEXT PRIMARY KEY, value INTEGER NOT NULL);
+CREATE TABLE IF NOT EXISTS gauge (name TEXT PRIMARY KEY, value REAL NOT NULL);
+CREATE TABLE IF NOT EXISTS histogram (name TEXT PRIMARY KEY, value TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS summary (name TEXT PRIMARY KEY, value TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS counter_history (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, value INTEGER NOT NULL, delta INTEGER NOT NULL DEFAULT 0, created_at INTEGER NOT NULL);
+CREATE INDEX IF NOT EXISTS counter_history_name_created_at_idx ON counter_history (name, created_at);
+CREATE TABLE IF NOT EXISTS gauge_history (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, value REAL NOT NULL, created_at INTEGER NOT NULL);
+CREATE INDEX IF NOT EXISTS gauge_history_name_created_at_idx ON gauge_history (name, created_at);
+CREATE TABLE IF NOT EXISTS gauge_rollup (name TEXT NOT NULL, step_ms INTEGER NOT NULL, bucket INTEGER NOT NULL, samples INTEGER NOT NULL, min_value REAL NOT NULL, max_value REAL NOT NULL, avg_value REAL NOT NULL, last_value REAL NOT NULL, PRIMARY KEY (name, step_ms, bucket));
+CREATE TABLE IF NOT EXISTS counter_rollup (name TEXT NOT NULL, step_ms INTEGER NOT NULL, bucket INTEGER NOT NULL, samples INTEGER NOT NULL, increment INTEGER NOT NULL, last_value INTEGER NOT NULL, PRIMARY KEY (name, step_ms, bucket));
@@ -0,0 +1,9 @@
+-- Время последней записи значения в наносекундах unix, у существующих значений - время миграции
+ALTER TABLE counter ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE gauge ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE histogram ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE summary ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;
+UPDATE counter SET updated_at = CAST(strftime('%s', 'now') AS INTEGER) * 1000000000;
+UPDATE gauge SET updated_at = CAST(strftime('%s', 'now') AS INTEGER) * 1000000000;
+UPDATE histogram SET updated_at = CAST(strftime('%s', 'now') AS INTEGER) * 1000000000;
+UPDATE summary SET updated_at = CAST(strftime('%s', 'now') AS INTEGER) * 1000000000;
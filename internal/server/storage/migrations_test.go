@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, migration := range migrations {
+		require.Equal(t, i+1, migration.Version)
+		require.NotEmpty(t, migration.SQL)
+	}
+	require.Equal(t, "0001_create_metrics", migrations[0].String())
+}
+
+func TestLoadMigrationsInvalid(t *testing.T) {
+	_, err := loadMigrations(fstest.MapFS{
+		"migrations/0001_init.up.sql":  {Data: []byte("SELECT 1")},
+		"migrations/0003_later.up.sql": {Data: []byte("SELECT 3")},
+	}, "migrations")
+	require.ErrorIs(t, err, ErrInvalidMigration)
+
+	_, err = loadMigrations(fstest.MapFS{
+		"migrations/init.sql": {Data: []byte("SELECT 1")},
+	}, "migrations")
+	require.ErrorIs(t, err, ErrInvalidMigration)
+}
+
+func TestPendingMigrations(t *testing.T) {
+	migrations, err := loadMigrations(fstest.MapFS{
+		"migrations/0002_second.up.sql": {Data: []byte("SELECT 2")},
+		"migrations/0001_first.up.sql":  {Data: []byte("SELECT 1")},
+	}, "migrations")
+	require.NoError(t, err)
+
+	pending, err := pendingMigrations(migrations, 0)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	require.Equal(t, "first", pending[0].Name)
+
+	pending, err = pendingMigrations(migrations, 1)
+	require.NoError(t, err)
+	require.Equal(t, []Migration{migrations[1]}, pending)
+
+	pending, err = pendingMigrations(migrations, 2)
+	require.NoError(t, err)
+	require.Empty(t, pending)
+
+	_, err = pendingMigrations(migrations, 3)
+	require.ErrorIs(t, err, ErrUnknownMigration)
+}
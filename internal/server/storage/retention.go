@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"metrics/internal/server/config"
+)
+
+// RollupRepo - агрегированная история в ОП, отдельный HistoryRepo на каждый шаг прореживания.
+type RollupRepo struct {
+	levels map[time.Duration]*HistoryRepo
+	*sync.RWMutex
+}
+
+func NewRollupRepo() (*RollupRepo, error) {
+	return &RollupRepo{
+		levels:  make(map[time.Duration]*HistoryRepo),
+		RWMutex: &sync.RWMutex{},
+	}, nil
+}
+
+// Level - история агрегатов с шагом step, создаётся при первом обращении.
+func (r *RollupRepo) Level(step time.Duration) *HistoryRepo {
+	r.RLock()
+	level, ok := r.levels[step]
+	r.RUnlock()
+	if ok {
+		return level
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	level, ok = r.levels[step]
+	if !ok {
+		level, _ = NewHistoryRepo()
+		r.levels[step] = level
+	}
+
+	return level
+}
+
+// Steps - шаги, для которых есть агрегаты.
+func (r *RollupRepo) Steps() []time.Duration {
+	r.RLock()
+	defer r.RUnlock()
+
+	steps := make([]time.Duration, 0, len(r.levels))
+	for step := range r.levels {
+		steps = append(steps, step)
+	}
+	sort.Slice(steps, func(i, j int) bool {
+		return steps[i] < steps[j]
+	})
+
+	return steps
+}
+
+// Delete - удаление агрегатов ключа на всех уровнях.
+func (r *RollupRepo) Delete(key string) {
+	for _, step := range r.Steps() {
+		r.Level(step).Delete(key)
+	}
+}
+
+func (r *RollupRepo) Close() error {
+	return nil
+}
+
+// rollupBucket - начало интервала прореживания, интервалы выровнены по unix времени.
+func rollupBucket(timestamp time.Time, step time.Duration) time.Time {
+	nanos := timestamp.UnixNano()
+	offset := nanos % int64(step)
+	if offset < 0 {
+		offset += int64(step)
+	}
+
+	return time.Unix(0, nanos-offset).In(timestamp.Location())
+}
+
+// retentionRule - правило хранения для ключа серии, правила сопоставляются с именем метрики без меток.
+func retentionRule(retention config.RetentionConfig, key string) (config.RetentionRule, bool) {
+	return retention.Match(seriesName(key))
+}
+
+// historyTier - шаг самого подробного уровня, который ещё хранит данные с момента from, 0 - исходные значения.
+// Если from старше всех уровней, используется самый грубый.
+func historyTier(retention config.RetentionConfig, key string, from, now time.Time) time.Duration {
+	rule, ok := retentionRule(retention, key)
+	if !ok || rule.Raw == 0 || !from.Before(now.Add(-time.Duration(rule.Raw))) || len(rule.Rollups) == 0 {
+		return 0
+	}
+
+	for _, rollup := range rule.Rollups {
+		if rollup.Retention == 0 || !from.Before(now.Add(-time.Duration(rollup.Retention))) {
+			return time.Duration(rollup.Step)
+		}
+	}
+
+	return time.Duration(rule.Rollups[len(rule.Rollups)-1].Step)
+}
+
+// compactHistory - прореживание и очистка истории в ОП по правилам хранения.
+// Агрегаты считаются по исходным значениям только для закрытых интервалов,
+// начиная с интервала, следующего за последним посчитанным.
+func compactHistory(retention config.RetentionConfig, history *HistoryRepo, rollups *RollupRepo, now time.Time) error {
+	for _, key := range history.Keys() {
+		rule, ok := retentionRule(retention, key)
+		if !ok {
+			continue
+		}
+
+		for _, rollupRule := range rule.Rollups {
+			step := time.Duration(rollupRule.Step)
+			level := rollups.Level(step)
+
+			var start time.Time
+			if last, ok := level.Last(key); ok {
+				start = last.Timestamp.Add(step)
+			}
+			cutoff := rollupBucket(now, step)
+			if !start.Before(cutoff) {
+				continue
+			}
+
+			samples := history.Range(key, start, cutoff.Add(-time.Nanosecond))
+			if len(samples) == 0 {
+				continue
+			}
+
+			for _, sample := range DownsampleHistory(samples, rollupBucket(samples[0].Timestamp, step), step) {
+				err := level.Append(key, sample)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if rule.Raw != 0 {
+			history.DeleteBefore(key, now.Add(-time.Duration(rule.Raw)))
+		}
+	}
+
+	for _, step := range rollups.Steps() {
+		level := rollups.Level(step)
+		for _, key := range level.Keys() {
+			rule, ok := retentionRule(retention, key)
+			if !ok {
+				continue
+			}
+
+			for _, rollupRule := range rule.Rollups {
+				if time.Duration(rollupRule.Step) == step && rollupRule.Retention != 0 {
+					level.DeleteBefore(key, now.Add(-time.Duration(rollupRule.Retention)))
+				}
+			}
+		}
+	}
+
+	return nil
+}
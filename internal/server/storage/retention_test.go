@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/config"
+)
+
+func TestMemoryRepoCompact(t *testing.T) {
+	metricsMemoryRepo := NewMetricsMemoryRepo(config.StoreConfig{
+		Retention: config.RetentionConfig{
+			Rules: []config.RetentionRule{
+				{
+					Pattern: "*",
+					Raw:     config.Duration(time.Hour),
+					Rollups: []config.RollupRule{
+						{Step: config.Duration(time.Minute), Retention: config.Duration(24 * time.Hour)},
+						{Step: config.Duration(time.Hour)},
+					},
+				},
+			},
+		},
+	})
+
+	now := time.Now()
+	base := rollupBucket(now.Add(-3*time.Hour), time.Hour)
+	offsets := []time.Duration{0, 10 * time.Second, 70 * time.Second}
+	values := []float64{1, 3, 10}
+	deltas := []int64{1, 2, 3}
+
+	old := -3.0
+	err := metricsMemoryRepo.update("Alloc", MetricValue{MType: MeticTypeGauge, Value: &old}, now.Add(-48*time.Hour), updateFromClient)
+	require.NoError(t, err)
+	for i := range offsets {
+		err = metricsMemoryRepo.update("Alloc", MetricValue{MType: MeticTypeGauge, Value: &values[i]}, base.Add(offsets[i]), updateFromClient)
+		require.NoError(t, err)
+		err = metricsMemoryRepo.update("PollCount", MetricValue{MType: MeticTypeCounter, Delta: &deltas[i]}, base.Add(offsets[i]), updateFromClient)
+		require.NoError(t, err)
+	}
+
+	// Повторный запуск не должен дублировать агрегаты
+	for i := 0; i < 2; i++ {
+		err = metricsMemoryRepo.Compact(context.Background(), now)
+		require.NoError(t, err)
+	}
+
+	// Исходные значения старше часа удалены
+	require.Equal(t, 0, metricsMemoryRepo.gaugeHistory.Len("Alloc"))
+	require.Equal(t, 0, metricsMemoryRepo.counterHistory.Len("PollCount"))
+
+	// Агрегаты старше суток удалены только с минутного уровня
+	require.Equal(t, 2, metricsMemoryRepo.gaugeRollups.Level(time.Minute).Len("Alloc"))
+	require.Equal(t, 2, metricsMemoryRepo.gaugeRollups.Level(time.Hour).Len("Alloc"))
+
+	gaugeHistory, err := metricsMemoryRepo.ReadHistory(context.Background(), "Alloc", MeticTypeGauge, base, now, 0)
+	require.NoError(t, err)
+	require.Len(t, gaugeHistory, 2)
+	require.Equal(t, base, gaugeHistory[0].Timestamp)
+	require.EqualValues(t, 2, *gaugeHistory[0].Value)
+	require.EqualValues(t, 2, gaugeHistory[0].Rollup.Count)
+	require.EqualValues(t, 1, *gaugeHistory[0].Rollup.Min)
+	require.EqualValues(t, 3, *gaugeHistory[0].Rollup.Max)
+	require.EqualValues(t, 3, *gaugeHistory[0].Rollup.Last)
+	require.EqualValues(t, 10, *gaugeHistory[1].Value)
+
+	gaugeHistory, err = metricsMemoryRepo.ReadHistory(context.Background(), "Alloc", MeticTypeGauge, base, now, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, gaugeHistory, 1)
+	require.InDelta(t, 14.0/3, *gaugeHistory[0].Value, 1e-9)
+	require.EqualValues(t, 3, gaugeHistory[0].Rollup.Count)
+	require.EqualValues(t, 1, *gaugeHistory[0].Rollup.Min)
+	require.EqualValues(t, 10, *gaugeHistory[0].Rollup.Max)
+	require.EqualValues(t, 10, *gaugeHistory[0].Rollup.Last)
+
+	counterHistory, err := metricsMemoryRepo.ReadHistory(context.Background(), "PollCount", MeticTypeCounter, base, now, 0)
+	require.NoError(t, err)
+	require.Len(t, counterHistory, 2)
+	require.EqualValues(t, 3, *counterHistory[0].Increment)
+	require.EqualValues(t, 3, *counterHistory[0].Delta)
+	require.EqualValues(t, 3, *counterHistory[1].Increment)
+	require.EqualValues(t, 6, *counterHistory[1].Delta)
+
+	err = metricsMemoryRepo.Close()
+	require.NoError(t, err)
+}
+
+func TestHistoryTier(t *testing.T) {
+	retention := config.RetentionConfig{
+		Rules: []config.RetentionRule{
+			{Pattern: "Raw*"},
+			{
+				Pattern: "*",
+				Raw:     config.Duration(time.Hour),
+				Rollups: []config.RollupRule{
+					{Step: config.Duration(time.Minute), Retention: config.Duration(24 * time.Hour)},
+					{Step: config.Duration(time.Hour), Retention: config.Duration(7 * 24 * time.Hour)},
+				},
+			},
+		},
+	}
+	require.NoError(t, retention.Validate())
+
+	now := time.Now()
+	require.Equal(t, time.Duration(0), historyTier(retention, `RawAlloc{host="a"}`, now.Add(-48*time.Hour), now))
+	require.Equal(t, time.Duration(0), historyTier(retention, "Alloc", now.Add(-time.Minute), now))
+	require.Equal(t, time.Minute, historyTier(retention, `Alloc{host="a"}`, now.Add(-2*time.Hour), now))
+	require.Equal(t, time.Hour, historyTier(retention, "Alloc", now.Add(-48*time.Hour), now))
+	require.Equal(t, time.Hour, historyTier(retention, "Alloc", now.Add(-30*24*time.Hour), now))
+
+	retention.Rules[1].Raw = config.Duration(time.Second)
+	require.Error(t, retention.Validate())
+}
+
+func TestMemoryRepoHistorySnapshot(t *testing.T) {
+	storeConfig := config.StoreConfig{
+		File:    filepath.Join(t.TempDir(), "metrics.json"),
+		Restore: true,
+		Retention: config.RetentionConfig{
+			Rules: []config.RetentionRule{
+				{
+					Pattern: "*",
+					Raw:     config.Duration(time.Hour),
+					Rollups: []config.RollupRule{{Step: config.Duration(time.Minute)}},
+				},
+			},
+		},
+	}
+
+	metricsMemoryRepo := NewMetricsMemoryRepo(storeConfig)
+	metricsMemoryRepo.InitFromFile(context.Background())
+
+	now := time.Now()
+	base := rollupBucket(now.Add(-3*time.Hour), time.Minute)
+	values := []float64{1, 3}
+	for i := range values {
+		err := metricsMemoryRepo.update("Alloc", MetricValue{MType: MeticTypeGauge, Value: &values[i]}, base.Add(time.Duration(i)*time.Second), updateFromClient)
+		require.NoError(t, err)
+	}
+	err := metricsMemoryRepo.Compact(context.Background(), now)
+	require.NoError(t, err)
+
+	// Исходные значения после снимка восстанавливаются из журнала
+	latest := 5.0
+	err = metricsMemoryRepo.Save(context.Background())
+	require.NoError(t, err)
+	err = metricsMemoryRepo.update("Alloc", MetricValue{MType: MeticTypeGauge, Value: &latest}, now, updateFromClient)
+	require.NoError(t, err)
+	err = metricsMemoryRepo.Close()
+	require.NoError(t, err)
+
+	restoredRepo := NewMetricsMemoryRepo(storeConfig)
+	restoredRepo.InitFromFile(context.Background())
+
+	require.Equal(t, 1, restoredRepo.gaugeRollups.Level(time.Minute).Len("Alloc"))
+	require.Equal(t, 1, restoredRepo.gaugeHistory.Len("Alloc"))
+
+	gaugeHistory, err := restoredRepo.ReadHistory(context.Background(), "Alloc", MeticTypeGauge, base, now, 0)
+	require.NoError(t, err)
+	require.Len(t, gaugeHistory, 1)
+	require.Equal(t, base.UnixNano(), gaugeHistory[0].Timestamp.UnixNano())
+	require.EqualValues(t, 2, *gaugeHistory[0].Value)
+	require.EqualValues(t, 2, gaugeHistory[0].Rollup.Count)
+
+	err = restoredRepo.Close()
+	require.NoError(t, err)
+}
@@ -0,0 +1,718 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"metrics/internal/server/config"
+)
+
+// SQLiteDSNPrefix - префикс DSN, при котором метрики хранятся в файле SQLite.
+const SQLiteDSNPrefix = "sqlite://"
+
+const (
+	querySQLiteUpdateGauge        = "INSERT INTO gauge (name, value, updated_at) VALUES (?, ?, ?) ON CONFLICT (name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at"
+	querySQLiteInsertGaugeHistory = "INSERT INTO gauge_history (name, value, created_at) VALUES (?, ?, ?)"
+	querySQLiteUpdateCounter      = "INSERT INTO counter (name, value, updated_at) VALUES (?, ?, ?) ON CONFLICT (name) DO UPDATE SET value = counter.value + excluded.value, updated_at = excluded.updated_at RETURNING value"
+	querySQLiteInsertCounterHist  = "INSERT INTO counter_history (name, value, delta, created_at) VALUES (?, ?, ?, ?)"
+	querySQLiteSetCounter         = "INSERT INTO counter (name, value, updated_at) VALUES (?, ?, ?) ON CONFLICT (name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at"
+)
+
+// IsSQLiteDSN - DSN указывает на файл SQLite.
+func IsSQLiteDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, SQLiteDSNPrefix)
+}
+
+// sqliteQueryer - *sql.DB или *sql.Tx.
+type sqliteQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// SQLiteRepo - хранилище метрик во встроенной БД SQLite.
+// Время записи и время в истории хранятся в наносекундах unix.
+type SQLiteRepo struct {
+	config config.StoreConfig
+	db     *sql.DB
+}
+
+func NewSQLiteRepo(config config.StoreConfig) (SQLiteRepo, error) {
+	var repository SQLiteRepo
+	repository.config = config
+
+	db, err := sql.Open("sqlite", sqliteDataSource(config.DatabaseDSN))
+	if err != nil {
+		return SQLiteRepo{}, err
+	}
+	repository.db = db
+
+	repository.PrepareDB()
+	if repository.config.MigrateDryRun {
+		return repository, nil
+	}
+
+	err = repository.InitTables()
+	if err != nil {
+		return SQLiteRepo{}, err
+	}
+
+	return repository, nil
+}
+
+// sqliteDataSource - путь к файлу БД из DSN вида sqlite:///var/lib/metrics.db с параметрами соединения.
+// Ожидание блокировки нужно, чтобы запись из других процессов не завершалась ошибкой SQLITE_BUSY.
+func sqliteDataSource(dsn string) string {
+	dataSource := strings.TrimPrefix(dsn, SQLiteDSNPrefix)
+
+	separator := "?"
+	if strings.Contains(dataSource, "?") {
+		separator = "&"
+	}
+
+	return dataSource + separator + "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+}
+
+func (repository SQLiteRepo) DB() *sql.DB {
+	return repository.db
+}
+
+// PrepareDB - SQLite допускает только одного писателя, поэтому все запросы идут через одно соединение.
+func (repository SQLiteRepo) PrepareDB() {
+	repository.db.SetMaxOpenConns(1)
+	repository.db.SetMaxIdleConns(1)
+}
+
+// InitTables - применение миграций схемы.
+func (repository SQLiteRepo) InitTables() error {
+	return migrate(repository.db, sqliteMigrations)
+}
+
+// PendingMigrations - миграции, которые будут применены при запуске.
+func (repository SQLiteRepo) PendingMigrations() ([]Migration, error) {
+	return readPendingMigrations(repository.db, sqliteMigrations)
+}
+
+func (repository SQLiteRepo) Update(ctx context.Context, key string, newMetricValue MetricValue) error {
+	if err := ValidateSeriesKey(key); err != nil {
+		return err
+	}
+
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = repository.updateTX(ctx, tx, key, newMetricValue, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetValues - установка значений gauge и накопленных значений counter в одной транзакции.
+// В историю counter пишется разница с предыдущим значением, а если значение уменьшилось (счётчик сброшен) - само значение.
+func (repository SQLiteRepo) SetValues(ctx context.Context, gauges map[string]float64, counters map[string]int64) error {
+	for key := range gauges {
+		if err := ValidateSeriesKey(key); err != nil {
+			return err
+		}
+	}
+	for key := range counters {
+		if err := ValidateSeriesKey(key); err != nil {
+			return err
+		}
+	}
+
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	timestamp := time.Now()
+	for key, value := range gauges {
+		value := value
+		err = repository.updateTX(ctx, tx, key, MetricValue{MType: MeticTypeGauge, Value: &value}, timestamp)
+		if err != nil {
+			return err
+		}
+	}
+
+	now := timestamp.UnixNano()
+	for key, value := range counters {
+		var previous int64
+		err = tx.QueryRowContext(ctx, "SELECT value FROM counter WHERE name = ?", key).Scan(&previous)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		delta := value
+		if previous <= value {
+			delta -= previous
+		}
+
+		_, err = tx.ExecContext(ctx, querySQLiteSetCounter, key, value, now)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, querySQLiteInsertCounterHist, key, value, delta, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// updateTX - обновление значения и запись в историю в рамках транзакции.
+func (repository SQLiteRepo) updateTX(ctx context.Context, tx *sql.Tx, key string, newMetricValue MetricValue, timestamp time.Time) error {
+	switch newMetricValue.MType {
+	case MeticTypeGauge:
+		if newMetricValue.Value == nil {
+			return fmt.Errorf("%w: Value", ErrEmptyMetricValue)
+		}
+
+		_, err := tx.ExecContext(ctx, querySQLiteUpdateGauge, key, *newMetricValue.Value, timestamp.UnixNano())
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, querySQLiteInsertGaugeHistory, key, *newMetricValue.Value, timestamp.UnixNano())
+		return err
+	case MeticTypeCounter:
+		if newMetricValue.Delta == nil {
+			return fmt.Errorf("%w: Delta", ErrEmptyMetricValue)
+		}
+
+		var value int64
+		err := tx.QueryRowContext(ctx, querySQLiteUpdateCounter, key, *newMetricValue.Delta, timestamp.UnixNano()).Scan(&value)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, querySQLiteInsertCounterHist, key, value, *newMetricValue.Delta, timestamp.UnixNano())
+		return err
+	case MeticTypeHistogram, MeticTypeSummary:
+		newMetricValue, err := prepareAggregateValue(newMetricValue)
+		if err != nil {
+			return err
+		}
+
+		return repository.updateAggregateTX(ctx, tx, key, newMetricValue, timestamp)
+	default:
+		return ErrUnknownMetricType
+	}
+}
+
+// updateAggregateTX - объединение значения с сохранённым в рамках транзакции.
+// Транзакции в SQLite сериализуются, поэтому отдельная блокировка ключа не нужна.
+func (repository SQLiteRepo) updateAggregateTX(ctx context.Context, tx *sql.Tx, key string, newMetricValue MetricValue, timestamp time.Time) error {
+	table := aggregateTables[newMetricValue.MType]
+
+	var oldMetricValuePtr *MetricValue
+	var oldData []byte
+	err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT value FROM %s WHERE name = ?", table), key).Scan(&oldData)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return err
+	default:
+		oldMetricValue, err := unmarshalAggregate(newMetricValue.MType, oldData)
+		if err != nil {
+			return err
+		}
+		oldMetricValuePtr = &oldMetricValue
+	}
+
+	newMetricValue, err = MergeMetricValue(oldMetricValuePtr, newMetricValue)
+	if err != nil {
+		return err
+	}
+
+	newData, err := marshalAggregate(newMetricValue)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (name, value, updated_at) VALUES (?, ?, ?) ON CONFLICT (name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at", table), key, string(newData), timestamp.UnixNano())
+	return err
+}
+
+// UpdateManySliceMetric - обновление пачки метрик в одной транзакции, при ошибке не применяется ни одно значение.
+func (repository SQLiteRepo) UpdateManySliceMetric(ctx context.Context, MetricBatch []Metric) error {
+	for _, metricValue := range MetricBatch {
+		if err := ValidateSeriesKey(metricValue.SeriesKey()); err != nil {
+			return err
+		}
+	}
+
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, metricValue := range MetricBatch {
+		err = repository.updateTX(ctx, tx, metricValue.SeriesKey(), metricValue.MetricValue, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (repository SQLiteRepo) UpdateMany(ctx context.Context, DBSchema map[string]MetricValue) error {
+	var MetricBatch []Metric
+
+	for metricKey, metricValue := range DBSchema {
+		MetricBatch = append(MetricBatch, Metric{
+			ID:          metricKey,
+			MetricValue: metricValue,
+		})
+	}
+
+	return repository.UpdateManySliceMetric(ctx, MetricBatch)
+}
+
+func (repository SQLiteRepo) Read(ctx context.Context, key string, metricType string) (MetricValue, error) {
+	metricValue := MetricValue{
+		MType: metricType,
+	}
+
+	var err error
+	var updatedAt int64
+	switch metricType {
+	case MeticTypeGauge:
+		err = repository.db.QueryRowContext(ctx, "SELECT value, updated_at FROM gauge WHERE name = ?", key).Scan(&metricValue.Value, &updatedAt)
+	case MeticTypeCounter:
+		err = repository.db.QueryRowContext(ctx, "SELECT value, updated_at FROM counter WHERE name = ?", key).Scan(&metricValue.Delta, &updatedAt)
+	case MeticTypeHistogram, MeticTypeSummary:
+		var data []byte
+		err = repository.db.QueryRowContext(ctx, fmt.Sprintf("SELECT value, updated_at FROM %s WHERE name = ?", aggregateTables[metricType]), key).Scan(&data, &updatedAt)
+		if err == nil {
+			metricValue, err = unmarshalAggregate(metricType, data)
+		}
+	default:
+		return MetricValue{}, ErrUnknownMetricType
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return metricValue, ErrMetricNotFound
+	}
+	if err != nil {
+		return metricValue, fmt.Errorf("%s select error : %w", metricType, err)
+	}
+
+	metricValue.UpdatedAt = sqliteTime(updatedAt)
+	return metricValue, nil
+}
+
+// sqliteTime - время из наносекунд unix.
+func sqliteTime(nanoseconds int64) *time.Time {
+	timestamp := time.Unix(0, nanoseconds)
+	return &timestamp
+}
+
+// sqliteSeriesCondition - условие выборки всех серий метрики: имя метрики и диапазон ключей её серий с метками,
+// '|' следует за '{', поэтому диапазон покрывает все ключи с началом "id{" и использует индекс по name.
+const sqliteSeriesCondition = " WHERE name = ? OR (name >= ? AND name < ?)"
+
+func (repository SQLiteRepo) readAll(ctx context.Context, metricType string) (map[string]MetricValue, error) {
+	return repository.selectAll(ctx, metricType, "")
+}
+
+// ReadSeries - все серии метрики id одним запросом к таблице типа.
+func (repository SQLiteRepo) ReadSeries(ctx context.Context, id string, metricType string) (MetricMap, error) {
+	switch metricType {
+	case MeticTypeGauge, MeticTypeCounter, MeticTypeHistogram, MeticTypeSummary:
+		return repository.selectAll(ctx, metricType, sqliteSeriesCondition, id, seriesPrefix(id), id+"|")
+	default:
+		return nil, ErrUnknownMetricType
+	}
+}
+
+func (repository SQLiteRepo) selectAll(ctx context.Context, metricType string, condition string, args ...interface{}) (map[string]MetricValue, error) {
+	table, ok := aggregateTables[metricType]
+	if !ok {
+		table = metricType
+	}
+
+	rows, err := repository.db.QueryContext(ctx, fmt.Sprintf("SELECT name, value, updated_at FROM %s", table)+condition, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	allValues := map[string]MetricValue{}
+	for rows.Next() {
+		var vKey string
+		var updatedAt int64
+		v := MetricValue{
+			MType: metricType,
+		}
+
+		switch metricType {
+		case MeticTypeGauge:
+			err = rows.Scan(&vKey, &v.Value, &updatedAt)
+		case MeticTypeCounter:
+			err = rows.Scan(&vKey, &v.Delta, &updatedAt)
+		default:
+			var data []byte
+			err = rows.Scan(&vKey, &data, &updatedAt)
+			if err == nil {
+				v, err = unmarshalAggregate(metricType, data)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		v.UpdatedAt = sqliteTime(updatedAt)
+
+		allValues[vKey] = v
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return allValues, nil
+}
+
+// ReadAll - все значения всех типов, при ошибке чтения любого типа возвращается ошибка, а не часть значений.
+func (repository SQLiteRepo) ReadAll(ctx context.Context) (map[string]MetricMap, error) {
+	var err error
+	AllValues := map[string]MetricMap{}
+
+	for _, metricType := range []string{MeticTypeCounter, MeticTypeGauge, MeticTypeHistogram, MeticTypeSummary} {
+		AllValues[metricType], err = repository.readAll(ctx, metricType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return AllValues, nil
+}
+
+// ReadHistory - история за интервал [from, to].
+// Если исходные значения за from уже удалены по правилам хранения, используются агрегаты прореживания.
+func (repository SQLiteRepo) ReadHistory(ctx context.Context, key string, metricType string, from, to time.Time, step time.Duration) ([]MetricSample, error) {
+	if _, ok := rollupTables[metricType]; !ok {
+		return nil, ErrUnknownMetricType
+	}
+
+	tier := historyTier(repository.config.Retention, key, from, time.Now())
+	if tier != 0 {
+		samples, err := repository.readRollups(ctx, key, metricType, tier, from, to)
+		if err != nil || step <= tier {
+			return samples, err
+		}
+
+		return DownsampleHistory(samples, from, step), nil
+	}
+
+	samples, err := repository.readRawHistory(ctx, repository.db, key, metricType, from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+
+	return DownsampleHistory(samples, from, step), nil
+}
+
+// readRawHistory - исходные значения истории за интервал [from, to] в наносекундах unix.
+func (repository SQLiteRepo) readRawHistory(ctx context.Context, queryer sqliteQueryer, key string, metricType string, from, to int64) ([]MetricSample, error) {
+	var query string
+	switch metricType {
+	case MeticTypeGauge:
+		query = "SELECT created_at, value FROM gauge_history WHERE name = ? AND created_at BETWEEN ? AND ? ORDER BY created_at, id"
+	case MeticTypeCounter:
+		query = "SELECT created_at, value, delta FROM counter_history WHERE name = ? AND created_at BETWEEN ? AND ? ORDER BY created_at, id"
+	default:
+		return nil, ErrUnknownMetricType
+	}
+
+	rows, err := queryer.QueryContext(ctx, query, key, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	samples := []MetricSample{}
+	for rows.Next() {
+		var timestamp int64
+		sample := MetricSample{
+			MetricValue: MetricValue{
+				MType: metricType,
+			},
+		}
+
+		if metricType == MeticTypeGauge {
+			err = rows.Scan(&timestamp, &sample.Value)
+		} else {
+			err = rows.Scan(&timestamp, &sample.Delta, &sample.Increment)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sample.Timestamp = time.Unix(0, timestamp)
+		samples = append(samples, sample)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// Delete - удаление значения вместе с историей.
+func (repository SQLiteRepo) Delete(ctx context.Context, key string, metricType string) error {
+	deleted, err := repository.deleteKeys(ctx, metricType, []string{key})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrMetricNotFound
+	}
+
+	return nil
+}
+
+// DeleteMatching - удаление всех серий метрик, имя которых соответствует шаблону path.Match.
+// Пустой metricType - удаление среди всех типов.
+func (repository SQLiteRepo) DeleteMatching(ctx context.Context, metricType string, pattern string) (int, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, err
+	}
+
+	metricTypes := []string{metricType}
+	if metricType == "" {
+		metricTypes = []string{MeticTypeGauge, MeticTypeCounter, MeticTypeHistogram, MeticTypeSummary}
+	}
+
+	var deleted int
+	for _, metricType := range metricTypes {
+		tables, ok := metricTables[metricType]
+		if !ok {
+			return deleted, ErrUnknownMetricType
+		}
+
+		keys, err := repository.matchingKeys(ctx, tables[0], pattern)
+		if err != nil {
+			return deleted, err
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		count, err := repository.deleteKeys(ctx, metricType, keys)
+		deleted += count
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+func (repository SQLiteRepo) matchingKeys(ctx context.Context, table string, pattern string) ([]string, error) {
+	keys, err := repository.keys(ctx, repository.db, fmt.Sprintf("SELECT name FROM %s", table))
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []string
+	for _, key := range keys {
+		if matchSeriesName(pattern, key) {
+			matched = append(matched, key)
+		}
+	}
+
+	return matched, nil
+}
+
+// keys - ключи серий из запроса, строки читаются полностью до следующего запроса через единственное соединение.
+func (repository SQLiteRepo) keys(ctx context.Context, queryer sqliteQueryer, query string, args ...interface{}) ([]string, error) {
+	rows, err := queryer.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		err = rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// deleteKeys - удаление ключей из всех таблиц типа метрики в одной транзакции,
+// возвращает количество удалённых значений из основной таблицы.
+func (repository SQLiteRepo) deleteKeys(ctx context.Context, metricType string, keys []string) (int, error) {
+	tables, ok := metricTables[metricType]
+	if !ok {
+		return 0, ErrUnknownMetricType
+	}
+
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var deleted int64
+	for _, key := range keys {
+		for i, table := range tables {
+			result, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE name = ?", table), key)
+			if err != nil {
+				return 0, fmt.Errorf("failed to delete from %s: %w", table, err)
+			}
+
+			if i == 0 {
+				count, err := result.RowsAffected()
+				if err != nil {
+					return 0, err
+				}
+				deleted += count
+			}
+		}
+	}
+
+	return int(deleted), tx.Commit()
+}
+
+// Expire - удаление серий всех типов, в которые не было записи с момента before, вместе с историей.
+func (repository SQLiteRepo) Expire(ctx context.Context, before time.Time) (int, error) {
+	var expired int
+	for _, metricType := range []string{MeticTypeGauge, MeticTypeCounter, MeticTypeHistogram, MeticTypeSummary} {
+		count, err := repository.expireType(ctx, metricType, before)
+		expired += count
+		if err != nil {
+			return expired, err
+		}
+	}
+
+	return expired, nil
+}
+
+// expireType - удаление устаревших серий типа метрики в одной транзакции.
+func (repository SQLiteRepo) expireType(ctx context.Context, metricType string, before time.Time) (int, error) {
+	tables := metricTables[metricType]
+
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	keys, err := repository.keys(ctx, tx, fmt.Sprintf("DELETE FROM %s WHERE updated_at < ? RETURNING name", tables[0]), before.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete from %s: %w", tables[0], err)
+	}
+
+	for _, key := range keys {
+		for _, table := range tables[1:] {
+			_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE name = ?", table), key)
+			if err != nil {
+				return 0, fmt.Errorf("failed to delete from %s: %w", table, err)
+			}
+		}
+	}
+
+	return len(keys), tx.Commit()
+}
+
+// ResetCounter - сброс counter в 0, сброс попадает в историю.
+func (repository SQLiteRepo) ResetCounter(ctx context.Context, key string) error {
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UnixNano()
+	result, err := tx.ExecContext(ctx, "UPDATE counter SET value = 0, updated_at = ? WHERE name = ?", now, key)
+	if err != nil {
+		return err
+	}
+
+	reset, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if reset == 0 {
+		return ErrMetricNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, querySQLiteInsertCounterHist, key, 0, 0, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repository SQLiteRepo) Close() error {
+	return repository.db.Close()
+}
+
+func (repository SQLiteRepo) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	return repository.db.PingContext(ctx)
+}
+
+func (repository SQLiteRepo) InitFromFile(ctx context.Context) {
+	file, err := os.OpenFile(repository.config.File, os.O_RDONLY|os.O_CREATE, 0777)
+	if err != nil {
+		panic(err.Error())
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		panic(err.Error())
+	}
+	fileSnapshot, err := readSnapshot(data)
+	if err != nil {
+		log.Println(err)
+	}
+
+	for _, metricList := range fileSnapshot.Metrics {
+		err = repository.UpdateMany(ctx, metricList)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func (repository SQLiteRepo) Save(_ context.Context) error {
+	return nil
+}
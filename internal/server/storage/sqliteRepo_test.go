@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/config"
+)
+
+func newTestSQLiteRepo(t *testing.T, storeConfig config.StoreConfig) SQLiteRepo {
+	storeConfig.DatabaseDSN = SQLiteDSNPrefix + filepath.Join(t.TempDir(), "metrics.db")
+
+	repository, err := NewSQLiteRepo(storeConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, repository.Close())
+	})
+
+	return repository
+}
+
+func TestSQLiteRepoReadWrite(t *testing.T) {
+	repository := newTestSQLiteRepo(t, config.StoreConfig{})
+	require.NoError(t, repository.Ping(context.Background()))
+
+	_, err := repository.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.Error(t, err)
+
+	value := 1.5
+	var delta int64 = 5
+	for i := 0; i < 2; i++ {
+		err = repository.Update(context.Background(), "Alloc", MetricValue{MType: MeticTypeGauge, Value: &value})
+		require.NoError(t, err)
+		err = repository.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+		require.NoError(t, err)
+	}
+
+	alloc, err := repository.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, 1.5, *alloc.Value)
+
+	pollCount, err := repository.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, *pollCount.Delta)
+
+	err = repository.Update(context.Background(), "Latency", MetricValue{MType: MeticTypeHistogram, Histogram: &HistogramValue{Buckets: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5, Count: 1}})
+	require.NoError(t, err)
+	err = repository.Update(context.Background(), "Latency", MetricValue{MType: MeticTypeHistogram, Histogram: &HistogramValue{Buckets: []float64{1}, Counts: []uint64{0, 1}, Sum: 2, Count: 1}})
+	require.NoError(t, err)
+
+	latency, err := repository.Read(context.Background(), "Latency", MeticTypeHistogram)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 1}, latency.Histogram.Counts)
+	require.EqualValues(t, 2, latency.Histogram.Count)
+
+	allValues, err := repository.ReadAll(context.Background())
+	require.NoError(t, err)
+	require.Len(t, allValues[MeticTypeGauge], 1)
+	require.Len(t, allValues[MeticTypeCounter], 1)
+	require.Len(t, allValues[MeticTypeHistogram], 1)
+
+	history, err := repository.ReadHistory(context.Background(), "PollCount", MeticTypeCounter, time.Now().Add(-time.Minute), time.Now(), 0)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.EqualValues(t, 10, *history[1].Delta)
+	require.EqualValues(t, 5, *history[1].Increment)
+}
+
+func TestSQLiteRepoUpdateManySliceMetricRollback(t *testing.T) {
+	repository := newTestSQLiteRepo(t, config.StoreConfig{})
+
+	value := 1.5
+	var delta int64 = 5
+	err := repository.UpdateManySliceMetric(context.Background(), []Metric{
+		{ID: "Alloc", MetricValue: MetricValue{MType: MeticTypeGauge, Value: &value}},
+		{ID: "PollCount", Labels: Labels{"host": "a"}, MetricValue: MetricValue{MType: MeticTypeCounter, Delta: &delta}},
+		{ID: "PollCount", Labels: Labels{"host": "a"}, MetricValue: MetricValue{MType: MeticTypeCounter, Delta: &delta}},
+	})
+	require.NoError(t, err)
+
+	pollCount, err := repository.Read(context.Background(), `PollCount{host="a"}`, MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, *pollCount.Delta)
+
+	// Ошибка в середине пачки откатывает всю пачку
+	err = repository.UpdateManySliceMetric(context.Background(), []Metric{
+		{ID: "Alloc", MetricValue: MetricValue{MType: MeticTypeGauge, Value: &value}},
+		{ID: "PollCount", Labels: Labels{"host": "a"}, MetricValue: MetricValue{MType: MeticTypeCounter, Delta: &delta}},
+		{ID: "Broken", MetricValue: MetricValue{MType: MeticTypeGauge}},
+	})
+	require.Error(t, err)
+
+	pollCount, err = repository.Read(context.Background(), `PollCount{host="a"}`, MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, *pollCount.Delta)
+
+	history, err := repository.ReadHistory(context.Background(), "Alloc", MeticTypeGauge, time.Now().Add(-time.Minute), time.Now(), 0)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+}
+
+func TestSQLiteRepoDeleteAndReset(t *testing.T) {
+	repository := newTestSQLiteRepo(t, config.StoreConfig{})
+
+	value := 1.5
+	var delta int64 = 5
+	for _, key := range []string{"Alloc", `Alloc{host="a"}`, "HeapAlloc"} {
+		err := repository.Update(context.Background(), key, MetricValue{MType: MeticTypeGauge, Value: &value})
+		require.NoError(t, err)
+	}
+	err := repository.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+	require.NoError(t, err)
+
+	deleted, err := repository.DeleteMatching(context.Background(), "", "Alloc")
+	require.NoError(t, err)
+	require.Equal(t, 2, deleted)
+
+	err = repository.Delete(context.Background(), "HeapAlloc", MeticTypeGauge)
+	require.NoError(t, err)
+	err = repository.Delete(context.Background(), "HeapAlloc", MeticTypeGauge)
+	require.ErrorIs(t, err, ErrMetricNotFound)
+
+	history, err := repository.ReadHistory(context.Background(), "HeapAlloc", MeticTypeGauge, time.Now().Add(-time.Minute), time.Now(), 0)
+	require.NoError(t, err)
+	require.Empty(t, history)
+
+	err = repository.ResetCounter(context.Background(), "PollCount")
+	require.NoError(t, err)
+	err = repository.ResetCounter(context.Background(), "Unknown")
+	require.ErrorIs(t, err, ErrMetricNotFound)
+
+	pollCount, err := repository.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, *pollCount.Delta)
+}
+
+func TestSQLiteRepoExpire(t *testing.T) {
+	repository := newTestSQLiteRepo(t, config.StoreConfig{})
+
+	value := 1.5
+	var delta int64 = 5
+	err := repository.Update(context.Background(), "Alloc", MetricValue{MType: MeticTypeGauge, Value: &value})
+	require.NoError(t, err)
+	err = repository.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+	require.NoError(t, err)
+
+	alloc, err := repository.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), *alloc.UpdatedAt, time.Minute)
+
+	expired, err := repository.Expire(context.Background(), time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 0, expired)
+
+	// Серии, в которые не было записи с before, удаляются вместе с историей
+	before := time.Now().Add(time.Second)
+	err = repository.Update(context.Background(), "HeapAlloc", MetricValue{MType: MeticTypeGauge, Value: &value})
+	require.NoError(t, err)
+	_, err = repository.DB().Exec("UPDATE gauge SET updated_at = ? WHERE name = ?", before.Add(time.Minute).UnixNano(), "HeapAlloc")
+	require.NoError(t, err)
+
+	expired, err = repository.Expire(context.Background(), before)
+	require.NoError(t, err)
+	require.Equal(t, 2, expired)
+
+	_, err = repository.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.ErrorIs(t, err, ErrMetricNotFound)
+	_, err = repository.Read(context.Background(), "HeapAlloc", MeticTypeGauge)
+	require.NoError(t, err)
+
+	history, err := repository.ReadHistory(context.Background(), "PollCount", MeticTypeCounter, time.Now().Add(-time.Minute), time.Now(), 0)
+	require.NoError(t, err)
+	require.Empty(t, history)
+}
+
+func TestSQLiteRepoCompact(t *testing.T) {
+	repository := newTestSQLiteRepo(t, config.StoreConfig{
+		Retention: config.RetentionConfig{
+			Rules: []config.RetentionRule{
+				{
+					Pattern: "*",
+					Raw:     config.Duration(time.Hour),
+					Rollups: []config.RollupRule{
+						{Step: config.Duration(time.Minute)},
+					},
+				},
+			},
+		},
+	})
+
+	now := time.Now()
+	base := rollupBucket(now.Add(-3*time.Hour), time.Hour)
+	values := []float64{1, 3, 10}
+	offsets := []time.Duration{0, 10 * time.Second, 70 * time.Second}
+
+	tx, err := repository.db.BeginTx(context.Background(), nil)
+	require.NoError(t, err)
+	for i := range values {
+		err = repository.updateTX(context.Background(), tx, "Alloc", MetricValue{MType: MeticTypeGauge, Value: &values[i]}, base.Add(offsets[i]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+
+	// Повторный запуск не должен дублировать агрегаты
+	for i := 0; i < 2; i++ {
+		err = repository.Compact(context.Background(), now)
+		require.NoError(t, err)
+	}
+
+	history, err := repository.ReadHistory(context.Background(), "Alloc", MeticTypeGauge, base, now, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, base.UnixNano(), history[0].Timestamp.UnixNano())
+	require.EqualValues(t, 2, *history[0].Value)
+	require.EqualValues(t, 2, history[0].Rollup.Count)
+	require.EqualValues(t, 3, *history[0].Rollup.Last)
+}
+
+func TestSQLiteRepoMigrate(t *testing.T) {
+	repository := newTestSQLiteRepo(t, config.StoreConfig{})
+
+	pending, err := repository.PendingMigrations()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+
+	// Повторное применение ничего не меняет
+	require.NoError(t, repository.InitTables())
+}
+
+func TestSQLiteRepoSetValues(t *testing.T) {
+	repository := newTestSQLiteRepo(t, config.StoreConfig{})
+	from := time.Now().Add(-time.Minute)
+
+	for _, value := range []int64{10, 15, 4} {
+		err := repository.SetValues(context.Background(), nil, map[string]int64{"requests_total": value})
+		require.NoError(t, err)
+	}
+
+	counter, err := repository.Read(context.Background(), "requests_total", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, *counter.Delta)
+
+	err = repository.SetValues(context.Background(), map[string]float64{"queue": 3}, map[string]int64{"requests_total": 6})
+	require.NoError(t, err)
+	queue, err := repository.Read(context.Background(), "queue", MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, *queue.Value)
+
+	// Приращения - разница с предыдущим значением, после сброса счётчика - само значение
+	history, err := repository.ReadHistory(context.Background(), "requests_total", MeticTypeCounter, from, time.Now().Add(time.Minute), 0)
+	require.NoError(t, err)
+	require.Len(t, history, 4)
+	for i, increment := range []int64{10, 5, 4, 2} {
+		require.EqualValues(t, increment, *history[i].Increment)
+	}
+}
+
+func TestSQLiteRepoReadSeries(t *testing.T) {
+	repository := newTestSQLiteRepo(t, config.StoreConfig{})
+	seedSeries(t, repository)
+
+	series, err := repository.ReadSeries(context.Background(), "load", MeticTypeGauge)
+	require.NoError(t, err)
+	require.Len(t, series, 3)
+	require.EqualValues(t, 1.5, *series[`load{source="a"}`].Value)
+
+	_, err = repository.ReadSeries(context.Background(), "load", "unknown")
+	require.ErrorIs(t, err, ErrUnknownMetricType)
+}
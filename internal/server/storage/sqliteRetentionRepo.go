@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+func (repository SQLiteRepo) readRollups(ctx context.Context, key string, metricType string, step time.Duration, from, to time.Time) ([]MetricSample, error) {
+	var query string
+	switch metricType {
+	case MeticTypeGauge:
+		query = "SELECT bucket, samples, min_value, max_value, avg_value, last_value FROM gauge_rollup WHERE name = ? AND step_ms = ? AND bucket BETWEEN ? AND ? ORDER BY bucket"
+	case MeticTypeCounter:
+		query = "SELECT bucket, samples, increment, last_value FROM counter_rollup WHERE name = ? AND step_ms = ? AND bucket BETWEEN ? AND ? ORDER BY bucket"
+	default:
+		return nil, ErrUnknownMetricType
+	}
+
+	rows, err := repository.db.QueryContext(ctx, query, key, step.Milliseconds(), from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	samples := []MetricSample{}
+	for rows.Next() {
+		var bucket int64
+		sample := MetricSample{
+			MetricValue: MetricValue{
+				MType: metricType,
+			},
+			Rollup: &Rollup{},
+		}
+
+		if metricType == MeticTypeGauge {
+			err = rows.Scan(&bucket, &sample.Rollup.Count, &sample.Rollup.Min, &sample.Rollup.Max, &sample.Value, &sample.Rollup.Last)
+		} else {
+			err = rows.Scan(&bucket, &sample.Rollup.Count, &sample.Increment, &sample.Delta)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sample.Timestamp = time.Unix(0, bucket)
+		samples = append(samples, sample)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// Compact - прореживание истории и удаление устаревших значений по правилам хранения.
+// Агрегаты считаются так же, как в ОП: по исходным значениям закрытых интервалов,
+// начиная с интервала, следующего за последним посчитанным. Каждый тип метрики обрабатывается в одной транзакции.
+func (repository SQLiteRepo) Compact(ctx context.Context, now time.Time) error {
+	if len(repository.config.Retention.Rules) == 0 {
+		return nil
+	}
+
+	for metricType, tables := range rollupTables {
+		err := repository.compactTables(ctx, metricType, tables.history, tables.rollup, now)
+		if err != nil {
+			return fmt.Errorf("failed to compact %s: %w", tables.history, err)
+		}
+	}
+
+	return nil
+}
+
+func (repository SQLiteRepo) compactTables(ctx context.Context, metricType, historyTable, rollupTable string, now time.Time) error {
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	keys, err := repository.keys(ctx, tx, fmt.Sprintf("SELECT DISTINCT name FROM %s UNION SELECT DISTINCT name FROM %s", historyTable, rollupTable))
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		rule, ok := retentionRule(repository.config.Retention, key)
+		if !ok {
+			continue
+		}
+
+		for _, rollupRule := range rule.Rollups {
+			step := time.Duration(rollupRule.Step)
+
+			var start int64
+			var watermark sql.NullInt64
+			err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT max(bucket) FROM %s WHERE name = ? AND step_ms = ?", rollupTable), key, step.Milliseconds()).Scan(&watermark)
+			if err != nil {
+				return err
+			}
+			if watermark.Valid {
+				start = watermark.Int64 + int64(step)
+			}
+
+			cutoff := rollupBucket(now, step).UnixNano()
+			if start >= cutoff {
+				continue
+			}
+
+			samples, err := repository.readRawHistory(ctx, tx, key, metricType, start, cutoff-1)
+			if err != nil {
+				return err
+			}
+			if len(samples) == 0 {
+				continue
+			}
+
+			for _, sample := range DownsampleHistory(samples, rollupBucket(samples[0].Timestamp, step), step) {
+				err = insertSQLiteRollup(ctx, tx, key, step, sample)
+				if err != nil {
+					return err
+				}
+			}
+
+			if rollupRule.Retention != 0 {
+				_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE name = ? AND step_ms = ? AND bucket < ?", rollupTable),
+					key, step.Milliseconds(), now.Add(-time.Duration(rollupRule.Retention)).UnixNano())
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if rule.Raw != 0 {
+			_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE name = ? AND created_at < ?", historyTable),
+				key, now.Add(-time.Duration(rule.Raw)).UnixNano())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func insertSQLiteRollup(ctx context.Context, tx *sql.Tx, key string, step time.Duration, sample MetricSample) error {
+	var err error
+	switch sample.MType {
+	case MeticTypeGauge:
+		_, err = tx.ExecContext(ctx, "INSERT OR IGNORE INTO gauge_rollup (name, step_ms, bucket, samples, min_value, max_value, avg_value, last_value) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			key, step.Milliseconds(), sample.Timestamp.UnixNano(), sample.Rollup.Count, *sample.Rollup.Min, *sample.Rollup.Max, *sample.Value, *sample.Rollup.Last)
+	case MeticTypeCounter:
+		var increment int64
+		if sample.Increment != nil {
+			increment = *sample.Increment
+		}
+		_, err = tx.ExecContext(ctx, "INSERT OR IGNORE INTO counter_rollup (name, step_ms, bucket, samples, increment, last_value) VALUES (?, ?, ?, ?, ?, ?)",
+			key, step.Milliseconds(), sample.Timestamp.UnixNano(), sample.Rollup.Count, increment, *sample.Delta)
+	default:
+		err = ErrUnknownMetricType
+	}
+
+	return err
+}
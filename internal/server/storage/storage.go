@@ -1,21 +1,51 @@
 // Package storage - хранилища метрик.
 package storage
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
 const (
-	MeticTypeGauge   = "gauge"
-	MeticTypeCounter = "counter"
+	MeticTypeGauge     = "gauge"
+	MeticTypeCounter   = "counter"
+	MeticTypeHistogram = "histogram"
+	MeticTypeSummary   = "summary"
+)
+
+var (
+	// ErrMetricNotFound - значения метрики нет в хранилище
+	ErrMetricNotFound = errors.New("metric not found")
+	// ErrUnknownMetricType - тип метрики не поддерживается
+	ErrUnknownMetricType = errors.New("metric type is not defined")
+	// ErrEmptyMetricValue - не заполнено значение, соответствующее типу метрики
+	ErrEmptyMetricValue = errors.New("metric value is empty")
 )
 
 type MetricMap map[string]MetricValue
 
+// MetricStorager - хранилище метрик.
+// Все методы, кроме Close, принимают контекст запроса: отмена и дедлайн HTTP и gRPC запросов прерывают работу с хранилищем.
 type MetricStorager interface {
-	InitFromFile()
-	Save() error
-	Update(key string, value MetricValue) error
-	UpdateManySliceMetric(MetricBatch []Metric) error
-	UpdateMany(DBSchema map[string]MetricValue) error
-	Read(key string, metricType string) (MetricValue, error)
-	ReadAll() map[string]MetricMap
+	InitFromFile(ctx context.Context)
+	Save(ctx context.Context) error
+	Update(ctx context.Context, key string, value MetricValue) error
+	UpdateManySliceMetric(ctx context.Context, MetricBatch []Metric) error
+	UpdateMany(ctx context.Context, DBSchema map[string]MetricValue) error
+	Read(ctx context.Context, key string, metricType string) (MetricValue, error)
+	ReadAll(ctx context.Context) (map[string]MetricMap, error)
+	// ReadSeries - все серии метрики id типа metricType: без меток и с любым набором меток
+	ReadSeries(ctx context.Context, id string, metricType string) (MetricMap, error)
+	ReadHistory(ctx context.Context, key string, metricType string, from, to time.Time, step time.Duration) ([]MetricSample, error)
+	Compact(ctx context.Context, now time.Time) error
+	Delete(ctx context.Context, key string, metricType string) error
+	DeleteMatching(ctx context.Context, metricType string, pattern string) (int, error)
+	ResetCounter(ctx context.Context, key string) error
+	// SetValues - установка значений gauge и накопленных значений counter (например, метрик Prometheus)
+	// одной операцией без чтения текущих значений вызывающим: записываются все значения или ни одного
+	SetValues(ctx context.Context, gauges map[string]float64, counters map[string]int64) error
+	Expire(ctx context.Context, before time.Time) (int, error)
 	Close() error
-	Ping() error
+	Ping(ctx context.Context) error
 }
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// WALSuffix - суффикс файла журнала относительно файла снимка.
+	WALSuffix = ".wal"
+	// walCompactThreshold - количество записей журнала, после которого в синхронном режиме делается снимок.
+	walCompactThreshold = 1000
+	// walMaxRecordSize - максимальный размер одной записи журнала.
+	walMaxRecordSize = 16 * 1024 * 1024
+)
+
+const (
+	walOpUpdate = "update"
+	walOpDelete = "delete"
+	walOpReset  = "reset"
+	// walOpSet - установка накопленного значения counter, Value.Delta - новое значение
+	walOpSet = "set"
+	// walOpExpire - удаление серии, в которую не было записи до Timestamp
+	walOpExpire = "expire"
+	// walOpBatch - пачка изменений, которая применяется целиком или никак
+	walOpBatch = "batch"
+	// walOpHeader - первая запись журнала, Key - поколение журнала
+	walOpHeader = "header"
+)
+
+// walRecord - запись журнала упреждающей записи.
+// Для counter хранится приращение, а не итоговое значение, поэтому журнал воспроизводится поверх снимка.
+type walRecord struct {
+	Op        string      `json:"op"`
+	Key       string      `json:"key"`
+	Value     MetricValue `json:"value"`
+	Timestamp time.Time   `json:"ts"`
+	Records   []walRecord `json:"records,omitempty"`
+}
+
+// WAL - журнал упреждающей записи (append-only, одна JSON запись на строку).
+type WAL struct {
+	path       string
+	file       *os.File
+	syncWrites bool
+	records    int
+	mutex      *sync.Mutex
+}
+
+// OpenWAL - открытие журнала на дозапись, при syncWrites каждая запись сбрасывается на диск (fsync).
+func OpenWAL(path string, syncWrites bool) (*WAL, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WAL{
+		path:       path,
+		file:       file,
+		syncWrites: syncWrites,
+		mutex:      &sync.Mutex{},
+	}, nil
+}
+
+// Append - дозапись записи в журнал.
+func (wal *WAL) Append(record walRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+
+	_, err = wal.file.Write(data)
+	if err != nil {
+		return err
+	}
+	wal.records++
+
+	if wal.syncWrites {
+		return wal.file.Sync()
+	}
+
+	return nil
+}
+
+// Replay - воспроизведение журнала с начала, если поколение журнала совпадает с generation - поколением снимка.
+// Журнал другого поколения уже учтён в снимке (падение между записью снимка и очисткой журнала),
+// он не воспроизводится и очищается с переходом на поколение снимка.
+// Повреждённый хвост (например, запись, не дописанная при падении) отбрасывается.
+func (wal *WAL) Replay(generation string, apply func(record walRecord) error) error {
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+
+	_, err := wal.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(wal.file)
+	var validSize int64
+	wal.records = 0
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) != 0 {
+				log.Printf("WAL %s: dropping incomplete record at offset %d", wal.path, validSize)
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var record walRecord
+		if len(line) > walMaxRecordSize || json.Unmarshal(line, &record) != nil {
+			log.Printf("WAL %s: dropping corrupted records from offset %d", wal.path, validSize)
+			break
+		}
+
+		if validSize == 0 && record.Op == walOpHeader {
+			if record.Key != generation {
+				log.Printf("WAL %s: generation %q is already in snapshot %q, skipping", wal.path, record.Key, generation)
+				return wal.reset(generation)
+			}
+			validSize += int64(len(line))
+			continue
+		}
+		if validSize == 0 && generation != "" {
+			// Журнал без заголовка записан до снимка текущего формата
+			log.Printf("WAL %s: records without generation are already in snapshot %q, skipping", wal.path, generation)
+			return wal.reset(generation)
+		}
+
+		err = apply(record)
+		if err != nil {
+			log.Printf("WAL %s: record %q not applied: %v", wal.path, record.Key, err)
+		}
+
+		validSize += int64(len(line))
+		wal.records++
+	}
+
+	return wal.file.Truncate(validSize)
+}
+
+// Reset - очистка журнала после записи снимка поколения generation.
+func (wal *WAL) Reset(generation string) error {
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+
+	return wal.reset(generation)
+}
+
+func (wal *WAL) reset(generation string) error {
+	err := wal.file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	wal.records = 0
+
+	data, err := json.Marshal(walRecord{Op: walOpHeader, Key: generation})
+	if err != nil {
+		return err
+	}
+	_, err = wal.file.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+
+	return wal.file.Sync()
+}
+
+// newWALGeneration - случайный идентификатор поколения снимка и журнала.
+func newWALGeneration() (string, error) {
+	generation := make([]byte, 8)
+	if _, err := rand.Read(generation); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(generation), nil
+}
+
+// Len - количество записей в журнале.
+func (wal *WAL) Len() int {
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+	return wal.records
+}
+
+func (wal *WAL) Close() error {
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+	return wal.file.Close()
+}
+
+// writeFileAtomic - запись файла через временный файл и переименование,
+// чтобы при падении на диске оставался либо старый, либо новый снимок целиком.
+func writeFileAtomic(path string, write func(file *os.File) error) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = write(file)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return err
+	}
+
+	// Переименование сохраняется на диске только после сброса каталога
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	err = dir.Sync()
+	closeErr = dir.Close()
+	if err != nil {
+		return err
+	}
+
+	return closeErr
+}
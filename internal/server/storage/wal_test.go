@@ -0,0 +1,356 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"metrics/internal/server/config"
+)
+
+func TestMemoryRepoWALRecovery(t *testing.T) {
+	storeConfig := config.StoreConfig{
+		File:    filepath.Join(t.TempDir(), "metrics.json"),
+		Restore: true,
+	}
+
+	metricsMemoryRepo := NewMetricsMemoryRepo(storeConfig)
+	metricsMemoryRepo.InitFromFile(context.Background())
+
+	var delta int64 = 5
+	value := 1.5
+	for i := 0; i < 3; i++ {
+		err := metricsMemoryRepo.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+		require.NoError(t, err)
+	}
+	err := metricsMemoryRepo.Save(context.Background())
+	require.NoError(t, err)
+
+	// Изменения после снимка есть только в журнале
+	err = metricsMemoryRepo.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+	require.NoError(t, err)
+	err = metricsMemoryRepo.Update(context.Background(), "Alloc", MetricValue{MType: MeticTypeGauge, Value: &value})
+	require.NoError(t, err)
+	require.Equal(t, 2, metricsMemoryRepo.wal.Len())
+
+	// Падение без сохранения снимка
+	err = metricsMemoryRepo.Close()
+	require.NoError(t, err)
+
+	restoredRepo := NewMetricsMemoryRepo(storeConfig)
+	restoredRepo.InitFromFile(context.Background())
+
+	pollCount, err := restoredRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 20, *pollCount.Delta)
+
+	alloc, err := restoredRepo.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.NoError(t, err)
+	require.EqualValues(t, 1.5, *alloc.Value)
+
+	// После восстановления журнал перенесён в снимок
+	require.Equal(t, 0, restoredRepo.wal.Len())
+
+	err = restoredRepo.Close()
+	require.NoError(t, err)
+}
+
+func TestMemoryRepoWALExpire(t *testing.T) {
+	storeConfig := config.StoreConfig{
+		File:    filepath.Join(t.TempDir(), "metrics.json"),
+		Restore: true,
+	}
+
+	metricsMemoryRepo := NewMetricsMemoryRepo(storeConfig)
+	metricsMemoryRepo.InitFromFile(context.Background())
+
+	now := time.Now()
+	value := 1.5
+	err := metricsMemoryRepo.update("Alloc", MetricValue{MType: MeticTypeGauge, Value: &value}, now.Add(-time.Hour), updateFromClient)
+	require.NoError(t, err)
+	err = metricsMemoryRepo.Save(context.Background())
+	require.NoError(t, err)
+
+	expired, err := metricsMemoryRepo.Expire(context.Background(), now.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, expired)
+
+	// Серия обновлена после удаления, воспроизведение журнала не должно удалить её снова
+	err = metricsMemoryRepo.Update(context.Background(), "Alloc", MetricValue{MType: MeticTypeGauge, Value: &value})
+	require.NoError(t, err)
+	err = metricsMemoryRepo.Close()
+	require.NoError(t, err)
+
+	restoredRepo := NewMetricsMemoryRepo(storeConfig)
+	restoredRepo.InitFromFile(context.Background())
+
+	alloc, err := restoredRepo.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.NoError(t, err)
+	require.True(t, alloc.UpdatedAt.After(now.Add(-time.Minute)))
+	require.Equal(t, 1, restoredRepo.gaugeHistory.Len("Alloc"))
+
+	// Время записи сохраняется в снимке
+	err = restoredRepo.Close()
+	require.NoError(t, err)
+
+	restoredRepo = NewMetricsMemoryRepo(storeConfig)
+	restoredRepo.InitFromFile(context.Background())
+
+	restoredAlloc, err := restoredRepo.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.NoError(t, err)
+	require.True(t, alloc.UpdatedAt.Equal(*restoredAlloc.UpdatedAt))
+
+	err = restoredRepo.Close()
+	require.NoError(t, err)
+}
+
+func TestMemoryRepoWALCorruptedTail(t *testing.T) {
+	storeConfig := config.StoreConfig{
+		File:    filepath.Join(t.TempDir(), "metrics.json"),
+		Restore: true,
+	}
+
+	metricsMemoryRepo := NewMetricsMemoryRepo(storeConfig)
+
+	var delta int64 = 3
+	for i := 0; i < 2; i++ {
+		err := metricsMemoryRepo.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+		require.NoError(t, err)
+	}
+	err := metricsMemoryRepo.Close()
+	require.NoError(t, err)
+
+	// Запись, не дописанная при падении
+	walFile, err := os.OpenFile(storeConfig.File+WALSuffix, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = walFile.WriteString(`{"op":"update","key":"PollCount","value":{"type":"cou`)
+	require.NoError(t, err)
+	require.NoError(t, walFile.Close())
+
+	restoredRepo := NewMetricsMemoryRepo(storeConfig)
+	restoredRepo.InitFromFile(context.Background())
+
+	pollCount, err := restoredRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 6, *pollCount.Delta)
+
+	err = restoredRepo.Close()
+	require.NoError(t, err)
+}
+
+func TestWALReplayTruncatesCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+
+	wal, err := OpenWAL(path, true)
+	require.NoError(t, err)
+
+	var delta int64 = 1
+	err = wal.Append(walRecord{Op: walOpUpdate, Key: "PollCount", Value: MetricValue{MType: MeticTypeCounter, Delta: &delta}})
+	require.NoError(t, err)
+
+	_, err = wal.file.WriteString("garbage\n")
+	require.NoError(t, err)
+	err = wal.Append(walRecord{Op: walOpUpdate, Key: "Lost", Value: MetricValue{MType: MeticTypeCounter, Delta: &delta}})
+	require.NoError(t, err)
+
+	var keys []string
+	err = wal.Replay("", func(record walRecord) error {
+		keys = append(keys, record.Key)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"PollCount"}, keys)
+	require.Equal(t, 1, wal.Len())
+
+	// Повреждённая часть отброшена, новые записи дописываются после корректных
+	err = wal.Append(walRecord{Op: walOpUpdate, Key: "Next", Value: MetricValue{MType: MeticTypeCounter, Delta: &delta}})
+	require.NoError(t, err)
+
+	keys = nil
+	err = wal.Replay("", func(record walRecord) error {
+		keys = append(keys, record.Key)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"PollCount", "Next"}, keys)
+
+	require.NoError(t, wal.Close())
+}
+
+func TestMemoryRepoWALDeleteAndReset(t *testing.T) {
+	storeConfig := config.StoreConfig{
+		File:    filepath.Join(t.TempDir(), "metrics.json"),
+		Restore: true,
+	}
+
+	metricsMemoryRepo := NewMetricsMemoryRepo(storeConfig)
+
+	var delta int64 = 5
+	value := 1.5
+	err := metricsMemoryRepo.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+	require.NoError(t, err)
+	err = metricsMemoryRepo.Update(context.Background(), "Alloc", MetricValue{MType: MeticTypeGauge, Value: &value})
+	require.NoError(t, err)
+	err = metricsMemoryRepo.Save(context.Background())
+	require.NoError(t, err)
+
+	// Удаление и сброс после снимка есть только в журнале
+	err = metricsMemoryRepo.Delete(context.Background(), "Alloc", MeticTypeGauge)
+	require.NoError(t, err)
+	err = metricsMemoryRepo.ResetCounter(context.Background(), "PollCount")
+	require.NoError(t, err)
+	err = metricsMemoryRepo.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+	require.NoError(t, err)
+
+	err = metricsMemoryRepo.Close()
+	require.NoError(t, err)
+
+	restoredRepo := NewMetricsMemoryRepo(storeConfig)
+	restoredRepo.InitFromFile(context.Background())
+
+	_, err = restoredRepo.Read(context.Background(), "Alloc", MeticTypeGauge)
+	require.Error(t, err)
+
+	pollCount, err := restoredRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, *pollCount.Delta)
+
+	err = restoredRepo.Close()
+	require.NoError(t, err)
+}
+
+func TestMemoryRepoWALCrashAfterSnapshot(t *testing.T) {
+	storeConfig := config.StoreConfig{
+		File:    filepath.Join(t.TempDir(), "metrics.json"),
+		Restore: true,
+	}
+
+	metricsMemoryRepo := NewMetricsMemoryRepo(storeConfig)
+	metricsMemoryRepo.InitFromFile(context.Background())
+
+	var delta int64 = 5
+	err := metricsMemoryRepo.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+	require.NoError(t, err)
+
+	// Падение после переименования снимка, но до очистки журнала
+	walData, err := os.ReadFile(storeConfig.File + WALSuffix)
+	require.NoError(t, err)
+	err = metricsMemoryRepo.Save(context.Background())
+	require.NoError(t, err)
+	err = metricsMemoryRepo.Close()
+	require.NoError(t, err)
+	err = os.WriteFile(storeConfig.File+WALSuffix, walData, 0644)
+	require.NoError(t, err)
+
+	restoredRepo := NewMetricsMemoryRepo(storeConfig)
+	restoredRepo.InitFromFile(context.Background())
+
+	pollCount, err := restoredRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, *pollCount.Delta)
+
+	// Журнал переведён на поколение снимка, новые изменения восстанавливаются
+	err = restoredRepo.Update(context.Background(), "PollCount", MetricValue{MType: MeticTypeCounter, Delta: &delta})
+	require.NoError(t, err)
+	err = restoredRepo.Close()
+	require.NoError(t, err)
+
+	restoredRepo = NewMetricsMemoryRepo(storeConfig)
+	restoredRepo.InitFromFile(context.Background())
+
+	pollCount, err = restoredRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, *pollCount.Delta)
+
+	err = restoredRepo.Close()
+	require.NoError(t, err)
+}
+
+func TestMemoryRepoLegacySnapshot(t *testing.T) {
+	storeConfig := config.StoreConfig{
+		File:    filepath.Join(t.TempDir(), "metrics.json"),
+		Restore: true,
+	}
+
+	err := os.WriteFile(storeConfig.File, []byte(`{"counter":{"PollCount":{"type":"counter","delta":7}}}`), 0644)
+	require.NoError(t, err)
+
+	restoredRepo := NewMetricsMemoryRepo(storeConfig)
+	restoredRepo.InitFromFile(context.Background())
+
+	pollCount, err := restoredRepo.Read(context.Background(), "PollCount", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 7, *pollCount.Delta)
+
+	err = restoredRepo.Close()
+	require.NoError(t, err)
+}
+
+func TestMemoryRepoCorruptedSnapshot(t *testing.T) {
+	storeConfig := config.StoreConfig{
+		File:    filepath.Join(t.TempDir(), "metrics.json"),
+		Restore: true,
+	}
+
+	corrupted := []byte(`{"wal":"1","metrics":{"counter":{"PollCount":`)
+	err := os.WriteFile(storeConfig.File, corrupted, 0644)
+	require.NoError(t, err)
+
+	restoredRepo := NewMetricsMemoryRepo(storeConfig)
+	require.Panics(t, func() {
+		restoredRepo.InitFromFile(context.Background())
+	})
+	require.NoError(t, restoredRepo.Close())
+
+	// Повреждённый снимок не перезаписан
+	data, err := os.ReadFile(storeConfig.File)
+	require.NoError(t, err)
+	require.Equal(t, corrupted, data)
+}
+
+func TestMemoryRepoSetValues(t *testing.T) {
+	storeConfig := config.StoreConfig{
+		File:    filepath.Join(t.TempDir(), "metrics.json"),
+		Restore: true,
+	}
+
+	metricsMemoryRepo := NewMetricsMemoryRepo(storeConfig)
+	metricsMemoryRepo.InitFromFile(context.Background())
+	from := time.Now().Add(-time.Minute)
+
+	for _, value := range []int64{10, 15, 4} {
+		err := metricsMemoryRepo.SetValues(context.Background(), nil, map[string]int64{"requests_total": value})
+		require.NoError(t, err)
+	}
+	require.Error(t, metricsMemoryRepo.SetValues(context.Background(), nil, map[string]int64{"a{": 1}))
+
+	// Gauge и counter устанавливаются вместе: при ошибке не записывается ни одно значение
+	err := metricsMemoryRepo.SetValues(context.Background(), map[string]float64{"queue": 3}, map[string]int64{"a{": 1})
+	require.Error(t, err)
+	_, err = metricsMemoryRepo.Read(context.Background(), "queue", MeticTypeGauge)
+	require.ErrorIs(t, err, ErrMetricNotFound)
+
+	history, err := metricsMemoryRepo.ReadHistory(context.Background(), "requests_total", MeticTypeCounter, from, time.Now().Add(time.Minute), 0)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	for i, increment := range []int64{10, 5, 4} {
+		require.EqualValues(t, increment, *history[i].Increment)
+	}
+
+	// Установка значения воспроизводится из журнала как установка, а не как приращение
+	err = metricsMemoryRepo.Close()
+	require.NoError(t, err)
+
+	restoredRepo := NewMetricsMemoryRepo(storeConfig)
+	restoredRepo.InitFromFile(context.Background())
+
+	counter, err := restoredRepo.Read(context.Background(), "requests_total", MeticTypeCounter)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, *counter.Delta)
+
+	err = restoredRepo.Close()
+	require.NoError(t, err)
+}
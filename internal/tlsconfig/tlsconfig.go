@@ -0,0 +1,80 @@
+// Package tlsconfig - настройки TLS и mTLS из PEM файлов сертификатов.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// ErrNoCertificates - в файле CA нет ни одного сертификата PEM
+var ErrNoCertificates = errors.New("no certificates found")
+
+// Server - TLS сервера с сертификатом certFile и ключом keyFile.
+// Если задан clientCAFile, клиент обязан предъявить сертификат, подписанный одним из CA файла (mTLS).
+func Server(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		config.ClientCAs, err = loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// Client - TLS клиента. Сертификат сервера проверяется по CA из caFile, пустой caFile - по системным CA.
+// certFile и keyFile - сертификат клиента для mTLS, пустые - клиент без сертификата.
+// serverName заменяет имя сервера из адреса при проверке сертификата.
+func Client(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	var err error
+	if caFile != "" {
+		config.RootCAs, err = loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// loadCertPool - пул сертификатов CA из PEM файла.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%w in %s", ErrNoCertificates, file)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,93 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// handshake - TLS рукопожатие клиента и сервера, возвращает CN сертификата клиента на сервере и ошибку рукопожатия.
+// В TLS 1.3 клиент завершает рукопожатие раньше, чем сервер проверит его сертификат, поэтому учитываются ошибки обеих сторон.
+func handshake(serverConfig, clientConfig *tls.Config) (string, error) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+
+	type result struct {
+		commonName string
+		err        error
+	}
+	serverResult := make(chan result, 1)
+	go func() {
+		conn := tls.Server(serverConn, serverConfig)
+		err := conn.Handshake()
+		if err != nil {
+			serverConn.Close()
+			serverResult <- result{err: err}
+			return
+		}
+
+		var commonName string
+		if certificates := conn.ConnectionState().PeerCertificates; len(certificates) > 0 {
+			commonName = certificates[0].Subject.CommonName
+		}
+		serverResult <- result{commonName: commonName}
+	}()
+
+	clientErr := tls.Client(clientConn, clientConfig).Handshake()
+	// Клиент, отклонивший сертификат сервера, закрывает соединение, иначе сервер ждал бы его бесконечно
+	clientConn.Close()
+
+	server := <-serverResult
+	if clientErr != nil {
+		return "", clientErr
+	}
+	return server.commonName, server.err
+}
+
+func TestMutualTLS(t *testing.T) {
+	serverConfig, err := Server("testdata/server.crt", "testdata/server.key", "testdata/ca.crt")
+	require.NoError(t, err)
+	require.Equal(t, tls.RequireAndVerifyClientCert, serverConfig.ClientAuth)
+
+	clientConfig, err := Client("testdata/ca.crt", "testdata/client.crt", "testdata/client.key", "localhost")
+	require.NoError(t, err)
+
+	commonName, err := handshake(serverConfig, clientConfig)
+	require.NoError(t, err)
+	require.Equal(t, "agent-1", commonName)
+
+	// Без сертификата клиента сервер обрывает соединение
+	clientConfig, err = Client("testdata/ca.crt", "", "", "localhost")
+	require.NoError(t, err)
+	_, err = handshake(serverConfig, clientConfig)
+	require.Error(t, err)
+}
+
+func TestServerTLS(t *testing.T) {
+	serverConfig, err := Server("testdata/server.crt", "testdata/server.key", "")
+	require.NoError(t, err)
+
+	clientConfig, err := Client("testdata/ca.crt", "", "", "localhost")
+	require.NoError(t, err)
+	_, err = handshake(serverConfig, clientConfig)
+	require.NoError(t, err)
+
+	// Сертификат сервера выдан не на это имя
+	clientConfig, err = Client("testdata/ca.crt", "", "", "metrics.example.com")
+	require.NoError(t, err)
+	_, err = handshake(serverConfig, clientConfig)
+	require.Error(t, err)
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, err := Server("testdata/server.crt", "testdata/server.key", "testdata/server.key")
+	require.ErrorIs(t, err, ErrNoCertificates)
+
+	_, err = Client("testdata/missing.crt", "", "", "")
+	require.Error(t, err)
+
+	_, err = Client("", "testdata/client.crt", "", "")
+	require.Error(t, err)
+}
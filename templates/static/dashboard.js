@@ -0,0 +1,586 @@
+// Страница метрик: поиск, группировка, сортировка, спарклайны истории и живые обновления из /stream.
+(function () {
+    "use strict";
+
+    var SPARKLINE_RANGE = 60 * 60 * 1000;
+    var SPARKLINE_STEP = "1m";
+    var HISTORY_CONCURRENCY = 4;
+    var CHART_POINTS = 300;
+
+    var data = window.dashboardData || {series: []};
+    var series = new Map();
+    var sparklines = new Map();
+    var historyQueue = [];
+    var historyLoading = 0;
+    var changed = new Set();
+    var selected = null;
+    var renderScheduled = false;
+
+    var controls = {
+        search: document.getElementById("search"),
+        type: document.getElementById("type"),
+        group: document.getElementById("group"),
+        sort: document.getElementById("sort")
+    };
+    var container = document.getElementById("metrics");
+    var status = document.getElementById("status");
+    var chart = {
+        panel: document.getElementById("chart"),
+        title: document.getElementById("chart-title"),
+        range: document.getElementById("chart-range"),
+        canvas: document.getElementById("chart-canvas"),
+        details: document.getElementById("chart-details"),
+        close: document.getElementById("chart-close")
+    };
+
+    function seriesID(type, key) {
+        return type + "\u0000" + key;
+    }
+
+    function parseTime(value) {
+        var time = value ? Date.parse(value) : NaN;
+        return isNaN(time) ? null : time;
+    }
+
+    function addSeries(item) {
+        var id = seriesID(item.type, item.key);
+        series.set(id, {
+            id: id,
+            key: item.key,
+            name: item.id,
+            type: item.type,
+            labels: item.labels || {},
+            source: item.source || (item.labels && item.labels.source) || "",
+            value: item.value,
+            text: item.text,
+            updatedAt: parseTime(item.value && item.value.updated_at)
+        });
+        return id;
+    }
+
+    data.series.forEach(addSeries);
+
+    // Состояние элементов управления хранится в адресе страницы, чтобы ссылкой можно было поделиться
+    function readState() {
+        var params = new URLSearchParams(location.hash.slice(1));
+        controls.search.value = params.get("q") || "";
+        controls.type.value = params.get("type") || "";
+        controls.group.value = params.has("group") ? params.get("group") : "type";
+        controls.sort.value = params.get("sort") || "name";
+    }
+
+    function writeState() {
+        var params = new URLSearchParams();
+        if (controls.search.value) {
+            params.set("q", controls.search.value);
+        }
+        if (controls.type.value) {
+            params.set("type", controls.type.value);
+        }
+        if (controls.group.value !== "type") {
+            params.set("group", controls.group.value);
+        }
+        if (controls.sort.value !== "name") {
+            params.set("sort", controls.sort.value);
+        }
+        history.replaceState(null, "", params.toString() ? "#" + params.toString() : location.pathname);
+    }
+
+    function isStale(item, now) {
+        return item.type === "gauge" && data.stale_after_ms > 0 && item.updatedAt !== null &&
+            now - item.updatedAt > data.stale_after_ms;
+    }
+
+    function hasHistory(item) {
+        return item.type === "gauge" || item.type === "counter";
+    }
+
+    function numericValue(value) {
+        if (!value) {
+            return null;
+        }
+        if (typeof value.value === "number") {
+            return value.value;
+        }
+        if (typeof value.delta === "number") {
+            return value.delta;
+        }
+        return null;
+    }
+
+    function shortText(item) {
+        if (item.value && item.value.histogram) {
+            return "count=" + item.value.histogram.count + " sum=" + item.value.histogram.sum;
+        }
+        if (item.value && item.value.summary) {
+            return "count=" + item.value.summary.count + " sum=" + item.value.summary.sum;
+        }
+        return item.text;
+    }
+
+    function labelsText(labels) {
+        var names = Object.keys(labels).sort();
+        if (!names.length) {
+            return "";
+        }
+        return "{" + names.map(function (name) {
+            return name + "=\"" + labels[name] + "\"";
+        }).join(",") + "}";
+    }
+
+    function ago(time, now) {
+        if (time === null) {
+            return "";
+        }
+        var seconds = Math.max(0, Math.round((now - time) / 1000));
+        if (seconds < 60) {
+            return seconds + "s ago";
+        }
+        if (seconds < 3600) {
+            return Math.floor(seconds / 60) + "m ago";
+        }
+        if (seconds < 86400) {
+            return Math.floor(seconds / 3600) + "h ago";
+        }
+        return Math.floor(seconds / 86400) + "d ago";
+    }
+
+    function matches(item, tokens) {
+        if (controls.type.value && item.type !== controls.type.value) {
+            return false;
+        }
+        var haystack = item.key.toLowerCase();
+        return tokens.every(function (token) {
+            return haystack.indexOf(token) >= 0;
+        });
+    }
+
+    function compare(a, b) {
+        if (controls.sort.value === "updated" && a.updatedAt !== b.updatedAt) {
+            return (b.updatedAt || 0) - (a.updatedAt || 0);
+        }
+        return a.key < b.key ? -1 : a.key > b.key ? 1 : 0;
+    }
+
+    function groupName(item) {
+        switch (controls.group.value) {
+        case "type":
+            return item.type;
+        case "source":
+            return item.source || "(no source)";
+        default:
+            return "all";
+        }
+    }
+
+    function scheduleRender() {
+        if (renderScheduled) {
+            return;
+        }
+        renderScheduled = true;
+        window.requestAnimationFrame(function () {
+            renderScheduled = false;
+            render();
+        });
+    }
+
+    function render() {
+        var now = Date.now();
+        var tokens = controls.search.value.toLowerCase().split(/\s+/).filter(Boolean);
+        var groups = new Map();
+
+        Array.from(series.values()).filter(function (item) {
+            return matches(item, tokens);
+        }).sort(compare).forEach(function (item) {
+            var name = groupName(item);
+            if (!groups.has(name)) {
+                groups.set(name, []);
+            }
+            groups.get(name).push(item);
+        });
+
+        var fragment = document.createDocumentFragment();
+        Array.from(groups.keys()).sort().forEach(function (name) {
+            var items = groups.get(name);
+            var group = document.createElement("section");
+            group.className = "metrics__group";
+
+            var header = document.createElement("h3");
+            header.className = "metrics__group-header";
+            header.textContent = name + " ";
+            var count = document.createElement("span");
+            count.className = "metrics__count";
+            count.textContent = "(" + items.length + ")";
+            header.appendChild(count);
+            group.appendChild(header);
+
+            items.forEach(function (item) {
+                group.appendChild(renderRow(item, now));
+            });
+            fragment.appendChild(group);
+        });
+
+        if (!groups.size) {
+            var empty = document.createElement("div");
+            empty.className = "metrics__empty";
+            empty.textContent = series.size ? "No metrics match the filter" : "No metrics yet";
+            fragment.appendChild(empty);
+        }
+
+        container.replaceChildren(fragment);
+        changed.clear();
+    }
+
+    function renderRow(item, now) {
+        var row = document.createElement("div");
+        row.className = "metric";
+        if (isStale(item, now)) {
+            row.classList.add("metric_stale");
+        }
+        if (changed.has(item.id)) {
+            row.classList.add("metric_changed");
+        }
+        if (selected === item.id) {
+            row.classList.add("metric_selected");
+        }
+        row.addEventListener("click", function () {
+            openChart(item.id);
+        });
+
+        var name = document.createElement("div");
+        name.className = "metric__name";
+        name.title = item.key;
+        var bold = document.createElement("b");
+        bold.textContent = item.name;
+        var labels = document.createElement("span");
+        labels.className = "metric__labels";
+        labels.textContent = labelsText(item.labels);
+        name.appendChild(bold);
+        name.appendChild(labels);
+
+        var value = document.createElement("div");
+        value.className = "metric__value";
+        value.textContent = shortText(item);
+        value.title = item.text;
+
+        var sparkline;
+        if (hasHistory(item)) {
+            sparkline = document.createElement("canvas");
+            sparkline.className = "sparkline";
+            sparkline.width = 130;
+            sparkline.height = 24;
+            drawSparkline(item, sparkline);
+        } else {
+            sparkline = document.createElement("div");
+        }
+
+        var updated = document.createElement("div");
+        updated.className = "metric__updated";
+        updated.textContent = ago(item.updatedAt, now);
+        if (item.updatedAt !== null) {
+            updated.title = new Date(item.updatedAt).toLocaleString();
+        }
+
+        row.appendChild(name);
+        row.appendChild(value);
+        row.appendChild(sparkline);
+        row.appendChild(updated);
+        return row;
+    }
+
+    function historyURL(item, from, step) {
+        var params = new URLSearchParams();
+        params.set("from", Math.floor(from / 1000));
+        params.set("step", step);
+        Object.keys(item.labels).sort().forEach(function (name) {
+            params.append("label", name + ":" + item.labels[name]);
+        });
+        return "/history/" + item.type + "/" + encodeURIComponent(item.name) + "?" + params.toString();
+    }
+
+    function fetchHistory(item, from, step) {
+        return fetch(historyURL(item, from, step)).then(function (response) {
+            if (!response.ok) {
+                throw new Error(response.statusText);
+            }
+            return response.json();
+        }).then(function (answer) {
+            return (answer.samples || []).map(function (sample) {
+                return [Date.parse(sample.timestamp), numericValue(sample)];
+            }).filter(function (point) {
+                return point[1] !== null;
+            });
+        });
+    }
+
+    // Истории для спарклайнов загружаются по очереди, не больше HISTORY_CONCURRENCY запросов одновременно
+    function queueHistory(item) {
+        sparklines.set(item.id, null);
+        historyQueue.push(item.id);
+        nextHistory();
+    }
+
+    function nextHistory() {
+        while (historyLoading < HISTORY_CONCURRENCY && historyQueue.length) {
+            var item = series.get(historyQueue.shift());
+            if (!item) {
+                continue;
+            }
+
+            historyLoading++;
+            loadSparkline(item);
+        }
+    }
+
+    function loadSparkline(item) {
+        fetchHistory(item, Date.now() - SPARKLINE_RANGE, SPARKLINE_STEP).then(function (points) {
+            sparklines.set(item.id, points);
+            scheduleRender();
+        }).catch(function () {
+            sparklines.set(item.id, []);
+        }).then(function () {
+            historyLoading--;
+            nextHistory();
+        });
+    }
+
+    function drawSparkline(item, canvas) {
+        if (!sparklines.has(item.id)) {
+            queueHistory(item);
+            return;
+        }
+        var points = sparklines.get(item.id);
+        if (points && points.length > 1) {
+            drawLine(canvas, points, false);
+        }
+    }
+
+    function appendPoint(item) {
+        var points = sparklines.get(item.id);
+        var value = numericValue(item.value);
+        if (!points || value === null) {
+            return;
+        }
+
+        var now = Date.now();
+        points.push([now, value]);
+        while (points.length && points[0][0] < now - SPARKLINE_RANGE) {
+            points.shift();
+        }
+    }
+
+    function drawLine(canvas, points, axes) {
+        var context = canvas.getContext("2d");
+        var width = canvas.width;
+        var height = canvas.height;
+        var padding = axes ? {left: 60, right: 10, top: 10, bottom: 24} : {left: 1, right: 1, top: 2, bottom: 2};
+        context.clearRect(0, 0, width, height);
+        if (points.length < 2) {
+            return;
+        }
+
+        var minTime = points[0][0];
+        var maxTime = points[points.length - 1][0];
+        var minValue = Infinity;
+        var maxValue = -Infinity;
+        points.forEach(function (point) {
+            minValue = Math.min(minValue, point[1]);
+            maxValue = Math.max(maxValue, point[1]);
+        });
+        if (minValue === maxValue) {
+            minValue -= 1;
+            maxValue += 1;
+        }
+
+        var plotWidth = width - padding.left - padding.right;
+        var plotHeight = height - padding.top - padding.bottom;
+        function x(time) {
+            return padding.left + (maxTime === minTime ? 0 : (time - minTime) / (maxTime - minTime) * plotWidth);
+        }
+        function y(value) {
+            return padding.top + (1 - (value - minValue) / (maxValue - minValue)) * plotHeight;
+        }
+
+        if (axes) {
+            context.strokeStyle = "#ddd";
+            context.fillStyle = "#777";
+            context.font = "11px sans-serif";
+            context.textBaseline = "middle";
+            [maxValue, (maxValue + minValue) / 2, minValue].forEach(function (value) {
+                context.beginPath();
+                context.moveTo(padding.left, y(value));
+                context.lineTo(width - padding.right, y(value));
+                context.stroke();
+                context.textAlign = "right";
+                context.fillText(formatNumber(value), padding.left - 6, y(value));
+            });
+            context.textBaseline = "top";
+            context.textAlign = "left";
+            context.fillText(new Date(minTime).toLocaleString(), padding.left, height - padding.bottom + 6);
+            context.textAlign = "right";
+            context.fillText(new Date(maxTime).toLocaleString(), width - padding.right, height - padding.bottom + 6);
+        }
+
+        context.strokeStyle = "#3366cc";
+        context.lineWidth = axes ? 1.5 : 1;
+        context.beginPath();
+        points.forEach(function (point, i) {
+            if (i === 0) {
+                context.moveTo(x(point[0]), y(point[1]));
+            } else {
+                context.lineTo(x(point[0]), y(point[1]));
+            }
+        });
+        context.stroke();
+    }
+
+    function drawBars(canvas, labels, values) {
+        var context = canvas.getContext("2d");
+        var width = canvas.width;
+        var height = canvas.height;
+        var padding = {left: 10, right: 10, top: 10, bottom: 24};
+        context.clearRect(0, 0, width, height);
+        if (!values.length) {
+            return;
+        }
+
+        var maxValue = Math.max.apply(null, values) || 1;
+        var barWidth = (width - padding.left - padding.right) / values.length;
+        var plotHeight = height - padding.top - padding.bottom;
+        context.font = "11px sans-serif";
+        context.textAlign = "center";
+        context.textBaseline = "top";
+        values.forEach(function (value, i) {
+            var barHeight = value / maxValue * plotHeight;
+            var left = padding.left + i * barWidth;
+            context.fillStyle = "#3366cc";
+            context.fillRect(left + 2, padding.top + plotHeight - barHeight, Math.max(1, barWidth - 4), barHeight);
+            context.fillStyle = "#777";
+            context.fillText(labels[i], left + barWidth / 2, height - padding.bottom + 6);
+        });
+    }
+
+    function formatNumber(value) {
+        return Math.abs(value) >= 1e6 || (value !== 0 && Math.abs(value) < 1e-3) ?
+            value.toExponential(2) : String(Math.round(value * 1000) / 1000);
+    }
+
+    function parseRange(range) {
+        return parseInt(range, 10) * 60 * 60 * 1000;
+    }
+
+    function openChart(id) {
+        selected = id;
+        chart.panel.hidden = false;
+        scheduleRender();
+        drawChart();
+    }
+
+    function closeChart() {
+        selected = null;
+        chart.panel.hidden = true;
+        scheduleRender();
+    }
+
+    function drawChart() {
+        var item = series.get(selected);
+        if (!item) {
+            closeChart();
+            return;
+        }
+
+        chart.title.textContent = item.key;
+        chart.title.title = item.key;
+        chart.range.hidden = !hasHistory(item);
+        chart.details.textContent = item.text;
+
+        if (item.value && item.value.histogram) {
+            var histogram = item.value.histogram;
+            drawBars(chart.canvas, histogram.counts.map(function (count, i) {
+                return i < histogram.buckets.length ? "≤" + histogram.buckets[i] : "+Inf";
+            }), histogram.counts);
+            return;
+        }
+        if (item.value && item.value.summary) {
+            var quantiles = item.value.summary.quantiles || [];
+            drawBars(chart.canvas, quantiles.map(function (quantile) {
+                return "q" + quantile.quantile;
+            }), quantiles.map(function (quantile) {
+                return quantile.value;
+            }));
+            return;
+        }
+
+        var range = parseRange(chart.range.value);
+        var step = Math.max(1, Math.round(range / CHART_POINTS / 1000)) + "s";
+        fetchHistory(item, Date.now() - range, step).then(function (points) {
+            if (selected === item.id) {
+                drawLine(chart.canvas, points, true);
+            }
+        }).catch(function (err) {
+            chart.details.textContent = "History is unavailable: " + err.message;
+        });
+    }
+
+    function connect() {
+        if (!window.EventSource) {
+            return;
+        }
+
+        var source = new EventSource("/stream");
+        var connected = false;
+        source.onopen = function () {
+            // После переподключения события за время обрыва потеряны
+            if (connected) {
+                location.reload();
+            }
+            connected = true;
+            status.classList.add("dashboard__status_live");
+        };
+        source.onerror = function () {
+            status.classList.remove("dashboard__status_live");
+        };
+        source.addEventListener("update", function (message) {
+            var event = JSON.parse(message.data);
+            var id = addSeries(event);
+            var item = series.get(id);
+            if (item.updatedAt === null) {
+                item.updatedAt = Date.now();
+            }
+            appendPoint(item);
+            changed.add(id);
+            if (selected === id && !hasHistory(item)) {
+                drawChart();
+            }
+            scheduleRender();
+        });
+        source.addEventListener("delete", function (message) {
+            var event = JSON.parse(message.data);
+            var id = seriesID(event.type, event.key);
+            series.delete(id);
+            sparklines.delete(id);
+            if (selected === id) {
+                closeChart();
+            }
+            scheduleRender();
+        });
+        source.addEventListener("reload", function () {
+            location.reload();
+        });
+    }
+
+    readState();
+    Object.keys(controls).forEach(function (name) {
+        controls[name].addEventListener(name === "search" ? "input" : "change", function () {
+            writeState();
+            scheduleRender();
+        });
+    });
+    chart.range.addEventListener("change", drawChart);
+    chart.close.addEventListener("click", closeChart);
+    // Время последнего обновления и признак устаревания пересчитываются без событий
+    window.setInterval(scheduleRender, 5000);
+
+    render();
+    connect();
+})();
@@ -0,0 +1,11 @@
+// Package templates - HTML шаблоны и статические файлы веб-интерфейса, встраиваются в бинарный файл.
+package templates
+
+import (
+	"embed"
+)
+
+// FS - шаблоны в корне, статические файлы в каталоге static.
+//
+//go:embed *.html static
+var FS embed.FS